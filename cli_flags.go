@@ -19,7 +19,9 @@ import (
 
 	"github.com/elastic/otel-profiling-agent/config"
 	"github.com/elastic/otel-profiling-agent/debug/log"
+	"github.com/elastic/otel-profiling-agent/hostmetadata"
 	"github.com/elastic/otel-profiling-agent/hostmetadata/host"
+	"github.com/elastic/otel-profiling-agent/reporter"
 	"github.com/elastic/otel-profiling-agent/tracer"
 )
 
@@ -60,6 +62,7 @@ var (
 	tagsHelp           = fmt.Sprintf("User-specified tags separated by ';'. "+
 		"Each tag should match '%v'.", host.ValidTagRegex)
 	disableTLSHelp          = "Disable encryption for data in transit."
+	dryRunHelp              = "Build profiles, but neither send them nor upload symbols."
 	bpfVerifierLogLevelHelp = "Log level of the eBPF verifier output (0,1,2). Default is 0."
 	bpfVerifierLogSizeHelp  = "Size in bytes that will be allocated for the eBPF " +
 		"verifier output. Only takes effect if bpf-log-level > 0."
@@ -74,11 +77,164 @@ var (
 	probabilisticIntervalHelp = "Time interval for which probabilistic profiling will be " +
 		"enabled or disabled."
 
-	buildIDModeHelp = "The type of build ID to report. Valid values are either" +
-		`"linker" or "hash".`
+	buildIDModeHelp = "The type of build ID to report. Valid values are " +
+		`"linker", "hash" or "auto". "auto" reports the linker build ID if present ` +
+		"and the file hash otherwise."
 	noExtractDebuginfoHelp = "Disable extracting debug information from binaries. " +
 		"Note this means the executable section will be sent to the backend."
 	uploadSymbolsHelp = "Upload symbols from local binaries to the backend."
+	otlpProtocolHelp  = "The transport protocol used to send profiles. Valid values are " +
+		`"grpc", "http/protobuf" or "file/json", which writes the profiles as OTLP/JSON ` +
+		"lines to the file set with -otlp-file instead."
+	otlpFileHelp      = `The file the "file/json" protocol appends the profiles to, "-" for stdout.`
+	profileIDModeHelp = "The strategy to generate profile IDs with. Valid values are either " +
+		`"random" or "deterministic" (derived from host ID and time of the report).`
+	kernelImageNameHelp = "The file name to report for functions of the core kernel. The " +
+		`placeholder "{release}" is replaced with the kernel release of the host, e.g. ` +
+		`"vmlinux-{release}". Functions of kernel modules are reported with the module name.`
+	reportCPUTimeHelp = "Report the CPU time in nanoseconds as additional value of " +
+		"every sample, next to the number of samples."
+	traceInfoGracePeriodHelp = "Time to wait for late-arriving trace information before " +
+		"samples are deferred to the next report. Must not exceed a tenth of the reporter " +
+		"interval. Default is 0, which disables waiting."
+	traceInfoMaxReportsHelp = "Number of reports a sample is kept for while its trace " +
+		"information is missing, before it is dropped. 0 keeps such samples until they " +
+		"are evicted."
+	traceInfoLifetimeHelp = "Time after which the cached information of a trace is removed, " +
+		"unless the trace is seen again. It must be at least twice the reporter interval. " +
+		"0 keeps the information until it is evicted."
+	cacheMemoryLimitHelp = "Total memory in MiB used by the reporter caches. The budget is " +
+		"divided across the caches based on their estimated entry sizes. Default is 0, " +
+		"which sizes the caches based on the expected number of traces."
+	executableMetadataLifetimeHelp = "Time after which the metadata of an executable, " +
+		"like its build ID, is removed from the reporter cache unless it is reported " +
+		"again. As the agent re-reads executables every 6 hours, shorter values may " +
+		"drop the metadata of executables that still run. Default is 0, which keeps the " +
+		"metadata until it is evicted."
+	authTokenFileHelp = "Path to a file holding the bearer token sent with every request. " +
+		"Takes precedence over -secret-token. The file is re-read periodically, so the " +
+		"token can be rotated without restarting the agent."
+	authTokenRefreshIntervalHelp = "Interval in which the file given by -auth-token-file is re-read."
+	rpcHeadersHelp               = "Additional headers sent with every request to the collector, " +
+		`as comma separated list of key=value pairs, e.g. "X-Scope-OrgID=tenant".`
+	tlsCAFileHelp = "Path to a PEM encoded CA bundle to verify the collector with. " +
+		"Defaults to the system CA pool."
+	tlsCertFileHelp = "Path to a PEM encoded client certificate for mTLS. " +
+		"Requires -tls-key-file."
+	tlsKeyFileHelp = "Path to the PEM encoded key of the client certificate for mTLS. " +
+		"Requires -tls-cert-file."
+	tlsServerNameHelp         = "Override the server name used to verify the collector certificate."
+	tlsInsecureSkipVerifyHelp = "Disable the verification of the collector certificate. " +
+		"Only use this for testing."
+	stdoutReporterHelp = "Print a summary of the collected samples to stdout every " +
+		"reporting interval instead of sending them to the collector. Only use this " +
+		"for local debugging."
+	idleSamplesHelp = "How samples of the idle task are reported. Valid values are " +
+		`"keep", "label" (adds the label "cpu.state=idle") or "drop".`
+	uploadSymbolsAllowHelp = "Comma separated list of path prefixes or globs. If set, only " +
+		"executables below one of the prefixes or matching one of the globs are uploaded."
+	uploadSymbolsDenyHelp = "Comma separated list of path prefixes or globs. Executables " +
+		"below one of the prefixes or matching one of the globs are never uploaded, e.g. " +
+		`"/home,/opt/*/bin/vendor-*". Takes precedence over the allow lists.`
+	uploadSymbolsAllowBuildIDsHelp = "Comma separated list of build IDs. If set, executables " +
+		"with one of the build IDs are uploaded, in addition to the ones allowed by " +
+		"-upload-symbols-allow-paths."
+	uploadSymbolsDenyBuildIDsHelp = "Comma separated list of build IDs of executables that " +
+		"are never uploaded. Takes precedence over the allow lists."
+	dedupTimestampsHelp = "Report every timestamp of a sample only once, for backends " +
+		"that expect unique timestamps. The sample count still includes all occurrences."
+	omitPlaceholderFramesHelp = "Omit kernel and interpreted frames without symbol " +
+		`information, instead of reporting them with placeholders like "UNKNOWN".`
+	rawNativeFramesHelp = "Report native frames only by the file ID of their executable " +
+		"and their address, without its file name or placeholders, for backends that " +
+		"symbolize the frames on their own."
+	tenantNamespacesHelp = "Comma separated list of namespace=tenant pairs. Profiles " +
+		"of different tenants are reported separately with a tenant.id resource attribute."
+	tenantPodNameRegexHelp = "Regular expression that extracts the tenant from the pod " +
+		"name, if its namespace is not listed in -tenant-namespaces. The tenant is taken " +
+		"from the capture group named tenant, or from the only capture group."
+	cacheHighWaterMarkHelp = "Fill ratio of the sample cache, between 0 and 1, above which " +
+		"a warning is logged on every report. A value of 0 disables the warning."
+	symbolUploadURLHelp = "Base URL the http symbol uploader posts executables to, " +
+		"as <url>/<build ID>."
+	symbolUploaderHelp = "Backend for the symbol upload, either parca or http. Custom " +
+		"uploaders can be registered with reporter.RegisterSymbolUploader."
+	schemaURLHelp = "Schema URL of the OpenTelemetry semantic conventions that is reported " +
+		"with the profiles."
+	detectResourceHelp = "Detect resource attributes of the host, operating system, " +
+		"agent process and container with the OpenTelemetry SDK. Host metadata collected " +
+		"by the agent takes precedence over detected attributes."
+	serviceNameHelp = "Value of the service.name resource attribute that is reported with " +
+		"the profiles."
+	profileNameKeyHelp = "Key of the resource attribute that names the profile type. " +
+		"Some ingestion pipelines reserve the default key."
+	profileNameHelp        = "Value of the resource attribute that names the profile type."
+	omitProfileNameHelp    = "Omit the resource attribute that names the profile type."
+	scopeNameHelp          = "Name of the instrumentation scope that is reported with the profiles."
+	scopeVersionSuffixHelp = "Suffix that is appended to the version of the instrumentation " +
+		`scope, e.g. "+vendor.1".`
+	reportJitterHelp = "Factor in [0, 1) by which the interval between two reports is " +
+		"randomly shortened or extended. A value of 0 disables the jitter."
+	omitFramePathsHelp = "Comma separated list of path prefixes or glob patterns. Frames " +
+		"of executables with a matching path are omitted from the profiles."
+	minSampleCountHelp = "Minimum count of a trace before it is reported. Traces with a " +
+		"lower count are held back until their counts across reports reach the minimum."
+	extraCollAgentAddrsHelp = "Comma separated list of further collection agent addresses. " +
+		"Profiles and symbols are sent to each of them in addition to -collection-agent."
+	exportBreakerThresholdHelp = "Number of consecutive failed exports after which samples " +
+		"are dropped and the collector is probed with a growing delay until it is " +
+		"reachable again. A value of 0 disables this."
+	exportSampleRateHelp = "Fraction of report intervals, between 0 and 1, whose profiles " +
+		"are exported to protect the collector under load. The profiles of the other " +
+		"intervals are dropped. A value of 1 exports every interval."
+	maxStackDepthHelp = "Number of frames of a trace above which the outermost frames " +
+		`are replaced with a single "[truncated N frames]" frame. A value of 0 reports ` +
+		"all frames."
+	maxSamplesPerReportHelp = "Number of samples above which the collected samples are " +
+		"reported before the report interval ends. A value of 0 reports only once per interval."
+	maxRequestSizeHelp = "Size in MiB above which the profiles of a report are split across " +
+		"several export requests, to stay below the maximum message size of the collector. " +
+		"A value of 0 sends every report in a single request."
+	extractDebuginfoMinSizeHelp = "Size in MiB below which executables are uploaded as is, " +
+		"without extracting their debug information. A value of 0 extracts the debug " +
+		"information of all executables."
+	streamDebuginfoHelp = "Stream the extracted debug information to the backend instead " +
+		"of caching it on disk. This avoids the disk IO at the cost of extracting it twice."
+	compressDebuginfoCacheHelp = "Store the extracted debug information gzip-compressed " +
+		"on disk until it is uploaded. This saves disk space at the cost of CPU time."
+	uploadChunkSizeHelp = "Size in MiB of the chunks the debug information is uploaded in, " +
+		"resuming failed chunks. The signed URLs of the backend must accept resumable " +
+		"uploads. A value of 0 uploads the debug information in a single request."
+	uploadVerifyETagHelp = "Verify the uploaded debug information with the ETag of the " +
+		"response, if it is an MD5 checksum. Only enable this for backends that use the " +
+		"MD5 checksum as ETag. The Content-MD5 of the response is always verified."
+	defaultSampleTypeHelp = "Type of the samples that UIs show by default if the profiles " +
+		`hold it, either "samples", "cpu" or "alloc_space". Defaults to the CPU time if ` +
+		"-report-cpu-time is set, and to the sample count otherwise."
+	dropFramesHelp = "Regular expression of function names that are reported for downstream " +
+		"tooling to drop the matching frames and the frames below them from the profiles."
+	keepFramesHelp = "Regular expression of function names that are reported for downstream " +
+		"tooling to keep the matching frames, even if they match -drop-frames."
+	profileBuildWarnFractionHelp = "Fraction of the report interval, between 0 and 1, above " +
+		"which a warning is logged if building the profiles of a report takes longer. " +
+		"A value of 0 disables the warning."
+	profileSizeWarnLimitHelp = "Number of locations, functions, mappings or strings of a " +
+		"profile above which a warning is logged, to detect cardinality explosions. " +
+		"A value of 0 disables the warning."
+	shutdownTimeoutHelp = "Time to wait on exit for the connections to the collectors " +
+		"to be closed."
+	grpcKeepaliveTimeHelp = "Time without activity after which the gRPC connections to the " +
+		"collectors are pinged, so that idle connections are kept alive and broken ones are " +
+		"detected. gRPC enforces a minimum of 10s. A value of 0 disables keepalive pings."
+	grpcKeepaliveTimeoutHelp = "Time to wait for the response to a keepalive ping before " +
+		"the gRPC connection is closed. A value of 0 uses the gRPC default of 20s."
+	grpcKeepalivePermitWithoutStreamHelp = "Send keepalive pings even if there are no " +
+		"active RPCs. The collector must permit this, or it closes the connection."
+	hostMetadataRefreshHelp = "Interval in which the host metadata is collected again, " +
+		"so that the reported resource attributes follow changes of the host."
+	splitTracesByProcessHelp = "Report the same trace of different processes as separate " +
+		"traces, so that every sample carries the PID and start time of its own process. " +
+		"This multiplies the number of reported traces by the number of processes."
 )
 
 // Variables for command line arguments
@@ -95,6 +251,12 @@ var (
 	argConfigFile             string
 	argSecretToken            string
 	argDisableTLS             bool
+	argDryRun                 bool
+	argTLSCAFile              string
+	argTLSCertFile            string
+	argTLSKeyFile             string
+	argTLSServerName          string
+	argTLSInsecureSkipVerify  bool
 	argTags                   string
 	argBpfVerifierLogLevel    uint
 	argBpfVerifierLogSize     int
@@ -104,6 +266,68 @@ var (
 	argBuildIDMode            string
 	argNoExtractDebuginfo     bool
 	argUploadSymbols          bool
+	argOTLPProtocol           string
+	argOTLPFile               string
+	argTraceInfoGracePeriod   time.Duration
+	argTraceInfoMaxReports    uint
+	argTraceInfoLifetime      time.Duration
+	argProfileIDMode          string
+	argReportCPUTime          bool
+	argKernelImageName        string
+	argCacheMemoryLimit       uint
+	argAuthTokenFile          string
+	argAuthTokenRefresh       time.Duration
+	argRPCHeaders             string
+	argStdoutReporter         bool
+	argIdleSamples            string
+	argUploadAllowPaths       string
+	argUploadDenyPaths        string
+	argUploadAllowBuildIDs    string
+	argUploadDenyBuildIDs     string
+	argOmitPlaceholderFrames  bool
+	argRawNativeFrames        bool
+	argDedupTimestamps        bool
+	argTenantNamespaces       string
+	argTenantPodNameRegex     string
+	argCacheHighWaterMark     float64
+	argSymbolUploader         string
+	argSymbolUploadURL        string
+	argSchemaURL              string
+	argServiceName            string
+	argDetectResource         bool
+	argProfileNameKey         string
+	argProfileName            string
+	argOmitProfileName        bool
+	argScopeName              string
+	argScopeVersionSuffix     string
+	argReportJitter           float64
+	argOmitFramePaths         string
+	argMinSampleCount         uint
+	argExtraCollAgentAddrs    string
+	argExportBreakerThreshold uint
+	argExtractMinSize         uint
+	argStreamDebuginfo        bool
+	argUploadChunkSize        uint
+	argUploadVerifyETag       bool
+	argCompressDebuginfoCache bool
+	argDropFrames             string
+	argDefaultSampleType      string
+	argKeepFrames             string
+	argExportSampleRate       float64
+	argMaxStackDepth          uint
+	argMaxSamplesPerReport    uint
+	argMaxRequestSize         uint
+	argExecMetadataLifetime   time.Duration
+	argProfileBuildWarnFrac   float64
+	argHostMetadataRefresh    time.Duration
+	argProfileSizeWarnLimit   uint
+	argShutdownTimeout        time.Duration
+	argSplitTracesByProcess   bool
+
+	// Flag variables of the gRPC keepalive pings.
+	argGRPCKeepaliveTime          time.Duration
+	argGRPCKeepaliveTimeout       time.Duration
+	argGRPCKeepaliveWithoutStream bool
 
 	// "internal" flag variables.
 	// Flag variables that are configured in "internal" builds will have to be assigned
@@ -122,31 +346,124 @@ var fs = flag.NewFlagSet("otel-profiling-agent", flag.ExitOnError)
 
 func parseArgs() error {
 	// Please keep the parameters ordered alphabetically in the source-code.
+	fs.StringVar(&argAuthTokenFile, "auth-token-file", "", authTokenFileHelp)
+	fs.DurationVar(&argAuthTokenRefresh, "auth-token-refresh-interval", time.Minute,
+		authTokenRefreshIntervalHelp)
+
 	fs.UintVar(&argBpfVerifierLogLevel, "bpf-log-level", 0, bpfVerifierLogLevelHelp)
 	fs.IntVar(&argBpfVerifierLogSize, "bpf-log-size", cebpf.DefaultVerifierLogSize,
 		bpfVerifierLogSizeHelp)
 
 	fs.StringVar(&argCacheDirectory, "cache-directory", config.CacheDirectory(),
 		cacheDirectoryHelp)
+	fs.Float64Var(&argCacheHighWaterMark, "cache-high-water-mark", 0.9,
+		cacheHighWaterMarkHelp)
+	fs.UintVar(&argCacheMemoryLimit, "cache-memory-limit", 0, cacheMemoryLimitHelp)
 	fs.StringVar(&argCollAgentAddr, "collection-agent", "",
 		collAgentAddrHelp)
 	fs.StringVar(&argConfigFile, "config", "/etc/otel/profiling-agent/agent.conf",
 		configFileHelp)
 	fs.BoolVar(&argCopyright, "copyright", false, copyrightHelp)
 
+	fs.BoolVar(&argDedupTimestamps, "dedup-timestamps", false, dedupTimestampsHelp)
+	fs.StringVar(&argDefaultSampleType, "default-sample-type", "", defaultSampleTypeHelp)
+	fs.BoolVar(&argDetectResource, "detect-resource", false, detectResourceHelp)
 	fs.BoolVar(&argDisableTLS, "disable-tls", false, disableTLSHelp)
+	fs.StringVar(&argDropFrames, "drop-frames", "", dropFramesHelp)
+	fs.BoolVar(&argDryRun, "dry-run", false, dryRunHelp)
+
+	fs.DurationVar(&argExecMetadataLifetime, "executable-metadata-lifetime", 0,
+		executableMetadataLifetimeHelp)
+	fs.UintVar(&argExportBreakerThreshold, "export-breaker-threshold", 5,
+		exportBreakerThresholdHelp)
+	fs.Float64Var(&argExportSampleRate, "export-sample-rate", 1, exportSampleRateHelp)
+	fs.StringVar(&argExtraCollAgentAddrs, "extra-collection-agents", "",
+		extraCollAgentAddrsHelp)
+
+	fs.DurationVar(&argGRPCKeepaliveTime, "grpc-keepalive-time", 0, grpcKeepaliveTimeHelp)
+	fs.DurationVar(&argGRPCKeepaliveTimeout, "grpc-keepalive-timeout", 0,
+		grpcKeepaliveTimeoutHelp)
+	fs.BoolVar(&argGRPCKeepaliveWithoutStream, "grpc-keepalive-permit-without-stream", false,
+		grpcKeepalivePermitWithoutStreamHelp)
+
+	fs.DurationVar(&argHostMetadataRefresh, "host-metadata-refresh-interval",
+		hostmetadata.CollectionInterval, hostMetadataRefreshHelp)
+
+	fs.StringVar(&argIdleSamples, "idle-samples", "keep", idleSamplesHelp)
+
+	fs.StringVar(&argKeepFrames, "keep-frames", "", keepFramesHelp)
+	fs.StringVar(&argKernelImageName, "kernel-image-name", "vmlinux", kernelImageNameHelp)
 
 	fs.UintVar(&argMapScaleFactor, "map-scale-factor",
 		defaultArgMapScaleFactor, mapScaleFactorHelp)
 
+	fs.UintVar(&argMaxRequestSize, "max-request-size", 0, maxRequestSizeHelp)
+	fs.UintVar(&argMaxSamplesPerReport, "max-samples-per-report", 0, maxSamplesPerReportHelp)
+	fs.UintVar(&argMaxStackDepth, "max-stack-depth", 0, maxStackDepthHelp)
+	fs.UintVar(&argMinSampleCount, "min-sample-count", 0, minSampleCountHelp)
+
 	fs.BoolVar(&argNoKernelVersionCheck, "no-kernel-version-check", false, noKernelVersionCheckHelp)
 
+	fs.StringVar(&argOmitFramePaths, "omit-frame-paths", "", omitFramePathsHelp)
+	fs.BoolVar(&argOmitPlaceholderFrames, "omit-placeholder-frames", false,
+		omitPlaceholderFramesHelp)
+	fs.BoolVar(&argOmitProfileName, "omit-profile-name", false, omitProfileNameHelp)
+
+	fs.StringVar(&argOTLPFile, "otlp-file", "-", otlpFileHelp)
+	fs.StringVar(&argOTLPProtocol, "otlp-protocol", "grpc", otlpProtocolHelp)
+
+	fs.Float64Var(&argProfileBuildWarnFrac, "profile-build-warn-fraction", 0.5,
+		profileBuildWarnFractionHelp)
+	fs.StringVar(&argProfileIDMode, "profile-id-mode", "random", profileIDModeHelp)
+	fs.StringVar(&argProfileName, "profile-name", reporter.DefaultProfileName, profileNameHelp)
+	fs.StringVar(&argProfileNameKey, "profile-name-key", reporter.DefaultProfileNameKey,
+		profileNameKeyHelp)
+	fs.UintVar(&argProfileSizeWarnLimit, "profile-size-warn-limit", 1000000,
+		profileSizeWarnLimitHelp)
+
 	fs.UintVar(&argProjectID, "project-id", 1, projectIDHelp)
 
+	fs.BoolVar(&argRawNativeFrames, "raw-native-frames", false, rawNativeFramesHelp)
+
+	fs.StringVar(&argRPCHeaders, "rpc-headers", "", rpcHeadersHelp)
+
+	fs.BoolVar(&argReportCPUTime, "report-cpu-time", false, reportCPUTimeHelp)
+
+	fs.Float64Var(&argReportJitter, "report-jitter", 0.2, reportJitterHelp)
+
+	fs.StringVar(&argSchemaURL, "schema-url", reporter.DefaultSchemaURL, schemaURLHelp)
+
 	// Using a default value here to simplify OTEL review process.
 	fs.StringVar(&argSecretToken, "secret-token", "abc123", secretTokenHelp)
 
+	fs.StringVar(&argScopeName, "scope-name", reporter.DefaultScopeName, scopeNameHelp)
+	fs.StringVar(&argScopeVersionSuffix, "scope-version-suffix", "", scopeVersionSuffixHelp)
+	fs.StringVar(&argServiceName, "service-name", reporter.DefaultServiceName, serviceNameHelp)
+
+	fs.DurationVar(&argShutdownTimeout, "shutdown-timeout", 5*time.Second, shutdownTimeoutHelp)
+	fs.BoolVar(&argSplitTracesByProcess, "split-traces-by-process", false,
+		splitTracesByProcessHelp)
+
+	fs.BoolVar(&argStdoutReporter, "stdout-reporter", false, stdoutReporterHelp)
+
+	fs.StringVar(&argSymbolUploadURL, "symbol-upload-url", "", symbolUploadURLHelp)
+	fs.StringVar(&argSymbolUploader, "symbol-uploader", "parca", symbolUploaderHelp)
+
 	fs.StringVar(&argTags, "tags", "", tagsHelp)
+	fs.StringVar(&argTenantNamespaces, "tenant-namespaces", "", tenantNamespacesHelp)
+	fs.StringVar(&argTenantPodNameRegex, "tenant-pod-name-regex", "", tenantPodNameRegexHelp)
+	fs.DurationVar(&argTraceInfoGracePeriod, "trace-info-grace-period", 0,
+		traceInfoGracePeriodHelp)
+	fs.DurationVar(&argTraceInfoLifetime, "trace-info-lifetime", 0, traceInfoLifetimeHelp)
+	fs.UintVar(&argTraceInfoMaxReports, "trace-info-max-reports", 5, traceInfoMaxReportsHelp)
+
+	fs.StringVar(&argTLSCAFile, "tls-ca-file", "", tlsCAFileHelp)
+	fs.StringVar(&argTLSCertFile, "tls-cert-file", "", tlsCertFileHelp)
+	fs.BoolVar(&argTLSInsecureSkipVerify, "tls-insecure-skip-verify", false,
+		tlsInsecureSkipVerifyHelp)
+	fs.StringVar(&argTLSKeyFile, "tls-key-file", "", tlsKeyFileHelp)
+	fs.StringVar(&argTLSServerName, "tls-server-name", "", tlsServerNameHelp)
+
 	fs.StringVar(&argTracers, "t", "all", "Shorthand for -tracers.")
 	fs.StringVar(&argTracers, "tracers", "all", tracersHelp)
 
@@ -154,10 +471,24 @@ func parseArgs() error {
 	fs.BoolVar(&argVerboseMode, "verbose", false, verboseModeHelp)
 	fs.BoolVar(&argVersion, "version", false, versionHelp)
 
-	fs.StringVar(&argBuildIDMode, "build-id-mode", "linker", buildIDModeHelp)
+	fs.StringVar(&argBuildIDMode, "build-id-mode", reporter.BuildIDModeLinker, buildIDModeHelp)
 
 	fs.BoolVar(&argUploadSymbols, "upload-symbols", true, uploadSymbolsHelp)
+	fs.StringVar(&argUploadAllowPaths, "upload-symbols-allow-paths", "", uploadSymbolsAllowHelp)
+	fs.StringVar(&argUploadDenyPaths, "upload-symbols-deny-paths", "", uploadSymbolsDenyHelp)
+	fs.StringVar(&argUploadAllowBuildIDs, "upload-symbols-allow-build-ids", "",
+		uploadSymbolsAllowBuildIDsHelp)
+	fs.StringVar(&argUploadDenyBuildIDs, "upload-symbols-deny-build-ids", "",
+		uploadSymbolsDenyBuildIDsHelp)
 	fs.BoolVar(&argNoExtractDebuginfo, "no-extract-debuginfo", false, noExtractDebuginfoHelp)
+	fs.UintVar(&argExtractMinSize, "extract-debuginfo-min-size", 0,
+		extractDebuginfoMinSizeHelp)
+	fs.BoolVar(&argStreamDebuginfo, "stream-debuginfo", false, streamDebuginfoHelp)
+	fs.BoolVar(&argCompressDebuginfoCache, "compress-debuginfo-cache", false,
+		compressDebuginfoCacheHelp)
+	fs.UintVar(&argUploadChunkSize, "upload-symbols-chunk-size", 0, uploadChunkSizeHelp)
+	fs.BoolVar(&argUploadVerifyETag, "upload-symbols-verify-etag", false,
+		uploadVerifyETagHelp)
 
 	fs.UintVar(&argProbabilisticThreshold, "probabilistic-threshold",
 		defaultProbabilisticThreshold, probabilisticThresholdHelp)
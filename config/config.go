@@ -42,6 +42,8 @@ type Config struct {
 	PresentCPUCores        uint16
 	DisableTLS             bool
 	UploadSymbols          bool
+	DryRun                 bool
+	SplitTracesByProcess   bool
 	NoKernelVersionCheck   bool
 	TraceCacheIntervals    uint8
 	Verbose                bool
@@ -88,6 +90,12 @@ var (
 	noKernelVersionCheck bool
 	// uploadSymbols indicates whether automatic uploading of symbols is enabled
 	uploadSymbols bool
+	// dryRun indicates that profiles are built, but neither profiles nor symbols
+	// are sent to the backend
+	dryRun bool
+	// splitTracesByProcess indicates that the same trace of different processes
+	// is reported as separate traces
+	splitTracesByProcess bool
 	// bpfVerifierLogLevel holds the defined log level of the eBPF verifier.
 	// Currently there are three different log levels applied by the kernel verifier:
 	// 0 - no logging
@@ -203,6 +211,8 @@ func SetConfiguration(conf *Config) error {
 	disableTLS = conf.DisableTLS
 	noKernelVersionCheck = conf.NoKernelVersionCheck
 	uploadSymbols = conf.UploadSymbols
+	dryRun = conf.DryRun
+	splitTracesByProcess = conf.SplitTracesByProcess
 	tracers = conf.Tracers
 	startTime = conf.StartTime
 	mapScaleFactor = conf.MapScaleFactor
@@ -329,6 +339,18 @@ func UploadSymbols() bool {
 	return uploadSymbols
 }
 
+// DryRun indicates whether profiles are only built, without sending them or
+// uploading symbols to the backend
+func DryRun() bool {
+	return dryRun
+}
+
+// SplitTracesByProcess indicates whether the same trace of different processes
+// is reported as separate traces, each with its own process
+func SplitTracesByProcess() bool {
+	return splitTracesByProcess
+}
+
 // User-specified tracers to enable
 func Tracers() string {
 	return tracers
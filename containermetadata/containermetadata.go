@@ -108,7 +108,7 @@ type Handler struct {
 
 // ContainerMetadata contains the container and/or pod metadata.
 type ContainerMetadata struct {
-	containerID   string
+	ContainerID   string
 	PodName       string
 	PodNamespace  string
 	ContainerName string
@@ -369,7 +369,7 @@ func (h *Handler) putCache(pod *corev1.Pod) {
 		}
 
 		h.containerMetadataCache.Add(containerID, ContainerMetadata{
-			containerID:   containerID,
+			ContainerID:   containerID,
 			PodName:       pod.Name,
 			PodNamespace:  pod.Namespace,
 			ContainerName: pod.Status.ContainerStatuses[i].Name,
@@ -438,14 +438,14 @@ func (h *Handler) GetContainerMetadata(pid libpf.PID) (ContainerMetadata, error)
 		// from the docker socket. Therefore, we populate container ID and container name
 		// with the information we have.
 		return ContainerMetadata{
-			containerID:   pidContainerID,
+			ContainerID:   pidContainerID,
 			ContainerName: pidContainerID,
 		}, nil
 	} else if isContainerEnvironment(env, envLxc) {
 		// As lxc does not use different identifiers we populate container ID and container
 		// name of metadata with the same information.
 		return ContainerMetadata{
-			containerID:   pidContainerID,
+			ContainerID:   pidContainerID,
 			ContainerName: pidContainerID,
 		}, nil
 	}
@@ -479,7 +479,7 @@ func (h *Handler) getKubernetesPodMetadata(pidContainerID string) (
 			}
 			if containerID == pidContainerID {
 				containerMetadata := ContainerMetadata{
-					containerID:   containerID,
+					ContainerID:   containerID,
 					PodName:       podName,
 					ContainerName: containers[i].Name,
 				}
@@ -511,7 +511,7 @@ func (h *Handler) getDockerContainerMetadata(pidContainerID string) (
 			// remove / prefix from container name
 			containerName := strings.TrimPrefix(containers[i].Names[0], "/")
 			metadata := ContainerMetadata{
-				containerID:   containers[i].ID,
+				ContainerID:   containers[i].ID,
 				ContainerName: containerName,
 			}
 			h.containerMetadataCache.Add(pidContainerID, metadata)
@@ -552,7 +552,7 @@ func (h *Handler) getContainerdContainerMetadata(pidContainerID string) (
 			// Containerd does not differentiate between the name and the ID of a
 			// container. So we both options to the same value.
 			return ContainerMetadata{
-				containerID:   fields[2],
+				ContainerID:   fields[2],
 				ContainerName: fields[2],
 				PodName:       fields[1],
 			}, nil
@@ -7,7 +7,6 @@
 package hostmetadata
 
 import (
-	"context"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -18,28 +17,27 @@ import (
 	"github.com/elastic/otel-profiling-agent/hostmetadata/ec2"
 	"github.com/elastic/otel-profiling-agent/hostmetadata/gce"
 	"github.com/elastic/otel-profiling-agent/hostmetadata/host"
-	"github.com/elastic/otel-profiling-agent/reporter"
+	"github.com/elastic/otel-profiling-agent/hostmetadata/k8s"
 )
 
-// Collector implements host metadata collection and reporting
+// CollectionInterval is the default duration between host metadata collections.
+// Changing this significantly must be done in coordination with pf-web-service, as
+// it bounds the minimum time for which host metadata must be retrieved.
+// 23021 is 6h23m41s - picked randomly so we don't do the collection at the same
+// time every day.
+const CollectionInterval = 23021 * time.Second
+
+// Collector implements host metadata collection
 type Collector struct {
 	// caEndpoint is the collection agent endpoint, which is necessary to determine the source IP
 	// address from which traffic will be routed. This IP address is reported as host metadata.
 	caEndpoint string
-	// collectionInterval specifies the duration between host metadata collections.
-	collectionInterval time.Duration
 }
 
 // NewCollector returns a new Collector for the specified collection agent endpoint.
 func NewCollector(caEndpoint string) *Collector {
 	return &Collector{
 		caEndpoint: caEndpoint,
-
-		// Changing this significantly must be done in coordination with pf-web-service, as
-		// it bounds the minimum time for which host metadata must be retrieved.
-		// 23021 is 6h23m41s - picked randomly so we don't do the collection at the same
-		// time every day.
-		collectionInterval: 23021 * time.Second,
 	}
 }
 
@@ -53,6 +51,8 @@ func (c *Collector) GetHostMetadata() map[string]string {
 		log.Errorf("Unable to get host metadata: %v", err)
 	}
 
+	k8s.AddMetadata(result)
+
 	// Here we can gather more metadata, which may be dependent on the cloud provider, container
 	// technology, container orchestration stack, etc.
 	switch {
@@ -67,22 +67,3 @@ func (c *Collector) GetHostMetadata() map[string]string {
 
 	return result
 }
-
-// StartMetadataCollection starts a goroutine that reports host metadata every collectionInterval.
-func (c *Collector) StartMetadataCollection(ctx context.Context,
-	rep reporter.HostMetadataReporter) {
-	collectionTicker := time.NewTicker(c.collectionInterval)
-	go func() {
-		defer collectionTicker.Stop()
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case <-collectionTicker.C:
-				metadataMap := c.GetHostMetadata()
-				// metadataMap will always contain revision and build timestamp
-				rep.ReportHostMetadata(metadataMap)
-			}
-		}
-	}()
-}
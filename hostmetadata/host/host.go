@@ -35,6 +35,7 @@ import (
 const (
 	KeyKernelProcVersion = "host:kernel_proc_version"
 	KeyKernelVersion     = "host:kernel_version"
+	KeyKernelTextBase    = "host:kernel_text_base"
 	KeyHostname          = "host:hostname"
 	KeyMachine           = "host:machine"
 	KeyIPAddress         = "host:ip"
@@ -81,6 +82,14 @@ func AddMetadata(caEndpoint string, result map[string]string) error {
 	}
 	result[KeyKernelProcVersion] = sanitizeString(kernelProcVersion)
 
+	// Kernel frames are reported as offsets to the kernel text, so that the
+	// backend can restore their addresses with its base address.
+	if base, err := kernelTextBase(); err == nil {
+		result[KeyKernelTextBase] = fmt.Sprintf("0x%x", base)
+	} else {
+		log.Debugf("Unable to determine kernel text base: %v", err)
+	}
+
 	info, err := readCPUInfo()
 	if err != nil {
 		return fmt.Errorf("unable to read CPU information: %v", err)
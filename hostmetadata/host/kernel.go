@@ -0,0 +1,56 @@
+/*
+ * Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+ * or more contributor license agreements. Licensed under the Apache License 2.0.
+ * See the file "LICENSE" for details.
+ */
+
+package host
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// kernelTextBase returns the address of the start of the kernel text, which is
+// randomized by KASLR on every boot. It is only read once, as it does not change
+// while the host is running.
+var kernelTextBase = sync.OnceValues(func() (uint64, error) {
+	return readKernelTextBase("/proc/kallsyms")
+})
+
+// readKernelTextBase returns the address of the _stext symbol from the
+// kallsyms file at path.
+func readKernelTextBase(path string) (uint64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// Lines are formatted as: <address> <type> <name> [<module>]
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || fields[2] != "_stext" {
+			continue
+		}
+		address, err := strconv.ParseUint(fields[0], 16, 64)
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse address of _stext: %v", err)
+		}
+		if address == 0 {
+			// Without CAP_SYSLOG the addresses are hidden.
+			return 0, errors.New("address of _stext is hidden")
+		}
+		return address, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, errors.New("no _stext in kallsyms")
+}
@@ -0,0 +1,58 @@
+/*
+ * Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+ * or more contributor license agreements. Licensed under the Apache License 2.0.
+ * See the file "LICENSE" for details.
+ */
+
+package host
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadKernelTextBase(t *testing.T) {
+	tests := map[string]struct {
+		kallsyms string
+		want     uint64
+		wantErr  bool
+	}{
+		"kernel text": {
+			kallsyms: "0000000000000000 A fixed_percpu_data\n" +
+				"ffffffff9d000000 T startup_64\n" +
+				"ffffffff9d000000 T _stext\n" +
+				"ffffffffc0a1b000 t nf_conntrack_init [nf_conntrack]\n",
+			want: 0xffffffff9d000000,
+		},
+		"hidden addresses": {
+			kallsyms: "0000000000000000 T startup_64\n" +
+				"0000000000000000 T _stext\n",
+			wantErr: true,
+		},
+		"no kernel text": {
+			kallsyms: "ffffffff9d000000 T startup_64\n",
+			wantErr:  true,
+		},
+	}
+
+	for name, tc := range tests {
+		name := name
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "kallsyms")
+			require.NoError(t, os.WriteFile(path, []byte(tc.kallsyms), 0o600))
+
+			base, err := readKernelTextBase(path)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, base)
+		})
+	}
+}
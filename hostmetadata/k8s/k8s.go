@@ -0,0 +1,50 @@
+/*
+ * Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+ * or more contributor license agreements. Licensed under the Apache License 2.0.
+ * See the file "LICENSE" for details.
+ */
+
+package k8s
+
+import (
+	"os"
+)
+
+// Kubernetes metadata keys
+const (
+	keyNodeName    = "k8s:node_name"
+	keyClusterName = "k8s:cluster_name"
+)
+
+// The agent learns about its node and cluster from environment variables, which
+// are set in the manifest of its DaemonSet. For every key, the variables are
+// checked in order.
+var (
+	// The Elastic manifest for kubernetes uses NODE_NAME instead of
+	// KUBERNETES_NODE_NAME, see also containermetadata.
+	nodeNameVariables = []string{"KUBERNETES_NODE_NAME", "NODE_NAME"}
+	// Kubernetes itself does not know the name of its cluster.
+	clusterNameVariables = []string{"KUBERNETES_CLUSTER_NAME", "CLUSTER_NAME"}
+)
+
+// AddMetadata adds the name of the Kubernetes node and cluster the agent runs
+// in to the result map, if they are known.
+func AddMetadata(result map[string]string) {
+	if nodeName := firstEnv(nodeNameVariables); nodeName != "" {
+		result[keyNodeName] = nodeName
+	}
+	if clusterName := firstEnv(clusterNameVariables); clusterName != "" {
+		result[keyClusterName] = clusterName
+	}
+}
+
+// firstEnv returns the value of the first of the environment variables that
+// is not empty.
+func firstEnv(variables []string) string {
+	for _, variable := range variables {
+		if value := os.Getenv(variable); value != "" {
+			return value
+		}
+	}
+	return ""
+}
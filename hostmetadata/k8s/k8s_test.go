@@ -0,0 +1,51 @@
+/*
+ * Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+ * or more contributor license agreements. Licensed under the Apache License 2.0.
+ * See the file "LICENSE" for details.
+ */
+
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddMetadata(t *testing.T) {
+	tests := map[string]struct {
+		env  map[string]string
+		want map[string]string
+	}{
+		"no kubernetes": {
+			want: map[string]string{},
+		},
+		"node name": {
+			env:  map[string]string{"NODE_NAME": "node-1"},
+			want: map[string]string{keyNodeName: "node-1"},
+		},
+		"preferred variables": {
+			env: map[string]string{
+				"KUBERNETES_NODE_NAME":    "node-1",
+				"NODE_NAME":               "node-2",
+				"KUBERNETES_CLUSTER_NAME": "production",
+				"CLUSTER_NAME":            "staging",
+			},
+			want: map[string]string{keyNodeName: "node-1", keyClusterName: "production"},
+		},
+	}
+
+	for name, tc := range tests {
+		name := name
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			for _, variable := range append(nodeNameVariables, clusterNameVariables...) {
+				t.Setenv(variable, tc.env[variable])
+			}
+
+			result := make(map[string]string)
+			AddMetadata(result)
+			assert.Equal(t, tc.want, result)
+		})
+	}
+}
@@ -1006,14 +1006,15 @@ func (d *hotspotInstance) getJITInfo(addr libpf.Address,
 }
 
 // Symbolize generates symbolization information for given hotspot method and
-// a Byte Code Index (BCI)
+// a Byte Code Index (BCI) executed in the given JIT tier
 func (m *hotspotMethod) symbolize(symbolizer interpreter.Symbolizer, bci int32,
-	ii *hotspotInstance, trace *libpf.Trace) error {
+	tier libpf.JITTier, ii *hotspotInstance, trace *libpf.Trace) error {
 	// Make sure the BCI is within the method range
 	if bci < 0 || bci >= int32(m.bytecodeSize) {
 		bci = 0
 	}
-	trace.AppendFrame(libpf.HotSpotFrame, m.objectID, libpf.AddressOrLineno(bci))
+	trace.AppendFrameWithJITTier(libpf.HotSpotFrame, m.objectID,
+		libpf.AddressOrLineno(bci), tier)
 
 	// Check if this is already symbolized
 	if _, ok := m.bciSeen[uint16(bci)]; ok {
@@ -1082,7 +1083,7 @@ func (ji *hotspotJITInfo) symbolize(symbolizer interpreter.Symbolizer, ripDelta
 		// It is possible that there is no debug info, or no scope information,
 		// for the given RIP. In this case we can provide the method name
 		// from the metadata.
-		return ji.method.symbolize(symbolizer, 0, ii, trace)
+		return ji.method.symbolize(symbolizer, 0, libpf.JITTierCompiled, ii, trace)
 	}
 
 	// Found scope data. Expand the inlined scope information from it.
@@ -1124,7 +1125,8 @@ func (ji *hotspotJITInfo) symbolize(symbolizer interpreter.Symbolizer, ripDelta
 			if err != nil {
 				return err
 			}
-			err = method.symbolize(symbolizer, int32(byteCodeIndex), ii, trace)
+			err = method.symbolize(symbolizer, int32(byteCodeIndex), libpf.JITTierCompiled,
+				ii, trace)
 			if err != nil {
 				return err
 			}
@@ -1445,7 +1447,7 @@ func (d *hotspotInstance) Symbolize(symbolReporter reporter.SymbolReporter,
 		if err1 != nil {
 			return err
 		}
-		err = method.symbolize(symbolReporter, ripOrBci, d, trace)
+		err = method.symbolize(symbolReporter, ripOrBci, libpf.JITTierInterpreted, d, trace)
 	case C.FRAME_HOTSPOT_NATIVE:
 		jitinfo, err1 := d.getJITInfo(ptr, ptrCheck)
 		if err1 != nil {
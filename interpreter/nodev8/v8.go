@@ -718,9 +718,10 @@ func (i *v8Instance) calculateAndSymbolizeStubID(symbolizer interpreter.Symboliz
 	return stubID
 }
 
-// insertFrame inserts a V8 frame to libpf.Trace
-func insertFrame(trace *libpf.Trace, fileID libpf.FileID, line libpf.AddressOrLineno) {
-	trace.AppendFrame(libpf.V8Frame, fileID, line)
+// insertFrame inserts a V8 frame executed in the given JIT tier to libpf.Trace
+func insertFrame(trace *libpf.Trace, fileID libpf.FileID, line libpf.AddressOrLineno,
+	tier libpf.JITTier) {
+	trace.AppendFrameWithJITTier(libpf.V8Frame, fileID, line, tier)
 }
 
 // symbolizeMarkerFrame symbolizes and adds to trace a V8 stub frame
@@ -748,7 +749,7 @@ func (i *v8Instance) symbolizeMarkerFrame(symbolizer interpreter.Symbolizer, mar
 			marker, name, stubID)
 	}
 
-	insertFrame(trace, v8StubsFileID, stubID)
+	insertFrame(trace, v8StubsFileID, stubID, libpf.JITTierUnknown)
 	return nil
 }
 
@@ -1483,13 +1484,13 @@ func (i *v8Instance) generateNativeFrame(symbolizer interpreter.Symbolizer,
 			i.d.externalStubID = i.calculateAndSymbolizeStubID(
 				symbolizer, "<external-file>")
 		}
-		insertFrame(trace, v8StubsFileID, i.d.externalStubID)
+		insertFrame(trace, v8StubsFileID, i.d.externalStubID, libpf.JITTierUnknown)
 		return
 	}
 
 	lineNo := sfi.scriptOffsetToLine(sourcePos)
 	addressOrLineno := libpf.AddressOrLineno(lineNo) + nativeCodeBaseAddress
-	insertFrame(trace, sfi.funcID, addressOrLineno)
+	insertFrame(trace, sfi.funcID, addressOrLineno, libpf.JITTierOptimized)
 	if !seen {
 		i.symbolize(symbolizer, sfi, addressOrLineno, lineNo)
 	}
@@ -1497,8 +1498,8 @@ func (i *v8Instance) generateNativeFrame(symbolizer interpreter.Symbolizer,
 
 // symbolizeBytecode symbolizes and records to a trace a Bytecode based frame.
 func (i *v8Instance) symbolizeBytecode(symbolizer interpreter.Symbolizer, sfi *v8SFI,
-	delta uint64, trace *libpf.Trace) error {
-	insertFrame(trace, sfi.funcID, libpf.AddressOrLineno(delta))
+	delta uint64, tier libpf.JITTier, trace *libpf.Trace) error {
+	insertFrame(trace, sfi.funcID, libpf.AddressOrLineno(delta), tier)
 	if _, ok := sfi.bytecodeDeltaSeen[uint32(delta)]; !ok {
 		sourcePos := decodePosition(sfi.bytecodePositionTable, delta)
 		lineNo := sfi.scriptOffsetToLine(sourcePos)
@@ -1510,7 +1511,7 @@ func (i *v8Instance) symbolizeBytecode(symbolizer interpreter.Symbolizer, sfi *v
 
 // symbolizeSFI symbolizes and records to a trace a SharedFunctionInfo based frame.
 func (i *v8Instance) symbolizeSFI(symbolizer interpreter.Symbolizer, pointer libpf.Address,
-	delta uint64, trace *libpf.Trace) error {
+	delta uint64, tier libpf.JITTier, trace *libpf.Trace) error {
 	vms := &i.d.vmStructs
 	sfi, err := i.getSFI(pointer)
 	if err != nil {
@@ -1529,7 +1530,7 @@ func (i *v8Instance) symbolizeSFI(symbolizer interpreter.Symbolizer, pointer lib
 		// Invalid value
 		bytecodeDelta = nativeCodeBaseAddress - 1
 	}
-	return i.symbolizeBytecode(symbolizer, sfi, uint64(bytecodeDelta), trace)
+	return i.symbolizeBytecode(symbolizer, sfi, uint64(bytecodeDelta), tier, trace)
 }
 
 // getBytecodeLength decodes the length at the start of bytecode array
@@ -1623,14 +1624,16 @@ func (i *v8Instance) symbolizeBaselineCode(symbolizer interpreter.Symbolizer, co
 	delta uint32, trace *libpf.Trace) error {
 	if bytecodeDelta, ok := code.codeDeltaToPosition[delta]; ok {
 		// We've seen this frame before, so just insert the frame
-		insertFrame(trace, code.sfi.funcID, libpf.AddressOrLineno(bytecodeDelta))
+		insertFrame(trace, code.sfi.funcID, libpf.AddressOrLineno(bytecodeDelta),
+			libpf.JITTierBaseline)
 		return nil
 	}
 
 	// Decode bytecode delta, memoize it, and symbolize frame
 	bytecodeDelta := i.mapBaselineCodeOffsetToBytecode(code, delta)
 	code.codeDeltaToPosition[delta] = sourcePosition(bytecodeDelta)
-	return i.symbolizeBytecode(symbolizer, code.sfi, uint64(bytecodeDelta), trace)
+	return i.symbolizeBytecode(symbolizer, code.sfi, uint64(bytecodeDelta),
+		libpf.JITTierBaseline, trace)
 }
 
 // symbolizeCode symbolizes and records to a trace a Code based frame.
@@ -1716,8 +1719,14 @@ func (i *v8Instance) Symbolize(symbolReporter reporter.SymbolReporter,
 		// Convert the V8 build specific marker ID to a static ID and symbolize
 		// that if needed.
 		err = i.symbolizeMarkerFrame(symbolReporter, deltaOrMarker, trace)
-	case C.V8_FILE_TYPE_BYTECODE, C.V8_FILE_TYPE_NATIVE_SFI:
-		err = i.symbolizeSFI(symbolReporter, pointer, deltaOrMarker, trace)
+	case C.V8_FILE_TYPE_BYTECODE:
+		err = i.symbolizeSFI(symbolReporter, pointer, deltaOrMarker,
+			libpf.JITTierInterpreted, trace)
+	case C.V8_FILE_TYPE_NATIVE_SFI:
+		// Native code for which only the SharedFunctionInfo is known, so the
+		// tier of the code can not be determined.
+		err = i.symbolizeSFI(symbolReporter, pointer, deltaOrMarker,
+			libpf.JITTierUnknown, trace)
 	case C.V8_FILE_TYPE_NATIVE_CODE, C.V8_FILE_TYPE_NATIVE_JSFUNC:
 		var code *v8Code
 		codeCookie := uint32(deltaOrMarker & C.V8_LINE_COOKIE_MASK >> C.V8_LINE_COOKIE_SHIFT)
@@ -8,6 +8,7 @@ package libpf
 
 import (
 	"testing"
+	"time"
 )
 
 func TestMin(t *testing.T) {
@@ -89,3 +90,16 @@ func TestIsValidString(t *testing.T) {
 		})
 	}
 }
+
+func TestAddJitter(t *testing.T) {
+	base := 5 * time.Second
+
+	for i := 0; i < 100; i++ {
+		if d := AddJitter(base, 0); d != base {
+			t.Fatalf("Expected no jitter, got %v", d)
+		}
+		if d := AddJitter(base, 0.2); d < 4*time.Second || d > 6*time.Second {
+			t.Fatalf("Jitter out of range: %v", d)
+		}
+	}
+}
@@ -39,14 +39,35 @@ func (t *UnixTime32) MarshalJSON() ([]byte, error) {
 	return time.Unix(int64(*t), 0).UTC().MarshalJSON()
 }
 
+// UnixTime64 returns t converted to nanoseconds since epoch. This allows callers
+// that only have second precision to use APIs that expect UnixTime64.
+func (t UnixTime32) UnixTime64() UnixTime64 {
+	return UnixTime64(uint64(t) * uint64(time.Second))
+}
+
+// UnixTime64 is another type to represent nanoseconds since epoch.
+// OTEP/profiles uses nanosecond precision for timestamps, which does
+// not fit into UnixTime32.
+type UnixTime64 uint64
+
+func (t *UnixTime64) MarshalJSON() ([]byte, error) {
+	return time.Unix(0, int64(*t)).UTC().MarshalJSON()
+}
+
 // Compile-time interface checks
 var _ json.Marshaler = (*UnixTime32)(nil)
+var _ json.Marshaler = (*UnixTime64)(nil)
 
 // NowAsUInt32 is a convenience function to avoid code repetition
 func NowAsUInt32() uint32 {
 	return uint32(time.Now().Unix())
 }
 
+// NowAsUInt64 returns the current time in nanoseconds since epoch.
+func NowAsUInt64() uint64 {
+	return uint64(time.Now().UnixNano())
+}
+
 // PID represent Unix Process ID (pid_t)
 type PID int32
 
@@ -459,7 +480,10 @@ type Trace struct {
 	Files      []FileID
 	Linenos    []AddressOrLineno
 	FrameTypes []FrameType
-	Hash       TraceHash
+	// JITTiers holds the JIT tier for each frame. It is nil if the tier
+	// is not known for any frame of the trace.
+	JITTiers []JITTier
+	Hash     TraceHash
 }
 
 // AppendFrame appends a frame to the columnar frame array.
@@ -467,11 +491,60 @@ func (trace *Trace) AppendFrame(ty FrameType, file FileID, addrOrLine AddressOrL
 	trace.FrameTypes = append(trace.FrameTypes, ty)
 	trace.Files = append(trace.Files, file)
 	trace.Linenos = append(trace.Linenos, addrOrLine)
+	if trace.JITTiers != nil {
+		trace.JITTiers = append(trace.JITTiers, JITTierUnknown)
+	}
+}
+
+// AppendFrameWithJITTier appends a frame with a known JIT tier to the columnar
+// frame array.
+func (trace *Trace) AppendFrameWithJITTier(ty FrameType, file FileID,
+	addrOrLine AddressOrLineno, tier JITTier) {
+	if trace.JITTiers == nil && tier != JITTierUnknown {
+		trace.JITTiers = make([]JITTier, len(trace.FrameTypes), cap(trace.FrameTypes))
+	}
+	trace.AppendFrame(ty, file, addrOrLine)
+	if trace.JITTiers != nil {
+		trace.JITTiers[len(trace.JITTiers)-1] = tier
+	}
+}
+
+// JITTier describes how a frame of a runtime with a tiered JIT compiler was executed.
+type JITTier uint8
+
+const (
+	// JITTierUnknown is used if the tier of the frame is not known.
+	JITTierUnknown JITTier = iota
+	// JITTierInterpreted is used for frames executed by the interpreter.
+	JITTierInterpreted
+	// JITTierBaseline is used for frames executed as code of a non-optimizing compiler.
+	JITTierBaseline
+	// JITTierOptimized is used for frames executed as code of an optimizing compiler.
+	JITTierOptimized
+	// JITTierCompiled is used for frames executed as compiled code, if the
+	// compiler is not known.
+	JITTierCompiled
+)
+
+// String implements the Stringer interface.
+func (t JITTier) String() string {
+	switch t {
+	case JITTierInterpreted:
+		return "interpreted"
+	case JITTierBaseline:
+		return "baseline"
+	case JITTierOptimized:
+		return "optimized"
+	case JITTierCompiled:
+		return "compiled"
+	default:
+		return "unknown"
+	}
 }
 
 type TraceAndCounts struct {
 	Hash          TraceHash
-	Timestamp     UnixTime32
+	Timestamp     UnixTime64
 	Count         uint16
 	Comm          string
 	PodName       string
@@ -485,6 +558,18 @@ type FrameMetadata struct {
 	FunctionOffset uint32
 	FunctionName   string
 	Filename       string
+	// FunctionEndLine is the last source line of the function, if known.
+	FunctionEndLine SourceLineno
+	// InlineFrames are the functions that were inlined into FunctionName at
+	// AddressOrLine, ordered from caller to callee.
+	InlineFrames []InlineFrame
+}
+
+// InlineFrame describes a function that was inlined into its caller.
+type InlineFrame struct {
+	FunctionName string
+	Filename     string
+	LineNumber   SourceLineno
 }
 
 // StackFrame represents a stack frame - an ID for the file it belongs to, an
@@ -304,3 +304,20 @@ func TestTraceType(t *testing.T) {
 		assert.Equal(t, test.str, test.ty.String())
 	}
 }
+
+func TestTraceJITTiers(t *testing.T) {
+	trace := &Trace{}
+	trace.AppendFrame(NativeFrame, NewFileID(1, 1), 1)
+	assert.Nil(t, trace.JITTiers)
+
+	trace.AppendFrameWithJITTier(HotSpotFrame, NewFileID(2, 2), 2, JITTierUnknown)
+	assert.Nil(t, trace.JITTiers)
+
+	trace.AppendFrameWithJITTier(HotSpotFrame, NewFileID(3, 3), 3, JITTierCompiled)
+	trace.AppendFrame(NativeFrame, NewFileID(4, 4), 4)
+	trace.AppendFrameWithJITTier(HotSpotFrame, NewFileID(5, 5), 5, JITTierInterpreted)
+
+	assert.Equal(t, []JITTier{JITTierUnknown, JITTierUnknown, JITTierCompiled,
+		JITTierUnknown, JITTierInterpreted}, trace.JITTiers)
+	assert.Len(t, trace.FrameTypes, len(trace.JITTiers))
+}
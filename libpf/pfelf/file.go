@@ -471,13 +471,8 @@ func (f *File) EHFrame() (*Prog, error) {
 
 // GetBuildID returns the ELF BuildID if present
 func (f *File) GetBuildID() (string, error) {
-	s := f.Section(".note.gnu.build-id")
-	if s == nil {
-		s = f.Section(".notes")
-	}
-	if s == nil {
-		s = f.Section(".note.go.buildid")
-		if s != nil {
+	if f.Section(".note.gnu.build-id") == nil && f.Section(".notes") == nil {
+		if s := f.Section(".note.go.buildid"); s != nil {
 			data, err := s.Data(maxBytesSmallSection)
 			if err != nil {
 				return "", err
@@ -486,6 +481,16 @@ func (f *File) GetBuildID() (string, error) {
 			return getBuildIDFromGoNotes(data)
 		}
 	}
+	return f.GetGNUBuildID()
+}
+
+// GetGNUBuildID returns the BuildID of the GNU build ID note if present. Unlike
+// GetBuildID, it does not fall back to the Go BuildID.
+func (f *File) GetGNUBuildID() (string, error) {
+	s := f.Section(".note.gnu.build-id")
+	if s == nil {
+		s = f.Section(".notes")
+	}
 	if s == nil {
 		return "", ErrNoBuildID
 	}
@@ -16,6 +16,7 @@ import (
 	"github.com/elastic/otel-profiling-agent/libpf/pfelf"
 	"github.com/elastic/otel-profiling-agent/testsupport"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var (
@@ -53,6 +54,41 @@ func TestGetBuildID(t *testing.T) {
 	}
 }
 
+func TestGetGNUBuildID(t *testing.T) {
+	tests := map[string]struct {
+		write   func() (string, error)
+		buildID string
+		err     error
+	}{
+		"gnu note": {
+			write:   testsupport.WriteTestExecutable1,
+			buildID: "6920fd217a8416131f4377ef018a2c932f311b6d",
+		},
+		"no build id": {
+			write: testsupport.WriteTestExecutable2,
+			err:   pfelf.ErrNoBuildID,
+		},
+	}
+
+	for name, tc := range tests {
+		name := name
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			exePath, err := tc.write()
+			require.NoError(t, err)
+			defer os.Remove(exePath)
+
+			ef, err := pfelf.Open(exePath)
+			require.NoError(t, err)
+			defer ef.Close()
+
+			buildID, err := ef.GetGNUBuildID()
+			assert.Equal(t, tc.err, err, name)
+			assert.Equal(t, tc.buildID, buildID, name)
+		})
+	}
+}
+
 func TestGetDebugLink(t *testing.T) {
 	debugExePath, err := testsupport.WriteTestExecutable1()
 	if err != nil {
@@ -0,0 +1,25 @@
+/*
+ * Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+ * or more contributor license agreements. Licensed under the Apache License 2.0.
+ * See the file "LICENSE" for details.
+ */
+
+package process
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/elastic/otel-profiling-agent/libpf"
+)
+
+// Name returns the name of the process with the given PID, which is the name of
+// its main thread. Other threads of the process can have names of their own.
+func Name(pid libpf.PID) (string, error) {
+	comm, err := os.ReadFile(fmt.Sprintf("/proc/%d/comm", pid))
+	if err != nil {
+		return "", err
+	}
+	return string(bytes.TrimSuffix(comm, []byte("\n"))), nil
+}
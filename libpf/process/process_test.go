@@ -9,8 +9,10 @@ package process
 import (
 	"debug/elf"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/elastic/otel-profiling-agent/libpf"
 
@@ -92,3 +94,68 @@ func TestNewPIDOfSelf(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Greater(t, len(mappings), 0)
 }
+
+func TestParseStartTime(t *testing.T) {
+	tests := map[string]struct {
+		stat    string
+		want    uint64
+		wantErr bool
+	}{
+		"simple": {
+			stat: "1234 (bash) S 1 1234 1234 34816 1234 4194560 1303 0 0 0 1 0 0 0 20 0 " +
+				"1 0 5678 9555968 1290 18446744073709551615\n",
+			want: 5678,
+		},
+		"name with spaces and parentheses": {
+			stat: "1234 (a (b) c) S 1 1234 1234 34816 1234 4194560 1303 0 0 0 1 0 0 0 20 0 " +
+				"1 0 91011 9555968 1290 18446744073709551615\n",
+			want: 91011,
+		},
+		"truncated": {
+			stat:    "1234 (bash) S 1 1234",
+			wantErr: true,
+		},
+		"no name": {
+			stat:    "1234",
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range tests {
+		name := name
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			got, err := parseStartTime([]byte(tc.stat))
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestStartTimeOfSelf(t *testing.T) {
+	start, err := StartTime(libpf.PID(os.Getpid()))
+	assert.NoError(t, err)
+	// The start time has a resolution of clock ticks.
+	now := time.Now()
+	assert.LessOrEqual(t, int64(start), now.Add(time.Second).UnixNano())
+	assert.Greater(t, int64(start), now.Add(-time.Hour).UnixNano())
+
+	again, err := StartTime(libpf.PID(os.Getpid()))
+	assert.NoError(t, err)
+	assert.Equal(t, start, again)
+}
+
+func TestNameOfSelf(t *testing.T) {
+	name, err := Name(libpf.PID(os.Getpid()))
+	assert.NoError(t, err)
+	// The kernel truncates the name to 15 bytes.
+	want := filepath.Base(os.Args[0])
+	if len(want) > 15 {
+		want = want[:15]
+	}
+	assert.Equal(t, want, name)
+}
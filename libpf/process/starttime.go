@@ -0,0 +1,73 @@
+/*
+ * Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+ * or more contributor license agreements. Licensed under the Apache License 2.0.
+ * See the file "LICENSE" for details.
+ */
+
+package process
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/elastic/otel-profiling-agent/libpf"
+)
+
+// clockTicksPerSecond is the unit of the times in /proc/<pid>/stat. The kernel
+// reports them in USER_HZ, which is 100 on all supported architectures.
+const clockTicksPerSecond = 100
+
+// bootTime returns the wall-clock time the host was booted at. It is only
+// determined once, so that the start times of a process are stable.
+var bootTime = sync.OnceValues(func() (time.Time, error) {
+	var ts unix.Timespec
+	if err := unix.ClockGettime(unix.CLOCK_BOOTTIME, &ts); err != nil {
+		return time.Time{}, fmt.Errorf("failed to read boot time clock: %v", err)
+	}
+	return time.Now().Add(-time.Duration(ts.Nano())), nil
+})
+
+// StartTime returns the time the process with the given PID was started at.
+// Together with the PID it identifies a process, as PIDs are reused.
+func StartTime(pid libpf.PID) (libpf.UnixTime64, error) {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, err
+	}
+	ticks, err := parseStartTime(stat)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse stat of PID %d: %v", pid, err)
+	}
+	boot, err := bootTime()
+	if err != nil {
+		return 0, err
+	}
+	start := boot.Add(time.Duration(ticks) * time.Second / clockTicksPerSecond)
+	return libpf.UnixTime64(start.UnixNano()), nil
+}
+
+// parseStartTime returns the start time in clock ticks after boot from the
+// contents of /proc/<pid>/stat. The process name in the second field may hold
+// spaces and parentheses, so the fields are counted from its closing parenthesis.
+func parseStartTime(stat []byte) (uint64, error) {
+	nameEnd := bytes.LastIndexByte(stat, ')')
+	if nameEnd < 0 {
+		return 0, errors.New("missing process name")
+	}
+	// The start time is the 22nd field, the fields following the process
+	// name start with the 3rd field.
+	const startTimeIndex = 22 - 3
+	fields := strings.Fields(string(stat[nameEnd+1:]))
+	if len(fields) <= startTimeIndex {
+		return 0, fmt.Errorf("unexpected number of fields %d", len(fields)+2)
+	}
+	return strconv.ParseUint(fields[startTimeIndex], 10, 64)
+}
@@ -12,6 +12,7 @@ import (
 	"os"
 	"os/signal"
 	"runtime"
+	"strings"
 	"time"
 
 	"golang.org/x/sys/unix"
@@ -230,6 +231,8 @@ func mainWithExitCode() exitCode {
 		DisableTLS:             argDisableTLS,
 		NoKernelVersionCheck:   argNoKernelVersionCheck,
 		UploadSymbols:          argUploadSymbols,
+		DryRun:                 argDryRun,
+		SplitTracesByProcess:   argSplitTracesByProcess,
 		BpfVerifierLogLevel:    argBpfVerifierLogLevel,
 		BpfVerifierLogSize:     argBpfVerifierLogSize,
 		MonitorInterval:        argMonitorInterval,
@@ -289,24 +292,106 @@ func mainWithExitCode() exitCode {
 		}
 	}
 
+	rpcHeaders, err := reporter.ParseKeyValues(argRPCHeaders)
+	if err != nil {
+		msg := fmt.Sprintf("Failed to parse RPC headers: %v", err)
+		log.Error(msg)
+		return exitFailure
+	}
+
+	tenantNamespaces, err := reporter.ParseKeyValues(argTenantNamespaces)
+	if err != nil {
+		msg := fmt.Sprintf("Failed to parse tenant namespaces: %v", err)
+		log.Error(msg)
+		return exitFailure
+	}
+
 	// Network operations to CA start here
 	var rep reporter.Reporter
 	// Connect to the collection agent
-	rep, err = reporter.StartOTLP(mainCtx, &reporter.Config{
-		CollAgentAddr:           argCollAgentAddr,
-		MaxRPCMsgSize:           33554432, // 32 MiB
-		ExecMetadataMaxQueue:    1024,
-		CountsForTracesMaxQueue: tracesQSize,
-		MetricsMaxQueue:         1024,
-		FramesForTracesMaxQueue: tracesQSize,
-		FrameMetadataMaxQueue:   tracesQSize,
-		HostMetadataMaxQueue:    2,
-		FallbackSymbolsMaxQueue: 1024,
-		DisableTLS:              argDisableTLS,
-		MaxGRPCRetries:          5,
-		Times:                   times,
-		OTLPBuildIDMode:         argBuildIDMode,
-		NoExtractDebuginfo:      argNoExtractDebuginfo,
+	startReporter := reporter.StartOTLP
+	if argStdoutReporter {
+		startReporter = reporter.StartStdout
+	}
+	rep, err = startReporter(mainCtx, &reporter.Config{
+		CollAgentAddr:              argCollAgentAddr,
+		ExtraCollAgentAddrs:        strings.Split(argExtraCollAgentAddrs, ","),
+		MaxRPCMsgSize:              33554432, // 32 MiB
+		ExecMetadataMaxQueue:       1024,
+		CountsForTracesMaxQueue:    tracesQSize,
+		MetricsMaxQueue:            1024,
+		FramesForTracesMaxQueue:    tracesQSize,
+		FrameMetadataMaxQueue:      tracesQSize,
+		HostMetadataMaxQueue:       2,
+		FallbackSymbolsMaxQueue:    1024,
+		DisableTLS:                 argDisableTLS,
+		TLSCAFile:                  argTLSCAFile,
+		TLSCertFile:                argTLSCertFile,
+		TLSKeyFile:                 argTLSKeyFile,
+		TLSServerName:              argTLSServerName,
+		TLSInsecureSkipVerify:      argTLSInsecureSkipVerify,
+		MaxGRPCRetries:             5,
+		Times:                      times,
+		OTLPBuildIDMode:            argBuildIDMode,
+		OTLPProtocol:               argOTLPProtocol,
+		OTLPFile:                   argOTLPFile,
+		TraceInfoGracePeriod:       argTraceInfoGracePeriod,
+		TraceInfoMaxReports:        uint32(argTraceInfoMaxReports),
+		TraceInfoLifetime:          argTraceInfoLifetime,
+		ProfileIDMode:              argProfileIDMode,
+		ReportCPUTime:              argReportCPUTime,
+		KernelImageName:            argKernelImageName,
+		CacheMemoryLimit:           uint64(argCacheMemoryLimit) * 1024 * 1024,
+		ExecutableMetadataLifetime: argExecMetadataLifetime,
+		AuthTokenFile:              argAuthTokenFile,
+		AuthTokenRefresh:           argAuthTokenRefresh,
+		RPCHeaders:                 rpcHeaders,
+		IdleSamples:                argIdleSamples,
+		OmitPlaceholderFrames:      argOmitPlaceholderFrames,
+		RawNativeFrames:            argRawNativeFrames,
+		DedupTimestamps:            argDedupTimestamps,
+		MaxStackDepth:              uint32(argMaxStackDepth),
+		MaxSamplesPerReport:        uint32(argMaxSamplesPerReport),
+		MaxRequestSize:             int(argMaxRequestSize) * 1024 * 1024,
+		OmitFramePaths:             strings.Split(argOmitFramePaths, ","),
+		DropFrames:                 argDropFrames,
+		DefaultSampleType:          argDefaultSampleType,
+		KeepFrames:                 argKeepFrames,
+		MinSampleCount:             uint32(argMinSampleCount),
+		ExportBreakerThreshold:     uint32(argExportBreakerThreshold),
+		ExportSampleRate:           argExportSampleRate,
+		NoExtractDebuginfo:         argNoExtractDebuginfo,
+		ExtractDebuginfoMinSize:    int64(argExtractMinSize) * 1024 * 1024,
+		StreamDebuginfo:            argStreamDebuginfo,
+		CompressDebuginfoCache:     argCompressDebuginfoCache,
+		ResumableUploadChunkSize:   int64(argUploadChunkSize) * 1024 * 1024,
+		UploadVerifyETag:           argUploadVerifyETag,
+		UploadAllowPaths:           strings.Split(argUploadAllowPaths, ","),
+		UploadDenyPaths:            strings.Split(argUploadDenyPaths, ","),
+		UploadAllowBuildIDs:        strings.Split(argUploadAllowBuildIDs, ","),
+		UploadDenyBuildIDs:         strings.Split(argUploadDenyBuildIDs, ","),
+		TenantNamespaces:           tenantNamespaces,
+		TenantPodNameRegex:         argTenantPodNameRegex,
+		CacheHighWaterMark:         argCacheHighWaterMark,
+		ProfileBuildWarnFraction:   argProfileBuildWarnFrac,
+		ProfileSizeWarnLimit:       uint32(argProfileSizeWarnLimit),
+		SymbolUploader:             argSymbolUploader,
+		SymbolUploadURL:            argSymbolUploadURL,
+		SchemaURL:                  argSchemaURL,
+		ServiceName:                argServiceName,
+		DetectResource:             argDetectResource,
+		ProfileNameKey:             argProfileNameKey,
+		ProfileName:                argProfileName,
+		OmitProfileName:            argOmitProfileName,
+		ScopeName:                  argScopeName,
+		ScopeVersionSuffix:         argScopeVersionSuffix,
+		ReportJitter:               argReportJitter,
+		HostMetadataSource:         metadataCollector.GetHostMetadata,
+		HostMetadataRefresh:        argHostMetadataRefresh,
+		ShutdownTimeout:            argShutdownTimeout,
+		GRPCKeepaliveTime:          argGRPCKeepaliveTime,
+		GRPCKeepaliveTimeout:       argGRPCKeepaliveTimeout,
+		GRPCKeepaliveWithoutStream: argGRPCKeepaliveWithoutStream,
 	})
 	if err != nil {
 		msg := fmt.Sprintf("Failed to start reporting: %v", err)
@@ -316,11 +401,10 @@ func mainWithExitCode() exitCode {
 
 	metrics.SetReporter(rep)
 
-	rep.ReportHostMetadata(hostMetadataMap)
-	// Now that we've sent the first host metadata update, start a goroutine to keep sending updates
-	// regularly. This is required so pf-web-service only needs to query metadata for bounded
+	// The reporter keeps refreshing the host metadata every HostMetadataRefresh.
+	// This is required so pf-web-service only needs to query metadata for bounded
 	// periods of time.
-	metadataCollector.StartMetadataCollection(mainCtx, rep)
+	rep.ReportHostMetadata(hostMetadataMap)
 
 	// Start agent specific metric retrieval and report them every second.
 	agentMetricCancel, agentErr := agentmetrics.Start(mainCtx, 1*time.Second)
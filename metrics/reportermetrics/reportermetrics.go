@@ -65,6 +65,74 @@ func report(forReporter reporter.Reporter) {
 			ID:    metrics.IDWireBytesInCount,
 			Value: metrics.MetricValue(reporterMetrics.WireBytesInCount),
 		},
+		{
+			ID:    metrics.IDTraceInfoGraceRecovered,
+			Value: metrics.MetricValue(reporterMetrics.TraceInfoGraceRecoveredCount),
+		},
+		{
+			ID:    metrics.IDTraceInfoMissingDropped,
+			Value: metrics.MetricValue(reporterMetrics.TraceInfoMissingDroppedCount),
+		},
+		{
+			ID:    metrics.IDExportSkipped,
+			Value: metrics.MetricValue(reporterMetrics.ExportSkippedCount),
+		},
+		{
+			ID:    metrics.IDExportSkippedSamples,
+			Value: metrics.MetricValue(reporterMetrics.ExportSkippedSamplesCount),
+		},
+		{
+			ID:    metrics.IDExportEndpointFailed,
+			Value: metrics.MetricValue(reporterMetrics.ExportEndpointFailedCount),
+		},
+		{
+			ID:    metrics.IDExportRejectedProfiles,
+			Value: metrics.MetricValue(reporterMetrics.ExportRejectedProfilesCount),
+		},
+		{
+			ID:    metrics.IDExportRejectedSamples,
+			Value: metrics.MetricValue(reporterMetrics.ExportRejectedSamplesCount),
+		},
+		{
+			ID:    metrics.IDSymbolUploadPathDenied,
+			Value: metrics.MetricValue(reporterMetrics.SymbolUploadPathDeniedCount),
+		},
+		{
+			ID:    metrics.IDTraceCacheEviction,
+			Value: metrics.MetricValue(reporterMetrics.TraceEvictionCount),
+		},
+		{
+			ID:    metrics.IDSampleCacheEviction,
+			Value: metrics.MetricValue(reporterMetrics.SampleEvictionCount),
+		},
+		{
+			ID:    metrics.IDExportBreakerOpen,
+			Value: metrics.MetricValue(reporterMetrics.ExportBreakerOpen),
+		},
+		{
+			ID:    metrics.IDExportBreakerDroppedSamples,
+			Value: metrics.MetricValue(reporterMetrics.ExportBreakerDroppedCount),
+		},
+		{
+			ID:    metrics.IDProfileBuildMaxUsec,
+			Value: metrics.MetricValue(reporterMetrics.ProfileBuildMaxUsec),
+		},
+		{
+			ID:    metrics.IDProfileLocations,
+			Value: metrics.MetricValue(reporterMetrics.ProfileLocations),
+		},
+		{
+			ID:    metrics.IDProfileFunctions,
+			Value: metrics.MetricValue(reporterMetrics.ProfileFunctions),
+		},
+		{
+			ID:    metrics.IDProfileMappings,
+			Value: metrics.MetricValue(reporterMetrics.ProfileMappings),
+		},
+		{
+			ID:    metrics.IDProfileStrings,
+			Value: metrics.MetricValue(reporterMetrics.ProfileStrings),
+		},
 	})
 }
 
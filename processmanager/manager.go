@@ -22,6 +22,7 @@ import (
 	"github.com/elastic/otel-profiling-agent/libpf/nativeunwind"
 	sdtypes "github.com/elastic/otel-profiling-agent/libpf/nativeunwind/stackdeltatypes"
 	"github.com/elastic/otel-profiling-agent/libpf/periodiccaller"
+	"github.com/elastic/otel-profiling-agent/libpf/process"
 	"github.com/elastic/otel-profiling-agent/libpf/traceutil"
 	"github.com/elastic/otel-profiling-agent/lpm"
 	"github.com/elastic/otel-profiling-agent/metrics"
@@ -40,6 +41,20 @@ const (
 
 	// TTL of entries in the LRU cache holding the executables' ELF information.
 	elfInfoCacheTTL = 6 * time.Hour
+
+	// Maximum size of the LRU cache holding the start times of untracked processes.
+	processStartTimeCacheSize = 1024
+
+	// TTL of entries in the LRU cache holding the start times of untracked processes.
+	// It is short, as the exit of untracked processes is not always handled.
+	processStartTimeCacheTTL = 10 * time.Second
+
+	// Maximum size of the LRU cache holding the names of processes.
+	processNameCacheSize = 1024
+
+	// TTL of entries in the LRU cache holding the names of processes. It is short,
+	// as processes can change their name, e.g. with exec or prctl(PR_SET_NAME).
+	processNameCacheTTL = 10 * time.Second
 )
 
 var (
@@ -79,6 +94,20 @@ func New(ctx context.Context, includeTracers []bool, monitorInterval time.Durati
 	}
 	elfInfoCache.SetLifetime(elfInfoCacheTTL)
 
+	processStartTimeCache, err := lru.NewSynced[libpf.PID, libpf.UnixTime64](
+		processStartTimeCacheSize, libpf.PID.Hash32)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create processStartTimeCache: %v", err)
+	}
+	processStartTimeCache.SetLifetime(processStartTimeCacheTTL)
+
+	processNameCache, err := lru.NewSynced[libpf.PID, string](processNameCacheSize,
+		libpf.PID.Hash32)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create processNameCache: %v", err)
+	}
+	processNameCache.SetLifetime(processNameCacheTTL)
+
 	em := eim.NewExecutableInfoManager(sdp, ebpf, includeTracers)
 
 	interpreters := make(map[libpf.PID]map[libpf.OnDiskFileIdentifier]interpreter.Instance)
@@ -92,6 +121,8 @@ func New(ctx context.Context, includeTracers []bool, monitorInterval time.Durati
 		ebpf:                     ebpf,
 		FileIDMapper:             fileIDMapper,
 		elfInfoCache:             elfInfoCache,
+		processStartTimeCache:    processStartTimeCache,
+		processNameCache:         processNameCache,
 		reporter:                 symbolReporter,
 		metricsAddSlice:          metrics.AddSlice,
 		filterErrorFrames:        filterErrorFrames,
@@ -292,6 +323,45 @@ func (pm *ProcessManager) ConvertTrace(trace *host.Trace) (newTrace *libpf.Trace
 	return newTrace
 }
 
+// ProcessStartTime returns the start time of the process with the given PID, or zero
+// if it can not be determined, e.g. since the process already exited.
+func (pm *ProcessManager) ProcessStartTime(pid libpf.PID) libpf.UnixTime64 {
+	pm.mu.RLock()
+	info, ok := pm.pidToProcessInfo[pid]
+	pm.mu.RUnlock()
+	if ok {
+		return info.startTime
+	}
+	// Processes without executable mappings, like kernel threads, are not tracked.
+	// The idle task has no entry in procfs.
+	if pid == 0 {
+		return 0
+	}
+	if startTime, ok := pm.processStartTimeCache.Get(pid); ok {
+		return startTime
+	}
+	// Zero is cached as well, so that procfs is not read for every trace of a
+	// process whose start time can not be determined.
+	startTime, _ := process.StartTime(pid)
+	pm.processStartTimeCache.Add(pid, startTime)
+	return startTime
+}
+
+// ProcessName returns the name of the process with the given PID, or an empty
+// string if it can not be determined.
+func (pm *ProcessManager) ProcessName(pid libpf.PID) string {
+	// The idle task has no entry in procfs.
+	if pid == 0 {
+		return ""
+	}
+	if name, ok := pm.processNameCache.Get(pid); ok {
+		return name
+	}
+	name, _ := process.Name(pid)
+	pm.processNameCache.Add(pid, name)
+	return name
+}
+
 func (pm *ProcessManager) SymbolizationComplete(traceCaptureKTime libpf.KTime) {
 	pm.mu.Lock()
 	defer pm.mu.Unlock()
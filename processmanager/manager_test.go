@@ -634,3 +634,46 @@ func TestProcExit(t *testing.T) {
 		})
 	}
 }
+
+func TestProcessCaches(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	manager, err := New(ctx,
+		make([]bool, config.MaxTracers),
+		1*time.Second,
+		&ebpfMapsMockup{},
+		NewMapFileIDMapper(),
+		nil,
+		&dummyStackDeltaProvider{},
+		true)
+	if err != nil {
+		t.Fatalf("Failed to initialize new process manager: %v", err)
+	}
+
+	// The own process is not tracked by the process manager.
+	pid := libpf.PID(os.Getpid())
+	startTime := manager.ProcessStartTime(pid)
+	if startTime == 0 {
+		t.Fatalf("Failed to get start time of PID %d", pid)
+	}
+	if cached, ok := manager.processStartTimeCache.Peek(pid); !ok || cached != startTime {
+		t.Fatalf("Expected cached start time %d, got %d", startTime, cached)
+	}
+	name := manager.ProcessName(pid)
+	if name == "" {
+		t.Fatalf("Failed to get name of PID %d", pid)
+	}
+	if cached, ok := manager.processNameCache.Peek(pid); !ok || cached != name {
+		t.Fatalf("Expected cached name %q, got %q", name, cached)
+	}
+
+	// The exit of a process invalidates its start time and name.
+	_ = manager.ProcessPIDExit(pid)
+	if manager.processStartTimeCache.Contains(pid) {
+		t.Fatalf("Start time of PID %d is still cached after its exit", pid)
+	}
+	if manager.processNameCache.Contains(pid) {
+		t.Fatalf("Name of PID %d is still cached after its exit", pid)
+	}
+}
@@ -87,9 +87,16 @@ func (pm *ProcessManager) updatePidInformation(pid libpf.PID, m *Mapping) (bool,
 	if !ok {
 		// We don't have information for this pid, so we first need to
 		// allocate the embedded map for this process.
+		// The start time is only read once, as the PID of the process is not
+		// reused before its exit is handled.
+		startTime, err := process.StartTime(pid)
+		if err != nil {
+			log.Debugf("Failed to get start time of PID %d: %v", pid, err)
+		}
 		info = &processInfo{
-			mappings: make(map[libpf.Address]Mapping),
-			tsdInfo:  nil,
+			mappings:  make(map[libpf.Address]Mapping),
+			tsdInfo:   nil,
+			startTime: startTime,
 		}
 		pm.pidToProcessInfo[pid] = info
 
@@ -304,12 +311,17 @@ func (pm *ProcessManager) getELFInfo(pr process.Process, mapping *process.Mappin
 	}
 	pm.FileIDMapper.Set(hostFileID, fileID)
 
-	buildID, _ := ef.GetBuildID()
+	buildID, err := ef.GetGNUBuildID()
+	gnuBuildID := err == nil
+	if !gnuBuildID {
+		buildID, _ = ef.GetBuildID()
+	}
 	pm.reporter.ExecutableMetadata(
 		context.TODO(),
 		fileID,
 		path.Join("/proc", strconv.Itoa(int(pr.PID())), "root", mapping.Path),
 		buildID,
+		gnuBuildID,
 	)
 
 	return info
@@ -338,6 +350,12 @@ func (pm *ProcessManager) processNewExecMapping(pr process.Process, mapping *pro
 		return
 	}
 
+	// The range is reported for every process, as it differs between them if
+	// the executable is position independent.
+	if fileID, ok := pm.FileIDMapper.Get(info.fileID); ok {
+		pm.reporter.MappingMetadata(fileID, mapping.Vaddr, mapping.Vaddr+mapping.Length)
+	}
+
 	// Get the virtual addresses for this mapping
 	elfSpaceVA, ok := info.addressMapper.FileOffsetToVirtualAddress(mapping.FileOffset)
 	if !ok {
@@ -498,6 +516,9 @@ func (pm *ProcessManager) synchronizeMappings(pr process.Process,
 func (pm *ProcessManager) ProcessPIDExit(pid libpf.PID) bool {
 	log.Debugf("- PID: %v", pid)
 	defer pm.ebpf.RemoveReportedPID(pid)
+	// The PID can be reused by a new process.
+	pm.processStartTimeCache.Remove(pid)
+	pm.processNameCache.Remove(pid)
 
 	pm.mu.Lock()
 	defer pm.mu.Unlock()
@@ -86,6 +86,13 @@ type ProcessManager struct {
 	// executable. It caches results based on iNode number and device ID. Locked LRU.
 	elfInfoCache *lru.LRU[libpf.OnDiskFileIdentifier, elfInfo]
 
+	// processStartTimeCache caches the start times of processes that are not
+	// tracked in pidToProcessInfo, like kernel threads. Synced LRU.
+	processStartTimeCache *lru.SyncedLRU[libpf.PID, libpf.UnixTime64]
+
+	// processNameCache caches the names of processes. Synced LRU.
+	processNameCache *lru.SyncedLRU[libpf.PID, string]
+
 	// reporter is the interface to report symbolization information
 	reporter reporter.SymbolReporter
 
@@ -148,4 +155,7 @@ type processInfo struct {
 	mappings addressSpace
 	// C-library Thread Specific Data information
 	tsdInfo *tpbase.TSDInfo
+	// startTime is the time the process was started at, or zero if it is unknown.
+	// Together with the PID it identifies the process, as PIDs are reused.
+	startTime libpf.UnixTime64
 }
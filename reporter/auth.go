@@ -0,0 +1,147 @@
+/*
+ * Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+ * or more contributor license agreements. Licensed under the Apache License 2.0.
+ * See the file "LICENSE" for details.
+ */
+
+package reporter
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc/credentials"
+
+	"github.com/elastic/otel-profiling-agent/debug/log"
+)
+
+// defaultAuthTokenRefreshInterval is the interval the bearer token is re-read
+// from its file, if no other interval is configured.
+const defaultAuthTokenRefreshInterval = time.Minute
+
+// Assert that perRPCCredentials can be used for gRPC connections.
+var _ credentials.PerRPCCredentials = (*perRPCCredentials)(nil)
+
+// perRPCCredentials adds a bearer token and additional headers to every request
+// sent to the collector.
+type perRPCCredentials struct {
+	// token holds the current bearer token, it may be empty.
+	token atomic.Pointer[string]
+
+	// tokenFile is the file the bearer token is read from, if set.
+	tokenFile string
+
+	// headers are sent with every request in addition to the bearer token.
+	headers map[string]string
+
+	insecure bool
+}
+
+// newPerRPCCredentials returns credentials that send token as bearer token and the
+// given headers with every request. If tokenFile is set, the bearer token is
+// read from that file instead and refreshed by run. It returns nil if there is
+// nothing to send.
+func newPerRPCCredentials(token, tokenFile string, headers map[string]string,
+	insecure bool) (*perRPCCredentials, error) {
+	if token == "" && tokenFile == "" && len(headers) == 0 {
+		return nil, nil
+	}
+
+	c := &perRPCCredentials{
+		tokenFile: tokenFile,
+		headers:   make(map[string]string, len(headers)),
+		insecure:  insecure,
+	}
+	for k, v := range headers {
+		// gRPC requires lowercase metadata keys.
+		c.headers[strings.ToLower(k)] = v
+	}
+
+	if tokenFile != "" {
+		var err error
+		if token, err = readTokenFile(tokenFile); err != nil {
+			return nil, err
+		}
+	}
+	c.token.Store(&token)
+
+	return c, nil
+}
+
+// readTokenFile returns the bearer token stored in fileName.
+func readTokenFile(fileName string) (string, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return "", fmt.Errorf("failed to read token file: %v", err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("token file %s is empty", fileName)
+	}
+	return token, nil
+}
+
+// run re-reads the token file every interval until ctx is canceled. If the
+// file can not be read, the previous token is kept.
+func (c *perRPCCredentials) run(ctx context.Context, interval time.Duration) {
+	if c.tokenFile == "" {
+		return
+	}
+
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+			token, err := readTokenFile(c.tokenFile)
+			if err != nil {
+				log.Warnf("Failed to refresh bearer token: %v", err)
+				continue
+			}
+			c.token.Store(&token)
+		}
+	}
+}
+
+// GetRequestMetadata implements the credentials.PerRPCCredentials interface.
+func (c *perRPCCredentials) GetRequestMetadata(_ context.Context,
+	_ ...string) (map[string]string, error) {
+	md := make(map[string]string, len(c.headers)+1)
+	for k, v := range c.headers {
+		md[k] = v
+	}
+	if token := *c.token.Load(); token != "" {
+		md["authorization"] = "Bearer " + token
+	}
+	return md, nil
+}
+
+// RequireTransportSecurity implements the credentials.PerRPCCredentials interface.
+func (c *perRPCCredentials) RequireTransportSecurity() bool {
+	return !c.insecure
+}
+
+// ParseKeyValues parses a comma separated list of key=value pairs into a map.
+func ParseKeyValues(s string) (map[string]string, error) {
+	pairs := make(map[string]string)
+	if strings.TrimSpace(s) == "" {
+		return pairs, nil
+	}
+
+	for _, pair := range strings.Split(s, ",") {
+		key, value, found := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !found || key == "" {
+			return nil, fmt.Errorf("invalid key=value pair %q", pair)
+		}
+		pairs[key] = strings.TrimSpace(value)
+	}
+	return pairs, nil
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+ * or more contributor license agreements. Licensed under the Apache License 2.0.
+ * See the file "LICENSE" for details.
+ */
+
+package reporter
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPerRPCCredentials(t *testing.T) {
+	creds, err := newPerRPCCredentials("", "", nil, false)
+	require.NoError(t, err)
+	assert.Nil(t, creds)
+
+	creds, err = newPerRPCCredentials("abc123", "",
+		map[string]string{"X-Scope-OrgID": "tenant"}, false)
+	require.NoError(t, err)
+	assert.True(t, creds.RequireTransportSecurity())
+
+	md, err := creds.GetRequestMetadata(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"authorization": "Bearer abc123",
+		"x-scope-orgid": "tenant",
+	}, md)
+}
+
+func TestPerRPCCredentialsTokenFile(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+
+	_, err := newPerRPCCredentials("abc123", tokenFile, nil, true)
+	require.Error(t, err, "missing token file")
+
+	require.NoError(t, os.WriteFile(tokenFile, []byte("first\n"), 0o600))
+	creds, err := newPerRPCCredentials("abc123", tokenFile, nil, true)
+	require.NoError(t, err)
+
+	md, err := creds.GetRequestMetadata(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer first", md["authorization"])
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go creds.run(ctx, time.Millisecond)
+
+	require.NoError(t, os.WriteFile(tokenFile, []byte("second"), 0o600))
+	assert.Eventually(t, func() bool {
+		md, err := creds.GetRequestMetadata(context.Background())
+		return err == nil && md["authorization"] == "Bearer second"
+	}, 5*time.Second, time.Millisecond)
+
+	// A token file that can not be read keeps the previous token.
+	require.NoError(t, os.Remove(tokenFile))
+	time.Sleep(10 * time.Millisecond)
+	md, err = creds.GetRequestMetadata(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer second", md["authorization"])
+}
+
+func TestParseKeyValues(t *testing.T) {
+	tests := map[string]struct {
+		input   string
+		want    map[string]string
+		wantErr bool
+	}{
+		"empty":    {input: "", want: map[string]string{}},
+		"single":   {input: "X-Scope-OrgID=tenant", want: map[string]string{"X-Scope-OrgID": "tenant"}},
+		"multiple": {input: "a=1, b = 2", want: map[string]string{"a": "1", "b": "2"}},
+		"noValue":  {input: "a", wantErr: true},
+		"noKey":    {input: "=1", wantErr: true},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			pairs, err := ParseKeyValues(tc.input)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, pairs)
+		})
+	}
+}
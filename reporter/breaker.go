@@ -0,0 +1,118 @@
+/*
+ * Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+ * or more contributor license agreements. Licensed under the Apache License 2.0.
+ * See the file "LICENSE" for details.
+ */
+
+package reporter
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/elastic/otel-profiling-agent/debug/log"
+)
+
+// maxExportBackoffFactor limits the delay between two probes of an open breaker
+// to this multiple of the report interval.
+const maxExportBackoffFactor = 16
+
+// exportBreaker is a circuit breaker for the export of profiles. After threshold
+// consecutive failed exports it opens: new samples are dropped instead of being
+// cached, and the backend is probed with a growing delay instead of the report
+// interval. The first successful probe closes the breaker again.
+//
+// If profiles are sent to several collectors, an export only fails if it failed
+// for all of them, so a single broken collector does not open the breaker and
+// drop the samples of the healthy ones.
+type exportBreaker struct {
+	// threshold is the number of consecutive failures that opens the breaker.
+	threshold uint32
+	// failures is the number of consecutive failures.
+	failures uint32
+	// backoff is the delay until the next probe while the breaker is open.
+	backoff time.Duration
+
+	// open is read by the goroutines that report samples.
+	open atomic.Bool
+	// dropped counts the samples that were dropped while the breaker was open.
+	dropped atomic.Uint32
+}
+
+// newExportBreaker returns a breaker that opens after threshold consecutive
+// failures, or nil if threshold is zero.
+func newExportBreaker(threshold uint32) *exportBreaker {
+	if threshold == 0 {
+		return nil
+	}
+	return &exportBreaker{threshold: threshold}
+}
+
+// isOpen returns whether exports currently fail and samples are dropped.
+func (b *exportBreaker) isOpen() bool {
+	return b != nil && b.open.Load()
+}
+
+// drop records a sample that is dropped, if the breaker is open. It returns
+// whether the sample must be dropped.
+func (b *exportBreaker) drop() bool {
+	return b.dropN(1)
+}
+
+// dropN is like drop for n samples.
+func (b *exportBreaker) dropN(n uint32) bool {
+	if !b.isOpen() {
+		return false
+	}
+	b.dropped.Add(n)
+	return true
+}
+
+// record records the result of an export or probe and returns the delay until
+// the next one.
+func (b *exportBreaker) record(err error, reportInterval time.Duration) time.Duration {
+	if b == nil {
+		return reportInterval
+	}
+
+	if err == nil {
+		if b.open.Load() {
+			log.Infof("Export succeeded after %d failures, resuming reports", b.failures)
+			b.open.Store(false)
+		}
+		b.failures = 0
+		b.backoff = 0
+		return reportInterval
+	}
+
+	b.failures++
+	if b.open.Load() {
+		b.backoff = min(2*b.backoff, maxExportBackoffFactor*reportInterval)
+		return b.backoff
+	}
+	if b.failures < b.threshold {
+		return reportInterval
+	}
+
+	b.backoff = 2 * reportInterval
+	b.open.Store(true)
+	log.Warnf("Export failed %d times in a row, dropping samples until the collector "+
+		"is reachable again", b.failures)
+	return b.backoff
+}
+
+// openGauge returns 1 if the breaker is open and 0 otherwise.
+func (b *exportBreaker) openGauge() uint32 {
+	if b.isOpen() {
+		return 1
+	}
+	return 0
+}
+
+// droppedCount returns the number of samples dropped since the last call.
+func (b *exportBreaker) droppedCount() uint32 {
+	if b == nil {
+		return 0
+	}
+	return b.dropped.Swap(0)
+}
@@ -0,0 +1,138 @@
+/*
+ * Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+ * or more contributor license agreements. Licensed under the Apache License 2.0.
+ * See the file "LICENSE" for details.
+ */
+
+package reporter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+
+	"github.com/elastic/otel-profiling-agent/libpf"
+	otlpcollector "github.com/elastic/otel-profiling-agent/proto/experiments/opentelemetry/proto/collector/profiles/v1"
+)
+
+// flakyProfilesClient fails all Export calls while down is set.
+type flakyProfilesClient struct {
+	down bool
+	// requests holds the number of resource profiles of every Export call.
+	requests []int
+}
+
+func (f *flakyProfilesClient) Export(_ context.Context,
+	in *otlpcollector.ExportProfilesServiceRequest, _ ...grpc.CallOption) (
+	*otlpcollector.ExportProfilesServiceResponse, error) {
+	f.requests = append(f.requests, len(in.ResourceProfiles))
+	if f.down {
+		return nil, errors.New("unavailable")
+	}
+	return &otlpcollector.ExportProfilesServiceResponse{}, nil
+}
+
+func TestExportBreaker(t *testing.T) {
+	const interval = 5 * time.Second
+
+	r := newTestOTLPReporter(t)
+	r.breaker = newExportBreaker(2)
+	client := &flakyProfilesClient{down: true}
+	r.client = client
+
+	trace := &libpf.Trace{Hash: libpf.NewTraceHash(1, 2)}
+	trace.AppendFrame(libpf.KernelFrame, libpf.NewFileID(3, 4), 5)
+	r.ReportFramesForTrace(trace)
+	reportSample := func() {
+		r.ReportCountForTrace(trace.Hash, libpf.UnixTime64(1710000000e9), 1,
+			"comm", "", "", "", "", "")
+	}
+
+	// The first failure keeps the report interval.
+	reportSample()
+	assert.Equal(t, interval, r.report(context.Background(), interval))
+	assert.False(t, r.breaker.isOpen())
+
+	// The second consecutive failure opens the breaker.
+	reportSample()
+	assert.Equal(t, 2*interval, r.report(context.Background(), interval))
+	assert.True(t, r.breaker.isOpen())
+	metrics := r.GetMetrics()
+	assert.Equal(t, uint32(1), metrics.ExportBreakerOpen)
+
+	// While open, samples are dropped and the backend is probed with empty
+	// requests at growing intervals, up to the maximum.
+	reportSample()
+	assert.Zero(t, r.samples.Len())
+	assert.Equal(t, 4*interval, r.report(context.Background(), interval))
+	assert.Equal(t, 8*interval, r.report(context.Background(), interval))
+	assert.Equal(t, 16*interval, r.report(context.Background(), interval))
+	assert.Equal(t, 16*interval, r.report(context.Background(), interval))
+	assert.Equal(t, []int{1, 1, 0, 0, 0, 0}, client.requests)
+	metrics = r.GetMetrics()
+	assert.Equal(t, uint32(1), metrics.ExportBreakerDroppedCount)
+
+	// A successful probe closes the breaker and restores the report interval.
+	client.down = false
+	assert.Equal(t, interval, r.report(context.Background(), interval))
+	assert.False(t, r.breaker.isOpen())
+	metrics = r.GetMetrics()
+	assert.Zero(t, metrics.ExportBreakerOpen)
+	assert.Zero(t, metrics.ExportBreakerDroppedCount)
+
+	reportSample()
+	require.Equal(t, 1, r.samples.Len())
+	assert.Equal(t, interval, r.report(context.Background(), interval))
+	assert.Equal(t, 1, client.requests[len(client.requests)-1])
+}
+
+func TestExportBreakerFailingEndpoint(t *testing.T) {
+	const interval = 5 * time.Second
+
+	broken := &flakyProfilesClient{down: true}
+	healthy := &flakyProfilesClient{}
+	client := &fanOutProfilesClient{endpoints: []endpointClient{
+		{addr: "broken:4317", client: broken},
+		{addr: "healthy:4317", client: healthy},
+	}}
+	r := newTestOTLPReporterWithClient(t, client)
+	r.breaker = newExportBreaker(2)
+
+	trace := &libpf.Trace{Hash: libpf.NewTraceHash(1, 2)}
+	trace.AppendFrame(libpf.KernelFrame, libpf.NewFileID(3, 4), 5)
+	r.ReportFramesForTrace(trace)
+	for i := 0; i < 3; i++ {
+		r.ReportCountForTrace(trace.Hash, libpf.UnixTime64(1710000000e9), 1,
+			"comm", "", "", "", "", "")
+		assert.Equal(t, interval, r.report(context.Background(), interval))
+		assert.False(t, r.breaker.isOpen())
+	}
+	// No samples are dropped for the healthy collector.
+	assert.Equal(t, []int{1, 1, 1}, healthy.requests)
+	assert.Zero(t, r.GetMetrics().ExportBreakerDroppedCount)
+
+	// The breaker opens once all collectors fail.
+	healthy.down = true
+	for i := 0; i < 2; i++ {
+		r.ReportCountForTrace(trace.Hash, libpf.UnixTime64(1710000000e9), 1,
+			"comm", "", "", "", "", "")
+		r.report(context.Background(), interval)
+	}
+	assert.True(t, r.breaker.isOpen())
+}
+
+func TestExportBreakerDisabled(t *testing.T) {
+	b := newExportBreaker(0)
+	assert.Nil(t, b)
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, time.Second, b.record(errors.New("unavailable"), time.Second))
+	}
+	assert.False(t, b.drop())
+	assert.Zero(t, b.openGauge())
+	assert.Zero(t, b.droppedCount())
+}
@@ -0,0 +1,40 @@
+/*
+ * Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+ * or more contributor license agreements. Licensed under the Apache License 2.0.
+ * See the file "LICENSE" for details.
+ */
+
+package reporter
+
+import (
+	"fmt"
+)
+
+const (
+	// BuildIDModeLinker reports the build ID the linker embedded in the executable.
+	BuildIDModeLinker = "linker"
+	// BuildIDModeHash reports the hash of the executable as build ID.
+	BuildIDModeHash = "hash"
+	// BuildIDModeAuto reports the linker build ID if the executable has one, and
+	// the hash of the executable otherwise.
+	BuildIDModeAuto = "auto"
+)
+
+// gnuBuildIDAttributeKey is the mapping attribute that holds the build ID of
+// executables whose build ID comes from a GNU build ID note. The BuildIdKind of
+// the protocol does not tell these apart from other linker build IDs, like the
+// ones of Go.
+const gnuBuildIDAttributeKey = "process.executable.build_id.gnu"
+
+// validateBuildIDMode returns mode, or BuildIDModeLinker if it is empty, and an
+// error if mode is not a known build ID mode.
+func validateBuildIDMode(mode string) (string, error) {
+	switch mode {
+	case "":
+		return BuildIDModeLinker, nil
+	case BuildIDModeLinker, BuildIDModeHash, BuildIDModeAuto:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unsupported build ID mode: %s", mode)
+	}
+}
@@ -0,0 +1,154 @@
+/*
+ * Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+ * or more contributor license agreements. Licensed under the Apache License 2.0.
+ * See the file "LICENSE" for details.
+ */
+
+package reporter
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+
+	"github.com/elastic/otel-profiling-agent/libpf"
+	"github.com/elastic/otel-profiling-agent/proto/experiments/opentelemetry/proto/profiles/v1/alternatives/pprofextended"
+)
+
+func TestValidateBuildIDMode(t *testing.T) {
+	for _, mode := range []string{BuildIDModeLinker, BuildIDModeHash, BuildIDModeAuto} {
+		got, err := validateBuildIDMode(mode)
+		assert.NoError(t, err)
+		assert.Equal(t, mode, got)
+	}
+
+	got, err := validateBuildIDMode("")
+	assert.NoError(t, err)
+	assert.Equal(t, BuildIDModeLinker, got)
+
+	_, err = validateBuildIDMode("gnu")
+	assert.Error(t, err)
+}
+
+func TestGetProfileGNUBuildID(t *testing.T) {
+	tests := map[string]struct {
+		buildID    string
+		gnuBuildID bool
+		wantGNU    bool
+	}{
+		"gnu note": {
+			buildID:    "6920fd217a8416131f4377ef018a2c932f311b6d",
+			gnuBuildID: true,
+			wantGNU:    true,
+		},
+		"go build id": {
+			buildID: "go-build-id",
+		},
+		"no build id": {
+			gnuBuildID: true,
+		},
+	}
+
+	for name, tc := range tests {
+		name := name
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			fileID := libpf.NewFileID(3, 4)
+			r := newTestOTLPReporter(t)
+			r.ExecutableMetadata(context.Background(), fileID, "/usr/bin/app", tc.buildID,
+				tc.gnuBuildID)
+
+			trace := &libpf.Trace{Hash: libpf.NewTraceHash(1, 2)}
+			trace.AppendFrame(libpf.NativeFrame, fileID, 0x1234)
+			r.ReportFramesForTrace(trace)
+			r.ReportCountForTrace(trace.Hash, libpf.UnixTime64(1710000000e9), 1,
+				"comm", "", "", "", "", "")
+
+			profile, _, _ := r.getProfile()
+			require.Len(t, profile.Mapping, 1)
+			mapping := profile.Mapping[0]
+			assert.Equal(t, tc.buildID, profile.StringTable[mapping.BuildId], name)
+			assert.Equal(t, pprofextended.BuildIdKind_BUILD_ID_LINKER, mapping.BuildIdKind)
+
+			attributes := make(map[string]string)
+			for _, idx := range mapping.Attributes {
+				attr := profile.AttributeTable[idx]
+				attributes[attr.Key] = attr.Value.GetStringValue()
+			}
+			if tc.wantGNU {
+				assert.Equal(t, tc.buildID, attributes[gnuBuildIDAttributeKey], name)
+			} else {
+				assert.NotContains(t, attributes, gnuBuildIDAttributeKey, name)
+			}
+		})
+	}
+}
+
+func TestGetProfileFileAttributes(t *testing.T) {
+	executable := filepath.Join(t.TempDir(), "app")
+	require.NoError(t, os.WriteFile(executable, []byte("app"), 0o755))
+	var st unix.Stat_t
+	require.NoError(t, unix.Stat(executable, &st))
+
+	tests := map[string]struct {
+		fileName   string
+		wantInode  int64
+		wantDevice int64
+	}{
+		"existing file": {
+			fileName:   executable,
+			wantInode:  int64(st.Ino),
+			wantDevice: int64(st.Dev),
+		},
+		"missing file": {
+			fileName: filepath.Join(t.TempDir(), "missing"),
+		},
+		// Kernel modules are reported by their bare name.
+		"bare name": {
+			fileName: "app",
+		},
+	}
+
+	// The bare name must not resolve to the file in the working directory.
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(filepath.Dir(executable)))
+	t.Cleanup(func() { require.NoError(t, os.Chdir(wd)) })
+
+	for name, tc := range tests {
+		name := name
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			fileID := libpf.NewFileID(3, 4)
+			r := newTestOTLPReporter(t)
+			r.ExecutableMetadata(context.Background(), fileID, tc.fileName, "", false)
+
+			trace := &libpf.Trace{Hash: libpf.NewTraceHash(1, 2)}
+			trace.AppendFrame(libpf.NativeFrame, fileID, 0x1234)
+			r.ReportFramesForTrace(trace)
+			r.ReportCountForTrace(trace.Hash, libpf.UnixTime64(1710000000e9), 1,
+				"comm", "", "", "", "", "")
+
+			profile, _, _ := r.getProfile()
+			require.Len(t, profile.Mapping, 1)
+
+			attributes := make(map[string]int64)
+			for _, idx := range profile.Mapping[0].Attributes {
+				attr := profile.AttributeTable[idx]
+				attributes[attr.Key] = attr.Value.GetIntValue()
+			}
+			if tc.wantInode == 0 {
+				assert.NotContains(t, attributes, "file.inode", name)
+				assert.NotContains(t, attributes, "file.device", name)
+				return
+			}
+			assert.Equal(t, tc.wantInode, attributes["file.inode"], name)
+			assert.Equal(t, tc.wantDevice, attributes["file.device"], name)
+		})
+	}
+}
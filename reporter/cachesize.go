@@ -0,0 +1,123 @@
+/*
+ * Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+ * or more contributor license agreements. Licensed under the Apache License 2.0.
+ * See the file "LICENSE" for details.
+ */
+
+package reporter
+
+import (
+	"fmt"
+	"unsafe"
+
+	"github.com/elastic/otel-profiling-agent/debug/log"
+	"github.com/elastic/otel-profiling-agent/libpf"
+)
+
+// The following values are rough averages observed on typical hosts. They are
+// used to estimate the memory use of the dynamically sized parts of cache entries.
+const (
+	// estimatedFramesPerTrace is the average number of frames of a trace.
+	estimatedFramesPerTrace = 32
+	// estimatedTimestampsPerSample is the average number of timestamps of a
+	// sample within a reporting interval.
+	estimatedTimestampsPerSample = 4
+	// estimatedFramesPerFile is the average number of distinct frames per file.
+	estimatedFramesPerFile = 16
+	// estimatedStringLen is the average length of symbol names, file paths,
+	// build IDs and trace labels.
+	estimatedStringLen = 48
+	// estimatedFramesPerFallbackSymbol is the average number of frames that share
+	// a fallback symbol, as many addresses resolve to the same function.
+	estimatedFramesPerFallbackSymbol = 4
+	// lruEntryOverhead is the bookkeeping overhead of an LRU for every entry.
+	lruEntryOverhead = 32
+
+	// minCacheEntries is the smallest number of entries per cache that is
+	// still functional.
+	minCacheEntries = 256
+)
+
+// Estimated memory use in bytes of a single entry of the reporter caches.
+const (
+	traceEntrySize = lruEntryOverhead + unsafe.Sizeof(libpf.TraceHash{}) +
+		unsafe.Sizeof(traceInfo{}) + 5*estimatedStringLen +
+		estimatedFramesPerTrace*(unsafe.Sizeof(libpf.FileID{})+
+			unsafe.Sizeof(libpf.AddressOrLineno(0))+unsafe.Sizeof(libpf.FrameType(0))+
+			unsafe.Sizeof(libpf.JITTier(0)))
+	sampleEntrySize = lruEntryOverhead + unsafe.Sizeof(libpf.TraceHash{}) +
+		unsafe.Sizeof(sample{}) + estimatedTimestampsPerSample*unsafe.Sizeof(libpf.UnixTime64(0))
+	// The storage of fallback symbols is shared across the frames of a symbol,
+	// see internedSymbolEntrySize.
+	fallbackSymbolEntrySize = lruEntryOverhead + unsafe.Sizeof(libpf.FrameID{}) +
+		unsafe.Sizeof("") + internedSymbolEntrySize/estimatedFramesPerFallbackSymbol
+	executableEntrySize = lruEntryOverhead + unsafe.Sizeof(libpf.FileID{}) +
+		unsafe.Sizeof(execInfo{}) + 2*estimatedStringLen
+	framesEntrySize = lruEntryOverhead + unsafe.Sizeof(libpf.FileID{}) +
+		estimatedFramesPerFile*(unsafe.Sizeof(libpf.AddressOrLineno(0))+
+			unsafe.Sizeof(sourceInfo{})+2*estimatedStringLen)
+	internedSymbolEntrySize = lruEntryOverhead + 2*unsafe.Sizeof("") + estimatedStringLen
+)
+
+// cacheSizes holds the number of entries of each cache of OTLPReporter.
+type cacheSizes struct {
+	traces          uint32
+	samples         uint32
+	fallbackSymbols uint32
+	executables     uint32
+	frames          uint32
+}
+
+// newCacheSizes returns the number of entries of each cache. If memoryBudget
+// is zero, every cache holds defaultEntries entries. Otherwise, the budget in
+// bytes is divided across the caches based on the estimated size of their
+// entries, keeping the same number of entries for every cache.
+func newCacheSizes(defaultEntries uint32, memoryBudget uint64) (cacheSizes, error) {
+	entries := defaultEntries
+	if memoryBudget != 0 {
+		perEntry := uint64(traceEntrySize + sampleEntrySize + fallbackSymbolEntrySize +
+			executableEntrySize + framesEntrySize)
+		n := memoryBudget / perEntry
+		if n < minCacheEntries {
+			return cacheSizes{}, fmt.Errorf("cache memory budget of %d bytes is too small, "+
+				"at least %d bytes are required", memoryBudget, minCacheEntries*perEntry)
+		}
+		entries = uint32(min(n, uint64(^uint32(0))))
+	}
+
+	return cacheSizes{
+		traces:          entries,
+		samples:         entries,
+		fallbackSymbols: entries,
+		executables:     entries,
+		frames:          entries,
+	}, nil
+}
+
+// estimatedMemory returns the estimated memory use in bytes of all caches.
+func (s cacheSizes) estimatedMemory() uint64 {
+	return uint64(s.traces)*uint64(traceEntrySize) +
+		uint64(s.samples)*uint64(sampleEntrySize) +
+		uint64(s.fallbackSymbols)*uint64(fallbackSymbolEntrySize) +
+		uint64(s.executables)*uint64(executableEntrySize) +
+		uint64(s.frames)*uint64(framesEntrySize)
+}
+
+// log reports the number of entries and the estimated memory use of every cache.
+func (s cacheSizes) log() {
+	for _, c := range []struct {
+		name      string
+		entries   uint32
+		entrySize uintptr
+	}{
+		{"traces", s.traces, traceEntrySize},
+		{"samples", s.samples, sampleEntrySize},
+		{"fallback symbols", s.fallbackSymbols, fallbackSymbolEntrySize},
+		{"executables", s.executables, executableEntrySize},
+		{"frames", s.frames, framesEntrySize},
+	} {
+		log.Infof("Reporter cache for %s: %d entries (~%d KiB)", c.name, c.entries,
+			uint64(c.entries)*uint64(c.entrySize)/1024)
+	}
+	log.Infof("Reporter caches use ~%d MiB in total", s.estimatedMemory()>>20)
+}
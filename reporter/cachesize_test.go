@@ -0,0 +1,41 @@
+/*
+ * Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+ * or more contributor license agreements. Licensed under the Apache License 2.0.
+ * See the file "LICENSE" for details.
+ */
+
+package reporter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewCacheSizes(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		sizes, err := newCacheSizes(1024, 0)
+		require.NoError(t, err)
+		assert.Equal(t, cacheSizes{
+			traces:          1024,
+			samples:         1024,
+			fallbackSymbols: 1024,
+			executables:     1024,
+			frames:          1024,
+		}, sizes)
+	})
+
+	for _, budget := range []uint64{16 << 20, 64 << 20, 1 << 30} {
+		sizes, err := newCacheSizes(1024, budget)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, sizes.estimatedMemory(), budget)
+		// The budget should be used for the most part.
+		assert.Greater(t, sizes.estimatedMemory(), budget*9/10)
+	}
+
+	t.Run("too small", func(t *testing.T) {
+		_, err := newCacheSizes(1024, 1<<10)
+		assert.Error(t, err)
+	})
+}
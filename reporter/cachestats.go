@@ -0,0 +1,73 @@
+/*
+ * Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+ * or more contributor license agreements. Licensed under the Apache License 2.0.
+ * See the file "LICENSE" for details.
+ */
+
+package reporter
+
+import (
+	"github.com/elastic/otel-profiling-agent/debug/log"
+)
+
+// CacheStats describes the usage of a single cache of a reporter.
+// FreeLRU does not track hits and misses, so they are not reported.
+type CacheStats struct {
+	// Entries is the current number of entries.
+	Entries int
+	// Capacity is the maximum number of entries.
+	Capacity int
+	// Evictions is the number of entries that were evicted to make room for
+	// new entries since the last call of GetMetrics. It is only tracked for
+	// the traces and samples caches.
+	Evictions uint32
+}
+
+// Stats describes the usage of the caches of a reporter.
+type Stats struct {
+	Traces          CacheStats
+	Samples         CacheStats
+	Executables     CacheStats
+	Frames          CacheStats
+	FallbackSymbols CacheStats
+}
+
+// Stats implements the Reporter interface.
+func (r *OTLPReporter) Stats() Stats {
+	return Stats{
+		Traces: CacheStats{
+			Entries:   r.traces.Len(),
+			Capacity:  int(r.capacities.traces),
+			Evictions: r.traceEvictions.Load(),
+		},
+		Samples: CacheStats{
+			Entries:   r.samples.Len(),
+			Capacity:  int(r.capacities.samples),
+			Evictions: r.sampleEvictions.Load(),
+		},
+		Executables: CacheStats{
+			Entries:  r.executables.Len(),
+			Capacity: int(r.capacities.executables),
+		},
+		Frames: CacheStats{
+			Entries:  r.frames.Len(),
+			Capacity: int(r.capacities.frames),
+		},
+		FallbackSymbols: CacheStats{
+			Entries:  r.fallbackSymbols.Len(),
+			Capacity: int(r.capacities.fallbackSymbols),
+		},
+	}
+}
+
+// logStats logs the usage of the caches at debug level.
+func (r *OTLPReporter) logStats() {
+	s := r.Stats()
+	log.Debugf("Reporter caches: traces %d/%d (%d evicted), samples %d/%d (%d evicted), "+
+		"executables %d/%d, frames %d/%d, fallback symbols %d/%d",
+		s.Traces.Entries, s.Traces.Capacity, s.Traces.Evictions,
+		s.Samples.Entries, s.Samples.Capacity, s.Samples.Evictions,
+		s.Executables.Entries, s.Executables.Capacity,
+		s.Frames.Entries, s.Frames.Capacity,
+		s.FallbackSymbols.Entries, s.FallbackSymbols.Capacity)
+}
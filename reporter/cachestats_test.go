@@ -0,0 +1,61 @@
+/*
+ * Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+ * or more contributor license agreements. Licensed under the Apache License 2.0.
+ * See the file "LICENSE" for details.
+ */
+
+package reporter
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/otel-profiling-agent/libpf"
+)
+
+func TestStats(t *testing.T) {
+	r := newTestOTLPReporter(t)
+	r.capacities = cacheSizes{
+		traces:          1,
+		samples:         2,
+		fallbackSymbols: 3,
+		executables:     4,
+		frames:          5,
+	}
+
+	assert.Equal(t, Stats{
+		Traces:          CacheStats{Capacity: 1},
+		Samples:         CacheStats{Capacity: 2},
+		Executables:     CacheStats{Capacity: 4},
+		Frames:          CacheStats{Capacity: 5},
+		FallbackSymbols: CacheStats{Capacity: 3},
+	}, r.Stats())
+
+	for i := 0; i < 3; i++ {
+		trace := &libpf.Trace{Hash: libpf.NewTraceHash(uint64(i), 0)}
+		fileID := libpf.NewFileID(uint64(i), 4)
+		trace.AppendFrame(libpf.NativeFrame, fileID, 5)
+		r.ReportFramesForTrace(trace)
+		r.ReportCountForTrace(trace.Hash, libpf.UnixTime64(1710000000e9), 1,
+			"comm", "", "", "", "", "")
+		r.ExecutableMetadata(context.Background(), fileID, "/usr/bin/foo", "", false)
+	}
+	r.FrameMetadata(libpf.NewFileID(0, 4), 5, 10, 0, "foo", "foo.c")
+	r.FrameMetadata(libpf.NewFileID(1, 4), 5, 10, 0, "foo", "foo.c")
+	r.ReportFallbackSymbol(libpf.NewFrameID(libpf.NewFileID(0, 4), 5), "foo")
+
+	stats := r.Stats()
+	assert.Equal(t, 3, stats.Traces.Entries)
+	assert.Equal(t, 3, stats.Samples.Entries)
+	assert.Equal(t, 3, stats.Executables.Entries)
+	assert.Equal(t, 2, stats.Frames.Entries)
+	assert.Equal(t, 1, stats.FallbackSymbols.Entries)
+
+	// Reported samples are removed from the cache, their traces are kept.
+	r.getProfile()
+	stats = r.Stats()
+	assert.Equal(t, 3, stats.Traces.Entries)
+	assert.Zero(t, stats.Samples.Entries)
+}
@@ -0,0 +1,213 @@
+/*
+ * Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+ * or more contributor license agreements. Licensed under the Apache License 2.0.
+ * See the file "LICENSE" for details.
+ */
+
+package reporter
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/otel-profiling-agent/libpf"
+	otlpcollector "github.com/elastic/otel-profiling-agent/proto/experiments/opentelemetry/proto/collector/profiles/v1"
+)
+
+// fakeClock is a Clock whose time only passes with Advance.
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	tickers []*fakeTicker
+	// created and resets receive the period of every ticker that is created
+	// or reset, so that tests know when to advance the time.
+	created chan time.Duration
+	resets  chan time.Duration
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{
+		now:     now,
+		created: make(chan time.Duration, 1),
+		resets:  make(chan time.Duration, 1),
+	}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) NewTicker(d time.Duration) Ticker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTicker{clock: c, c: make(chan time.Time, 1), next: c.now.Add(d), period: d}
+	c.tickers = append(c.tickers, t)
+	c.created <- d
+	return t
+}
+
+// Advance moves the time forward by d and fires the tickers that are due. Like
+// with time.Ticker, ticks are dropped for receivers that are too slow.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	for _, t := range c.tickers {
+		if t.stopped || c.now.Before(t.next) {
+			continue
+		}
+		select {
+		case t.c <- c.now:
+		default:
+		}
+		t.next = c.now.Add(t.period)
+	}
+}
+
+// fakeTicker is a Ticker of a fakeClock.
+type fakeTicker struct {
+	clock   *fakeClock
+	c       chan time.Time
+	next    time.Time
+	period  time.Duration
+	stopped bool
+}
+
+func (t *fakeTicker) Chan() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTicker) Reset(d time.Duration) {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	t.next = t.clock.now.Add(d)
+	t.period = d
+	t.stopped = false
+	t.clock.resets <- d
+}
+
+func (t *fakeTicker) Stop() {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	t.stopped = true
+}
+
+func TestReportLoopFakeClock(t *testing.T) {
+	const (
+		reportInterval = 5 * time.Second
+		reports        = 3
+	)
+
+	clock := newFakeClock(time.Unix(1710000000, 0))
+	client := &notifyingProfilesClient{
+		exports: make(chan *otlpcollector.ExportProfilesServiceRequest, 1),
+	}
+	r := newTestOTLPReporterWithClient(t, client)
+	r.clock = clock
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan libpf.Void)
+	go func() {
+		r.reportLoop(ctx, reportInterval, 0)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	require.Equal(t, reportInterval, <-clock.created)
+
+	reportSample := func(i int) {
+		trace := &libpf.Trace{Hash: libpf.NewTraceHash(uint64(i), 2)}
+		trace.AppendFrame(libpf.KernelFrame, libpf.NewFileID(3, 4), libpf.AddressOrLineno(i))
+		r.ReportFramesForTrace(trace)
+		r.ReportCountForTrace(trace.Hash, libpf.UnixTime64(clock.Now().UnixNano()), 1,
+			"comm", "", "", "", "", "")
+	}
+	noExport := func() {
+		select {
+		case <-client.exports:
+			t.Fatal("Unexpected report")
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	for i := 0; i < reports; i++ {
+		reportSample(i)
+		// No report before the interval passed.
+		clock.Advance(reportInterval - time.Second)
+		noExport()
+
+		clock.Advance(time.Second)
+		var req *otlpcollector.ExportProfilesServiceRequest
+		select {
+		case req = <-client.exports:
+		case <-time.After(10 * time.Second):
+			t.Fatalf("No report %d", i+1)
+		}
+		require.Len(t, req.ResourceProfiles, 1)
+		profile := req.ResourceProfiles[0].ScopeProfiles[0].Profiles[0].Profile
+		require.Len(t, profile.Sample, 1)
+		// The report windows are exact, as the time only passes with the clock.
+		assert.Equal(t, reportInterval.Nanoseconds(), profile.DurationNanos)
+		require.Equal(t, reportInterval, <-clock.resets)
+	}
+
+	// Without samples, no further reports are sent.
+	clock.Advance(reportInterval)
+	noExport()
+}
+
+func TestAwaitTraceInfoFakeClock(t *testing.T) {
+	const gracePeriod = 20 * time.Millisecond
+
+	clock := newFakeClock(time.Unix(1710000000, 0))
+	r := newTestOTLPReporter(t)
+	r.clock = clock
+	r.traceInfoGracePeriod = gracePeriod
+	r.traceInfoGraceLeft = gracePeriod
+
+	// Samples whose trace information is not cached (yet).
+	late := &libpf.Trace{Hash: libpf.NewTraceHash(1, 2)}
+	late.AppendFrame(libpf.KernelFrame, libpf.UnknownKernelFileID, 0x1234)
+	lost := libpf.NewTraceHash(3, 4)
+	for _, hash := range []libpf.TraceHash{late.Hash, lost} {
+		r.addSample(hash, sample{count: 1, timestamps: []libpf.UnixTime64{1710000000e9}})
+	}
+
+	collected := make(chan map[libpf.TraceHash]sample)
+	go func() {
+		collected <- r.collectSamples()
+	}()
+
+	// The trace information of one sample arrives during the grace period.
+	assert.Equal(t, traceInfoGracePollInterval, <-clock.created)
+	r.ReportFramesForTrace(late)
+	clock.Advance(traceInfoGracePollInterval)
+	clock.Advance(gracePeriod - traceInfoGracePollInterval)
+
+	samples := <-collected
+	assert.Contains(t, samples, late.Hash)
+	assert.NotContains(t, samples, lost)
+	assert.Equal(t, uint32(1), r.traceInfoGraceRecovered.Load())
+	assert.Zero(t, r.traceInfoGraceLeft)
+
+	// Further reports of the same interval do not wait anymore.
+	samples = r.collectSamples()
+	assert.Empty(t, samples)
+	select {
+	case d := <-clock.created:
+		t.Fatalf("unexpected ticker with period %v", d)
+	default:
+	}
+	s, ok := r.samples.Peek(lost)
+	require.True(t, ok)
+	assert.Equal(t, uint32(2), s.missedReports)
+}
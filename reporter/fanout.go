@@ -0,0 +1,123 @@
+/*
+ * Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+ * or more contributor license agreements. Licensed under the Apache License 2.0.
+ * See the file "LICENSE" for details.
+ */
+
+package reporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"google.golang.org/grpc"
+
+	"github.com/elastic/otel-profiling-agent/debug/log"
+	otlpcollector "github.com/elastic/otel-profiling-agent/proto/experiments/opentelemetry/proto/collector/profiles/v1"
+)
+
+// endpointClient is the client for a single backend.
+type endpointClient struct {
+	addr   string
+	client otlpcollector.ProfilesServiceClient
+}
+
+// fanOutProfilesClient sends every export to all of its backends concurrently.
+type fanOutProfilesClient struct {
+	endpoints []endpointClient
+	// failures counts the exports to single backends that failed while others
+	// succeeded.
+	failures atomic.Uint32
+}
+
+// Export implements the otlpcollector.ProfilesServiceClient interface. A failing
+// backend does not keep the request from the others. Its error is logged and
+// counted, and only if all backends failed, their errors are returned together.
+// Otherwise, the response of the first backend that succeeded is returned.
+func (f *fanOutProfilesClient) Export(ctx context.Context,
+	in *otlpcollector.ExportProfilesServiceRequest, opts ...grpc.CallOption) (
+	*otlpcollector.ExportProfilesServiceResponse, error) {
+	resps := make([]*otlpcollector.ExportProfilesServiceResponse, len(f.endpoints))
+	errs := make([]error, len(f.endpoints))
+
+	var wg sync.WaitGroup
+	for i, e := range f.endpoints {
+		wg.Add(1)
+		go func(i int, e endpointClient) {
+			defer wg.Done()
+			resp, err := e.client.Export(ctx, in, opts...)
+			if err != nil {
+				errs[i] = fmt.Errorf("export to %s: %w", e.addr, err)
+				return
+			}
+			resps[i] = resp
+		}(i, e)
+	}
+	wg.Wait()
+
+	var resp *otlpcollector.ExportProfilesServiceResponse
+	for _, r := range resps {
+		if r != nil {
+			resp = r
+			break
+		}
+	}
+	if resp == nil {
+		return nil, errors.Join(errs...)
+	}
+
+	for _, err := range errs {
+		if err != nil {
+			log.Warnf("Export failed for one of several collectors: %v", err)
+			f.failures.Add(1)
+		}
+	}
+	return resp, nil
+}
+
+// failureCount returns the number of exports to single backends that failed
+// while others succeeded, and resets it.
+func (f *fanOutProfilesClient) failureCount() uint32 {
+	if f == nil {
+		return 0
+	}
+	return f.failures.Swap(0)
+}
+
+// profilesClient returns the client for the backends of f. The fan-out is only
+// used for more than one backend.
+func (f *fanOutProfilesClient) profilesClient() otlpcollector.ProfilesServiceClient {
+	if len(f.endpoints) == 1 {
+		return f.endpoints[0].client
+	}
+	return f
+}
+
+// closeGrpcConns closes conns and logs errors.
+func closeGrpcConns(conns []*grpc.ClientConn) {
+	for _, conn := range conns {
+		if err := conn.Close(); err != nil {
+			log.Warnf("Failed to close gRPC connection to %s: %v", conn.Target(), err)
+		}
+	}
+}
+
+// collectorAddrs returns the addresses of all backends that profiles are sent to.
+// CollAgentAddr is always the first, empty and duplicate addresses are skipped.
+func collectorAddrs(c *Config) []string {
+	addrs := []string{c.CollAgentAddr}
+	seen := map[string]bool{c.CollAgentAddr: true}
+	for _, addr := range c.ExtraCollAgentAddrs {
+		addr = strings.TrimSpace(addr)
+		if addr == "" || seen[addr] {
+			continue
+		}
+		seen[addr] = true
+		addrs = append(addrs, addr)
+	}
+	return addrs
+}
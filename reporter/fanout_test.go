@@ -0,0 +1,158 @@
+/*
+ * Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+ * or more contributor license agreements. Licensed under the Apache License 2.0.
+ * See the file "LICENSE" for details.
+ */
+
+package reporter
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/elastic/otel-profiling-agent/libpf"
+	otlpcollector "github.com/elastic/otel-profiling-agent/proto/experiments/opentelemetry/proto/collector/profiles/v1"
+	profiles "github.com/elastic/otel-profiling-agent/proto/experiments/opentelemetry/proto/profiles/v1"
+)
+
+// failingProfilesClient fails every Export call.
+type failingProfilesClient struct{}
+
+func (failingProfilesClient) Export(context.Context, *otlpcollector.ExportProfilesServiceRequest,
+	...grpc.CallOption) (*otlpcollector.ExportProfilesServiceResponse, error) {
+	return nil, errors.New("unavailable")
+}
+
+func TestFanOutProfilesClient(t *testing.T) {
+	first := &fakeProfilesClient{}
+	second := &fakeProfilesClient{}
+	client := &fanOutProfilesClient{endpoints: []endpointClient{
+		{addr: "first:4317", client: first},
+		{addr: "broken:4317", client: failingProfilesClient{}},
+		{addr: "second:4317", client: second},
+	}}
+
+	// The failing backend does not fail the export, but is counted.
+	resp, err := client.Export(context.Background(), &otlpcollector.ExportProfilesServiceRequest{})
+	require.NoError(t, err)
+	assert.NotNil(t, resp)
+	assert.Equal(t, uint32(1), client.failureCount())
+	assert.Zero(t, client.failureCount())
+
+	// The failing backend does not keep the others from receiving the profile.
+	assert.Equal(t, 1, first.exports)
+	assert.Equal(t, 1, second.exports)
+
+	// Only if all backends fail, their errors are returned.
+	broken := &fanOutProfilesClient{endpoints: []endpointClient{
+		{addr: "broken:4317", client: failingProfilesClient{}},
+		{addr: "other:4317", client: failingProfilesClient{}},
+	}}
+	resp, err = broken.Export(context.Background(), &otlpcollector.ExportProfilesServiceRequest{})
+	require.Error(t, err)
+	assert.Nil(t, resp)
+	assert.Contains(t, err.Error(), "broken:4317")
+	assert.Contains(t, err.Error(), "other:4317")
+	assert.Zero(t, broken.failureCount())
+}
+
+func TestFanOutProfilesClientSingleBackend(t *testing.T) {
+	single := &fakeProfilesClient{}
+	client := &fanOutProfilesClient{endpoints: []endpointClient{
+		{addr: "only:4317", client: single},
+	}}
+	assert.Same(t, single, client.profilesClient())
+}
+
+func TestReportOTLPProfileMaxRequestSizeFailingEndpoint(t *testing.T) {
+	healthy := &fakeProfilesClient{}
+	client := &fanOutProfilesClient{endpoints: []endpointClient{
+		{addr: "broken:4317", client: failingProfilesClient{}},
+		{addr: "healthy:4317", client: healthy},
+	}}
+	r := newTestOTLPReporterWithClient(t, client)
+	r.fanOut = client
+	// Every tenant is sent in its own request.
+	tenants, err := newTenantResolver(nil, `^([a-z]+)-`)
+	require.NoError(t, err)
+	r.tenants = tenants
+	r.maxRequestSize = 1
+
+	pods := []string{"shop-1", "invoice-1", "search-1"}
+	for i, pod := range pods {
+		trace := &libpf.Trace{Hash: libpf.NewTraceHash(uint64(i), 0)}
+		trace.AppendFrame(libpf.KernelFrame, libpf.NewFileID(3, 4), 5)
+		r.ReportFramesForTrace(trace)
+		r.ReportCountForTrace(trace.Hash, libpf.UnixTime64(1710000000e9), 1,
+			"comm", pod, "default", "", "", "")
+	}
+
+	// All batches reach the healthy backend, and the export succeeds.
+	require.NoError(t, r.reportOTLPProfile(context.Background(), 5*time.Second))
+	assert.Equal(t, len(pods), healthy.exports)
+	assert.Equal(t, uint32(len(pods)), r.GetMetrics().ExportEndpointFailedCount)
+}
+
+func TestFanOutHTTPEndpoints(t *testing.T) {
+	want := &otlpcollector.ExportProfilesServiceRequest{
+		ResourceProfiles: []*profiles.ResourceProfiles{{SchemaUrl: DefaultSchemaURL}},
+	}
+
+	var received atomic.Int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		var got otlpcollector.ExportProfilesServiceRequest
+		assert.NoError(t, proto.Unmarshal(body, &got))
+		assert.True(t, proto.Equal(want, &got), "unexpected request: %v", &got)
+		received.Add(1)
+
+		resp, err := proto.Marshal(&otlpcollector.ExportProfilesServiceResponse{})
+		assert.NoError(t, err)
+		w.Header().Set("Content-Type", otlpHTTPContentType)
+		_, _ = w.Write(resp)
+	})
+	local := httptest.NewServer(handler)
+	defer local.Close()
+	central := httptest.NewServer(handler)
+	defer central.Close()
+
+	stats := newStatsHandler()
+	client := &fanOutProfilesClient{}
+	for _, srv := range []*httptest.Server{local, central} {
+		addr := strings.TrimPrefix(srv.URL, "http://")
+		client.endpoints = append(client.endpoints, endpointClient{
+			addr:   addr,
+			client: newHTTPProfilesClient(addr, nil, nil, 5*time.Second, stats),
+		})
+	}
+
+	_, err := client.Export(context.Background(), want)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), received.Load())
+	// The statistics cover both backends.
+	assert.Equal(t, 2*int64(proto.Size(want)), stats.getWireBytesOut())
+}
+
+func TestCollectorAddrs(t *testing.T) {
+	assert.Equal(t, []string{"local:4317"}, collectorAddrs(&Config{
+		CollAgentAddr:       "local:4317",
+		ExtraCollAgentAddrs: []string{""},
+	}))
+	assert.Equal(t, []string{"local:4317", "central:4317"}, collectorAddrs(&Config{
+		CollAgentAddr:       "local:4317",
+		ExtraCollAgentAddrs: []string{" central:4317", "local:4317", "central:4317"},
+	}))
+}
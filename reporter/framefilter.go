@@ -0,0 +1,72 @@
+/*
+ * Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+ * or more contributor license agreements. Licensed under the Apache License 2.0.
+ * See the file "LICENSE" for details.
+ */
+
+package reporter
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/elastic/otel-profiling-agent/symuploader"
+)
+
+// framePathFilter decides based on the path of an executable whether its frames
+// are omitted from profiles.
+type framePathFilter struct {
+	// prefixes are matched against the start of the path.
+	prefixes []string
+	// globs are matched against the whole path with filepath.Match.
+	globs []string
+}
+
+// newFramePathFilter returns a filter that matches executables whose path starts
+// with one of patterns, or matches one of patterns if it contains any of the
+// glob characters '*', '?' or '['. Empty patterns are ignored. It returns nil if
+// no patterns are given.
+func newFramePathFilter(patterns []string) (*framePathFilter, error) {
+	f := &framePathFilter{}
+	for _, p := range patterns {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if !strings.ContainsAny(p, "*?[") {
+			f.prefixes = append(f.prefixes, p)
+			continue
+		}
+		if _, err := filepath.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid frame path pattern %q: %v", p, err)
+		}
+		f.globs = append(f.globs, p)
+	}
+	if len(f.prefixes) == 0 && len(f.globs) == 0 {
+		return nil, nil
+	}
+	return f, nil
+}
+
+// omit returns whether the frames of the executable at path are omitted. Paths
+// of the form /proc/<pid>/root/<path> are matched by the path within the mount
+// namespace of the process.
+func (f *framePathFilter) omit(path string) bool {
+	if f == nil {
+		return false
+	}
+
+	path = symuploader.ExecutablePath(path)
+	for _, prefix := range f.prefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	for _, glob := range f.globs {
+		if ok, _ := filepath.Match(glob, path); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+/*
+ * Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+ * or more contributor license agreements. Licensed under the Apache License 2.0.
+ * See the file "LICENSE" for details.
+ */
+
+package reporter
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/otel-profiling-agent/libpf"
+)
+
+func TestFramePathFilter(t *testing.T) {
+	filter, err := newFramePathFilter([]string{" /usr/lib/ld-linux", "", "/opt/*/lib/*.so"})
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		path string
+		want bool
+	}{
+		"prefix":         {path: "/usr/lib/ld-linux-x86-64.so.2", want: true},
+		"procRootPrefix": {path: "/proc/42/root/usr/lib/ld-linux-aarch64.so.1", want: true},
+		"glob":           {path: "/opt/app/lib/libfoo.so", want: true},
+		"globNoMatch":    {path: "/opt/app/lib/sub/libfoo.so", want: false},
+		"noMatch":        {path: "/usr/lib/libc.so.6", want: false},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.want, filter.omit(tc.path))
+		})
+	}
+}
+
+func TestNewFramePathFilter(t *testing.T) {
+	filter, err := newFramePathFilter([]string{""})
+	require.NoError(t, err)
+	assert.Nil(t, filter)
+	assert.False(t, filter.omit("/usr/lib/libc.so.6"))
+
+	_, err = newFramePathFilter([]string{"/usr/lib/[a-"})
+	assert.Error(t, err)
+}
+
+func TestGetProfileOmitFramePaths(t *testing.T) {
+	r := newTestOTLPReporter(t)
+	filter, err := newFramePathFilter([]string{"/usr/lib/ld-linux"})
+	require.NoError(t, err)
+	r.framePaths = filter
+
+	executables := []string{
+		"/usr/lib/libc.so.6",
+		"/usr/lib/ld-linux-x86-64.so.2",
+		"/usr/bin/app",
+	}
+	trace := &libpf.Trace{Hash: libpf.NewTraceHash(1, 2)}
+	for i, exe := range executables {
+		fileID := libpf.NewFileID(uint64(i+1), 0)
+		r.ExecutableMetadata(context.Background(), fileID, exe, "", false)
+		trace.AppendFrame(libpf.NativeFrame, fileID, libpf.AddressOrLineno(0x100*(i+1)))
+	}
+	r.ReportFramesForTrace(trace)
+	r.ReportCountForTrace(trace.Hash, libpf.UnixTime64(1710000000e9), 1,
+		"app", "", "", "", "", "")
+
+	profile, _, _ := r.getProfile()
+	require.Len(t, profile.Sample, 1)
+	locs := sampleLocations(profile, profile.Sample[0])
+	require.Len(t, locs, 2)
+
+	var got []string
+	for _, loc := range locs {
+		mapping := profile.Mapping[loc.MappingIndex-1]
+		got = append(got, profile.StringTable[mapping.Filename])
+	}
+	assert.Equal(t, []string{"libc.so.6", "app"}, got)
+	assert.Equal(t, uint64(0x100), locs[0].Address)
+	assert.Equal(t, uint64(0x300), locs[1].Address)
+}
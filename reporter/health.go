@@ -0,0 +1,85 @@
+/*
+ * Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+ * or more contributor license agreements. Licensed under the Apache License 2.0.
+ * See the file "LICENSE" for details.
+ */
+
+package reporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"google.golang.org/grpc"
+
+	otlpcollector "github.com/elastic/otel-profiling-agent/proto/experiments/opentelemetry/proto/collector/profiles/v1"
+)
+
+var (
+	// ErrNeverConnected is returned by Ready if the collector was not reached yet.
+	ErrNeverConnected = errors.New("collector was not reached yet")
+	// ErrExportFailed is returned by Ready if the collector was reached before,
+	// but the last export failed.
+	ErrExportFailed = errors.New("last export failed")
+)
+
+// healthProfilesClient records the outcome of the exports to its client, so that
+// orchestrators can check whether the collector is reachable.
+type healthProfilesClient struct {
+	client otlpcollector.ProfilesServiceClient
+
+	mu sync.Mutex
+	// connected is set once a connection was established or an export succeeded.
+	connected bool
+	// lastErr is the error of the last export.
+	lastErr error
+}
+
+func newHealthProfilesClient(client otlpcollector.ProfilesServiceClient) *healthProfilesClient {
+	return &healthProfilesClient{client: client}
+}
+
+// Export implements the otlpcollector.ProfilesServiceClient interface.
+func (h *healthProfilesClient) Export(ctx context.Context,
+	in *otlpcollector.ExportProfilesServiceRequest, opts ...grpc.CallOption) (
+	*otlpcollector.ExportProfilesServiceResponse, error) {
+	resp, err := h.client.Export(ctx, in, opts...)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastErr = err
+	if err == nil {
+		h.connected = true
+	}
+	return resp, err
+}
+
+// markConnected records that a connection to the collector was established.
+func (h *healthProfilesClient) markConnected() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.connected = true
+}
+
+// ready returns whether the collector is reachable, see OTLPReporter.Ready.
+func (h *healthProfilesClient) ready() (bool, error) {
+	if h == nil {
+		// There is no collector to reach.
+		return true, nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	switch {
+	case !h.connected && h.lastErr != nil:
+		return false, fmt.Errorf("%w: %v", ErrNeverConnected, h.lastErr)
+	case !h.connected:
+		return false, ErrNeverConnected
+	case h.lastErr != nil:
+		return false, fmt.Errorf("%w: %v", ErrExportFailed, h.lastErr)
+	default:
+		return true, nil
+	}
+}
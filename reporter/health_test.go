@@ -0,0 +1,83 @@
+/*
+ * Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+ * or more contributor license agreements. Licensed under the Apache License 2.0.
+ * See the file "LICENSE" for details.
+ */
+
+package reporter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/otel-profiling-agent/libpf"
+)
+
+func TestReady(t *testing.T) {
+	const interval = 5 * time.Second
+
+	r := newTestOTLPReporter(t)
+	client := &flakyProfilesClient{down: true}
+	r.health = newHealthProfilesClient(client)
+	r.client = r.health
+
+	trace := &libpf.Trace{Hash: libpf.NewTraceHash(1, 2)}
+	trace.AppendFrame(libpf.KernelFrame, libpf.NewFileID(3, 4), 5)
+	r.ReportFramesForTrace(trace)
+	reportSample := func() {
+		r.ReportCountForTrace(trace.Hash, libpf.UnixTime64(1710000000e9), 1,
+			"comm", "", "", "", "", "")
+		r.report(context.Background(), interval)
+	}
+
+	// Before any export, the collector was never reached.
+	ready, err := r.Ready()
+	assert.False(t, ready)
+	require.ErrorIs(t, err, ErrNeverConnected)
+
+	// A failed export without a prior connection still was never connected.
+	reportSample()
+	ready, err = r.Ready()
+	assert.False(t, ready)
+	require.ErrorIs(t, err, ErrNeverConnected)
+	assert.NotErrorIs(t, err, ErrExportFailed)
+
+	client.down = false
+	reportSample()
+	ready, err = r.Ready()
+	assert.True(t, ready)
+	require.NoError(t, err)
+
+	// Once connected, a failed export is reported as such.
+	client.down = true
+	reportSample()
+	ready, err = r.Ready()
+	assert.False(t, ready)
+	require.ErrorIs(t, err, ErrExportFailed)
+	assert.NotErrorIs(t, err, ErrNeverConnected)
+
+	client.down = false
+	reportSample()
+	ready, err = r.Ready()
+	assert.True(t, ready)
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 1, 1, 1}, client.requests)
+}
+
+func TestReadyConnected(t *testing.T) {
+	h := newHealthProfilesClient(&flakyProfilesClient{})
+	h.markConnected()
+	ready, err := h.ready()
+	assert.True(t, ready)
+	require.NoError(t, err)
+
+	// Without a collector, the reporter is always ready.
+	var none *healthProfilesClient
+	ready, err = none.ready()
+	assert.True(t, ready)
+	require.NoError(t, err)
+}
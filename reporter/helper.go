@@ -10,44 +10,36 @@ import (
 	"context"
 	"crypto/tls"
 	"os"
-	"strings"
 	"time"
 
-	"github.com/elastic/otel-profiling-agent/config"
 	"github.com/elastic/otel-profiling-agent/libpf"
 	log "github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
 	"google.golang.org/grpc/status"
 )
 
-type perRequestBearerToken struct {
-	token    string
-	insecure bool
-}
-
-func NewPerRequestBearerToken(token string, insecure bool) *perRequestBearerToken {
-	return &perRequestBearerToken{
-		token:    token,
-		insecure: insecure,
-	}
-}
-
-func (t *perRequestBearerToken) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
-	return map[string]string{
-		"authorization": "Bearer " + t.token,
-	}, nil
+// setupGrpcConnection sets up a gRPC connection to addr instrumented with our auth
+// interceptor using tlsConfig for transport security. If tlsConfig is nil, the
+// connection is not encrypted. If set, rpcCreds are attached to every RPC.
+func setupGrpcConnection(parent context.Context, c *Config, addr string, tlsConfig *tls.Config,
+	rpcCreds *perRPCCredentials, statsHandler *statsHandlerImpl) (*grpc.ClientConn, error) {
+	ctx, cancel := context.WithTimeout(parent, c.Times.GRPCConnectionTimeout())
+	defer cancel()
+	return grpc.DialContext(ctx, addr,
+		grpcDialOptions(parent, c, tlsConfig, rpcCreds, statsHandler)...)
 }
 
-func (t *perRequestBearerToken) RequireTransportSecurity() bool {
-	return !t.insecure
-}
+// withKeepaliveParams returns the dial option of the keepalive parameters. It is
+// replaced in tests, as the dial options can not be inspected.
+var withKeepaliveParams = grpc.WithKeepaliveParams
 
-// setupGrpcConnection sets up a gRPC connection instrumented with our auth interceptor
-func setupGrpcConnection(parent context.Context, c *Config,
-	statsHandler *statsHandlerImpl) (*grpc.ClientConn, error) {
+// grpcDialOptions returns the options setupGrpcConnection dials with.
+func grpcDialOptions(parent context.Context, c *Config, tlsConfig *tls.Config,
+	rpcCreds *perRPCCredentials, statsHandler *statsHandlerImpl) []grpc.DialOption {
 	// authGrpcInterceptor intercepts gRPC operations, adds metadata to each operation and
 	// checks for authentication errors. If an authentication error is encountered, a
 	// process exit is triggered.
@@ -79,59 +71,69 @@ func setupGrpcConnection(parent context.Context, c *Config,
 		grpc.WithReturnConnectionError(),
 	}
 
-	if c.DisableTLS {
+	if tlsConfig == nil {
 		opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	} else {
 		opts = append(opts,
-			grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
-				// Support only TLS1.3+ with valid CA certificates
-				MinVersion:         tls.VersionTLS13,
-				InsecureSkipVerify: false,
-			})))
+			grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
 	}
 
-	if config.SecretToken() != "" {
-		opts = append(opts, grpc.WithPerRPCCredentials(
-			NewPerRequestBearerToken(strings.TrimSpace(string(config.SecretToken())), c.DisableTLS),
-		))
+	if rpcCreds != nil {
+		opts = append(opts, grpc.WithPerRPCCredentials(rpcCreds))
 	}
 
-	ctx, cancel := context.WithTimeout(parent, c.Times.GRPCConnectionTimeout())
-	defer cancel()
-	return grpc.DialContext(ctx, c.CollAgentAddr, opts...)
+	if kp, ok := keepaliveParams(c); ok {
+		opts = append(opts, withKeepaliveParams(kp))
+	}
+
+	return opts
+}
+
+// keepaliveParams returns the keepalive parameters of the gRPC connections, and
+// whether keepalive pings are enabled at all.
+func keepaliveParams(c *Config) (keepalive.ClientParameters, bool) {
+	if c.GRPCKeepaliveTime <= 0 {
+		return keepalive.ClientParameters{}, false
+	}
+	return keepalive.ClientParameters{
+		Time:                c.GRPCKeepaliveTime,
+		Timeout:             c.GRPCKeepaliveTimeout,
+		PermitWithoutStream: c.GRPCKeepaliveWithoutStream,
+	}, true
 }
 
 // When we are not able to connect immediately to the backend,
 // we will wait forever until a connection happens and we receive a response,
 // or the operation is canceled.
-func waitGrpcEndpoint(ctx context.Context, c *Config,
-	statsHandler *statsHandlerImpl) (*grpc.ClientConn, error) {
+func waitGrpcEndpoint(ctx context.Context, c *Config, addr string, tlsConfig *tls.Config,
+	rpcCreds *perRPCCredentials, statsHandler *statsHandlerImpl) (*grpc.ClientConn, error) {
 	// Sleep with a fixed backoff time added of +/- 20% jitter
 	tick := time.NewTicker(libpf.AddJitter(c.Times.GRPCStartupBackoffTime(), 0.2))
 	defer tick.Stop()
 
 	var retries uint32
 	for {
-		if collAgentConn, err := setupGrpcConnection(ctx, c, statsHandler); err != nil {
-			if retries >= c.MaxGRPCRetries {
-				return nil, err
-			}
-			retries++
-
-			log.Warnf(
-				"Failed to setup gRPC connection (try %d of %d): %v",
-				retries,
-				c.MaxGRPCRetries,
-				err,
-			)
-			select {
-			case <-ctx.Done():
-				return nil, ctx.Err()
-			case <-tick.C:
-				continue
-			}
-		} else {
+		collAgentConn, err := setupGrpcConnection(ctx, c, addr, tlsConfig, rpcCreds,
+			statsHandler)
+		if err == nil {
 			return collAgentConn, nil
 		}
+		if retries >= c.MaxGRPCRetries {
+			return nil, err
+		}
+		retries++
+
+		log.Warnf(
+			"Failed to setup gRPC connection to %s (try %d of %d): %v",
+			addr,
+			retries,
+			c.MaxGRPCRetries,
+			err,
+		)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-tick.C:
+		}
 	}
 }
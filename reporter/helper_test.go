@@ -0,0 +1,72 @@
+/*
+ * Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+ * or more contributor license agreements. Licensed under the Apache License 2.0.
+ * See the file "LICENSE" for details.
+ */
+
+package reporter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+)
+
+func TestGrpcDialOptionsKeepalive(t *testing.T) {
+	tests := map[string]struct {
+		config  Config
+		want    keepalive.ClientParameters
+		enabled bool
+	}{
+		"disabled": {
+			config: Config{GRPCKeepaliveTimeout: 5 * time.Second},
+		},
+		"time only": {
+			config:  Config{GRPCKeepaliveTime: 30 * time.Second},
+			want:    keepalive.ClientParameters{Time: 30 * time.Second},
+			enabled: true,
+		},
+		"all parameters": {
+			config: Config{
+				GRPCKeepaliveTime:          time.Minute,
+				GRPCKeepaliveTimeout:       10 * time.Second,
+				GRPCKeepaliveWithoutStream: true,
+			},
+			want: keepalive.ClientParameters{
+				Time:                time.Minute,
+				Timeout:             10 * time.Second,
+				PermitWithoutStream: true,
+			},
+			enabled: true,
+		},
+	}
+
+	var dialed []keepalive.ClientParameters
+	withKeepaliveParams = func(kp keepalive.ClientParameters) grpc.DialOption {
+		dialed = append(dialed, kp)
+		return grpc.WithKeepaliveParams(kp)
+	}
+	t.Cleanup(func() { withKeepaliveParams = grpc.WithKeepaliveParams })
+	disabled := len(grpcDialOptions(context.Background(), &Config{}, nil, nil, nil))
+
+	for name, tc := range tests {
+		name := name
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			dialed = nil
+			opts := grpcDialOptions(context.Background(), &tc.config, nil, nil, nil)
+			if !tc.enabled {
+				assert.Len(t, opts, disabled, name)
+				assert.Empty(t, dialed, name)
+				return
+			}
+			// The keepalive parameters are added as one more dial option.
+			assert.Len(t, opts, disabled+1, name)
+			assert.Equal(t, []keepalive.ClientParameters{tc.want}, dialed, name)
+		})
+	}
+}
@@ -0,0 +1,42 @@
+/*
+ * Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+ * or more contributor license agreements. Licensed under the Apache License 2.0.
+ * See the file "LICENSE" for details.
+ */
+
+package reporter
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// IdleSamplesKeep reports samples of the idle task like any other sample.
+	IdleSamplesKeep = "keep"
+	// IdleSamplesLabel adds the label "cpu.state" with the value "idle" to
+	// samples of the idle task.
+	IdleSamplesLabel = "label"
+	// IdleSamplesDrop does not report samples of the idle task.
+	IdleSamplesDrop = "drop"
+
+	// idleComm is the name of the idle task. The kernel names the idle task
+	// of every CPU "swapper/<cpu>".
+	idleComm = "swapper"
+)
+
+// validateIdleSamplesMode returns an error if mode is not a known way to handle
+// samples of the idle task.
+func validateIdleSamplesMode(mode string) error {
+	switch mode {
+	case IdleSamplesKeep, IdleSamplesLabel, IdleSamplesDrop, "":
+		return nil
+	default:
+		return fmt.Errorf("unsupported idle samples mode: %s", mode)
+	}
+}
+
+// isIdleComm returns true if comm is the name of the idle task.
+func isIdleComm(comm string) bool {
+	return comm == idleComm || strings.HasPrefix(comm, idleComm+"/")
+}
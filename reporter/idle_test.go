@@ -0,0 +1,29 @@
+/*
+ * Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+ * or more contributor license agreements. Licensed under the Apache License 2.0.
+ * See the file "LICENSE" for details.
+ */
+
+package reporter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsIdleComm(t *testing.T) {
+	assert.True(t, isIdleComm("swapper"))
+	assert.True(t, isIdleComm("swapper/0"))
+	assert.True(t, isIdleComm("swapper/127"))
+	assert.False(t, isIdleComm("swapperd"))
+	assert.False(t, isIdleComm("kworker/0:1"))
+	assert.False(t, isIdleComm(""))
+}
+
+func TestValidateIdleSamplesMode(t *testing.T) {
+	for _, mode := range []string{"", IdleSamplesKeep, IdleSamplesLabel, IdleSamplesDrop} {
+		assert.NoError(t, validateIdleSamplesMode(mode))
+	}
+	assert.Error(t, validateIdleSamplesMode("ignore"))
+}
@@ -30,6 +30,7 @@ type Times interface {
 // Reporter is the top-level interface implemented by a full reporter.
 type Reporter interface {
 	TraceReporter
+	AllocationReporter
 	SymbolReporter
 	HostMetadataReporter
 	MetricsReporter
@@ -38,6 +39,29 @@ type Reporter interface {
 	Stop()
 	// GetMetrics returns the reporter internal metrics.
 	GetMetrics() Metrics
+	// Stats returns the current usage of the reporter caches.
+	Stats() Stats
+
+	// ReportCompleteTrace accepts a trace with its frames together with its
+	// count and origin in a single call. The TraceHash of count is ignored in
+	// favor of the hash of trace. It is intended for tooling like integration
+	// tests and the replay of recorded profiles, which have the complete trace
+	// at hand, and not for the hot path of the agent.
+	ReportCompleteTrace(trace *libpf.Trace, count TraceCount)
+}
+
+// TraceCount is the count of a trace that is reported with ReportCounts, with
+// the same information as the arguments of ReportCountForTrace.
+type TraceCount struct {
+	TraceHash     libpf.TraceHash
+	Timestamp     libpf.UnixTime64
+	Count         uint16
+	Comm          string
+	PodName       string
+	PodNamespace  string
+	ContainerName string
+	ContainerID   string
+	ThreadName    string
 }
 
 type TraceReporter interface {
@@ -47,8 +71,32 @@ type TraceReporter interface {
 
 	// ReportCountForTrace accepts a hash of a trace with a corresponding count and
 	// caches this information before a periodic reporting to the backend.
-	ReportCountForTrace(traceHash libpf.TraceHash, timestamp libpf.UnixTime32,
-		count uint16, comm, podName, podNamespace, containerName string)
+	// Callers that only have a libpf.UnixTime32 can convert it with
+	// libpf.UnixTime32.UnixTime64(). The threadName is optional and reported in
+	// addition to comm.
+	ReportCountForTrace(traceHash libpf.TraceHash, timestamp libpf.UnixTime64,
+		count uint16, comm, podName, podNamespace, containerName, containerID,
+		threadName string)
+
+	// ReportCounts accepts the counts of many traces at once, like repeated calls
+	// of ReportCountForTrace, which avoids the per call overhead.
+	ReportCounts(counts []TraceCount)
+
+	// ReportProcessForTrace accepts the PID and start time of the process a trace
+	// was sampled in and caches this information before a periodic reporting to
+	// the backend. A PID can be reused by a later process, so only both together
+	// identify the process.
+	ReportProcessForTrace(traceHash libpf.TraceHash, pid libpf.PID,
+		startTime libpf.UnixTime64)
+}
+
+type AllocationReporter interface {
+	// ReportAllocationForTrace accepts a hash of a trace with the number of bytes
+	// it allocated and caches this information before a periodic reporting to
+	// the backend.
+	ReportAllocationForTrace(traceHash libpf.TraceHash, timestamp libpf.UnixTime64,
+		bytes uint64, comm, podName, podNamespace, containerName, containerID,
+		threadName string)
 }
 
 type SymbolReporter interface {
@@ -57,12 +105,28 @@ type SymbolReporter interface {
 
 	// ExecutableMetadata accepts a fileID with the corresponding filename
 	// and caches this information before a periodic reporting to the backend.
-	ExecutableMetadata(ctx context.Context, fileID libpf.FileID, fileName, buildID string)
+	// gnuBuildID is set if buildID comes from a GNU build ID note.
+	ExecutableMetadata(ctx context.Context, fileID libpf.FileID, fileName, buildID string,
+		gnuBuildID bool)
+
+	// MappingMetadata accepts the range of memory [memoryStart, memoryLimit) an
+	// executable is loaded at, for every process that maps it. It is only cached
+	// for executables whose metadata was reported with ExecutableMetadata before.
+	MappingMetadata(fileID libpf.FileID, memoryStart, memoryLimit uint64)
+
+	// ExpireExecutableMetadata signals that the executable is no longer mapped by
+	// any process. Its metadata is kept long enough to report the samples that
+	// were already collected, unless it is reported again in the meantime.
+	ExpireExecutableMetadata(fileID libpf.FileID)
 
 	// FrameMetadata accepts metadata associated with a frame and caches this information before
 	// a periodic reporting to the backend.
 	FrameMetadata(fileID libpf.FileID, addressOrLine libpf.AddressOrLineno,
 		lineNumber libpf.SourceLineno, functionOffset uint32, functionName, filePath string)
+
+	// ReportFrameMetadata is like FrameMetadata, but also accepts the optional
+	// elements of libpf.FrameMetadata.
+	ReportFrameMetadata(frameMetadata *libpf.FrameMetadata)
 }
 
 type HostMetadataReporter interface {
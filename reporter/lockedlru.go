@@ -0,0 +1,88 @@
+/*
+ * Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+ * or more contributor license agreements. Licensed under the Apache License 2.0.
+ * See the file "LICENSE" for details.
+ */
+
+package reporter
+
+import (
+	"sync"
+	"time"
+
+	lru "github.com/elastic/go-freelru"
+)
+
+// lockedLRU is a thread-safe LRU like lru.SyncedLRU. In addition, update applies
+// several operations while holding the lock only once.
+type lockedLRU[K comparable, V any] struct {
+	mu  sync.RWMutex
+	lru *lru.LRU[K, V]
+}
+
+// newLockedLRU returns a thread-safe LRU with the given capacity.
+func newLockedLRU[K comparable, V any](capacity uint32,
+	hash lru.HashKeyCallback[K]) (*lockedLRU[K, V], error) {
+	cache, err := lru.New[K, V](capacity, hash)
+	if err != nil {
+		return nil, err
+	}
+	return &lockedLRU[K, V]{lru: cache}, nil
+}
+
+// update calls fn with the underlying LRU, which fn must not retain. fn must not
+// lock another lockedLRU either, so that there is no lock order to keep.
+func (l *lockedLRU[K, V]) update(fn func(cache *lru.LRU[K, V])) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fn(l.lru)
+}
+
+// SetLifetime sets the lifetime after which entries that are added expire.
+func (l *lockedLRU[K, V]) SetLifetime(lifetime time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lru.SetLifetime(lifetime)
+}
+
+// Add adds value for key and returns whether another entry was evicted.
+func (l *lockedLRU[K, V]) Add(key K, value V) (evicted bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lru.Add(key, value)
+}
+
+// Get returns the value of key and marks it as the most recently used entry.
+func (l *lockedLRU[K, V]) Get(key K) (value V, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lru.Get(key)
+}
+
+// Peek returns the value of key without updating its recent usage.
+func (l *lockedLRU[K, V]) Peek(key K) (value V, ok bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.lru.Peek(key)
+}
+
+// Remove removes key and returns whether it was present.
+func (l *lockedLRU[K, V]) Remove(key K) (removed bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lru.Remove(key)
+}
+
+// Keys returns the keys of all entries.
+func (l *lockedLRU[K, V]) Keys() []K {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.lru.Keys()
+}
+
+// Len returns the number of entries.
+func (l *lockedLRU[K, V]) Len() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.lru.Len()
+}
@@ -98,6 +98,12 @@ func (sh *statsHandlerImpl) HandleRPC(ctx context.Context, s stats.RPCStats) {
 		panic(err)
 	}
 
+	sh.addBytes(method, wireBytesIn, rpcBytesIn, wireBytesOut, rpcBytesOut)
+}
+
+// addBytes aggregates in/out byte counts under the given method name.
+func (sh *statsHandlerImpl) addBytes(method string,
+	wireBytesIn, rpcBytesIn, wireBytesOut, rpcBytesOut int64) {
 	if wireBytesIn != 0 {
 		sh.numWireBytesIn.Add(wireBytesIn)
 		sh.numRPCBytesIn.Add(rpcBytesIn)
@@ -111,6 +117,7 @@ func (sh *statsHandlerImpl) HandleRPC(ctx context.Context, s stats.RPCStats) {
 
 	if wireBytesOut != 0 {
 		sh.numWireBytesOut.Add(wireBytesOut)
+		sh.numRPCBytesOut.Add(rpcBytesOut)
 		wireOut := sh.wireBytesOut.WLock()
 		rpcOut := sh.rpcBytesOut.WLock()
 		defer sh.wireBytesOut.WUnlock(&wireOut)
@@ -193,6 +200,23 @@ type Metrics struct {
 	RPCBytesInCount               int64
 	WireBytesOutCount             int64
 	WireBytesInCount              int64
+	TraceInfoGraceRecoveredCount  uint32
+	TraceInfoMissingDroppedCount  uint32
+	ExportSkippedCount            uint32
+	ExportSkippedSamplesCount     uint32
+	ExportEndpointFailedCount     uint32
+	ExportRejectedProfilesCount   uint32
+	ExportRejectedSamplesCount    uint32
+	SymbolUploadPathDeniedCount   uint32
+	TraceEvictionCount            uint32
+	SampleEvictionCount           uint32
+	ExportBreakerOpen             uint32
+	ExportBreakerDroppedCount     uint32
+	ProfileBuildMaxUsec           int64
+	ProfileLocations              uint32
+	ProfileFunctions              uint32
+	ProfileMappings               uint32
+	ProfileStrings                uint32
 }
 
 func (r *GRPCReporter) GetMetrics() Metrics {
@@ -0,0 +1,169 @@
+/*
+ * Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+ * or more contributor license agreements. Licensed under the Apache License 2.0.
+ * See the file "LICENSE" for details.
+ */
+
+package reporter
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/elastic/otel-profiling-agent/debug/log"
+	otlpcollector "github.com/elastic/otel-profiling-agent/proto/experiments/opentelemetry/proto/collector/profiles/v1"
+)
+
+const (
+	// OTLPProtocolFile selects writing the profiles to a file as OTLP/JSON, one
+	// request per line, instead of sending them to a collector.
+	OTLPProtocolFile = "file/json"
+
+	// otlpFileStatsMethod is the method under which the size of the profiles
+	// written to the file is recorded.
+	otlpFileStatsMethod = "file"
+)
+
+// otlpJSONIDFields are the bytes fields that OTLP/JSON encodes as hex strings
+// instead of base64, see https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding
+var otlpJSONIDFields = map[string]bool{
+	"profileId": true,
+	"traceId":   true,
+	"spanId":    true,
+}
+
+// Assert that fileProfilesClient can be used in place of the gRPC client.
+var _ otlpcollector.ProfilesServiceClient = (*fileProfilesClient)(nil)
+
+// fileProfilesClient writes ExportProfilesServiceRequest messages as OTLP/JSON
+// lines to a file or stdout.
+type fileProfilesClient struct {
+	mu sync.Mutex
+	w  io.Writer
+	// file is closed by Close, unless the requests are written to stdout.
+	file *os.File
+
+	// rpcStats receives the number of bytes written.
+	rpcStats *statsHandlerImpl
+}
+
+// newFileProfilesClient returns a client that appends the requests to the file at
+// path, which is created if needed. A path of "-" writes to stdout.
+func newFileProfilesClient(path string, statsHandler *statsHandlerImpl) (
+	*fileProfilesClient, error) {
+	if path == "-" {
+		return &fileProfilesClient{w: os.Stdout, rpcStats: statsHandler}, nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open profiles file: %w", err)
+	}
+	return &fileProfilesClient{w: f, file: f, rpcStats: statsHandler}, nil
+}
+
+// Export implements the otlpcollector.ProfilesServiceClient interface. Every
+// request is written as a single line.
+func (f *fileProfilesClient) Export(_ context.Context,
+	in *otlpcollector.ExportProfilesServiceRequest, _ ...grpc.CallOption) (
+	*otlpcollector.ExportProfilesServiceResponse, error) {
+	line, err := marshalOTLPJSON(in)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, err = f.w.Write(line); err != nil {
+		return nil, fmt.Errorf("write request: %w", err)
+	}
+	f.rpcStats.addBytes(otlpFileStatsMethod, 0, 0, int64(len(line)), int64(len(line)))
+	return &otlpcollector.ExportProfilesServiceResponse{}, nil
+}
+
+// Close closes the file the requests are written to.
+func (f *fileProfilesClient) Close() error {
+	if f.file == nil {
+		return nil
+	}
+	return f.file.Close()
+}
+
+// closeOnError closes the file if the reporter fails to start. f may be nil.
+func (f *fileProfilesClient) closeOnError() {
+	if f == nil {
+		return
+	}
+	if err := f.Close(); err != nil {
+		log.Warnf("Failed to close profiles file: %v", err)
+	}
+}
+
+// marshalOTLPJSON returns the OTLP/JSON encoding of m followed by a newline.
+// Unlike the canonical JSON mapping of protobuf, OTLP/JSON encodes enums as
+// integers and IDs as hex strings. The output is compact and its keys are
+// sorted, so that it is stable.
+func marshalOTLPJSON(m proto.Message) ([]byte, error) {
+	data, err := protojson.MarshalOptions{UseEnumNumbers: true}.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+
+	// Numbers are kept as they are, as 64-bit integers that are not encoded as
+	// strings would lose precision as float64.
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err = dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if err = hexEncodeIDs(v); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err = enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// hexEncodeIDs replaces the base64 encoded IDs in the decoded JSON value v with
+// their hex encoding.
+func hexEncodeIDs(v any) error {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if s, ok := value.(string); ok && otlpJSONIDFields[key] {
+				id, err := base64.StdEncoding.DecodeString(s)
+				if err != nil {
+					return fmt.Errorf("invalid %s: %w", key, err)
+				}
+				v[key] = hex.EncodeToString(id)
+				continue
+			}
+			if err := hexEncodeIDs(value); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for _, value := range v {
+			if err := hexEncodeIDs(value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
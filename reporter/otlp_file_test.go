@@ -0,0 +1,124 @@
+/*
+ * Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+ * or more contributor license agreements. Licensed under the Apache License 2.0.
+ * See the file "LICENSE" for details.
+ */
+
+package reporter
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	otlpcollector "github.com/elastic/otel-profiling-agent/proto/experiments/opentelemetry/proto/collector/profiles/v1"
+	profiles "github.com/elastic/otel-profiling-agent/proto/experiments/opentelemetry/proto/profiles/v1"
+	"github.com/elastic/otel-profiling-agent/proto/experiments/opentelemetry/proto/profiles/v1/alternatives/pprofextended"
+)
+
+// unmarshalOTLPJSON is the inverse of marshalOTLPJSON.
+func unmarshalOTLPJSON(t *testing.T, line []byte, m proto.Message) {
+	t.Helper()
+
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.UseNumber()
+	var v any
+	require.NoError(t, dec.Decode(&v))
+	base64EncodeIDs(t, v)
+	data, err := json.Marshal(v)
+	require.NoError(t, err)
+	require.NoError(t, protojson.Unmarshal(data, m))
+}
+
+// base64EncodeIDs is the inverse of hexEncodeIDs.
+func base64EncodeIDs(t *testing.T, v any) {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if s, ok := value.(string); ok && otlpJSONIDFields[key] {
+				id, err := hex.DecodeString(s)
+				require.NoError(t, err, key)
+				v[key] = base64.StdEncoding.EncodeToString(id)
+				continue
+			}
+			base64EncodeIDs(t, value)
+		}
+	case []any:
+		for _, value := range v {
+			base64EncodeIDs(t, value)
+		}
+	}
+}
+
+func TestFileProfilesClient(t *testing.T) {
+	req := &otlpcollector.ExportProfilesServiceRequest{
+		ResourceProfiles: []*profiles.ResourceProfiles{{
+			ScopeProfiles: []*profiles.ScopeProfiles{{
+				Profiles: []*profiles.ProfileContainer{{
+					ProfileId: []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08,
+						0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10},
+					StartTimeUnixNano: 1710000000e9,
+					OriginalPayload:   []byte("payload"),
+					Profile: &pprofextended.Profile{
+						SampleType: []*pprofextended.ValueType{{
+							Type: 1,
+							Unit: 2,
+							AggregationTemporality: pprofextended.
+								AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+						}},
+						Sample: []*pprofextended.Sample{{Value: []int64{1}}},
+						Mapping: []*pprofextended.Mapping{{
+							BuildIdKind: pprofextended.BuildIdKind_BUILD_ID_BINARY_HASH,
+						}},
+						LinkTable: []*pprofextended.Link{{
+							TraceId: bytes.Repeat([]byte{0xab}, 16),
+							SpanId:  bytes.Repeat([]byte{0xcd}, 8),
+						}},
+						StringTable: []string{"", "samples", "<count>"},
+					},
+				}},
+			}},
+		}},
+	}
+
+	path := filepath.Join(t.TempDir(), "profiles.jsonl")
+	client, err := newFileProfilesClient(path, newStatsHandler())
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		_, err = client.Export(context.Background(), req)
+		require.NoError(t, err)
+	}
+	require.NoError(t, client.Close())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	require.Len(t, lines, 2)
+
+	for _, line := range lines {
+		// IDs are hex encoded, other bytes fields base64 encoded, and enums
+		// are encoded as integers.
+		assert.Contains(t, line, `"profileId":"0102030405060708090a0b0c0d0e0f10"`)
+		assert.Contains(t, line, `"traceId":"abababababababababababababababab"`)
+		assert.Contains(t, line, `"spanId":"cdcdcdcdcdcdcdcd"`)
+		assert.Contains(t, line, `"originalPayload":"cGF5bG9hZA=="`)
+		assert.Contains(t, line, `"aggregationTemporality":1`)
+		assert.Contains(t, line, `"buildIdKind":1`)
+		assert.Contains(t, line, `"<count>"`)
+
+		got := &otlpcollector.ExportProfilesServiceRequest{}
+		unmarshalOTLPJSON(t, []byte(line), got)
+		assert.True(t, proto.Equal(req, got), "unmarshaled request differs")
+	}
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+ * or more contributor license agreements. Licensed under the Apache License 2.0.
+ * See the file "LICENSE" for details.
+ */
+
+package reporter
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+
+	otlpcollector "github.com/elastic/otel-profiling-agent/proto/experiments/opentelemetry/proto/collector/profiles/v1"
+)
+
+const (
+	// OTLPProtocolGRPC selects OTLP/gRPC as the transport for profiles.
+	OTLPProtocolGRPC = "grpc"
+	// OTLPProtocolHTTP selects OTLP/HTTP with binary protobuf encoding as the
+	// transport for profiles.
+	OTLPProtocolHTTP = "http/protobuf"
+
+	// otlpHTTPProfilesPath is the OTLP/HTTP path that accepts profiles.
+	otlpHTTPProfilesPath = "/v1development/profiles"
+	// otlpHTTPContentType is the Content-Type for binary protobuf encoded requests.
+	otlpHTTPContentType = "application/x-protobuf"
+)
+
+// Assert that httpProfilesClient can be used in place of the gRPC client.
+var _ otlpcollector.ProfilesServiceClient = (*httpProfilesClient)(nil)
+
+// httpProfilesClient sends ExportProfilesServiceRequest messages via OTLP/HTTP.
+type httpProfilesClient struct {
+	client *http.Client
+
+	// url is the full URL the requests are POSTed to.
+	url string
+
+	// rpcCreds are added to every request, if set.
+	rpcCreds *perRPCCredentials
+
+	// rpcStats receives the number of bytes sent and received.
+	rpcStats *statsHandlerImpl
+}
+
+// newHTTPProfilesClient returns a client that sends profiles to addr via OTLP/HTTP
+// using tlsConfig for transport security. If tlsConfig is nil, plain HTTP is used.
+func newHTTPProfilesClient(addr string, tlsConfig *tls.Config, rpcCreds *perRPCCredentials,
+	timeout time.Duration, statsHandler *statsHandlerImpl) *httpProfilesClient {
+	scheme := "http"
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if tlsConfig != nil {
+		scheme = "https"
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	return &httpProfilesClient{
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   timeout,
+		},
+		url:      fmt.Sprintf("%s://%s%s", scheme, addr, otlpHTTPProfilesPath),
+		rpcCreds: rpcCreds,
+		rpcStats: statsHandler,
+	}
+}
+
+// Export implements the otlpcollector.ProfilesServiceClient interface.
+// gRPC call options do not apply to OTLP/HTTP and are ignored.
+func (h *httpProfilesClient) Export(ctx context.Context,
+	in *otlpcollector.ExportProfilesServiceRequest, _ ...grpc.CallOption) (
+	*otlpcollector.ExportProfilesServiceResponse, error) {
+	body, err := proto.Marshal(in)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", otlpHTTPContentType)
+	if h.rpcCreds != nil {
+		md, err := h.rpcCreds.GetRequestMetadata(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("get request metadata: %w", err)
+		}
+		for k, v := range md {
+			req.Header.Set(k, v)
+		}
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("do export request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+
+	// There is no compression applied, so payload and on-the-wire sizes are the same.
+	h.rpcStats.addBytes(otlpHTTPProfilesPath, int64(len(respBody)), int64(len(respBody)),
+		int64(len(body)), int64(len(body)))
+
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("unexpected status code: %d, msg: %s",
+			resp.StatusCode, string(respBody))
+	}
+
+	var exportResp otlpcollector.ExportProfilesServiceResponse
+	if err := proto.Unmarshal(respBody, &exportResp); err != nil {
+		return nil, fmt.Errorf("unmarshal response: %w", err)
+	}
+	return &exportResp, nil
+}
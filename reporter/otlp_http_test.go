@@ -0,0 +1,92 @@
+/*
+ * Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+ * or more contributor license agreements. Licensed under the Apache License 2.0.
+ * See the file "LICENSE" for details.
+ */
+
+package reporter
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+
+	otlpcollector "github.com/elastic/otel-profiling-agent/proto/experiments/opentelemetry/proto/collector/profiles/v1"
+	profiles "github.com/elastic/otel-profiling-agent/proto/experiments/opentelemetry/proto/profiles/v1"
+	"github.com/elastic/otel-profiling-agent/proto/experiments/opentelemetry/proto/profiles/v1/alternatives/pprofextended"
+)
+
+func TestHTTPProfilesClientExport(t *testing.T) {
+	want := &otlpcollector.ExportProfilesServiceRequest{
+		ResourceProfiles: []*profiles.ResourceProfiles{{
+			ScopeProfiles: []*profiles.ScopeProfiles{{
+				Profiles: []*profiles.ProfileContainer{{
+					ProfileId: []byte("0123456789abcdef"),
+					Profile: &pprofextended.Profile{
+						StringTable: []string{"", "samples", "count"},
+						SampleType:  []*pprofextended.ValueType{{Type: 1, Unit: 2}},
+						Sample: []*pprofextended.Sample{{
+							Value:      []int64{42},
+							Timestamps: []uint64{1710000000000},
+						}},
+					},
+				}},
+			}},
+		}},
+	}
+
+	var got otlpcollector.ExportProfilesServiceRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, otlpHTTPProfilesPath, r.URL.Path)
+		assert.Equal(t, otlpHTTPContentType, r.Header.Get("Content-Type"))
+		assert.Equal(t, "Bearer abc123", r.Header.Get("Authorization"))
+		assert.Equal(t, "tenant", r.Header.Get("X-Scope-OrgID"))
+
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		assert.NoError(t, proto.Unmarshal(body, &got))
+
+		resp, err := proto.Marshal(&otlpcollector.ExportProfilesServiceResponse{})
+		assert.NoError(t, err)
+		w.Header().Set("Content-Type", otlpHTTPContentType)
+		_, _ = w.Write(resp)
+	}))
+	defer srv.Close()
+
+	rpcCreds, err := newPerRPCCredentials("abc123", "",
+		map[string]string{"X-Scope-OrgID": "tenant"}, true)
+	require.NoError(t, err)
+
+	stats := newStatsHandler()
+	client := newHTTPProfilesClient(strings.TrimPrefix(srv.URL, "http://"), nil,
+		rpcCreds, 5*time.Second, stats)
+
+	_, err = client.Export(context.Background(), want)
+	require.NoError(t, err)
+
+	assert.True(t, proto.Equal(want, &got), "unexpected request: %v", &got)
+	assert.Equal(t, int64(proto.Size(want)), stats.getWireBytesOut())
+}
+
+func TestHTTPProfilesClientExportError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "collector unavailable", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	client := newHTTPProfilesClient(strings.TrimPrefix(srv.URL, "http://"), nil,
+		nil, 5*time.Second, newStatsHandler())
+
+	_, err := client.Export(context.Background(), &otlpcollector.ExportProfilesServiceRequest{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "503")
+}
@@ -9,7 +9,15 @@ package reporter
 import (
 	"context"
 	"fmt"
+	"io"
+	"net/url"
+	"os"
 	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/elastic/otel-profiling-agent/config"
@@ -17,7 +25,6 @@ import (
 	otlpcollector "github.com/elastic/otel-profiling-agent/proto/experiments/opentelemetry/proto/collector/profiles/v1"
 	profiles "github.com/elastic/otel-profiling-agent/proto/experiments/opentelemetry/proto/profiles/v1"
 	"github.com/elastic/otel-profiling-agent/proto/experiments/opentelemetry/proto/profiles/v1/alternatives/pprofextended"
-	v1alpha1 "github.com/elastic/otel-profiling-agent/proto/experiments/parca/debuginfo/v1alpha1"
 	"github.com/elastic/otel-profiling-agent/symuploader"
 
 	"github.com/elastic/otel-profiling-agent/debug/log"
@@ -28,6 +35,10 @@ import (
 
 	lru "github.com/elastic/go-freelru"
 	"github.com/zeebo/xxh3"
+	"golang.org/x/sys/unix"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
 )
 
 // Assert that we implement the full Reporter interface.
@@ -38,25 +49,53 @@ type traceInfo struct {
 	files          []libpf.FileID
 	linenos        []libpf.AddressOrLineno
 	frameTypes     []libpf.FrameType
+	jitTiers       []libpf.JITTier
 	comm           string
+	threadName     string
 	podName        string
 	podNamespace   string
 	containerName  string
+	containerID    string
 	apmServiceName string
+	// pid and processStartTime identify the process the trace was sampled in.
+	// Both are zero if the process is not known.
+	pid              libpf.PID
+	processStartTime libpf.UnixTime64
 }
 
 // sample holds dynamic information about traces.
 type sample struct {
 	// In most cases OTEP/profiles requests timestamps in a uint64 format
 	// and use nanosecond precision - https://github.com/open-telemetry/oteps/issues/253
-	timestamps []uint64
+	timestamps []libpf.UnixTime64
 	count      uint32
+	// allocBytes is the number of bytes allocated by the trace.
+	allocBytes uint64
+	// missedReports is the number of reports that skipped the sample, as its
+	// trace information was missing.
+	missedReports uint32
 }
 
 // execInfo enriches an executable with additional metadata.
 type execInfo struct {
 	fileName string
 	buildID  string
+	// gnuBuildID is set if buildID comes from a GNU build ID note.
+	gnuBuildID bool
+	// inode and device identify the executable on the filesystem. Both are
+	// zero if the information is not available.
+	inode  uint64
+	device uint64
+	// omitFrames is set if the frames of the executable are not reported.
+	omitFrames bool
+	// memoryStart and memoryLimit are the range of memory the executable is
+	// loaded at. Both are zero if the information is not available.
+	memoryStart uint64
+	memoryLimit uint64
+	// ambiguousRange is set once processes map the executable at different
+	// ranges, e.g. because of ASLR. The range is not reported anymore then, as
+	// the mappings of the profile are shared by all processes.
+	ambiguousRange bool
 }
 
 // sourceInfo allows to map a frame to its source origin.
@@ -65,25 +104,101 @@ type sourceInfo struct {
 	functionOffset uint32
 	functionName   string
 	filePath       string
+	// functionEndLine is the last source line of the function or 0 if unknown.
+	functionEndLine libpf.SourceLineno
+	// inlineFrames are the functions inlined into functionName, ordered from
+	// caller to callee.
+	inlineFrames []libpf.InlineFrame
+}
+
+// startLine returns the first source line of the function, derived from the
+// line number and its offset to the start of the function, or 0 if unknown.
+func (si sourceInfo) startLine() int64 {
+	if uint64(si.functionOffset) > uint64(si.lineNumber) {
+		return 0
+	}
+	return int64(si.lineNumber) - int64(si.functionOffset)
+}
+
+// locationKey is a helper to deduplicate profile.Location messages.
+type locationKey struct {
+	fileID        libpf.FileID
+	addressOrLine libpf.AddressOrLineno
+	frameType     libpf.FrameType
+	jitTier       libpf.JITTier
 }
 
 // funcInfo is a helper to construct profile.Function messages.
 type funcInfo struct {
 	name     string
 	fileName string
+	// startLine is the first source line of the function or 0 if unknown.
+	startLine int64
 }
 
-type symbolUploader interface {
-	Upload(ctx context.Context, fileID libpf.FileID, fileName, buildID string)
+// attrKeyValue is a helper to construct profile.AttributeTable entries.
+type attrKeyValue struct {
+	key string
+	// value is either an int64 or a string.
+	value any
 }
 
-func NewNoopSymbolUploader() symbolUploader {
-	return &noopSymbolUploader{}
-}
+// profileOptions controls how newProfile builds profiles.
+type profileOptions struct {
+	// samplesPerSecond is the sampling frequency, which defines the CPU time a
+	// single sample represents.
+	samplesPerSecond uint16
+
+	// otlpBuildIDMode is the mode to use for the build ID ("linker", "hash" or "auto").
+	otlpBuildIDMode string
+
+	// rawNativeFrames reports the mappings of native frames only by their FileID,
+	// without the metadata of their executables.
+	rawNativeFrames bool
+
+	// kernelImageName is the file name reported for functions of the core
+	// kernel. Functions of kernel modules are reported with the module name.
+	kernelImageName string
+
+	// reportCPUTime adds the CPU time in nanoseconds as second value to every sample.
+	reportCPUTime bool
 
-type noopSymbolUploader struct{}
+	// idleSamples defines how samples of the idle task are reported.
+	idleSamples string
 
-func (n *noopSymbolUploader) Upload(_ context.Context, _ libpf.FileID, _ string, _ string) {}
+	// omitPlaceholderFrames omits frames that would only be reported with a
+	// placeholder function name.
+	omitPlaceholderFrames bool
+
+	// maxStackDepth is the number of frames of a trace above which the outermost
+	// frames are replaced with a single synthetic frame. Zero disables this.
+	maxStackDepth uint32
+
+	// dedupTimestamps reports every timestamp of a sample only once. The count
+	// of the sample still includes all occurrences.
+	dedupTimestamps bool
+
+	// dropFrames and keepFrames are the regular expressions that are reported
+	// as DropFrames and KeepFrames of the profiles.
+	dropFrames string
+	keepFrames string
+
+	// defaultSampleType is the type name of the sample type that is preferred
+	// as default sample type of the profiles.
+	defaultSampleType string
+}
+
+// profileData holds the samples of a profile together with the information
+// about their traces, executables and frames that newProfile needs.
+type profileData struct {
+	samples         map[libpf.TraceHash]sample
+	traces          map[libpf.TraceHash]traceInfo
+	executables     map[libpf.FileID]execInfo
+	frames          map[libpf.FileID]map[libpf.AddressOrLineno]sourceInfo
+	fallbackSymbols map[libpf.FrameID]string
+	// kernelModules holds the names of the kernel modules of kernel frames.
+	kernelModules map[libpf.FileID]string
+}
 
 // OTLPReporter receives and transforms information to be OTLP/profiles compliant.
 type OTLPReporter struct {
@@ -104,27 +219,288 @@ type OTLPReporter struct {
 	hostmetadata *lru.SyncedLRU[string, string]
 
 	// traces stores static information needed for samples.
-	traces *lru.SyncedLRU[libpf.TraceHash, traceInfo]
+	traces *lockedLRU[libpf.TraceHash, traceInfo]
 
 	// samples holds a map of currently encountered traces.
-	samples *lru.SyncedLRU[libpf.TraceHash, sample]
+	samples *lockedLRU[libpf.TraceHash, sample]
 
 	// fallbackSymbols keeps track of FrameID to their symbol.
 	fallbackSymbols *lru.SyncedLRU[libpf.FrameID, string]
+	// internedSymbols holds the storage of the fallback symbols that is shared
+	// by the frames of the same symbol, see internSymbol.
+	internedSymbols *lru.SyncedLRU[string, string]
 
 	// executables stores metadata for executables.
 	executables *lru.SyncedLRU[libpf.FileID, execInfo]
 
 	// frames maps frame information to its source location.
 	frames *lru.SyncedLRU[libpf.FileID, map[libpf.AddressOrLineno]sourceInfo]
+	// framesMu protects the maps in frames, as they are updated in place.
+	framesMu sync.RWMutex
 
-	// otlpBuildIDMode is the mode to use for the build ID (either "linker" or "hash").
-	otlpBuildIDMode string
+	// profileOptions controls how profiles are built from the samples.
+	profileOptions
+
+	// breaker stops the export of profiles while the backend is not reachable,
+	// if set.
+	breaker *exportBreaker
+
+	// sampler skips a fraction of the report intervals, if export sampling is
+	// configured.
+	sampler *exportSampler
+
+	// fanOut sends the exports to all backends.
+	fanOut *fanOutProfilesClient
+
+	// health records the outcome of the exports for Ready.
+	health *healthProfilesClient
+
+	// minSampleCount is the count a sample needs to reach before it is reported.
+	minSampleCount uint32
+
+	// framePaths selects the executables whose frames are omitted, if set.
+	framePaths *framePathFilter
+
+	// tenants resolves the tenant of samples, if tenant rules are configured.
+	tenants *tenantResolver
+
+	// schemaURL is the schema URL of the reported resources and scopes.
+	schemaURL string
+
+	// serviceName is the service.name resource attribute of the profiles.
+	serviceName string
+	// profileNameKey and profileName are the key and value of the resource
+	// attribute that names the profile type, which is omitted if
+	// omitProfileName is set.
+	profileNameKey  string
+	profileName     string
+	omitProfileName bool
+	// envAttributes are the resource attributes from OTEL_RESOURCE_ATTRIBUTES.
+	envAttributes []*common.KeyValue
+	// detectedAttributes are the resource attributes detected by the
+	// OpenTelemetry SDK, if enabled.
+	detectedAttributes []*common.KeyValue
+
+	// scopeName and scopeVersionSuffix describe the instrumentation scope of
+	// the profiles, see instrumentationScope.
+	scopeName          string
+	scopeVersionSuffix string
+
+	// profileID generates the ProfileId for every reported profile.
+	profileID profileIDGenerator
 
 	// symuploader uploads symbols to a backend.
-	symuploader symbolUploader
+	symuploader SymbolUploader
+
+	// uploadPathFilter decides which executables symuploader may upload.
+	uploadPathFilter *symuploader.PathFilter
+
+	// clock provides the time for the report loop and report windows.
+	clock Clock
+
+	// expiredExecutableLifetime is the time the metadata of an executable is
+	// kept for after ExpireExecutableMetadata.
+	expiredExecutableLifetime time.Duration
+
+	// lastReport is the time of the previous report. It is only accessed by
+	// the reporting goroutine.
+	lastReport time.Time
+
+	// traceInfoGracePeriod is the maximum time to wait for missing trace
+	// information before samples are deferred to the next report.
+	traceInfoGracePeriod time.Duration
+	// traceInfoGraceLeft is the part of traceInfoGracePeriod that is left in the
+	// current report interval. Early reports share the grace period with the
+	// regular report, so that waiting blocks the reporting goroutine for at most
+	// traceInfoGracePeriod per interval. It is only accessed by the reporting
+	// goroutine.
+	traceInfoGraceLeft time.Duration
+
+	// traceInfoGraceRecovered counts samples for which trace information
+	// arrived within traceInfoGracePeriod.
+	traceInfoGraceRecovered atomic.Uint32
+
+	// traceInfoMaxReports is the number of reports a sample waits for its trace
+	// information before it is dropped. Zero disables dropping.
+	traceInfoMaxReports uint32
+
+	// traceInfoMissingDropped counts samples that were dropped, as their trace
+	// information did not arrive within traceInfoMaxReports reports.
+	traceInfoMissingDropped atomic.Uint32
+
+	// traceInfoLifetime is the time after which the information of a trace
+	// expires, unless it is reported again. Zero disables the expiry.
+	traceInfoLifetime time.Duration
+
+	// rejectedProfiles and rejectedSamples count the profiles, and their
+	// samples, that the collector rejected in partially successful exports.
+	rejectedProfiles atomic.Uint32
+	rejectedSamples  atomic.Uint32
+
+	// traceEvictions and sampleEvictions count the entries that were evicted
+	// from traces and samples to make room for new entries.
+	traceEvictions  atomic.Uint32
+	sampleEvictions atomic.Uint32
+
+	// maxSamplesPerReport is the number of samples above which the collected
+	// samples are reported before the report interval ends. Zero disables
+	// early reports.
+	maxSamplesPerReport uint32
+	// pendingSamples counts the samples collected since the last report.
+	pendingSamples atomic.Uint32
+
+	// maxRequestSize is the size in bytes above which the profiles of a report
+	// are split across several requests. Zero disables splitting.
+	maxRequestSize int
+	// flush requests an early report from the report loop.
+	flush chan libpf.Void
+
+	// capacities holds the maximum number of entries of each cache.
+	capacities cacheSizes
+	// cacheHighWaterMark is the fill ratio of samples above which a warning
+	// is logged on report. Zero disables the warning.
+	cacheHighWaterMark float64
+
+	// profileBuildWarnFraction is the fraction of the report interval above
+	// which a warning is logged if building the profiles takes longer. Zero
+	// disables the warning.
+	profileBuildWarnFraction float64
+	// maxProfileBuildTime is the longest time in nanoseconds it took to build
+	// the profiles of a report since the last metrics report.
+	maxProfileBuildTime atomic.Int64
+
+	// profileSizeWarnLimit is the number of entries of a table of a profile
+	// above which a warning is logged. Zero disables the warning.
+	profileSizeWarnLimit uint32
+	// lastProfileSize holds the size of the largest profile of the last report.
+	lastProfileSize atomic.Pointer[profileSize]
+
+	// shutdownTimeout is the time Stop waits for the connections to the
+	// backends to be closed.
+	shutdownTimeout time.Duration
+	// stopped is closed once the reporter is shut down. It is nil if the
+	// reporter was not started.
+	stopped chan libpf.Void
+}
+
+// defaultShutdownTimeout is the time Stop waits for the connections to the
+// backends to be closed, if no other timeout is configured.
+const defaultShutdownTimeout = 5 * time.Second
+
+const (
+	// defaultKernelImageName is the file name reported for functions of the
+	// core kernel, if no other name is configured.
+	defaultKernelImageName = "vmlinux"
+	// kernelReleasePlaceholder is replaced with the kernel release of the host
+	// in the configured kernel image name.
+	kernelReleasePlaceholder = "{release}"
+)
+
+// sampleFrequencyAttributeKey is the resource attribute that holds the sampling
+// frequency in Hz.
+const sampleFrequencyAttributeKey = "profiling.sample.frequency"
+
+// DefaultSchemaURL is the schema URL of the version of the OpenTelemetry semantic
+// conventions the reported attributes follow.
+const DefaultSchemaURL = "https://opentelemetry.io/schemas/1.25.0"
+
+// DefaultProfileNameKey and DefaultProfileName are the key and value of the
+// resource attribute that names the profile type, if no others are configured.
+const (
+	DefaultProfileNameKey = "__name__"
+	DefaultProfileName    = "otel_profiling_agent_on_cpu"
+)
+
+// profileNameAttribute returns the resource attribute that names the profile
+// type, using the defaults for an empty key or value.
+func profileNameAttribute(key, value string) *common.KeyValue {
+	if key == "" {
+		key = DefaultProfileNameKey
+	}
+	if value == "" {
+		value = DefaultProfileName
+	}
+	return &common.KeyValue{
+		Key:   key,
+		Value: &common.AnyValue{Value: &common.AnyValue_StringValue{StringValue: value}},
+	}
+}
+
+// DefaultScopeName is the name of the instrumentation scope of the profiles, if
+// no other name is configured.
+const DefaultScopeName = "Elastic-Universal-Profiling"
+
+// instrumentationScope returns the instrumentation scope of the profiles with the
+// given name, or DefaultScopeName if name is empty. Its version is derived from
+// the version of the agent, followed by versionSuffix.
+func instrumentationScope(name, versionSuffix string) *common.InstrumentationScope {
+	if name == "" {
+		name = DefaultScopeName
+	}
+	return &common.InstrumentationScope{
+		Name:    name,
+		Version: fmt.Sprintf("%s@%s%s", vc.Version(), vc.Revision(), versionSuffix),
+	}
 }
 
+// validateSchemaURL returns schemaURL, or DefaultSchemaURL if it is empty, and
+// checks that it is an absolute HTTP(S) URL.
+func validateSchemaURL(schemaURL string) (string, error) {
+	if schemaURL == "" {
+		return DefaultSchemaURL, nil
+	}
+	u, err := url.Parse(schemaURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid schema URL: %v", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("invalid schema URL %q: expected an absolute HTTP(S) URL",
+			schemaURL)
+	}
+	return schemaURL, nil
+}
+
+// dryRunStatsMethod is the method under which the size of profiles that are
+// not sent in dry-run mode is accounted.
+const dryRunStatsMethod = "dry-run"
+
+// frameTypeAttribute is the key of the location attribute that holds the type
+// of the frame, like "native" or "python".
+const frameTypeAttribute = "frame.type"
+
+// abortFrameFunctionName is the name of the synthetic function that is reported
+// for libpf.AbortFrame, so that truncated stacks are visible in the profile.
+const abortFrameFunctionName = "[stack truncated]"
+
+// truncatedFramesFunctionName is the format of the name of the synthetic function
+// that replaces the frames beyond the maximum stack depth.
+const truncatedFramesFunctionName = "[truncated %d frames]"
+
+// Placeholders that are reported if information about a frame is missing.
+const (
+	// unknownPlaceholder is reported for executable names, build IDs and
+	// kernel symbols that are not known.
+	unknownPlaceholder = "UNKNOWN"
+	// dummyMappingFileName is the file name of the mappings that are reported
+	// for non-native frames.
+	dummyMappingFileName = "DUMMY"
+	// unreportedFunctionName is reported for interpreted frames of files
+	// without any metadata.
+	unreportedFunctionName = "UNREPORTED"
+	// unresolvedFunctionName is reported for interpreted frames without
+	// metadata for their line, while metadata for other lines of the file exists.
+	unresolvedFunctionName = "UNRESOLVED"
+)
+
+// omittedLocation marks frames in the location lookup of getProfile that are
+// not reported, as they would only hold a placeholder or belong to a filtered
+// executable.
+const omittedLocation = -1
+
+// traceInfoGracePollInterval is the interval at which traces is checked for
+// missing trace information during the grace period.
+const traceInfoGracePollInterval = 5 * time.Millisecond
+
 // hashString is a helper function for LRUs that use string as a key.
 // xxh3 turned out to be the fastest hash function for strings in the FreeLRU benchmarks.
 // It was only outperformed by the AES hash function, which is implemented in Plan9 assembly.
@@ -135,29 +511,201 @@ func hashString(s string) uint32 {
 // ReportFramesForTrace accepts a trace with the corresponding frames
 // and caches this information.
 func (r *OTLPReporter) ReportFramesForTrace(trace *libpf.Trace) {
-	if v, exists := r.traces.Peek(trace.Hash); exists {
+	evicted := false
+	r.traces.update(func(traces *lru.LRU[libpf.TraceHash, traceInfo]) {
 		// As traces is filled from two different API endpoints,
 		// some information for the trace might be available already.
-		// For simplicty, the just received information overwrites the
-		// the existing one.
-		v.files = trace.Files
-		v.linenos = trace.Linenos
-		v.frameTypes = trace.FrameTypes
+		v, _ := traces.Peek(trace.Hash)
+		if !mergeFrames(&v, trace) {
+			return
+		}
+		evicted = traces.Add(trace.Hash, v)
+	})
+	if evicted {
+		r.traceEvictions.Add(1)
+	}
+}
 
-		r.traces.Add(trace.Hash, v)
-	} else {
-		r.traces.Add(trace.Hash, traceInfo{
-			files:      trace.Files,
-			linenos:    trace.Linenos,
-			frameTypes: trace.FrameTypes,
-		})
+// mergeFrames replaces the frames of v with the ones of trace and returns
+// whether v was changed. As reports for the same trace hash can race, the
+// frames are only replaced if trace has at least as many frames as v, so that a
+// partial trace never replaces a complete one.
+func mergeFrames(v *traceInfo, trace *libpf.Trace) bool {
+	if len(trace.Files) < len(v.files) {
+		return false
+	}
+	v.files = trace.Files
+	v.linenos = trace.Linenos
+	v.frameTypes = trace.FrameTypes
+	v.jitTiers = trace.JITTiers
+	return true
+}
+
+// addTrace adds or updates the trace information for traceHash.
+// The OnEvict callback of the LRU is also called for removed entries, so
+// evictions are counted based on the result of Add instead.
+func (r *OTLPReporter) addTrace(traceHash libpf.TraceHash, info traceInfo) {
+	if r.traces.Add(traceHash, info) {
+		r.traceEvictions.Add(1)
+	}
+}
+
+// addSample adds or updates the sample for traceHash.
+func (r *OTLPReporter) addSample(traceHash libpf.TraceHash, s sample) {
+	if r.samples.Add(traceHash, s) {
+		r.sampleEvictions.Add(1)
+	}
+}
+
+// addPendingSamples counts n collected samples and requests an early report if
+// more than maxSamplesPerReport samples were collected since the last report.
+func (r *OTLPReporter) addPendingSamples(n uint32) {
+	if r.maxSamplesPerReport == 0 {
+		return
+	}
+	if r.pendingSamples.Add(n) > r.maxSamplesPerReport {
+		select {
+		case r.flush <- libpf.Void{}:
+		default:
+			// An early report is already requested.
+		}
 	}
 }
 
 // ReportCountForTrace accepts a hash of a trace with a corresponding count and
 // caches this information.
-func (r *OTLPReporter) ReportCountForTrace(traceHash libpf.TraceHash, timestamp libpf.UnixTime32,
-	count uint16, comm, podName, podNamespace, containerName string) {
+func (r *OTLPReporter) ReportCountForTrace(traceHash libpf.TraceHash, timestamp libpf.UnixTime64,
+	count uint16, comm, podName, podNamespace, containerName, containerID,
+	threadName string) {
+	if r.breaker.drop() {
+		return
+	}
+	r.reportTraceOrigin(traceHash, comm, podName, podNamespace, containerName, containerID,
+		threadName)
+
+	if v, ok := r.samples.Peek(traceHash); ok {
+		v.count += uint32(count)
+		v.timestamps = append(v.timestamps, timestamp)
+
+		r.addSample(traceHash, v)
+	} else {
+		r.addSample(traceHash, sample{
+			count:      uint32(count),
+			timestamps: []libpf.UnixTime64{timestamp},
+		})
+	}
+	r.addPendingSamples(uint32(count))
+}
+
+// ReportCounts accepts the counts of many traces like ReportCountForTrace, but
+// locks the caches of traces and samples only once for all of them.
+func (r *OTLPReporter) ReportCounts(counts []TraceCount) {
+	if len(counts) == 0 || r.breaker.dropN(uint32(len(counts))) {
+		return
+	}
+
+	var traceEvictions, sampleEvictions, total uint32
+	r.traces.update(func(traces *lru.LRU[libpf.TraceHash, traceInfo]) {
+		for i := range counts {
+			c := &counts[i]
+			// As in ReportCountForTrace, the received origin overwrites the
+			// existing one.
+			v, _ := traces.Peek(c.TraceHash)
+			v.comm = c.Comm
+			v.podName = c.PodName
+			v.podNamespace = c.PodNamespace
+			v.containerName = c.ContainerName
+			v.containerID = c.ContainerID
+			v.threadName = c.ThreadName
+			if traces.Add(c.TraceHash, v) {
+				traceEvictions++
+			}
+		}
+	})
+	r.samples.update(func(samples *lru.LRU[libpf.TraceHash, sample]) {
+		for i := range counts {
+			c := &counts[i]
+			v, _ := samples.Peek(c.TraceHash)
+			v.count += uint32(c.Count)
+			v.timestamps = append(v.timestamps, c.Timestamp)
+			if samples.Add(c.TraceHash, v) {
+				sampleEvictions++
+			}
+			total += uint32(c.Count)
+		}
+	})
+
+	r.traceEvictions.Add(traceEvictions)
+	r.sampleEvictions.Add(sampleEvictions)
+	r.addPendingSamples(total)
+}
+
+// ReportCompleteTrace accepts a trace together with its count and origin and
+// caches this information like ReportFramesForTrace followed by ReportCounts.
+// The trace is added before its sample, so that a concurrent report does not
+// see the sample without the information about its trace. As everywhere else,
+// the caches of traces and samples are never locked at the same time.
+func (r *OTLPReporter) ReportCompleteTrace(trace *libpf.Trace, count TraceCount) {
+	if r.breaker.drop() {
+		return
+	}
+
+	traceEvicted, sampleEvicted := false, false
+	r.traces.update(func(traces *lru.LRU[libpf.TraceHash, traceInfo]) {
+		v, _ := traces.Peek(trace.Hash)
+		mergeFrames(&v, trace)
+		v.comm = count.Comm
+		v.podName = count.PodName
+		v.podNamespace = count.PodNamespace
+		v.containerName = count.ContainerName
+		v.containerID = count.ContainerID
+		v.threadName = count.ThreadName
+		traceEvicted = traces.Add(trace.Hash, v)
+	})
+	r.samples.update(func(samples *lru.LRU[libpf.TraceHash, sample]) {
+		s, _ := samples.Peek(trace.Hash)
+		s.count += uint32(count.Count)
+		s.timestamps = append(s.timestamps, count.Timestamp)
+		sampleEvicted = samples.Add(trace.Hash, s)
+	})
+
+	if traceEvicted {
+		r.traceEvictions.Add(1)
+	}
+	if sampleEvicted {
+		r.sampleEvictions.Add(1)
+	}
+	r.addPendingSamples(uint32(count.Count))
+}
+
+// ReportAllocationForTrace accepts a hash of a trace with the number of bytes
+// it allocated and caches this information.
+func (r *OTLPReporter) ReportAllocationForTrace(traceHash libpf.TraceHash,
+	timestamp libpf.UnixTime64, bytes uint64, comm, podName, podNamespace,
+	containerName, containerID, threadName string) {
+	if r.breaker.drop() {
+		return
+	}
+	r.reportTraceOrigin(traceHash, comm, podName, podNamespace, containerName, containerID,
+		threadName)
+
+	if v, ok := r.samples.Peek(traceHash); ok {
+		v.allocBytes += bytes
+		v.timestamps = append(v.timestamps, timestamp)
+
+		r.addSample(traceHash, v)
+	} else {
+		r.addSample(traceHash, sample{
+			allocBytes: bytes,
+			timestamps: []libpf.UnixTime64{timestamp},
+		})
+	}
+	r.addPendingSamples(1)
+}
+
+// reportTraceOrigin caches the task and container information of a trace.
+func (r *OTLPReporter) reportTraceOrigin(traceHash libpf.TraceHash,
+	comm, podName, podNamespace, containerName, containerID, threadName string) {
 	if v, exists := r.traces.Peek(traceHash); exists {
 		// As traces is filled from two different API endpoints,
 		// some information for the trace might be available already.
@@ -167,28 +715,35 @@ func (r *OTLPReporter) ReportCountForTrace(traceHash libpf.TraceHash, timestamp
 		v.podName = podName
 		v.podNamespace = podNamespace
 		v.containerName = containerName
+		v.containerID = containerID
+		v.threadName = threadName
 
-		r.traces.Add(traceHash, v)
+		r.addTrace(traceHash, v)
 	} else {
-		r.traces.Add(traceHash, traceInfo{
+		r.addTrace(traceHash, traceInfo{
 			comm:          comm,
 			podName:       podName,
 			podNamespace:  podNamespace,
 			containerName: containerName,
+			containerID:   containerID,
+			threadName:    threadName,
 		})
 	}
+}
 
-	if v, ok := r.samples.Peek(traceHash); ok {
-		v.count += uint32(count)
-		v.timestamps = append(v.timestamps, uint64(timestamp))
-
-		r.samples.Add(traceHash, v)
-	} else {
-		r.samples.Add(traceHash, sample{
-			count:      uint32(count),
-			timestamps: []uint64{uint64(timestamp)},
-		})
+// ReportProcessForTrace caches the process a trace was sampled in.
+func (r *OTLPReporter) ReportProcessForTrace(traceHash libpf.TraceHash, pid libpf.PID,
+	startTime libpf.UnixTime64) {
+	// The sample of the trace is already counted as dropped.
+	if r.breaker.isOpen() {
+		return
 	}
+	// As for the other information about the origin of a trace, the process
+	// that reported the trace last is kept.
+	v, _ := r.traces.Peek(traceHash)
+	v.pid = pid
+	v.processStartTime = startTime
+	r.addTrace(traceHash, v)
 }
 
 // ReportFallbackSymbol enqueues a fallback symbol for reporting, for a given frame.
@@ -196,13 +751,25 @@ func (r *OTLPReporter) ReportFallbackSymbol(frameID libpf.FrameID, symbol string
 	if _, exists := r.fallbackSymbols.Peek(frameID); exists {
 		return
 	}
-	r.fallbackSymbols.Add(frameID, symbol)
+	r.fallbackSymbols.Add(frameID, r.internSymbol(symbol))
+}
+
+// internSymbol returns the stored symbol that is equal to symbol, or stores
+// symbol if there is none. This way, the frames of the same symbol share its
+// storage. Symbols that are evicted from internedSymbols keep being used by
+// their frames, but are not shared with frames that are reported later.
+func (r *OTLPReporter) internSymbol(symbol string) string {
+	if interned, exists := r.internedSymbols.Get(symbol); exists {
+		return interned
+	}
+	r.internedSymbols.Add(symbol, symbol)
+	return symbol
 }
 
 // ExecutableMetadata accepts a fileID with the corresponding filename
 // and caches this information.
 func (r *OTLPReporter) ExecutableMetadata(_ context.Context,
-	fileID libpf.FileID, fileName, buildID string) {
+	fileID libpf.FileID, fileName, buildID string, gnuBuildID bool) {
 	baseName := path.Base(fileName)
 	if baseName == "/" {
 		// There are circumstances where there is no filename.
@@ -214,40 +781,118 @@ func (r *OTLPReporter) ExecutableMetadata(_ context.Context,
 
 	r.symuploader.Upload(context.TODO(), fileID, fileName, buildID)
 
-	r.executables.Add(fileID, execInfo{
-		fileName: baseName,
-		buildID:  buildID,
-	})
+	info := execInfo{
+		fileName:   baseName,
+		buildID:    buildID,
+		omitFrames: r.framePaths.omit(fileName),
+		gnuBuildID: gnuBuildID && buildID != "",
+	}
+
+	// Backends with access to the same filesystem can use inode and device
+	// to locate the executable. Kernel modules or already exited processes
+	// can not be looked up, in which case this information is omitted. Kernel
+	// modules are reported by their bare name, which would be resolved relative
+	// to the working directory, so only absolute paths are looked up.
+	var st unix.Stat_t
+	if path.IsAbs(fileName) && unix.Stat(fileName, &st) == nil {
+		info.inode = st.Ino
+		info.device = st.Dev
+	}
+
+	r.executables.Add(fileID, info)
+}
+
+// MappingMetadata accepts the range of memory a previously reported executable
+// is loaded at and caches this information. If another process maps the
+// executable at a different range, no range is reported for it, rather than
+// the one of another process.
+func (r *OTLPReporter) MappingMetadata(fileID libpf.FileID, memoryStart, memoryLimit uint64) {
+	info, exists := r.executables.Peek(fileID)
+	if !exists || info.ambiguousRange {
+		return
+	}
+	switch {
+	case info.memoryStart == memoryStart && info.memoryLimit == memoryLimit:
+		return
+	case info.memoryLimit == 0:
+		info.memoryStart = memoryStart
+		info.memoryLimit = memoryLimit
+	default:
+		info.memoryStart = 0
+		info.memoryLimit = 0
+		info.ambiguousRange = true
+	}
+	r.executables.Add(fileID, info)
+}
+
+// ExpireExecutableMetadata keeps the metadata of the executable for
+// expiredExecutableLifetime, so that the samples collected before are still
+// reported with it, and removes it afterwards.
+func (r *OTLPReporter) ExpireExecutableMetadata(fileID libpf.FileID) {
+	info, exists := r.executables.Peek(fileID)
+	if !exists {
+		return
+	}
+	r.executables.AddWithLifetime(fileID, info, r.expiredExecutableLifetime)
 }
 
 // FrameMetadata accepts metadata associated with a frame and caches this information.
 func (r *OTLPReporter) FrameMetadata(fileID libpf.FileID, addressOrLine libpf.AddressOrLineno,
 	lineNumber libpf.SourceLineno, functionOffset uint32, functionName, filePath string) {
-	if v, exists := r.frames.Get(fileID); exists {
-		if filePath == "" {
-			// The new filePath may be empty, and we don't want to overwrite
-			// an existing filePath with it.
-			if s, exists := v[addressOrLine]; exists {
-				filePath = s.filePath
+	r.ReportFrameMetadata(&libpf.FrameMetadata{
+		FileID:         fileID,
+		AddressOrLine:  addressOrLine,
+		LineNumber:     lineNumber,
+		FunctionOffset: functionOffset,
+		FunctionName:   functionName,
+		Filename:       filePath,
+	})
+}
+
+// ReportFrameMetadata accepts metadata associated with a frame and caches this information.
+func (r *OTLPReporter) ReportFrameMetadata(frameMetadata *libpf.FrameMetadata) {
+	si := sourceInfo{
+		lineNumber:      frameMetadata.LineNumber,
+		functionOffset:  frameMetadata.FunctionOffset,
+		functionName:    frameMetadata.FunctionName,
+		filePath:        frameMetadata.Filename,
+		functionEndLine: frameMetadata.FunctionEndLine,
+		inlineFrames:    frameMetadata.InlineFrames,
+	}
+
+	r.framesMu.Lock()
+	defer r.framesMu.Unlock()
+
+	if v, exists := r.frames.Get(frameMetadata.FileID); exists {
+		if s, exists := v[frameMetadata.AddressOrLine]; exists {
+			// The new information may be incomplete, and we don't want to
+			// overwrite existing information with empty values.
+			if si.functionName == "" {
+				si.functionName = s.functionName
+			}
+			if si.filePath == "" {
+				si.filePath = s.filePath
+			}
+			// A zero line number is unknown. The function offset is relative
+			// to the line number, so both are kept together.
+			if si.lineNumber == 0 {
+				si.lineNumber = s.lineNumber
+				si.functionOffset = s.functionOffset
+			}
+			if si.functionEndLine == 0 {
+				si.functionEndLine = s.functionEndLine
+			}
+			if len(si.inlineFrames) == 0 {
+				si.inlineFrames = s.inlineFrames
 			}
 		}
-		v[addressOrLine] = sourceInfo{
-			lineNumber:     lineNumber,
-			functionOffset: functionOffset,
-			functionName:   functionName,
-			filePath:       filePath,
-		}
+		v[frameMetadata.AddressOrLine] = si
 		return
 	}
 
 	v := make(map[libpf.AddressOrLineno]sourceInfo)
-	v[addressOrLine] = sourceInfo{
-		lineNumber:     lineNumber,
-		functionOffset: functionOffset,
-		functionName:   functionName,
-		filePath:       filePath,
-	}
-	r.frames.Add(fileID, v)
+	v[frameMetadata.AddressOrLine] = si
+	r.frames.Add(frameMetadata.FileID, v)
 }
 
 // ReportHostMetadata enqueues host metadata.
@@ -272,156 +917,701 @@ func (r *OTLPReporter) addHostmetadata(metadataMap map[string]string) {
 // ReportMetrics is a NOP for OTLPReporter.
 func (r *OTLPReporter) ReportMetrics(_ uint32, _ []uint32, _ []int64) {}
 
-// Stop triggers a graceful shutdown of OTLPReporter.
+// Ready returns whether the collector was reachable on the last export, so that
+// it can be wired into a health endpoint. The returned error wraps
+// ErrNeverConnected if the collector was never reached, and ErrExportFailed if
+// the collector was reached before but the last export failed.
+func (r *OTLPReporter) Ready() (bool, error) {
+	return r.health.ready()
+}
+
+// Stop triggers a graceful shutdown of OTLPReporter. It waits up to the
+// shutdown timeout for the connections to the backends to be closed.
 func (r *OTLPReporter) Stop() {
 	close(r.stopSignal)
+	if r.stopped == nil {
+		return
+	}
+
+	timer := time.NewTimer(r.shutdownTimeout)
+	defer timer.Stop()
+	select {
+	case <-r.stopped:
+	case <-timer.C:
+		log.Warnf("Shutdown of the reporter did not complete within %v", r.shutdownTimeout)
+	}
+}
+
+// shutdown waits for the reporter to be stopped, then cancels the reporting
+// functions currently running and closes the connections to the backends.
+func (r *OTLPReporter) shutdown(cancelReporting context.CancelFunc, closers []io.Closer) {
+	<-r.stopSignal
+	cancelReporting()
+	for _, c := range closers {
+		if err := c.Close(); err != nil {
+			log.Errorf("Closing the connection to the backend failed: %v", err)
+		}
+	}
+	close(r.stopped)
 }
 
 // GetMetrics returns internal metrics of OTLPReporter.
 func (r *OTLPReporter) GetMetrics() Metrics {
-	return Metrics{
+	m := Metrics{
 		RPCBytesOutCount:  r.rpcStats.getRPCBytesOut(),
 		RPCBytesInCount:   r.rpcStats.getRPCBytesIn(),
 		WireBytesOutCount: r.rpcStats.getWireBytesOut(),
 		WireBytesInCount:  r.rpcStats.getWireBytesIn(),
+
+		TraceInfoGraceRecoveredCount: r.traceInfoGraceRecovered.Swap(0),
+		TraceInfoMissingDroppedCount: r.traceInfoMissingDropped.Swap(0),
+		TraceEvictionCount:           r.traceEvictions.Swap(0),
+		SampleEvictionCount:          r.sampleEvictions.Swap(0),
+		ExportBreakerOpen:            r.breaker.openGauge(),
+		ExportBreakerDroppedCount:    r.breaker.droppedCount(),
+		ExportSkippedCount:           r.sampler.skippedCount(),
+		ExportSkippedSamplesCount:    r.sampler.skippedSampleCount(),
+		ExportEndpointFailedCount:    r.fanOut.failureCount(),
+		ExportRejectedProfilesCount:  r.rejectedProfiles.Swap(0),
+		ExportRejectedSamplesCount:   r.rejectedSamples.Swap(0),
+		SymbolUploadPathDeniedCount:  r.uploadPathFilter.DeniedCount(),
+		ProfileBuildMaxUsec:          r.maxProfileBuildTime.Swap(0) / 1000,
+	}
+	if size := r.lastProfileSize.Load(); size != nil {
+		m.ProfileLocations = size.locations
+		m.ProfileFunctions = size.functions
+		m.ProfileMappings = size.mappings
+		m.ProfileStrings = size.strings
 	}
+	return m
 }
 
-// StartOTLP sets up and manages the reporting connection to a OTLP backend.
-func StartOTLP(mainCtx context.Context, c *Config) (Reporter, error) {
-	cacheSize := config.TraceCacheEntries()
+// newOTLPReporter validates c and returns an OTLPReporter with initialized
+// caches, but without a connection to a backend.
+func newOTLPReporter(c *Config) (*OTLPReporter, cacheSizes, error) {
+	// The grace period delays every report, so it must stay well below the
+	// report interval.
+	if maxGrace := c.Times.ReportInterval() / 10; c.TraceInfoGracePeriod > maxGrace {
+		return nil, cacheSizes{}, fmt.Errorf(
+			"trace info grace period %v exceeds maximum of %v", c.TraceInfoGracePeriod, maxGrace)
+	}
 
-	traces, err := lru.NewSynced[libpf.TraceHash, traceInfo](cacheSize, libpf.TraceHash.Hash32)
+	profileID, err := newProfileIDGenerator(c.ProfileIDMode, config.HostID())
 	if err != nil {
-		return nil, err
+		return nil, cacheSizes{}, err
 	}
 
-	samples, err := lru.NewSynced[libpf.TraceHash, sample](cacheSize, libpf.TraceHash.Hash32)
+	if err = validateIdleSamplesMode(c.IdleSamples); err != nil {
+		return nil, cacheSizes{}, err
+	}
+
+	buildIDMode, err := validateBuildIDMode(c.OTLPBuildIDMode)
 	if err != nil {
-		return nil, err
+		return nil, cacheSizes{}, err
 	}
 
-	fallbackSymbols, err := lru.NewSynced[libpf.FrameID, string](cacheSize, libpf.FrameID.Hash32)
+	framePaths, err := newFramePathFilter(c.OmitFramePaths)
 	if err != nil {
-		return nil, err
+		return nil, cacheSizes{}, err
 	}
 
-	executables, err := lru.NewSynced[libpf.FileID, execInfo](cacheSize, libpf.FileID.Hash32)
+	tenants, err := newTenantResolver(c.TenantNamespaces, c.TenantPodNameRegex)
 	if err != nil {
-		return nil, err
+		return nil, cacheSizes{}, err
+	}
+
+	schemaURL, err := validateSchemaURL(c.SchemaURL)
+	if err != nil {
+		return nil, cacheSizes{}, err
+	}
+
+	switch c.DefaultSampleType {
+	case "", "samples", "cpu", "alloc_space":
+	default:
+		return nil, cacheSizes{}, fmt.Errorf("unknown default sample type: %s",
+			c.DefaultSampleType)
+	}
+
+	if _, err = regexp.Compile(c.DropFrames); err != nil {
+		return nil, cacheSizes{}, fmt.Errorf("invalid drop frames regex: %v", err)
+	}
+	if _, err = regexp.Compile(c.KeepFrames); err != nil {
+		return nil, cacheSizes{}, fmt.Errorf("invalid keep frames regex: %v", err)
+	}
+
+	if c.CacheHighWaterMark < 0 || c.CacheHighWaterMark > 1 {
+		return nil, cacheSizes{}, fmt.Errorf("cache high-water mark %v is not between 0 and 1",
+			c.CacheHighWaterMark)
+	}
+	if c.ProfileBuildWarnFraction < 0 || c.ProfileBuildWarnFraction > 1 {
+		return nil, cacheSizes{}, fmt.Errorf(
+			"profile build warn fraction %v is not between 0 and 1", c.ProfileBuildWarnFraction)
+	}
+	if c.ReportJitter < 0 || c.ReportJitter >= 1 {
+		return nil, cacheSizes{}, fmt.Errorf("report jitter %v is not in [0, 1)",
+			c.ReportJitter)
+	}
+	if c.ExportSampleRate < 0 || c.ExportSampleRate > 1 {
+		return nil, cacheSizes{}, fmt.Errorf("export sample rate %v is not in [0, 1]",
+			c.ExportSampleRate)
+	}
+
+	// Samples are reported at the latest one report interval, plus the jitter,
+	// after their trace was seen last, which renews its trace information.
+	if minLifetime := 2 * c.Times.ReportInterval(); c.TraceInfoLifetime > 0 &&
+		c.TraceInfoLifetime < minLifetime {
+		return nil, cacheSizes{}, fmt.Errorf(
+			"trace info lifetime %v is below the minimum of %v", c.TraceInfoLifetime, minLifetime)
+	}
+
+	if c.ShutdownTimeout < 0 {
+		return nil, cacheSizes{}, fmt.Errorf("shutdown timeout %v is negative",
+			c.ShutdownTimeout)
+	}
+	if c.GRPCKeepaliveTime < 0 || c.GRPCKeepaliveTimeout < 0 {
+		return nil, cacheSizes{}, fmt.Errorf("gRPC keepalive time %v or timeout %v is negative",
+			c.GRPCKeepaliveTime, c.GRPCKeepaliveTimeout)
+	}
+
+	shutdownTimeout := c.ShutdownTimeout
+	if shutdownTimeout == 0 {
+		shutdownTimeout = defaultShutdownTimeout
+	}
+
+	if c.HostMetadataSource != nil && c.HostMetadataRefresh <= 0 {
+		return nil, cacheSizes{}, fmt.Errorf("host metadata refresh interval %v is not positive",
+			c.HostMetadataRefresh)
+	}
+
+	sizes, err := newCacheSizes(config.TraceCacheEntries(), c.CacheMemoryLimit)
+	if err != nil {
+		return nil, cacheSizes{}, err
+	}
+	sizes.log()
+
+	traces, err := newLockedLRU[libpf.TraceHash, traceInfo](sizes.traces,
+		libpf.TraceHash.Hash32)
+	if err != nil {
+		return nil, cacheSizes{}, err
+	}
+	if c.TraceInfoLifetime > 0 {
+		traces.SetLifetime(c.TraceInfoLifetime)
+	}
+
+	samples, err := newLockedLRU[libpf.TraceHash, sample](sizes.samples,
+		libpf.TraceHash.Hash32)
+	if err != nil {
+		return nil, cacheSizes{}, err
+	}
+
+	fallbackSymbols, err := lru.NewSynced[libpf.FrameID, string](sizes.fallbackSymbols,
+		libpf.FrameID.Hash32)
+	if err != nil {
+		return nil, cacheSizes{}, err
+	}
+
+	internedSymbols, err := lru.NewSynced[string, string](
+		max(sizes.fallbackSymbols/estimatedFramesPerFallbackSymbol, 1), hashString)
+	if err != nil {
+		return nil, cacheSizes{}, err
+	}
+
+	executables, err := lru.NewSynced[libpf.FileID, execInfo](sizes.executables,
+		libpf.FileID.Hash32)
+	if err != nil {
+		return nil, cacheSizes{}, err
+	}
+	if c.ExecutableMetadataLifetime > 0 {
+		executables.SetLifetime(c.ExecutableMetadataLifetime)
 	}
 
 	frames, err := lru.NewSynced[libpf.FileID,
-		map[libpf.AddressOrLineno]sourceInfo](cacheSize, libpf.FileID.Hash32)
+		map[libpf.AddressOrLineno]sourceInfo](sizes.frames, libpf.FileID.Hash32)
 	if err != nil {
-		return nil, err
+		return nil, cacheSizes{}, err
 	}
 
 	// Next step: Dynamically configure the size of this LRU.
 	// Currently we use the length of the JSON array in
 	// hostmetadata/hostmetadata.json.
-	hostmetadata, err := lru.NewSynced[string, string](115, hashString)
+	hostmetadata, err := lru.NewSynced[string, string](118, hashString)
 	if err != nil {
-		return nil, err
+		return nil, cacheSizes{}, err
 	}
 
 	r := &OTLPReporter{
 		stopSignal:      make(chan libpf.Void),
+		clock:           realClock{},
 		client:          nil,
 		rpcStats:        newStatsHandler(),
 		traces:          traces,
 		samples:         samples,
 		fallbackSymbols: fallbackSymbols,
+		internedSymbols: internedSymbols,
 		executables:     executables,
 		frames:          frames,
 		hostmetadata:    hostmetadata,
-		otlpBuildIDMode: c.OTLPBuildIDMode,
+		profileID:       profileID,
+		profileOptions: profileOptions{
+			samplesPerSecond:      config.SamplesPerSecond(),
+			otlpBuildIDMode:       buildIDMode,
+			rawNativeFrames:       c.RawNativeFrames,
+			kernelImageName:       expandKernelImageName(c.KernelImageName, config.KernelVersion()),
+			reportCPUTime:         c.ReportCPUTime,
+			idleSamples:           c.IdleSamples,
+			omitPlaceholderFrames: c.OmitPlaceholderFrames,
+			maxStackDepth:         c.MaxStackDepth,
+			dedupTimestamps:       c.DedupTimestamps,
+			dropFrames:            c.DropFrames,
+			defaultSampleType:     c.DefaultSampleType,
+			keepFrames:            c.KeepFrames,
+		},
+
+		traceInfoGracePeriod: c.TraceInfoGracePeriod,
+		traceInfoGraceLeft:   c.TraceInfoGracePeriod,
+		traceInfoMaxReports:  c.TraceInfoMaxReports,
+		traceInfoLifetime:    c.TraceInfoLifetime,
+		// Samples wait for their report for up to a report interval, plus the
+		// maximum jitter.
+		expiredExecutableLifetime: 2 * c.Times.ReportInterval(),
+		framePaths:                framePaths,
+		minSampleCount:            c.MinSampleCount,
+		breaker:                   newExportBreaker(c.ExportBreakerThreshold),
+		tenants:                   tenants,
+		capacities:                sizes,
+		cacheHighWaterMark:        c.CacheHighWaterMark,
+		profileBuildWarnFraction:  c.ProfileBuildWarnFraction,
+		profileSizeWarnLimit:      c.ProfileSizeWarnLimit,
+		shutdownTimeout:           shutdownTimeout,
+		maxSamplesPerReport:       c.MaxSamplesPerReport,
+		maxRequestSize:            c.MaxRequestSize,
+		flush:                     make(chan libpf.Void, 1),
+		schemaURL:                 schemaURL,
+		serviceName:               c.ServiceName,
+		profileNameKey:            c.ProfileNameKey,
+		profileName:               c.ProfileName,
+		omitProfileName:           c.OmitProfileName,
+		scopeName:                 c.ScopeName,
+		scopeVersionSuffix:        c.ScopeVersionSuffix,
+	}
+	if v := os.Getenv(resourceAttributesEnv); v != "" {
+		if r.envAttributes, err = parseResourceAttributes(v); err != nil {
+			log.Warnf("Ignoring the resource attributes of %s: %v", resourceAttributesEnv, err)
+		}
+		r.serviceName = envServiceName(r.serviceName, r.envAttributes)
+	}
+	if c.DetectResource {
+		r.detectedAttributes = detectResourceAttributes(context.TODO())
+	}
+
+	return r, sizes, nil
+}
+
+// StartOTLP sets up and manages the reporting connection to a OTLP backend.
+func StartOTLP(mainCtx context.Context, c *Config) (Reporter, error) {
+	r, sizes, err := newOTLPReporter(c)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := newTLSConfig(c)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TLS configuration: %v", err)
+	}
+
+	rpcCreds, err := newPerRPCCredentials(strings.TrimSpace(config.SecretToken()),
+		c.AuthTokenFile, c.RPCHeaders, c.DisableTLS)
+	if err != nil {
+		return nil, err
 	}
 
 	// Create a child context for reporting features
 	ctx, cancelReporting := context.WithCancel(mainCtx)
 
-	// Establish the gRPC connection before going on, waiting for a response
-	// from the collectionAgent endpoint.
-	// Use grpc.WithBlock() in setupGrpcConnection() for this to work.
-	otlpGrpcConn, err := waitGrpcEndpoint(ctx, c, r.rpcStats)
-	if err != nil {
+	if rpcCreds != nil {
+		refreshInterval := c.AuthTokenRefresh
+		if refreshInterval <= 0 {
+			refreshInterval = defaultAuthTokenRefreshInterval
+		}
+		go rpcCreds.run(ctx, refreshInterval)
+	}
+
+	// All backends share rpcStats, so that the statistics cover all of them.
+	addrs := collectorAddrs(c)
+	var clients []endpointClient
+	var otlpGrpcConns []*grpc.ClientConn
+	var otlpFile *fileProfilesClient
+	switch c.OTLPProtocol {
+	case OTLPProtocolGRPC, "":
+		for _, addr := range addrs {
+			// Establish the gRPC connection before going on, waiting for a response
+			// from the collectionAgent endpoint.
+			// Use grpc.WithBlock() in setupGrpcConnection() for this to work.
+			conn, err := waitGrpcEndpoint(ctx, c, addr, tlsConfig, rpcCreds, r.rpcStats)
+			if err != nil {
+				closeGrpcConns(otlpGrpcConns)
+				cancelReporting()
+				close(r.stopSignal)
+				return nil, err
+			}
+			otlpGrpcConns = append(otlpGrpcConns, conn)
+			clients = append(clients, endpointClient{
+				addr:   addr,
+				client: otlpcollector.NewProfilesServiceClient(conn),
+			})
+		}
+	case OTLPProtocolHTTP:
+		for _, addr := range addrs {
+			clients = append(clients, endpointClient{
+				addr: addr,
+				client: newHTTPProfilesClient(addr, tlsConfig, rpcCreds,
+					c.Times.GRPCOperationTimeout(), r.rpcStats),
+			})
+		}
+	case OTLPProtocolFile:
+		// The collector addresses don't apply, as no collector is involved.
+		otlpFile, err = newFileProfilesClient(c.OTLPFile, r.rpcStats)
+		if err != nil {
+			cancelReporting()
+			close(r.stopSignal)
+			return nil, err
+		}
+		clients = append(clients, endpointClient{addr: c.OTLPFile, client: otlpFile})
+	default:
 		cancelReporting()
 		close(r.stopSignal)
-		return nil, err
+		return nil, fmt.Errorf("unsupported OTLP protocol: %s", c.OTLPProtocol)
+	}
+	r.fanOut = &fanOutProfilesClient{endpoints: clients}
+	r.health = newHealthProfilesClient(r.fanOut.profilesClient())
+	if len(otlpGrpcConns) != 0 || otlpFile != nil {
+		// The gRPC connections and the file are established before the reporter
+		// starts.
+		r.health.markConnected()
 	}
-	r.client = otlpcollector.NewProfilesServiceClient(otlpGrpcConn)
+	r.client = r.health
+	r.sampler = newExportSampler(c.ExportSampleRate)
 
 	r.symuploader = NewNoopSymbolUploader()
 
-	if config.UploadSymbols() {
-		r.symuploader, err = symuploader.NewParcaSymbolUploader(
-			v1alpha1.NewDebuginfoServiceClient(otlpGrpcConn),
-			int(cacheSize),
-			c.NoExtractDebuginfo,
-		)
+	if config.UploadSymbols() && config.DryRun() {
+		log.Infof("Dry run: symbol upload is disabled")
+	} else if config.UploadSymbols() {
+		r.uploadPathFilter, err = symuploader.NewPathFilter(c.UploadAllowPaths,
+			c.UploadDenyPaths, c.UploadAllowBuildIDs, c.UploadDenyBuildIDs)
+		if err != nil {
+			closeGrpcConns(otlpGrpcConns)
+			otlpFile.closeOnError()
+			cancelReporting()
+			close(r.stopSignal)
+			return nil, fmt.Errorf("invalid symbol upload filter: %v", err)
+		}
+		params := SymbolUploaderParams{
+			Config:     c,
+			Conns:      otlpGrpcConns,
+			CacheSize:  int(sizes.executables),
+			PathFilter: r.uploadPathFilter,
+		}
+		if len(otlpGrpcConns) != 0 {
+			params.Conn = otlpGrpcConns[0]
+		}
+		r.symuploader, err = startSymbolUploader(c.SymbolUploader, params)
 		if err != nil {
+			closeGrpcConns(otlpGrpcConns)
+			otlpFile.closeOnError()
 			cancelReporting()
 			close(r.stopSignal)
 			return nil, err
 		}
 	}
 
-	go func() {
-		tick := time.NewTicker(c.Times.ReportInterval())
-		defer tick.Stop()
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case <-r.stopSignal:
-				return
-			case <-tick.C:
-				if err := r.reportOTLPProfile(ctx, c.Times.ReportInterval()); err != nil {
-					log.Errorf("Request failed: %v", err)
-				}
-				tick.Reset(libpf.AddJitter(c.Times.ReportInterval(), 0.2))
-			}
+	go r.reportLoop(ctx, c.Times.ReportInterval(), c.ReportJitter)
+	if c.HostMetadataSource != nil {
+		go r.hostMetadataLoop(ctx, c.HostMetadataRefresh, c.HostMetadataSource)
+	}
+
+	closers := make([]io.Closer, 0, len(otlpGrpcConns)+1)
+	for _, conn := range otlpGrpcConns {
+		closers = append(closers, conn)
+	}
+	if otlpFile != nil {
+		closers = append(closers, otlpFile)
+	}
+	r.stopped = make(chan libpf.Void)
+	go r.shutdown(cancelReporting, closers)
+
+	return r, nil
+}
+
+// hostMetadataLoop adds the host metadata of source every interval until ctx is
+// done or the reporter is stopped.
+func (r *OTLPReporter) hostMetadataLoop(ctx context.Context, interval time.Duration,
+	source func() map[string]string) {
+	tick := r.clock.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.stopSignal:
+			return
+		case <-tick.Chan():
+			r.addHostmetadata(source())
 		}
-	}()
+	}
+}
 
-	// When Stop() is called and a signal to 'stop' is received, then:
-	// - cancel the reporting functions currently running (using context)
-	// - close the gRPC connection with collection-agent
-	go func() {
-		<-r.stopSignal
-		cancelReporting()
-		if err := otlpGrpcConn.Close(); err != nil {
-			log.Fatalf("Stopping connection of OTLP client client failed: %v", err)
+// reportLoop reports every reportInterval, randomly shortened or extended by
+// jitter, until ctx is done or the reporter is stopped. Early reports requested
+// on flush restart the interval. As all reports are sent from the loop, an early
+// report never races with a regular one.
+func (r *OTLPReporter) reportLoop(ctx context.Context, reportInterval time.Duration,
+	jitter float64) {
+	tick := r.clock.NewTicker(reportInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.stopSignal:
+			return
+		case <-r.flush:
+			// The samples may already have been reported by a regular report
+			// after the early report was requested.
+			if r.pendingSamples.Load() <= r.maxSamplesPerReport {
+				continue
+			}
+			log.Debugf("Reporting early, more than %d samples were collected",
+				r.maxSamplesPerReport)
+		case <-tick.Chan():
+			r.traceInfoGraceLeft = r.traceInfoGracePeriod
 		}
-	}()
+		next := r.report(ctx, reportInterval)
+		r.logStats()
+		tick.Reset(libpf.AddJitter(next, jitter))
+	}
+}
 
-	return r, nil
+// report sends out the collected samples, or probes the backend with an empty
+// request if the export breaker is open. It returns the delay until the next
+// report.
+func (r *OTLPReporter) report(ctx context.Context, reportInterval time.Duration) time.Duration {
+	r.pendingSamples.Store(0)
+
+	var err error
+	if r.breaker.isOpen() {
+		_, err = r.client.Export(ctx, &otlpcollector.ExportProfilesServiceRequest{})
+		if err != nil {
+			log.Debugf("Probe failed: %v", err)
+		}
+	} else if err = r.reportOTLPProfile(ctx, reportInterval); err != nil {
+		log.Errorf("Request failed: %v", err)
+	}
+	return r.breaker.record(err, reportInterval)
 }
 
 // reportOTLPProfile creates and sends out an OTLP profile.
+// If tenant rules are configured, a separate profile is sent for every tenant.
+// If a maximum request size is configured, the profiles are split across as
+// many requests as needed.
 func (r *OTLPReporter) reportOTLPProfile(ctx context.Context, reportInterval time.Duration) error {
-	profile, startTS, endTS := r.getProfile()
+	start := time.Now()
+	window := r.reportWindow(reportInterval)
+
+	var resourceProfiles []*profiles.ResourceProfiles
+	for tenant, samples := range r.partitionByTenant(r.collectSamples()) {
+		resourceProfiles = append(resourceProfiles,
+			r.buildResourceProfiles(tenant, samples, window)...)
+	}
+	r.recordProfileSize(sizeOfResourceProfiles(resourceProfiles))
+
+	if len(resourceProfiles) == 0 {
+		log.Debugf("Skip sending of OTLP profile with no samples")
+		return nil
+	}
+	if !r.sampler.keep(resourceProfiles) {
+		return nil
+	}
+
+	batches := batchResourceProfiles(resourceProfiles, r.maxRequestSize)
+	r.recordProfileBuildTime(time.Since(start), reportInterval)
+
+	for _, batch := range batches {
+		req := otlpcollector.ExportProfilesServiceRequest{
+			ResourceProfiles: batch,
+		}
+
+		if config.DryRun() {
+			size := int64(proto.Size(&req))
+			log.Infof("Dry run: skip sending of %d OTLP profiles with %d samples (%d bytes)",
+				len(batch), numSamples(batch), size)
+			r.rpcStats.addBytes(dryRunStatsMethod, 0, 0, size, size)
+			continue
+		}
+
+		resp, err := r.client.Export(ctx, &req)
+		if err != nil {
+			return err
+		}
+		r.recordPartialSuccess(resp.GetPartialSuccess(), batch)
+	}
+	return nil
+}
+
+// recordProfileBuildTime records the time it took to build the profiles of a
+// report, and logs a warning if it exceeds the configured fraction of the
+// report interval. The time includes the sizing of the requests, but not the
+// marshaling by the client.
+func (r *OTLPReporter) recordProfileBuildTime(d, reportInterval time.Duration) {
+	for {
+		prev := r.maxProfileBuildTime.Load()
+		if int64(d) <= prev || r.maxProfileBuildTime.CompareAndSwap(prev, int64(d)) {
+			break
+		}
+	}
+
+	if r.profileBuildWarnFraction <= 0 {
+		return
+	}
+	if limit := time.Duration(r.profileBuildWarnFraction * float64(reportInterval)); d > limit {
+		log.Warnf("Building the profiles took %v, more than %v of the report interval of %v",
+			d, r.profileBuildWarnFraction, reportInterval)
+	}
+}
+
+// buildResourceProfiles returns the resource profiles of tenant that contain
+// samples. If a maximum request size is configured and the profile exceeds it,
+// the samples are split in halves, each of which is built into its own profile
+// with its own string table, until the profiles fit. A profile of a single
+// sample is returned even if it exceeds the maximum request size.
+func (r *OTLPReporter) buildResourceProfiles(tenant string,
+	samples map[libpf.TraceHash]sample, window time.Duration) []*profiles.ResourceProfiles {
+	profile, startTS, endTS := r.buildProfile(samples)
+	if len(profile.Sample) == 0 {
+		return nil
+	}
+	rp := r.getResourceProfiles(tenant, profile, startTS, endTS, window)
+	if r.maxRequestSize == 0 || len(profile.Sample) == 1 {
+		return []*profiles.ResourceProfiles{rp}
+	}
+	size := resourceProfilesSize(rp)
+	if size <= r.maxRequestSize {
+		return []*profiles.ResourceProfiles{rp}
+	}
+
+	first := make(map[libpf.TraceHash]sample, len(samples)/2)
+	second := make(map[libpf.TraceHash]sample, len(samples)-len(samples)/2)
+	for hash, s := range samples {
+		if len(first) < len(samples)/2 {
+			first[hash] = s
+		} else {
+			second[hash] = s
+		}
+	}
+	log.Debugf("Splitting OTLP profile with %d samples of %d bytes",
+		len(profile.Sample), size)
+	return append(r.buildResourceProfiles(tenant, first, window),
+		r.buildResourceProfiles(tenant, second, window)...)
+}
+
+// batchResourceProfiles groups resourceProfiles into the batches of consecutive
+// profiles that are sent in a single request each, so that no batch of several
+// profiles exceeds maxSize bytes. A maxSize of zero returns a single batch.
+func batchResourceProfiles(resourceProfiles []*profiles.ResourceProfiles,
+	maxSize int) [][]*profiles.ResourceProfiles {
+	if maxSize == 0 {
+		return [][]*profiles.ResourceProfiles{resourceProfiles}
+	}
+
+	var batches [][]*profiles.ResourceProfiles
+	var batch []*profiles.ResourceProfiles
+	batchSize := 0
+	for _, rp := range resourceProfiles {
+		size := resourceProfilesSize(rp)
+		if len(batch) != 0 && batchSize+size > maxSize {
+			batches = append(batches, batch)
+			batch = nil
+			batchSize = 0
+		}
+		batch = append(batch, rp)
+		batchSize += size
+	}
+	return append(batches, batch)
+}
+
+// resourceProfilesSize returns the number of bytes rp adds to the encoding of an
+// ExportProfilesServiceRequest, including its field tag and length.
+func resourceProfilesSize(rp *profiles.ResourceProfiles) int {
+	return protowire.SizeTag(1) + protowire.SizeBytes(proto.Size(rp))
+}
+
+// recordPartialSuccess logs and counts the profiles the collector rejected from
+// an export of resourceProfiles. The collector only reports the number of
+// rejected profiles, so the number of rejected samples is exact if all profiles
+// were rejected, and proportional to the rejected profiles otherwise.
+func (r *OTLPReporter) recordPartialSuccess(partial *otlpcollector.ExportProfilesPartialSuccess,
+	resourceProfiles []*profiles.ResourceProfiles) {
+	rejected := partial.GetRejectedProfiles()
+	if rejected <= 0 {
+		if msg := partial.GetErrorMessage(); msg != "" {
+			log.Warnf("Collector accepted all profiles with warning: %s", msg)
+		}
+		return
+	}
+
+	total := int64(len(resourceProfiles))
+	rejected = min(rejected, total)
+	samples := int64(numSamples(resourceProfiles)) * rejected / total
+	log.Errorf("Collector rejected %d of %d profiles (about %d samples): %s",
+		rejected, total, samples, partial.GetErrorMessage())
+	r.rejectedProfiles.Add(uint32(rejected))
+	r.rejectedSamples.Add(uint32(samples))
+}
 
-	if len(profile.Sample) == 0 {
-		log.Debugf("Skip sending of OTLP profile with no samples")
-		return nil
+// numSamples returns the number of samples of all profiles in resourceProfiles.
+func numSamples(resourceProfiles []*profiles.ResourceProfiles) int {
+	var n int
+	for _, rp := range resourceProfiles {
+		for _, sp := range rp.ScopeProfiles {
+			for _, pc := range sp.Profiles {
+				n += len(pc.Profile.Sample)
+			}
+		}
 	}
+	return n
+}
 
-	// A bit of a hack, but we need to set the duration of the profile.
-	if profile.DurationNanos == 0 {
-		profile.DurationNanos = reportInterval.Nanoseconds()
+// reportWindow returns the time since the previous report, measured with the
+// monotonic clock, and starts the next window. Before the first report after
+// startup, or if the reporter was not started, reportInterval is returned.
+func (r *OTLPReporter) reportWindow(reportInterval time.Duration) time.Duration {
+	now := r.clock.Now()
+	last := r.lastReport
+	r.lastReport = now
+	if last.IsZero() {
+		return reportInterval
 	}
+	return now.Sub(last)
+}
+
+// getResourceProfiles wraps profile with its resource and scope information.
+// If tenant is set, it is added as resource attribute. window is the duration
+// in which the samples of profile were collected.
+func (r *OTLPReporter) getResourceProfiles(tenant string, profile *pprofextended.Profile,
+	startTS, endTS libpf.UnixTime64, window time.Duration) *profiles.ResourceProfiles {
+	// The timestamps of the first and last sample only cover a part of the
+	// window, and none of it for a single sample. So the duration is taken
+	// from the report window instead.
+	profile.DurationNanos = window.Nanoseconds()
 
 	pc := []*profiles.ProfileContainer{{
-		// Next step: not sure about the value of ProfileId
 		// Discussion around this field and its requirements started with
 		// https://github.com/open-telemetry/oteps/pull/239#discussion_r1491546899
-		// As an ID with all zeros is considered invalid, we write ELASTIC here.
-		ProfileId:         []byte("ELASTIC"),
-		StartTimeUnixNano: uint64(time.Unix(int64(startTS), 0).UnixNano()),
-		EndTimeUnixNano:   uint64(time.Unix(int64(endTS), 0).UnixNano()),
-		// Attributes - Optional element we do not use.
+		// An ID with all zeros is considered invalid.
+		ProfileId:         r.profileID(r.clock.Now()),
+		StartTimeUnixNano: uint64(startTS),
+		EndTimeUnixNano:   uint64(endTS),
+		Attributes:        getProfileAttributes(profile, window),
 		// DroppedAttributesCount - Optional element we do not use.
 		// OriginalPayloadFormat - Optional element we do not use.
 		// OriginalPayload - Optional element we do not use.
@@ -429,53 +1619,55 @@ func (r *OTLPReporter) reportOTLPProfile(ctx context.Context, reportInterval tim
 	}}
 
 	scopeProfiles := []*profiles.ScopeProfiles{{
-		Profiles: pc,
-		Scope: &common.InstrumentationScope{
-			Name:    "Elastic-Universal-Profiling",
-			Version: fmt.Sprintf("%s@%s", vc.Version(), vc.Revision()),
-		},
-		// SchemaUrl - This element is not well defined yet. Therefore we skip it.
-	}}
-
-	resourceProfiles := []*profiles.ResourceProfiles{{
-		Resource:      r.getResource(),
-		ScopeProfiles: scopeProfiles,
-		// SchemaUrl - This element is not well defined yet. Therefore we skip it.
+		Profiles:  pc,
+		Scope:     instrumentationScope(r.scopeName, r.scopeVersionSuffix),
+		SchemaUrl: r.schemaURL,
 	}}
 
-	req := otlpcollector.ExportProfilesServiceRequest{
-		ResourceProfiles: resourceProfiles,
+	origin := r.getResource()
+	if tenant != "" {
+		origin.Attributes = append(origin.Attributes, &common.KeyValue{
+			Key:   tenantAttributeKey,
+			Value: &common.AnyValue{Value: &common.AnyValue_StringValue{StringValue: tenant}},
+		})
 	}
 
-	_, err := r.client.Export(ctx, &req)
-	return err
+	return &profiles.ResourceProfiles{
+		Resource:      origin,
+		ScopeProfiles: scopeProfiles,
+		SchemaUrl:     r.schemaURL,
+	}
 }
 
 // getResource returns the OTLP resource information of the origin of the profiles.
-// Next step: maybe extend this information with go.opentelemetry.io/otel/sdk/resource.
+// It only holds information about the host that is the same for every profile,
+// information that differs between profiles belongs to getProfileAttributes.
+// Attributes from OTEL_RESOURCE_ATTRIBUTES and those detected by the OpenTelemetry
+// SDK are added unless the host metadata already provides them, with the former
+// taking precedence, like for the SDKs.
 func (r *OTLPReporter) getResource() *resource.Resource {
-	keys := r.hostmetadata.Keys()
-
-	attributes := make([]*common.KeyValue, len(keys)+1)
-	i := 0
-	for _, k := range keys {
-		v, ok := r.hostmetadata.Get(k)
-		if !ok {
-			continue
-		}
-		attributes[i] = &common.KeyValue{
-			Key:   k,
-			Value: &common.AnyValue{Value: &common.AnyValue_StringValue{StringValue: v}},
+	metadata := make(map[string]string, r.hostmetadata.Len())
+	for _, k := range r.hostmetadata.Keys() {
+		if v, ok := r.hostmetadata.Get(k); ok {
+			metadata[k] = v
 		}
-
-		i++
 	}
-
-	// Add the name of the profile type.
-	attributes[i] = &common.KeyValue{
-		Key:   "__name__",
-		Value: &common.AnyValue{Value: &common.AnyValue_StringValue{StringValue: "otel_profiling_agent_on_cpu"}},
+	attributes := semconvAttributes(metadata, r.serviceName)
+	attributes = mergeAttributes(attributes, r.envAttributes)
+	attributes = mergeAttributes(attributes, r.detectedAttributes)
+
+	// Add the name of the profile type, unless the ingestion pipeline reserves
+	// its key.
+	if !r.omitProfileName {
+		attributes = append(attributes, profileNameAttribute(r.profileNameKey, r.profileName))
 	}
+	// Add the sampling frequency, so that profiles of agents that sample at
+	// different frequencies can be normalized.
+	attributes = append(attributes, &common.KeyValue{
+		Key: sampleFrequencyAttributeKey,
+		Value: &common.AnyValue{Value: &common.AnyValue_IntValue{
+			IntValue: int64(r.samplesPerSecond)}},
+	})
 
 	origin := &resource.Resource{
 		Attributes: attributes,
@@ -483,8 +1675,92 @@ func (r *OTLPReporter) getResource() *resource.Resource {
 	return origin
 }
 
+// getProfileAttributes returns the attributes that describe a single profile:
+//   - "profile.runtime" is the runtime most samples of the profile were taken in. A
+//     sample is attributed to the first interpreted frame of its trace, or to
+//     native code if it has none.
+//   - "profile.window.duration_ns" is the length of the aggregation window.
+func getProfileAttributes(profile *pprofextended.Profile,
+	window time.Duration) []*common.KeyValue {
+	attributes := []*common.KeyValue{{
+		Key: "profile.window.duration_ns",
+		Value: &common.AnyValue{Value: &common.AnyValue_IntValue{
+			IntValue: window.Nanoseconds()}},
+	}}
+
+	if runtime := dominantRuntime(profile); runtime != "" {
+		attributes = append(attributes, &common.KeyValue{
+			Key: "profile.runtime",
+			Value: &common.AnyValue{Value: &common.AnyValue_StringValue{
+				StringValue: runtime}},
+		})
+	}
+	return attributes
+}
+
+// dominantRuntime returns the runtime most samples of profile were taken in.
+// It returns an empty string for a profile without samples.
+func dominantRuntime(profile *pprofextended.Profile) string {
+	native := libpf.NativeFrame.String()
+	unattributed := map[string]bool{
+		native:                      true,
+		libpf.KernelFrame.String():  true,
+		libpf.AbortFrame.String():   true,
+		libpf.UnknownFrame.String(): true,
+	}
+
+	counts := make(map[string]int64)
+	for _, sample := range profile.Sample {
+		runtime := native
+		indices := profile.LocationIndices[sample.LocationsStartIndex:][:sample.LocationsLength]
+		for _, idx := range indices {
+			frameType := locationFrameType(profile, profile.Location[idx])
+			if !unattributed[frameType] {
+				runtime = frameType
+				break
+			}
+		}
+		counts[runtime] += sample.Value[0]
+	}
+
+	var dominant string
+	for runtime, count := range counts {
+		if count > counts[dominant] || (count == counts[dominant] && runtime < dominant) {
+			dominant = runtime
+		}
+	}
+	return dominant
+}
+
 // getProfile returns an OTLP profile containing all collected samples up to this moment.
-func (r *OTLPReporter) getProfile() (profile *pprofextended.Profile, startTS uint64, endTS uint64) {
+func (r *OTLPReporter) getProfile() (profile *pprofextended.Profile,
+	startTS, endTS libpf.UnixTime64) {
+	profile, startTS, endTS = r.buildProfile(r.collectSamples())
+	r.recordProfileSize(sizeOfProfile(profile))
+	return profile, startTS, endTS
+}
+
+// checkCacheUsage logs a warning if the number of samples collected since the last
+// report exceeds the high-water mark, as further samples evict pending ones.
+func (r *OTLPReporter) checkCacheUsage() {
+	if r.cacheHighWaterMark <= 0 || r.capacities.samples == 0 {
+		return
+	}
+	used := r.samples.Len()
+	if float64(used) < r.cacheHighWaterMark*float64(r.capacities.samples) {
+		return
+	}
+	log.Warnf("Sample cache is at %d of %d entries (%d samples and %d traces evicted "+
+		"since the last metrics report), increase the cache size to avoid losing samples",
+		used, r.capacities.samples, r.sampleEvictions.Load(), r.traceEvictions.Load())
+}
+
+// collectSamples removes and returns all collected samples with known trace
+// information. Samples for which trace information is missing or whose count is
+// below the minimum sample count are kept for the next report.
+func (r *OTLPReporter) collectSamples() map[libpf.TraceHash]sample {
+	r.checkCacheUsage()
+
 	// Avoid overlapping locks by copying its content.
 	sampleKeys := r.samples.Keys()
 	samplesCpy := make(map[libpf.TraceHash]sample, len(sampleKeys))
@@ -505,15 +1781,159 @@ func (r *OTLPReporter) getProfile() (profile *pprofextended.Profile, startTS uin
 		}
 	}
 
+	if len(samplesWoTraceinfo) != 0 && r.traceInfoGraceLeft > 0 {
+		samplesWoTraceinfo = r.awaitTraceInfo(samplesWoTraceinfo)
+	}
+
 	if len(samplesWoTraceinfo) != 0 {
 		log.Debugf("Missing trace information for %d samples", len(samplesWoTraceinfo))
-		// Return samples for which relevant information is not available yet.
+		// Return samples for which relevant information is not available yet,
+		// unless they already waited for it too long.
+		dropped := uint32(0)
 		for _, trace := range samplesWoTraceinfo {
-			r.samples.Add(trace, samplesCpy[trace])
+			s := samplesCpy[trace]
 			delete(samplesCpy, trace)
+			s.missedReports++
+			if r.traceInfoMaxReports > 0 && s.missedReports >= r.traceInfoMaxReports {
+				dropped++
+				continue
+			}
+			r.samples.Add(trace, s)
+		}
+		if dropped != 0 {
+			log.Debugf("Dropped %d samples without trace information after %d reports",
+				dropped, r.traceInfoMaxReports)
+			r.traceInfoMissingDropped.Add(dropped)
+		}
+	}
+
+	if r.minSampleCount > 1 {
+		r.holdBackSamples(samplesCpy)
+	}
+
+	return samplesCpy
+}
+
+// renewTraceInfo renews the lifetime of the information of the trace, so that it
+// does not expire while a sample of the trace still waits for its report.
+func (r *OTLPReporter) renewTraceInfo(traceHash libpf.TraceHash) {
+	if r.traceInfoLifetime == 0 {
+		return
+	}
+	r.traces.update(func(traces *lru.LRU[libpf.TraceHash, traceInfo]) {
+		if v, ok := traces.Peek(traceHash); ok {
+			traces.Add(traceHash, v)
+		}
+	})
+}
+
+// holdBackSamples moves the samples of samplesCpy whose count is below the minimum
+// sample count back to samples, so that their counts accumulate until they reach
+// the minimum in a later report. Samples without a count, like samples that only
+// hold allocations, are never held back.
+func (r *OTLPReporter) holdBackSamples(samplesCpy map[libpf.TraceHash]sample) {
+	held := 0
+	for hash, s := range samplesCpy {
+		if s.count == 0 || s.count >= r.minSampleCount {
+			continue
+		}
+		// Merge what was reported for the trace since the samples were collected.
+		if v, ok := r.samples.Peek(hash); ok {
+			s.count += v.count
+			s.allocBytes += v.allocBytes
+			s.timestamps = append(s.timestamps, v.timestamps...)
+		}
+		r.addSample(hash, s)
+		r.renewTraceInfo(hash)
+		delete(samplesCpy, hash)
+		held++
+	}
+	if held != 0 {
+		log.Debugf("Holding back %d samples with a count below %d", held, r.minSampleCount)
+	}
+}
+
+// buildProfile returns an OTLP profile containing samplesCpy. The trace
+// information of every sample must be available in traces.
+func (r *OTLPReporter) buildProfile(samplesCpy map[libpf.TraceHash]sample) (
+	profile *pprofextended.Profile, startTS, endTS libpf.UnixTime64) {
+	return newProfile(r.profileData(samplesCpy), &r.profileOptions)
+}
+
+// profileData looks up the information about the traces of samples and their
+// executables and frames in the caches. The returned data shares no maps with
+// the caches, so that profiles can be built while new information is reported.
+func (r *OTLPReporter) profileData(samples map[libpf.TraceHash]sample) *profileData {
+	data := &profileData{
+		samples:         samples,
+		traces:          make(map[libpf.TraceHash]traceInfo, len(samples)),
+		executables:     make(map[libpf.FileID]execInfo),
+		frames:          make(map[libpf.FileID]map[libpf.AddressOrLineno]sourceInfo),
+		fallbackSymbols: make(map[libpf.FrameID]string),
+		kernelModules:   make(map[libpf.FileID]string),
+	}
+	seenFiles := make(map[libpf.FileID]libpf.Void)
+	// cachedFrames holds the frame maps of the cache, of which only the entries
+	// used by the traces are copied.
+	cachedFrames := make(map[libpf.FileID]map[libpf.AddressOrLineno]sourceInfo)
+
+	r.framesMu.RLock()
+	defer r.framesMu.RUnlock()
+
+	for traceHash := range samples {
+		trace, exists := r.traces.Get(traceHash)
+		if !exists {
+			continue
+		}
+		data.traces[traceHash] = trace
+
+		for i, fileID := range trace.files {
+			switch trace.frameTypes[i] {
+			case libpf.KernelFrame:
+				frameID := libpf.NewFrameID(fileID, trace.linenos[i])
+				if symbol, exists := r.fallbackSymbols.Get(frameID); exists {
+					data.fallbackSymbols[frameID] = symbol
+				}
+				if _, seen := data.kernelModules[fileID]; !seen {
+					if info, exists := r.executables.Get(fileID); exists {
+						data.kernelModules[fileID] = info.fileName
+					}
+				}
+				continue
+			case libpf.AbortFrame:
+				continue
+			}
+
+			if _, seen := seenFiles[fileID]; !seen {
+				seenFiles[fileID] = libpf.Void{}
+				if info, exists := r.executables.Get(fileID); exists {
+					data.executables[fileID] = info
+				}
+				if trace.frameTypes[i] != libpf.NativeFrame {
+					if frames, exists := r.frames.Get(fileID); exists {
+						cachedFrames[fileID] = frames
+						data.frames[fileID] = make(map[libpf.AddressOrLineno]sourceInfo)
+					}
+				}
+			}
+			if frames, exists := cachedFrames[fileID]; exists {
+				if si, exists := frames[trace.linenos[i]]; exists {
+					data.frames[fileID][trace.linenos[i]] = si
+				}
+			}
 		}
 	}
+	return data
+}
 
+// newProfile returns an OTLP profile containing the samples of data. It only
+// depends on its arguments, so that it can be tested with deterministic input.
+// It does not read the clock, as the timestamps of the profile are those of
+// its samples.
+// The lookup maps that build the tables of the profile are owned by the call,
+// so profiles can be built concurrently as long as data is not modified.
+func newProfile(data *profileData, opts *profileOptions) (
+	profile *pprofextended.Profile, startTS, endTS libpf.UnixTime64) {
 	// stringMap is a temporary helper that will build the StringTable.
 	// By specification, the first element should be empty.
 	stringMap := make(map[string]uint32)
@@ -523,7 +1943,14 @@ func (r *OTLPReporter) getProfile() (profile *pprofextended.Profile, startTS uin
 	// in profile and make sure information is deduplicated.
 	funcMap := make(map[funcInfo]uint64)
 
-	numSamples := len(samplesCpy)
+	// attrMap is a temporary helper that will build the AttributeTable
+	// in profile and make sure information is deduplicated.
+	attrMap := make(map[attrKeyValue]uint64)
+
+	// period is the CPU time in nanoseconds that is represented by a single sample.
+	period := 1e9 / int64(opts.samplesPerSecond)
+
+	numSamples := len(data.samples)
 	profile = &pprofextended.Profile{
 		// SampleType - Next step: Figure out the correct SampleType.
 		Sample: make([]*pprofextended.Sample, 0, numSamples),
@@ -535,115 +1962,143 @@ func (r *OTLPReporter) getProfile() (profile *pprofextended.Profile, startTS uin
 			Type: int64(getStringMapIndex(stringMap, "cpu")),
 			Unit: int64(getStringMapIndex(stringMap, "nanoseconds")),
 		},
-		Period: 1e9 / int64(config.SamplesPerSecond()),
-		// LocationIndices - Optional element we do not use.
-		// AttributeTable - Optional element we do not use.
+		Period: period,
+		// An empty regular expression references the empty string at index 0,
+		// which leaves these unset.
+		DropFrames: int64(getStringMapIndex(stringMap, opts.dropFrames)),
+		KeepFrames: int64(getStringMapIndex(stringMap, opts.keepFrames)),
 		// AttributeUnits - Optional element we do not use.
 		// LinkTable - Optional element we do not use.
-		// DropFrames - Optional element we do not use.
-		// KeepFrames - Optional element we do not use.
 		// TimeNanos - Optional element we do not use.
-		// DurationNanos - Optional element we do not use.
+		// DurationNanos - Set from the report window in getResourceProfiles.
 		// Comment - Optional element we do not use.
-		// DefaultSampleType - Optional element we do not use.
+		// DefaultSampleType - Set once all sample types are known.
+	}
+
+	if opts.reportCPUTime {
+		profile.SampleType = append(profile.SampleType, &pprofextended.ValueType{
+			Type: int64(getStringMapIndex(stringMap, "cpu")),
+			Unit: int64(getStringMapIndex(stringMap, "nanoseconds")),
+		})
+	}
+
+	// Allocations are only reported as additional value, if any sample holds
+	// allocations, so that CPU only profiles keep their layout.
+	reportAllocations := false
+	for _, s := range data.samples {
+		if s.allocBytes != 0 {
+			reportAllocations = true
+			break
+		}
+	}
+	if reportAllocations {
+		profile.SampleType = append(profile.SampleType, &pprofextended.ValueType{
+			Type: int64(getStringMapIndex(stringMap, "alloc_space")),
+			Unit: int64(getStringMapIndex(stringMap, "bytes")),
+		})
 	}
 
-	locationIndex := uint64(0)
+	profile.DefaultSampleType = defaultSampleType(profile.SampleType, stringMap,
+		opts.defaultSampleType)
 
 	// Temporary lookup to reference existing Mappings.
-	fileIDtoMapping := make(map[libpf.FileID]uint64)
+	fileIDtoMapping := make(map[libpf.FileID]mappingRef)
 	frameIDtoFunction := make(map[libpf.FrameID]uint64)
 
-	for traceHash, sampleInfo := range samplesCpy {
+	// Temporary lookup to reference existing Locations, as the same frames
+	// usually show up in many samples.
+	locationMap := make(map[locationKey]int64)
+	// truncatedLocations references the synthetic locations of truncated
+	// traces by the number of truncated frames.
+	truncatedLocations := make(map[int]int64)
+
+	for traceHash, sampleInfo := range data.samples {
 		sample := &pprofextended.Sample{}
-		sample.LocationsStartIndex = locationIndex
+		// LocationsStartIndex references the first element of the sample
+		// in profile.LocationIndices.
+		sample.LocationsStartIndex = uint64(len(profile.LocationIndices))
 
 		// Earlier we peeked into traces for traceHash and know it exists.
-		trace, _ := r.traces.Get(traceHash)
+		trace := data.traces[traceHash]
+
+		// The sampler does not flag samples of the idle task, so they are
+		// detected by the name of the task.
+		idle := isIdleComm(trace.comm)
+		if idle && opts.idleSamples == IdleSamplesDrop {
+			continue
+		}
+		// Samples whose values are all zero carry no information, but would
+		// show up as empty stacks. As they are skipped before any of their
+		// frames are added, the profile holds no locations only they reference.
+		if sampleInfo.count == 0 && sampleInfo.allocBytes == 0 {
+			continue
+		}
 
 		sample.StacktraceIdIndex = getStringMapIndex(stringMap,
 			traceHash.StringNoQuotes())
 
-		sample.Timestamps = make([]uint64, 0, len(sampleInfo.timestamps))
-		for _, ts := range sampleInfo.timestamps {
-			sample.Timestamps = append(sample.Timestamps,
-				uint64(time.Unix(int64(ts), 0).UnixMilli()))
-			if ts < startTS || startTS == 0 {
-				startTS = ts
-				continue
+		sample.Timestamps = sortedTimestamps(sampleInfo.timestamps, opts.dedupTimestamps)
+		if n := len(sample.Timestamps); n != 0 {
+			if first := libpf.UnixTime64(sample.Timestamps[0]); first < startTS || startTS == 0 {
+				startTS = first
 			}
-			if ts > endTS {
-				endTS = ts
+			if last := libpf.UnixTime64(sample.Timestamps[n-1]); last > endTS {
+				endTS = last
 			}
 		}
 
-		// Walk every frame of the trace.
-		for i := range trace.frameTypes {
+		// Walk every frame of the trace, up to the maximum stack depth.
+		numFrames := len(trace.frameTypes)
+		if opts.maxStackDepth != 0 {
+			numFrames = min(numFrames, int(opts.maxStackDepth))
+		}
+		for i := 0; i < numFrames; i++ {
+			key := locationKey{
+				fileID:        trace.files[i],
+				addressOrLine: trace.linenos[i],
+				frameType:     trace.frameTypes[i],
+			}
+			if trace.jitTiers != nil {
+				key.jitTier = trace.jitTiers[i]
+			}
+			if locIndex, exists := locationMap[key]; exists {
+				if locIndex != omittedLocation {
+					profile.LocationIndices = append(profile.LocationIndices, locIndex)
+				}
+				continue
+			}
+			if exe, ok := data.executables[key.fileID]; ok && exe.omitFrames {
+				locationMap[key] = omittedLocation
+				continue
+			}
+
 			loc := &pprofextended.Location{
 				// Id - Optional element we do not use.
-				TypeIndex: getStringMapIndex(stringMap,
-					trace.frameTypes[i].String()),
+				// TypeIndex - Optional element we do not use.
 				Address: uint64(trace.linenos[i]),
 				// IsFolded - Optional element we do not use.
-				// Attributes - Optional element we do not use.
+				Attributes: []uint64{getAttributeIndex(attrMap, frameTypeAttribute,
+					trace.frameTypes[i].String())},
 			}
 
 			switch frameKind := trace.frameTypes[i]; frameKind {
 			case libpf.NativeFrame:
 				// As native frames are resolved in the backend, we use Mapping to
 				// report these frames.
-
-				var locationMappingIndex uint64
-				if tmpMappingIndex, exists := fileIDtoMapping[trace.files[i]]; exists {
-					locationMappingIndex = tmpMappingIndex
-				} else {
-					idx := uint64(len(fileIDtoMapping))
-					fileIDtoMapping[trace.files[i]] = idx
-					locationMappingIndex = idx
-
-					execInfo, exists := r.executables.Get(trace.files[i])
-
-					// Next step: Select a proper default value,
-					// if the name of the executable is not known yet.
-					var fileName = "UNKNOWN"
-					if exists {
-						fileName = execInfo.fileName
-					}
-
-					var (
-						buildID     = "UNKNOWN"
-						buildIDKind pprofextended.BuildIdKind
-					)
-					if r.otlpBuildIDMode == "linker" {
-						buildID = execInfo.buildID
-						buildIDKind = *pprofextended.BuildIdKind_BUILD_ID_LINKER.Enum()
-					}
-					if r.otlpBuildIDMode == "hash" {
-						buildID = trace.files[i].StringNoQuotes()
-						buildIDKind = *pprofextended.BuildIdKind_BUILD_ID_BINARY_HASH.Enum()
-					}
-
-					profile.Mapping = append(profile.Mapping, &pprofextended.Mapping{
-						// Id - Optional element we do not use.
-						// MemoryStart - Optional element we do not use.
-						// MemoryLImit - Optional element we do not use.
-						FileOffset:  uint64(trace.linenos[i]),
-						Filename:    int64(getStringMapIndex(stringMap, fileName)),
-						BuildId:     int64(getStringMapIndex(stringMap, buildID)),
-						BuildIdKind: buildIDKind,
-						// Attributes - Optional element we do not use.
-						// HasFunctions - Optional element we do not use.
-						// HasFilenames - Optional element we do not use.
-						// HasLineNumbers - Optional element we do not use.
-						// HasInlinedFrames - Optional element we do not use.
-					})
-				}
-
 				// Indexes used in locations are 1-indexed, 0 is the zero-value
 				// and therefore "reserved" for unset, so 1 has to be added to
 				// the returned index.
-				loc.MappingIndex = locationMappingIndex + 1
+				loc.MappingIndex = getNativeMappingIndex(fileIDtoMapping, stringMap,
+					attrMap, profile, data.executables, opts.otlpBuildIDMode,
+					opts.rawNativeFrames, trace.files[i], trace.linenos[i]) + 1
 			case libpf.KernelFrame:
+				// The address of kernel frames is the offset to the .text section
+				// of their module. Other addresses are relative to the start of
+				// the kernel text, which is reported in the host:kernel_text_base
+				// resource attribute, or absolute if the resource attribute is
+				// missing. Offsets of addresses below the kernel text are negative
+				// and stored as two's complement in the Address of the location.
+
 				// Reconstruct frameID
 				frameID := libpf.NewFrameID(trace.files[i], trace.linenos[i])
 				// Store Kernel frame information as Line message:
@@ -655,18 +2110,23 @@ func (r *OTLPReporter) getProfile() (profile *pprofextended.Profile, startTS uin
 					// to the returned index.
 					line.FunctionIndex = tmpFunctionIndex + 1
 				} else {
-					symbol, exists := r.fallbackSymbols.Get(frameID)
+					symbol, exists := data.fallbackSymbols[frameID]
 					if !exists {
+						if opts.omitPlaceholderFrames {
+							locationMap[key] = omittedLocation
+							continue
+						}
 						// TODO: choose a proper default value if the kernel symbol was not
 						// reported yet.
-						symbol = "UNKNOWN"
+						symbol = unknownPlaceholder
 					}
 
 					// Indexes used in lines are 1-indexed, 0 is the zero-value
 					// and therefore "reserved" for unset, so 1 has to be added
 					// to the returned index.
-					line.FunctionIndex = createFunctionEntry(funcMap,
-						symbol, "vmlinux") + 1
+					line.FunctionIndex = createFunctionEntry(funcMap, symbol,
+						kernelFileName(data.kernelModules, trace.files[i],
+							opts.kernelImageName), 0) + 1
 				}
 				loc.Line = append(loc.Line, line)
 
@@ -680,13 +2140,38 @@ func (r *OTLPReporter) getProfile() (profile *pprofextended.Profile, startTS uin
 				// Next step: Figure out how the OTLP protocol
 				// could handle artificial frames, like AbortFrame,
 				// that are not originate from a native or interpreted
-				// program.
+				// program. Until then, report a synthetic function so
+				// that callers do not appear to call the wrong function.
+				// Indexes used in lines are 1-indexed, 0 is the zero-value
+				// and therefore "reserved" for unset, so 1 has to be added
+				// to the returned index.
+				loc.Line = append(loc.Line, &pprofextended.Line{
+					FunctionIndex: createFunctionEntry(funcMap,
+						abortFrameFunctionName, frameKind.String(), 0) + 1,
+				})
+
+				// To be compliant with the protocol generate a dummy mapping
+				// entry. Indexes used in locations are 1-indexed, 0 is the
+				// zero-value and therefore "reserved" for unset, so 1 has to
+				// be added to the returned index.
+				loc.MappingIndex = getDummyMappingIndex(fileIDtoMapping, stringMap,
+					profile, trace.files[i]) + 1
 			default:
 				// Store interpreted frame information as Line message:
 				line := &pprofextended.Line{}
 
-				fileIDInfo, exists := r.frames.Get(trace.files[i])
+				// The tier is known independent of the source of the frame.
+				if key.jitTier != libpf.JITTierUnknown {
+					loc.Attributes = append(loc.Attributes,
+						getAttributeIndex(attrMap, "jit.tier", key.jitTier.String()))
+				}
+
+				fileIDInfo, exists := data.frames[trace.files[i]]
 				if !exists {
+					if opts.omitPlaceholderFrames {
+						locationMap[key] = omittedLocation
+						continue
+					}
 
 					// At this point, we do not have enough information for the
 					// frame. Therefore, we report a dummy entry and use the
@@ -694,10 +2179,14 @@ func (r *OTLPReporter) getProfile() (profile *pprofextended.Profile, startTS uin
 					// 1-indexed, 0 is the zero-value and therefore "reserved"
 					// for unset, so 1 has to be added to the returned index.
 					line.FunctionIndex = createFunctionEntry(funcMap,
-						"UNREPORTED", frameKind.String()) + 1
+						unreportedFunctionName, frameKind.String(), 0) + 1
 				} else {
 					si, exists := fileIDInfo[trace.linenos[i]]
 					if !exists {
+						if opts.omitPlaceholderFrames {
+							locationMap[key] = omittedLocation
+							continue
+						}
 						// At this point, we do not have enough information for
 						// the frame. Therefore, we report a dummy entry and
 						// use the interpreter as filename. To differentiate
@@ -708,15 +2197,36 @@ func (r *OTLPReporter) getProfile() (profile *pprofextended.Profile, startTS uin
 						// "reserved" for unset, so 1 has to be added to the
 						// returned index.
 						line.FunctionIndex = createFunctionEntry(funcMap,
-							"UNRESOLVED", frameKind.String()) + 1
+							unresolvedFunctionName, frameKind.String(), 0) + 1
 					} else {
 						line.Line = int64(si.lineNumber)
 
+						if si.functionEndLine != 0 {
+							// Function only holds the first line of a function, so the
+							// last line is reported as attribute of the location.
+							loc.Attributes = append(loc.Attributes,
+								getAttributeIndex(attrMap, "code.function.end_line",
+									int64(si.functionEndLine)))
+						}
+
 						// Indexes used in lines are 1-indexed, 0 is the
 						// zero-value and therefore "reserved" for unset, so 1
 						// has to be added to the returned index.
 						line.FunctionIndex = createFunctionEntry(funcMap,
-							si.functionName, si.filePath) + 1
+							si.functionName, si.filePath, si.startLine()) + 1
+
+						// In pprof, the last Line of a Location is the caller
+						// into which the preceding Lines were inlined. So the
+						// inlined functions are reported from callee to caller,
+						// ahead of the function they were inlined into.
+						for j := len(si.inlineFrames) - 1; j >= 0; j-- {
+							inline := si.inlineFrames[j]
+							loc.Line = append(loc.Line, &pprofextended.Line{
+								FunctionIndex: createFunctionEntry(funcMap,
+									inline.FunctionName, inline.Filename, 0) + 1,
+								Line: int64(inline.LineNumber),
+							})
+						}
 					}
 				}
 				loc.Line = append(loc.Line, line)
@@ -728,13 +2238,32 @@ func (r *OTLPReporter) getProfile() (profile *pprofextended.Profile, startTS uin
 				loc.MappingIndex = getDummyMappingIndex(fileIDtoMapping, stringMap,
 					profile, trace.files[i]) + 1
 			}
+			locIndex := int64(len(profile.Location))
+			locationMap[key] = locIndex
+			profile.LocationIndices = append(profile.LocationIndices, locIndex)
 			profile.Location = append(profile.Location, loc)
 		}
+		if truncated := len(trace.frameTypes) - numFrames; truncated > 0 {
+			profile.LocationIndices = append(profile.LocationIndices,
+				getTruncatedLocationIndex(truncatedLocations, funcMap, fileIDtoMapping,
+					stringMap, profile, truncated))
+		}
 
 		sample.Value = []int64{int64(sampleInfo.count)}
+		if opts.reportCPUTime {
+			sample.Value = append(sample.Value, int64(sampleInfo.count)*period)
+		}
+		if reportAllocations {
+			sample.Value = append(sample.Value, int64(sampleInfo.allocBytes))
+		}
 		sample.Label = getTraceLabels(stringMap, trace)
-		sample.LocationsLength = uint64(len(trace.frameTypes))
-		locationIndex += sample.LocationsLength
+		if idle && opts.idleSamples == IdleSamplesLabel {
+			sample.Label = append(sample.Label, &pprofextended.Label{
+				Key: int64(getStringMapIndex(stringMap, "cpu.state")),
+				Str: int64(getStringMapIndex(stringMap, "idle")),
+			})
+		}
+		sample.LocationsLength = uint64(len(profile.LocationIndices)) - sample.LocationsStartIndex
 
 		profile.Sample = append(profile.Sample, sample)
 	}
@@ -743,13 +2272,35 @@ func (r *OTLPReporter) getProfile() (profile *pprofextended.Profile, startTS uin
 	// Populate the deduplicated functions into profile.
 	funcTable := make([]*pprofextended.Function, len(funcMap))
 	for v, idx := range funcMap {
+		name := int64(getStringMapIndex(stringMap, v.name))
 		funcTable[idx] = &pprofextended.Function{
-			Name:     int64(getStringMapIndex(stringMap, v.name)),
-			Filename: int64(getStringMapIndex(stringMap, v.fileName)),
+			Name: name,
+			// The reported names are the ones the runtime knows the function
+			// by, as the agent does not demangle names.
+			SystemName: name,
+			Filename:   int64(getStringMapIndex(stringMap, v.fileName)),
+			StartLine:  v.startLine,
 		}
 	}
 	profile.Function = append(profile.Function, funcTable...)
 
+	// Populate the deduplicated attributes into profile.
+	attrTable := make([]*common.KeyValue, len(attrMap))
+	for v, idx := range attrMap {
+		value := &common.AnyValue{}
+		switch val := v.value.(type) {
+		case int64:
+			value.Value = &common.AnyValue_IntValue{IntValue: val}
+		case string:
+			value.Value = &common.AnyValue_StringValue{StringValue: val}
+		}
+		attrTable[idx] = &common.KeyValue{
+			Key:   v.key,
+			Value: value,
+		}
+	}
+	profile.AttributeTable = append(profile.AttributeTable, attrTable...)
+
 	// When ranging over stringMap the order will be according to the
 	// hash value of the key. To get the correct order for profile.StringTable,
 	// put the values in stringMap in the correct array order.
@@ -759,22 +2310,88 @@ func (r *OTLPReporter) getProfile() (profile *pprofextended.Profile, startTS uin
 	}
 	profile.StringTable = append(profile.StringTable, stringTable...)
 
-	// profile.LocationIndices is not optional and we only write elements into
-	// profile.Location that are referenced by sample.
-	profile.LocationIndices = make([]int64, len(profile.Location))
-	for i := int64(0); i < int64(len(profile.Location)); i++ {
-		profile.LocationIndices[i] = i
+	profile.TimeNanos = int64(startTS)
+	return profile, startTS, endTS
+}
+
+// expandKernelImageName returns the file name for kernel functions from the
+// configured name and the kernel release of the host.
+func expandKernelImageName(name, release string) string {
+	if name == "" {
+		return defaultKernelImageName
+	}
+	return strings.ReplaceAll(name, kernelReleasePlaceholder, release)
+}
+
+// kernelFileName returns the file name for the functions of kernel frames of
+// fileID, which is the name of their kernel module. Frames of the core kernel,
+// which is reported as module "vmlinux", and of modules whose name was not
+// reported, get kernelImageName.
+func kernelFileName(kernelModules map[libpf.FileID]string, fileID libpf.FileID,
+	kernelImageName string) string {
+	if name, exists := kernelModules[fileID]; exists && name != "vmlinux" {
+		return name
 	}
+	return kernelImageName
+}
 
-	// start and end ts are in milliseconds but we need nanoseconds.
-	startNanos := time.Unix(int64(startTS), 0).UnixNano()
-	endNanos := time.Unix(int64(endTS), 0).UnixNano()
-	profile.DurationNanos = endNanos - startNanos
-	profile.TimeNanos = startNanos
-	return profile, startTS, endTS
+// awaitTraceInfo waits up to traceInfoGraceLeft for trace information of the
+// given traces to arrive and returns the traces for which it is still missing.
+// The time waited is deducted from traceInfoGraceLeft.
+func (r *OTLPReporter) awaitTraceInfo(missing []libpf.TraceHash) []libpf.TraceHash {
+	numMissing := len(missing)
+	start := r.clock.Now()
+	deadline := start.Add(r.traceInfoGraceLeft)
+
+	tick := r.clock.NewTicker(min(traceInfoGracePollInterval, r.traceInfoGraceLeft))
+	defer tick.Stop()
+	for len(missing) != 0 {
+		<-tick.Chan()
+
+		stillMissing := missing[:0]
+		for _, trace := range missing {
+			if _, exists := r.traces.Peek(trace); !exists {
+				stillMissing = append(stillMissing, trace)
+			}
+		}
+		missing = stillMissing
+
+		remaining := deadline.Sub(r.clock.Now())
+		if remaining <= 0 {
+			break
+		}
+		if remaining < traceInfoGracePollInterval {
+			tick.Reset(remaining)
+		}
+	}
+
+	r.traceInfoGraceLeft = max(r.traceInfoGraceLeft-r.clock.Now().Sub(start), 0)
+	r.traceInfoGraceRecovered.Add(uint32(numMissing - len(missing)))
+	return missing
+}
+
+// defaultSampleType returns the string index of the type name of the sample
+// type that UIs show by default. This is preferred if the profile holds it,
+// otherwise the CPU time if it is reported, and the sample count otherwise.
+func defaultSampleType(sampleTypes []*pprofextended.ValueType, stringMap map[string]uint32,
+	preferred string) int64 {
+	for _, name := range []string{preferred, "cpu"} {
+		idx, ok := stringMap[name]
+		if !ok || name == "" {
+			continue
+		}
+		for _, st := range sampleTypes {
+			if st.Type == int64(idx) {
+				return st.Type
+			}
+		}
+	}
+	return sampleTypes[0].Type
 }
 
 // getStringMapIndex inserts or looks up the index for value in stringMap.
+// Like the other helpers that build the tables of a profile, it must not be
+// called concurrently for the same map.
 func getStringMapIndex(stringMap map[string]uint32, value string) uint32 {
 	if idx, exists := stringMap[value]; exists {
 		return idx
@@ -787,11 +2404,14 @@ func getStringMapIndex(stringMap map[string]uint32, value string) uint32 {
 }
 
 // createFunctionEntry adds a new function and returns its reference index.
+// Functions with the same name and file name, but a different start line are
+// reported as different functions.
 func createFunctionEntry(funcMap map[funcInfo]uint64,
-	name string, fileName string) uint64 {
+	name string, fileName string, startLine int64) uint64 {
 	key := funcInfo{
-		name:     name,
-		fileName: fileName,
+		name:      name,
+		fileName:  fileName,
+		startLine: startLine,
 	}
 	if idx, exists := funcMap[key]; exists {
 		return idx
@@ -803,6 +2423,33 @@ func createFunctionEntry(funcMap map[funcInfo]uint64,
 	return idx
 }
 
+// getAttributeIndex inserts or looks up the index for key and value in attrMap.
+// The value must be either an int64 or a string.
+func getAttributeIndex(attrMap map[attrKeyValue]uint64, key string, value any) uint64 {
+	kv := attrKeyValue{
+		key:   key,
+		value: value,
+	}
+	if idx, exists := attrMap[kv]; exists {
+		return idx
+	}
+
+	idx := uint64(len(attrMap))
+	attrMap[kv] = idx
+
+	return idx
+}
+
+// locationFrameType returns the frame type of loc from its attributes.
+func locationFrameType(profile *pprofextended.Profile, loc *pprofextended.Location) string {
+	for _, idx := range loc.Attributes {
+		if attr := profile.AttributeTable[idx]; attr.Key == frameTypeAttribute {
+			return attr.Value.GetStringValue()
+		}
+	}
+	return ""
+}
+
 // getTraceLabels builds OTEP/Label(s) from traceInfo.
 func getTraceLabels(stringMap map[string]uint32, i traceInfo) []*pprofextended.Label {
 	var labels []*pprofextended.Label
@@ -817,6 +2464,31 @@ func getTraceLabels(stringMap map[string]uint32, i traceInfo) []*pprofextended.L
 		})
 	}
 
+	if i.threadName != "" {
+		threadNameIdx := getStringMapIndex(stringMap, "thread.name")
+		threadNameValueIdx := getStringMapIndex(stringMap, i.threadName)
+
+		labels = append(labels, &pprofextended.Label{
+			Key: int64(threadNameIdx),
+			Str: int64(threadNameValueIdx),
+		})
+	}
+
+	if i.pid != 0 {
+		labels = append(labels, &pprofextended.Label{
+			Key: int64(getStringMapIndex(stringMap, "process.pid")),
+			Num: int64(i.pid),
+		})
+	}
+
+	if i.processStartTime != 0 {
+		labels = append(labels, &pprofextended.Label{
+			Key:     int64(getStringMapIndex(stringMap, "process.start_time")),
+			Num:     int64(i.processStartTime),
+			NumUnit: int64(getStringMapIndex(stringMap, "nanoseconds")),
+		})
+	}
+
 	if i.podName != "" {
 		podNameIdx := getStringMapIndex(stringMap, "podName")
 		podNameValueIdx := getStringMapIndex(stringMap, i.podName)
@@ -847,6 +2519,16 @@ func getTraceLabels(stringMap map[string]uint32, i traceInfo) []*pprofextended.L
 		})
 	}
 
+	if i.containerID != "" {
+		containerIDIdx := getStringMapIndex(stringMap, "containerId")
+		containerIDValueIdx := getStringMapIndex(stringMap, i.containerID)
+
+		labels = append(labels, &pprofextended.Label{
+			Key: int64(containerIDIdx),
+			Str: int64(containerIDValueIdx),
+		})
+	}
+
 	if i.apmServiceName != "" {
 		apmServiceNameIdx := getStringMapIndex(stringMap, "apmServiceName")
 		apmServiceNameValueIdx := getStringMapIndex(stringMap, i.apmServiceName)
@@ -860,26 +2542,186 @@ func getTraceLabels(stringMap map[string]uint32, i traceInfo) []*pprofextended.L
 	return labels
 }
 
+// mappingRef references an entry of profile.Mapping.
+type mappingRef struct {
+	index uint64
+	// dummy is set if the mapping was created without the metadata of the
+	// executable, i.e. for frames that are not native.
+	dummy bool
+}
+
+// getNativeMappingIndex inserts or looks up the mapping of the executable of a native
+// frame. As a FileID must only have a single mapping, a dummy mapping that was created
+// for the same FileID by an earlier frame is replaced with the executable metadata.
+// If raw is set, the mapping is keyed only by the FileID, see rawNativeMapping.
+func getNativeMappingIndex(fileIDtoMapping map[libpf.FileID]mappingRef,
+	stringMap map[string]uint32, attrMap map[attrKeyValue]uint64,
+	profile *pprofextended.Profile, executables map[libpf.FileID]execInfo,
+	otlpBuildIDMode string, raw bool, fileID libpf.FileID,
+	addressOrLine libpf.AddressOrLineno) uint64 {
+	ref, exists := fileIDtoMapping[fileID]
+	if exists && !ref.dummy {
+		return ref.index
+	}
+
+	var mapping *pprofextended.Mapping
+	if raw {
+		mapping = rawNativeMapping(stringMap, fileID, addressOrLine)
+	} else {
+		mapping = nativeMapping(stringMap, attrMap, executables, otlpBuildIDMode,
+			fileID, addressOrLine)
+	}
+
+	if exists {
+		// Locations reference the dummy mapping by its index, so it is
+		// replaced in place.
+		profile.Mapping[ref.index] = mapping
+		fileIDtoMapping[fileID] = mappingRef{index: ref.index}
+		return ref.index
+	}
+
+	idx := uint64(len(fileIDtoMapping))
+	fileIDtoMapping[fileID] = mappingRef{index: idx}
+	profile.Mapping = append(profile.Mapping, mapping)
+	return idx
+}
+
+// rawNativeMapping returns a mapping that identifies the executable of a native
+// frame only by its FileID, for backends that symbolize the addresses on their
+// own. No placeholders are reported for the file name or the build ID, as they
+// would be taken for the metadata of the executable.
+func rawNativeMapping(stringMap map[string]uint32, fileID libpf.FileID,
+	addressOrLine libpf.AddressOrLineno) *pprofextended.Mapping {
+	return &pprofextended.Mapping{
+		FileOffset:  uint64(addressOrLine),
+		Filename:    int64(getStringMapIndex(stringMap, "")),
+		BuildId:     int64(getStringMapIndex(stringMap, fileID.StringNoQuotes())),
+		BuildIdKind: *pprofextended.BuildIdKind_BUILD_ID_BINARY_HASH.Enum(),
+		// The agent did not symbolize any of the frames.
+		HasFunctions: false,
+		HasFilenames: false,
+	}
+}
+
+// nativeMapping returns the mapping of the executable of a native frame with the
+// metadata of the executable, or placeholders if it is not known.
+func nativeMapping(stringMap map[string]uint32, attrMap map[attrKeyValue]uint64,
+	executables map[libpf.FileID]execInfo, otlpBuildIDMode string,
+	fileID libpf.FileID, addressOrLine libpf.AddressOrLineno) *pprofextended.Mapping {
+	execInfo, execExists := executables[fileID]
+
+	// Next step: Select a proper default value,
+	// if the name of the executable is not known yet.
+	var fileName = unknownPlaceholder
+	if execExists {
+		fileName = execInfo.fileName
+	}
+
+	var (
+		buildID     = unknownPlaceholder
+		buildIDKind pprofextended.BuildIdKind
+		attributes  []uint64
+	)
+	switch {
+	case otlpBuildIDMode == BuildIDModeLinker,
+		otlpBuildIDMode == BuildIDModeAuto && execInfo.buildID != "":
+		buildID = execInfo.buildID
+		buildIDKind = *pprofextended.BuildIdKind_BUILD_ID_LINKER.Enum()
+		if execInfo.gnuBuildID {
+			attributes = append(attributes,
+				getAttributeIndex(attrMap, gnuBuildIDAttributeKey, buildID))
+		}
+	case otlpBuildIDMode == BuildIDModeHash, otlpBuildIDMode == BuildIDModeAuto:
+		buildID = fileID.StringNoQuotes()
+		buildIDKind = *pprofextended.BuildIdKind_BUILD_ID_BINARY_HASH.Enum()
+	}
+
+	if execInfo.inode != 0 {
+		attributes = append(attributes,
+			getAttributeIndex(attrMap, "file.inode", int64(execInfo.inode)),
+			getAttributeIndex(attrMap, "file.device", int64(execInfo.device)))
+	}
+
+	return &pprofextended.Mapping{
+		// Id - Optional element we do not use.
+		MemoryStart: execInfo.memoryStart,
+		MemoryLimit: execInfo.memoryLimit,
+		FileOffset:  uint64(addressOrLine),
+		Filename:    int64(getStringMapIndex(stringMap, fileName)),
+		BuildId:     int64(getStringMapIndex(stringMap, buildID)),
+		BuildIdKind: buildIDKind,
+		Attributes:  attributes,
+		// HasFunctions - Optional element we do not use.
+		// HasFilenames - Optional element we do not use.
+		// HasLineNumbers - Optional element we do not use.
+		// HasInlinedFrames - Optional element we do not use.
+	}
+}
+
+// sortedTimestamps returns timestamps in ascending order, as some backends
+// expect them sorted. The timestamps are appended in the order the samples
+// arrive, which differs between CPUs. If dedup is set, duplicates are removed.
+func sortedTimestamps(timestamps []libpf.UnixTime64, dedup bool) []uint64 {
+	sorted := make([]uint64, 0, len(timestamps))
+	for _, ts := range timestamps {
+		sorted = append(sorted, uint64(ts))
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	if !dedup {
+		return sorted
+	}
+
+	unique := sorted[:min(len(sorted), 1)]
+	for _, ts := range sorted[len(unique):] {
+		if ts != unique[len(unique)-1] {
+			unique = append(unique, ts)
+		}
+	}
+	return unique
+}
+
+// getTruncatedLocationIndex inserts or looks up the synthetic location that
+// replaces the given number of outermost frames of a trace.
+func getTruncatedLocationIndex(truncatedLocations map[int]int64,
+	funcMap map[funcInfo]uint64, fileIDtoMapping map[libpf.FileID]mappingRef,
+	stringMap map[string]uint32, profile *pprofextended.Profile, truncated int) int64 {
+	if locIndex, exists := truncatedLocations[truncated]; exists {
+		return locIndex
+	}
+
+	locIndex := int64(len(profile.Location))
+	profile.Location = append(profile.Location, &pprofextended.Location{
+		// Indexes used in locations and lines are 1-indexed, 0 is the
+		// zero-value and therefore "reserved" for unset, so 1 has to be
+		// added to the returned indexes.
+		MappingIndex: getDummyMappingIndex(fileIDtoMapping, stringMap, profile,
+			libpf.FileID{}) + 1,
+		Line: []*pprofextended.Line{{
+			FunctionIndex: createFunctionEntry(funcMap,
+				fmt.Sprintf(truncatedFramesFunctionName, truncated), "", 0) + 1,
+		}},
+	})
+	truncatedLocations[truncated] = locIndex
+	return locIndex
+}
+
 // getDummyMappingIndex inserts or looks up a dummy entry for interpreted FileIDs.
-func getDummyMappingIndex(fileIDtoMapping map[libpf.FileID]uint64,
+// If the FileID already has a mapping, e.g. from a native frame, it is reused.
+func getDummyMappingIndex(fileIDtoMapping map[libpf.FileID]mappingRef,
 	stringMap map[string]uint32, profile *pprofextended.Profile,
 	fileID libpf.FileID) uint64 {
-	var locationMappingIndex uint64
-	if tmpMappingIndex, exists := fileIDtoMapping[fileID]; exists {
-		locationMappingIndex = tmpMappingIndex
-	} else {
-		idx := uint64(len(fileIDtoMapping))
-		fileIDtoMapping[fileID] = idx
-		locationMappingIndex = idx
+	if ref, exists := fileIDtoMapping[fileID]; exists {
+		return ref.index
+	}
 
-		fileName := "DUMMY"
+	idx := uint64(len(fileIDtoMapping))
+	fileIDtoMapping[fileID] = mappingRef{index: idx, dummy: true}
 
-		profile.Mapping = append(profile.Mapping, &pprofextended.Mapping{
-			Filename: int64(getStringMapIndex(stringMap, fileName)),
-			BuildId: int64(getStringMapIndex(stringMap,
-				fileID.StringNoQuotes())),
-			BuildIdKind: *pprofextended.BuildIdKind_BUILD_ID_BINARY_HASH.Enum(),
-		})
-	}
-	return locationMappingIndex
+	profile.Mapping = append(profile.Mapping, &pprofextended.Mapping{
+		Filename: int64(getStringMapIndex(stringMap, dummyMappingFileName)),
+		BuildId: int64(getStringMapIndex(stringMap,
+			fileID.StringNoQuotes())),
+		BuildIdKind: *pprofextended.BuildIdKind_BUILD_ID_BINARY_HASH.Enum(),
+	})
+	return idx
 }
@@ -0,0 +1,2344 @@
+/*
+ * Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+ * or more contributor license agreements. Licensed under the Apache License 2.0.
+ * See the file "LICENSE" for details.
+ */
+
+package reporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unsafe"
+
+	lru "github.com/elastic/go-freelru"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	common "go.opentelemetry.io/proto/otlp/common/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/elastic/otel-profiling-agent/config"
+	"github.com/elastic/otel-profiling-agent/libpf"
+	"github.com/elastic/otel-profiling-agent/libpf/vc"
+	otlpcollector "github.com/elastic/otel-profiling-agent/proto/experiments/opentelemetry/proto/collector/profiles/v1"
+	profiles "github.com/elastic/otel-profiling-agent/proto/experiments/opentelemetry/proto/profiles/v1"
+	"github.com/elastic/otel-profiling-agent/proto/experiments/opentelemetry/proto/profiles/v1/alternatives/pprofextended"
+)
+
+// newTestOTLPReporter returns an OTLPReporter that is not connected to any backend.
+func newTestOTLPReporter(tb testing.TB) *OTLPReporter {
+	tb.Helper()
+
+	require.NoError(tb, config.SetConfiguration(&config.Config{
+		ProjectID:        1,
+		SecretToken:      "secret",
+		CacheDirectory:   tb.TempDir(),
+		SamplesPerSecond: 20,
+	}))
+
+	const cacheSize = 1024
+
+	traces, err := newLockedLRU[libpf.TraceHash, traceInfo](cacheSize, libpf.TraceHash.Hash32)
+	require.NoError(tb, err)
+	samples, err := newLockedLRU[libpf.TraceHash, sample](cacheSize, libpf.TraceHash.Hash32)
+	require.NoError(tb, err)
+	fallbackSymbols, err := lru.NewSynced[libpf.FrameID, string](cacheSize, libpf.FrameID.Hash32)
+	require.NoError(tb, err)
+	internedSymbols, err := lru.NewSynced[string, string](cacheSize, hashString)
+	require.NoError(tb, err)
+	executables, err := lru.NewSynced[libpf.FileID, execInfo](cacheSize, libpf.FileID.Hash32)
+	require.NoError(tb, err)
+	frames, err := lru.NewSynced[libpf.FileID,
+		map[libpf.AddressOrLineno]sourceInfo](cacheSize, libpf.FileID.Hash32)
+	require.NoError(tb, err)
+	hostmetadata, err := lru.NewSynced[string, string](cacheSize, hashString)
+	require.NoError(tb, err)
+
+	return &OTLPReporter{
+		stopSignal:      make(chan libpf.Void),
+		clock:           realClock{},
+		rpcStats:        newStatsHandler(),
+		traces:          traces,
+		samples:         samples,
+		fallbackSymbols: fallbackSymbols,
+		internedSymbols: internedSymbols,
+		executables:     executables,
+		frames:          frames,
+		hostmetadata:    hostmetadata,
+		profileID:       randomProfileID,
+		symuploader:     NewNoopSymbolUploader(),
+		profileOptions: profileOptions{
+			samplesPerSecond: config.SamplesPerSecond(),
+			otlpBuildIDMode:  BuildIDModeLinker,
+			kernelImageName:  defaultKernelImageName,
+		},
+	}
+}
+
+// newTestOTLPReporterWithClient returns a reporter like newTestOTLPReporter that
+// exports to client.
+func newTestOTLPReporterWithClient(tb testing.TB,
+	client otlpcollector.ProfilesServiceClient) *OTLPReporter {
+	tb.Helper()
+
+	r := newTestOTLPReporter(tb)
+	r.client = client
+	return r
+}
+
+// sampleLocations returns the locations referenced by sample.
+func sampleLocations(profile *pprofextended.Profile,
+	sample *pprofextended.Sample) []*pprofextended.Location {
+	locs := make([]*pprofextended.Location, 0, sample.LocationsLength)
+	for _, idx := range profile.LocationIndices[sample.LocationsStartIndex:][:sample.LocationsLength] {
+		locs = append(locs, profile.Location[idx])
+	}
+	return locs
+}
+
+// functionNames returns the names of the functions referenced by the lines of loc.
+func functionNames(profile *pprofextended.Profile, loc *pprofextended.Location) []string {
+	names := make([]string, 0, len(loc.Line))
+	for _, line := range loc.Line {
+		fn := profile.Function[line.FunctionIndex-1]
+		names = append(names, profile.StringTable[fn.Name])
+	}
+	return names
+}
+
+func TestNewProfile(t *testing.T) {
+	traceHash := libpf.NewTraceHash(1, 2)
+	fileID := libpf.NewFileID(3, 4)
+
+	tests := map[string]struct {
+		frameType libpf.FrameType
+		data      profileData
+		// wantFunctions are the functions of the location as "name file:line".
+		wantFunctions []string
+		wantMapping   string
+	}{
+		"kernel": {
+			frameType: libpf.KernelFrame,
+			data: profileData{
+				fallbackSymbols: map[libpf.FrameID]string{
+					libpf.NewFrameID(fileID, 0x10): "do_syscall_64",
+				},
+			},
+			wantFunctions: []string{"do_syscall_64 vmlinux:0"},
+			wantMapping:   dummyMappingFileName,
+		},
+		"kernel without symbol": {
+			frameType:     libpf.KernelFrame,
+			wantFunctions: []string{unknownPlaceholder + " vmlinux:0"},
+			wantMapping:   dummyMappingFileName,
+		},
+		"native": {
+			frameType: libpf.NativeFrame,
+			data: profileData{
+				executables: map[libpf.FileID]execInfo{
+					fileID: {fileName: "libc.so.6", buildID: "abcd"},
+				},
+			},
+			wantFunctions: []string{},
+			wantMapping:   "libc.so.6",
+		},
+		"native without executable": {
+			frameType:     libpf.NativeFrame,
+			wantFunctions: []string{},
+			wantMapping:   unknownPlaceholder,
+		},
+		"interpreted": {
+			frameType: libpf.PythonFrame,
+			data: profileData{
+				frames: map[libpf.FileID]map[libpf.AddressOrLineno]sourceInfo{
+					fileID: {0x10: {
+						lineNumber:     42,
+						functionOffset: 2,
+						functionName:   "handle",
+						filePath:       "server.py",
+					}},
+				},
+			},
+			wantFunctions: []string{"handle server.py:40"},
+			wantMapping:   dummyMappingFileName,
+		},
+		"interpreted without frames": {
+			frameType:     libpf.PythonFrame,
+			wantFunctions: []string{unreportedFunctionName + " python:0"},
+			wantMapping:   dummyMappingFileName,
+		},
+	}
+
+	for name, tc := range tests {
+		name := name
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			data := tc.data
+			data.samples = map[libpf.TraceHash]sample{traceHash: {
+				count:      1,
+				timestamps: []libpf.UnixTime64{1710000000e9},
+			}}
+			data.traces = map[libpf.TraceHash]traceInfo{traceHash: {
+				files:      []libpf.FileID{fileID},
+				linenos:    []libpf.AddressOrLineno{0x10},
+				frameTypes: []libpf.FrameType{tc.frameType},
+				comm:       "comm",
+			}}
+
+			profile, startTS, endTS := newProfile(&data, &profileOptions{
+				samplesPerSecond: 20,
+				otlpBuildIDMode:  BuildIDModeLinker,
+				kernelImageName:  defaultKernelImageName,
+			})
+			assert.Equal(t, libpf.UnixTime64(1710000000e9), startTS)
+			assert.Equal(t, libpf.UnixTime64(1710000000e9), endTS)
+			assert.Equal(t, int64(50e6), profile.Period)
+			require.Len(t, profile.Sample, 1)
+			assert.Equal(t, []int64{1}, profile.Sample[0].Value)
+
+			locs := sampleLocations(profile, profile.Sample[0])
+			require.Len(t, locs, 1)
+			functions := make([]string, 0, len(locs[0].Line))
+			for _, line := range locs[0].Line {
+				fn := profile.Function[line.FunctionIndex-1]
+				functions = append(functions, fmt.Sprintf("%s %s:%d",
+					profile.StringTable[fn.Name], profile.StringTable[fn.Filename],
+					fn.StartLine))
+			}
+			assert.Equal(t, tc.wantFunctions, functions)
+			assert.Equal(t, tc.frameType.String(), locationFrameType(profile, locs[0]))
+			require.NotZero(t, locs[0].MappingIndex)
+			mapping := profile.Mapping[locs[0].MappingIndex-1]
+			assert.Equal(t, tc.wantMapping, profile.StringTable[mapping.Filename])
+		})
+	}
+}
+
+func TestGetProfileAbortFrame(t *testing.T) {
+	r := newTestOTLPReporter(t)
+
+	trace := &libpf.Trace{Hash: libpf.NewTraceHash(1, 2)}
+	trace.AppendFrame(libpf.PythonFrame, libpf.NewFileID(3, 4), 5)
+	trace.AppendFrame(libpf.AbortFrame, libpf.NewFileID(0, 0), 0)
+
+	r.ReportFramesForTrace(trace)
+	r.ReportCountForTrace(trace.Hash, libpf.UnixTime64(1710000000e9), 1,
+		"python", "", "", "", "", "")
+
+	profile, _, _ := r.getProfile()
+	require.Len(t, profile.Sample, 1)
+	require.Equal(t, uint64(2), profile.Sample[0].LocationsLength)
+	require.Len(t, profile.Location, 2)
+
+	abortLoc := sampleLocations(profile, profile.Sample[0])[1]
+	assert.Equal(t, []string{abortFrameFunctionName}, functionNames(profile, abortLoc))
+	assert.NotZero(t, abortLoc.MappingIndex)
+}
+
+func TestGetProfileZeroValueSample(t *testing.T) {
+	r := newTestOTLPReporter(t)
+
+	trace := &libpf.Trace{Hash: libpf.NewTraceHash(1, 2)}
+	trace.AppendFrame(libpf.PythonFrame, libpf.NewFileID(3, 4), 5)
+	r.ReportFramesForTrace(trace)
+	r.ReportCountForTrace(trace.Hash, libpf.UnixTime64(1710000000e9), 1,
+		"python", "", "", "", "", "")
+
+	zeroTrace := &libpf.Trace{Hash: libpf.NewTraceHash(6, 7)}
+	zeroTrace.AppendFrame(libpf.PythonFrame, libpf.NewFileID(8, 9), 10)
+	r.ReportFramesForTrace(zeroTrace)
+	r.ReportCountForTrace(zeroTrace.Hash, libpf.UnixTime64(1710000001e9), 0,
+		"python", "", "", "", "", "")
+
+	profile, startTS, endTS := r.getProfile()
+	require.Len(t, profile.Sample, 1)
+	assert.Equal(t, []int64{1}, profile.Sample[0].Value)
+	// Neither the locations nor the timestamps of the omitted sample are reported.
+	assert.Len(t, profile.Location, 1)
+	assert.Len(t, profile.LocationIndices, 1)
+	assert.Equal(t, libpf.UnixTime64(1710000000e9), startTS)
+	assert.Equal(t, libpf.UnixTime64(1710000000e9), endTS)
+	assert.NotContains(t, profile.StringTable, zeroTrace.Hash.StringNoQuotes())
+}
+
+func TestGetProfileTimestamps(t *testing.T) {
+	r := newTestOTLPReporter(t)
+
+	trace := &libpf.Trace{Hash: libpf.NewTraceHash(1, 2)}
+	trace.AppendFrame(libpf.PythonFrame, libpf.NewFileID(3, 4), 5)
+	r.ReportFramesForTrace(trace)
+
+	start := libpf.UnixTime64(1710000000123456789)
+	end := start + 1500
+	r.ReportCountForTrace(trace.Hash, start, 1, "", "", "", "", "", "")
+	r.ReportCountForTrace(trace.Hash, end, 1, "", "", "", "", "", "")
+
+	profile, startTS, endTS := r.getProfile()
+	require.Len(t, profile.Sample, 1)
+	assert.ElementsMatch(t, []uint64{uint64(start), uint64(end)}, profile.Sample[0].Timestamps)
+	assert.Equal(t, start, startTS)
+	assert.Equal(t, end, endTS)
+	assert.Equal(t, int64(start), profile.TimeNanos)
+}
+
+func TestGetProfileTimestampsOrder(t *testing.T) {
+	tests := map[string]struct {
+		dedupTimestamps bool
+		want            []uint64
+	}{
+		"sorted":  {want: []uint64{1e9, 2e9, 2e9, 3e9, 3e9}},
+		"deduped": {dedupTimestamps: true, want: []uint64{1e9, 2e9, 3e9}},
+	}
+
+	for name, tc := range tests {
+		name := name
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			r := newTestOTLPReporter(t)
+			r.dedupTimestamps = tc.dedupTimestamps
+
+			trace := &libpf.Trace{Hash: libpf.NewTraceHash(1, 2)}
+			trace.AppendFrame(libpf.KernelFrame, libpf.NewFileID(3, 4), 5)
+			r.ReportFramesForTrace(trace)
+			for _, ts := range []libpf.UnixTime64{3e9, 1e9, 2e9, 3e9, 2e9} {
+				r.ReportCountForTrace(trace.Hash, ts, 1, "", "", "", "", "", "")
+			}
+
+			profile, startTS, endTS := r.getProfile()
+			require.Len(t, profile.Sample, 1)
+			assert.Equal(t, tc.want, profile.Sample[0].Timestamps)
+			// The count includes every occurrence, also of duplicate timestamps.
+			assert.Equal(t, []int64{5}, profile.Sample[0].Value)
+			assert.Equal(t, libpf.UnixTime64(1e9), startTS)
+			assert.Equal(t, libpf.UnixTime64(3e9), endTS)
+		})
+	}
+}
+
+func TestGetResourceProfilesDuration(t *testing.T) {
+	r := newTestOTLPReporter(t)
+
+	trace := &libpf.Trace{Hash: libpf.NewTraceHash(1, 2)}
+	trace.AppendFrame(libpf.PythonFrame, libpf.NewFileID(3, 4), 5)
+	r.ReportFramesForTrace(trace)
+	r.ReportCountForTrace(trace.Hash, libpf.UnixTime64(1710000000e9), 1, "", "", "", "", "", "")
+
+	// The first window lasts for the report interval.
+	window := r.reportWindow(5 * time.Second)
+	assert.Equal(t, 5*time.Second, window)
+
+	// A single sample has no duration by its timestamps.
+	profile, startTS, endTS := r.getProfile()
+	require.Len(t, profile.Sample, 1)
+	require.Equal(t, startTS, endTS)
+	r.getResourceProfiles("", profile, startTS, endTS, window)
+	assert.Equal(t, window.Nanoseconds(), profile.DurationNanos)
+
+	// Later windows last from the previous report.
+	time.Sleep(10 * time.Millisecond)
+	window = r.reportWindow(5 * time.Second)
+	assert.GreaterOrEqual(t, window, 10*time.Millisecond)
+	assert.Less(t, window, 5*time.Second)
+}
+
+func TestReportFrameMetadataKeepsExisting(t *testing.T) {
+	r := newTestOTLPReporter(t)
+	fileID := libpf.NewFileID(3, 4)
+
+	r.ReportFrameMetadata(&libpf.FrameMetadata{
+		FileID:          fileID,
+		AddressOrLine:   5,
+		LineNumber:      12,
+		FunctionOffset:  2,
+		FunctionName:    "foo",
+		Filename:        "foo.py",
+		FunctionEndLine: 20,
+	})
+	// A later, less complete report must not erase what is known.
+	r.ReportFrameMetadata(&libpf.FrameMetadata{
+		FileID:        fileID,
+		AddressOrLine: 5,
+	})
+
+	frames, ok := r.frames.Get(fileID)
+	require.True(t, ok)
+	assert.Equal(t, sourceInfo{
+		lineNumber:      12,
+		functionOffset:  2,
+		functionName:    "foo",
+		filePath:        "foo.py",
+		functionEndLine: 20,
+	}, frames[5])
+
+	// Non-empty values still replace existing ones.
+	r.ReportFrameMetadata(&libpf.FrameMetadata{
+		FileID:         fileID,
+		AddressOrLine:  5,
+		LineNumber:     14,
+		FunctionOffset: 0,
+		FunctionName:   "bar",
+	})
+	frames, ok = r.frames.Get(fileID)
+	require.True(t, ok)
+	assert.Equal(t, sourceInfo{
+		lineNumber:      14,
+		functionName:    "bar",
+		filePath:        "foo.py",
+		functionEndLine: 20,
+	}, frames[5])
+}
+
+func TestReportFramesForTraceKeepsComplete(t *testing.T) {
+	r := newTestOTLPReporter(t)
+	hash := libpf.NewTraceHash(1, 2)
+	newTrace := func(linenos ...libpf.AddressOrLineno) *libpf.Trace {
+		trace := &libpf.Trace{Hash: hash}
+		for _, lineno := range linenos {
+			trace.AppendFrame(libpf.PythonFrame, libpf.NewFileID(3, 4), lineno)
+		}
+		return trace
+	}
+
+	r.ReportCountForTrace(hash, libpf.UnixTime64(1710000000e9), 1,
+		"comm", "", "", "", "", "")
+	r.ReportFramesForTrace(newTrace(5, 6, 7))
+	// A shorter update for the same trace arrives after the complete one.
+	r.ReportFramesForTrace(newTrace(5))
+
+	info, ok := r.traces.Peek(hash)
+	require.True(t, ok)
+	assert.Equal(t, []libpf.AddressOrLineno{5, 6, 7}, info.linenos)
+	assert.Len(t, info.files, 3)
+	assert.Len(t, info.frameTypes, 3)
+	assert.Equal(t, "comm", info.comm)
+
+	// An update that is at least as long replaces the frames.
+	r.ReportFramesForTrace(newTrace(8, 9, 10))
+	info, ok = r.traces.Peek(hash)
+	require.True(t, ok)
+	assert.Equal(t, []libpf.AddressOrLineno{8, 9, 10}, info.linenos)
+	assert.Equal(t, "comm", info.comm)
+}
+
+func TestReportFallbackSymbolInterned(t *testing.T) {
+	r := newTestOTLPReporter(t)
+	first := libpf.NewFrameID(libpf.NewFileID(3, 4), 5)
+	second := libpf.NewFrameID(libpf.NewFileID(3, 4), 6)
+
+	// Both symbols are equal, but stored separately.
+	r.ReportFallbackSymbol(first, strings.Clone("do_syscall_64"))
+	r.ReportFallbackSymbol(second, strings.Clone("do_syscall_64"))
+
+	firstSymbol, ok := r.fallbackSymbols.Get(first)
+	require.True(t, ok)
+	secondSymbol, ok := r.fallbackSymbols.Get(second)
+	require.True(t, ok)
+	assert.Equal(t, "do_syscall_64", secondSymbol)
+	assert.Equal(t, 1, r.internedSymbols.Len())
+	assert.Same(t, unsafe.StringData(firstSymbol), unsafe.StringData(secondSymbol))
+}
+
+func TestBuildProfileConcurrently(t *testing.T) {
+	const traces = 50
+
+	r := newTestOTLPReporter(t)
+	// Every profile gets its own file, functions and traces.
+	samples := make([]map[libpf.TraceHash]sample, 2)
+	for p := range samples {
+		fileID := libpf.NewFileID(uint64(p), 1)
+		for i := 0; i < traces; i++ {
+			r.FrameMetadata(fileID, libpf.AddressOrLineno(i), libpf.SourceLineno(i), 0,
+				fmt.Sprintf("func%d_%d", p, i), fmt.Sprintf("file%d.py", p))
+			trace := &libpf.Trace{Hash: libpf.NewTraceHash(uint64(p), uint64(i))}
+			trace.AppendFrame(libpf.PythonFrame, fileID, libpf.AddressOrLineno(i))
+			r.ReportFramesForTrace(trace)
+			r.ReportCountForTrace(trace.Hash, libpf.UnixTime64(1710000000e9), 1,
+				"", "", "", "", "", "")
+		}
+		samples[p] = r.collectSamples()
+	}
+
+	profiles := make([]*pprofextended.Profile, len(samples))
+	var wg sync.WaitGroup
+	for p := range samples {
+		p := p
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			profiles[p], _, _ = r.buildProfile(samples[p])
+		}()
+	}
+	// Frame information may be reported while the profiles are built.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < traces; i++ {
+			r.FrameMetadata(libpf.NewFileID(0, 1), libpf.AddressOrLineno(i),
+				libpf.SourceLineno(i), 0, fmt.Sprintf("func0_%d", i), "file0.py")
+		}
+	}()
+	wg.Wait()
+
+	for p, profile := range profiles {
+		require.Len(t, profile.Sample, traces)
+		var names []string
+		for _, s := range profile.Sample {
+			names = append(names, functionNames(profile, sampleLocations(profile, s)[0])...)
+		}
+		want := make([]string, 0, traces)
+		for i := 0; i < traces; i++ {
+			want = append(want, fmt.Sprintf("func%d_%d", p, i))
+		}
+		assert.ElementsMatch(t, want, names)
+	}
+}
+
+func TestGetProfileFunctionEndLine(t *testing.T) {
+	r := newTestOTLPReporter(t)
+
+	fileID := libpf.NewFileID(3, 4)
+	trace := &libpf.Trace{Hash: libpf.NewTraceHash(1, 2)}
+	trace.AppendFrame(libpf.PythonFrame, fileID, 5)
+	trace.AppendFrame(libpf.PythonFrame, fileID, 6)
+
+	r.ReportFrameMetadata(&libpf.FrameMetadata{
+		FileID:          fileID,
+		AddressOrLine:   5,
+		LineNumber:      10,
+		FunctionName:    "foo",
+		Filename:        "foo.py",
+		FunctionEndLine: 20,
+	})
+	// Metadata without an end line must not remove a previously reported one.
+	r.FrameMetadata(fileID, 5, 11, 0, "foo", "")
+	r.FrameMetadata(fileID, 6, 30, 0, "bar", "foo.py")
+
+	r.ReportFramesForTrace(trace)
+	r.ReportCountForTrace(trace.Hash, libpf.UnixTime64(1710000000e9), 1, "", "", "", "", "", "")
+
+	profile, _, _ := r.getProfile()
+	require.Len(t, profile.Sample, 1)
+	require.Len(t, profile.Location, 2)
+
+	locs := sampleLocations(profile, profile.Sample[0])
+	fooLoc := locs[0]
+	require.Len(t, fooLoc.Attributes, 2)
+	attr := profile.AttributeTable[fooLoc.Attributes[1]]
+	assert.Equal(t, "code.function.end_line", attr.Key)
+	assert.Equal(t, int64(20), attr.Value.GetIntValue())
+	assert.Equal(t, int64(11), fooLoc.Line[0].Line)
+
+	// Only the frame type is reported.
+	barLoc := locs[1]
+	assert.Len(t, barLoc.Attributes, 1)
+}
+
+func TestGetProfileDeduplicatesLocations(t *testing.T) {
+	r := newTestOTLPReporter(t)
+
+	shared := libpf.NewFileID(3, 4)
+	for i := uint64(0); i < 3; i++ {
+		trace := &libpf.Trace{Hash: libpf.NewTraceHash(i, i)}
+		trace.AppendFrame(libpf.NativeFrame, libpf.NewFileID(5, i), 0x10)
+		trace.AppendFrame(libpf.NativeFrame, shared, 0x20)
+		trace.AppendFrame(libpf.NativeFrame, shared, 0x30)
+		r.ReportFramesForTrace(trace)
+		r.ReportCountForTrace(trace.Hash, libpf.UnixTime64(1710000000e9), 1, "", "", "", "", "", "")
+	}
+
+	profile, _, _ := r.getProfile()
+	require.Len(t, profile.Sample, 3)
+	// 3 unique leaf frames and 2 shared frames.
+	assert.Len(t, profile.Location, 5)
+	assert.Len(t, profile.LocationIndices, 9)
+
+	for _, sample := range profile.Sample {
+		locs := sampleLocations(profile, sample)
+		require.Len(t, locs, 3)
+		assert.Equal(t, uint64(0x10), locs[0].Address)
+		assert.Equal(t, uint64(0x20), locs[1].Address)
+		assert.Equal(t, uint64(0x30), locs[2].Address)
+	}
+}
+
+// BenchmarkGetProfile reports a set of traces that share most of their frames.
+func BenchmarkGetProfile(b *testing.B) {
+	const (
+		numTraces = 1000
+		numFrames = 64
+	)
+
+	for _, numShared := range []int{0, numFrames / 2, numFrames - 1} {
+		b.Run(fmt.Sprintf("shared=%d", numShared), func(b *testing.B) {
+			r := newTestOTLPReporter(b)
+			var size, numLocations int
+			for n := 0; n < b.N; n++ {
+				b.StopTimer()
+				for i := uint64(0); i < numTraces; i++ {
+					trace := &libpf.Trace{Hash: libpf.NewTraceHash(i, i)}
+					for f := 0; f < numFrames; f++ {
+						fileID := libpf.NewFileID(uint64(f), 0)
+						if f < numFrames-numShared {
+							fileID = libpf.NewFileID(uint64(f), i+1)
+						}
+						trace.AppendFrame(libpf.NativeFrame, fileID, libpf.AddressOrLineno(f))
+					}
+					r.ReportFramesForTrace(trace)
+					r.ReportCountForTrace(trace.Hash, libpf.UnixTime64(n), 1,
+						"", "", "", "", "", "")
+				}
+				b.StartTimer()
+
+				profile, _, _ := r.getProfile()
+
+				b.StopTimer()
+				size = proto.Size(profile)
+				numLocations = len(profile.Location)
+				b.StartTimer()
+			}
+			b.ReportMetric(float64(size), "bytes/profile")
+			b.ReportMetric(float64(numLocations), "locations/profile")
+		})
+	}
+}
+
+func TestReportCounts(t *testing.T) {
+	counts := []TraceCount{
+		{TraceHash: libpf.NewTraceHash(1, 2), Timestamp: 1710000000e9, Count: 1,
+			Comm: "comm", ThreadName: "thread"},
+		{TraceHash: libpf.NewTraceHash(3, 4), Timestamp: 1710000001e9, Count: 2,
+			Comm: "other", PodName: "pod", PodNamespace: "namespace"},
+		{TraceHash: libpf.NewTraceHash(1, 2), Timestamp: 1710000002e9, Count: 3,
+			Comm: "renamed", ContainerName: "container", ContainerID: "abc123"},
+	}
+
+	single := newTestOTLPReporter(t)
+	for _, c := range counts {
+		single.ReportCountForTrace(c.TraceHash, c.Timestamp, c.Count, c.Comm, c.PodName,
+			c.PodNamespace, c.ContainerName, c.ContainerID, c.ThreadName)
+	}
+	batched := newTestOTLPReporter(t)
+	batched.ReportCounts(counts)
+
+	require.Equal(t, single.samples.Len(), batched.samples.Len())
+	for _, hash := range single.samples.Keys() {
+		want, _ := single.samples.Peek(hash)
+		got, ok := batched.samples.Peek(hash)
+		require.True(t, ok)
+		assert.Equal(t, want, got)
+
+		wantTrace, _ := single.traces.Peek(hash)
+		gotTrace, ok := batched.traces.Peek(hash)
+		require.True(t, ok)
+		assert.Equal(t, wantTrace, gotTrace)
+	}
+
+	// Counts are dropped while the export breaker is open.
+	batched.breaker = newExportBreaker(1)
+	batched.breaker.open.Store(true)
+	batched.ReportCounts(counts)
+	assert.Equal(t, uint32(len(counts)), batched.breaker.droppedCount())
+}
+
+func TestReportCompleteTrace(t *testing.T) {
+	r := newTestOTLPReporter(t)
+
+	trace := &libpf.Trace{Hash: libpf.NewTraceHash(1, 2)}
+	trace.AppendFrame(libpf.KernelFrame, libpf.NewFileID(3, 4), 5)
+	trace.AppendFrame(libpf.KernelFrame, libpf.NewFileID(3, 4), 6)
+	r.ReportCompleteTrace(trace, TraceCount{
+		// The hash of the trace takes precedence over the one of the count.
+		TraceHash:  libpf.NewTraceHash(7, 8),
+		Timestamp:  1710000000e9,
+		Count:      3,
+		Comm:       "server",
+		ThreadName: "worker-3",
+	})
+
+	profile, startTS, _ := r.getProfile()
+	require.Len(t, profile.Sample, 1)
+	assert.Equal(t, []int64{3}, profile.Sample[0].Value)
+	assert.Len(t, sampleLocations(profile, profile.Sample[0]), 2)
+	assert.Equal(t, libpf.UnixTime64(1710000000e9), startTS)
+	labels := make(map[string]string)
+	for _, label := range profile.Sample[0].Label {
+		labels[profile.StringTable[label.Key]] = profile.StringTable[label.Str]
+	}
+	assert.Equal(t, map[string]string{"comm": "server", "thread.name": "worker-3"}, labels)
+
+	// Traces are dropped while the export breaker is open.
+	r.breaker = newExportBreaker(1)
+	r.breaker.open.Store(true)
+	r.ReportCompleteTrace(trace, TraceCount{Timestamp: 1710000001e9, Count: 1})
+	assert.Zero(t, r.samples.Len())
+	assert.Equal(t, uint32(1), r.breaker.droppedCount())
+}
+
+// BenchmarkReportCounts compares reporting counts one by one with reporting
+// them in batches, from several goroutines at once.
+func BenchmarkReportCounts(b *testing.B) {
+	const batchSize = 64
+
+	counts := make([]TraceCount, batchSize)
+	for i := range counts {
+		counts[i] = TraceCount{
+			TraceHash: libpf.NewTraceHash(uint64(i), 0),
+			Timestamp: libpf.UnixTime64(1710000000e9 + i),
+			Count:     1,
+			Comm:      "comm",
+		}
+	}
+
+	b.Run("per-call", func(b *testing.B) {
+		r := newTestOTLPReporter(b)
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				for i := range counts {
+					c := &counts[i]
+					r.ReportCountForTrace(c.TraceHash, c.Timestamp, c.Count, c.Comm,
+						"", "", "", "", "")
+				}
+			}
+		})
+	})
+	b.Run("batched", func(b *testing.B) {
+		r := newTestOTLPReporter(b)
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				r.ReportCounts(counts)
+			}
+		})
+	})
+}
+
+func TestGetProfileCPUTime(t *testing.T) {
+	tests := map[string]struct {
+		reportCPUTime bool
+		wantTypes     [][2]string
+		wantValue     []int64
+	}{
+		"disabled": {
+			wantTypes: [][2]string{{"samples", "count"}},
+			wantValue: []int64{3},
+		},
+		"enabled": {
+			reportCPUTime: true,
+			wantTypes:     [][2]string{{"samples", "count"}, {"cpu", "nanoseconds"}},
+			// 3 samples at 20 samples per second, 50ms each.
+			wantValue: []int64{3, 150e6},
+		},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			r := newTestOTLPReporter(t)
+			r.reportCPUTime = tc.reportCPUTime
+
+			trace := &libpf.Trace{Hash: libpf.NewTraceHash(1, 2)}
+			trace.AppendFrame(libpf.PythonFrame, libpf.NewFileID(3, 4), 5)
+			r.ReportFramesForTrace(trace)
+			r.ReportCountForTrace(trace.Hash, libpf.UnixTime64(1710000000e9), 3,
+				"", "", "", "", "", "")
+
+			profile, _, _ := r.getProfile()
+			require.Len(t, profile.Sample, 1)
+			assert.Equal(t, int64(50e6), profile.Period)
+
+			types := make([][2]string, 0, len(profile.SampleType))
+			for _, st := range profile.SampleType {
+				types = append(types, [2]string{
+					profile.StringTable[st.Type], profile.StringTable[st.Unit]})
+			}
+			assert.Equal(t, tc.wantTypes, types)
+			assert.Equal(t, tc.wantValue, profile.Sample[0].Value)
+		})
+	}
+}
+
+func TestExpandKernelImageName(t *testing.T) {
+	tests := map[string]struct {
+		name string
+		want string
+	}{
+		"default":     {name: "", want: "vmlinux"},
+		"static":      {name: "kernel", want: "kernel"},
+		"release":     {name: "vmlinux-{release}", want: "vmlinux-6.1.0-18-amd64"},
+		"releaseOnly": {name: "{release}", want: "6.1.0-18-amd64"},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.want, expandKernelImageName(tc.name, "6.1.0-18-amd64"))
+		})
+	}
+}
+
+func TestGetProfileKernelImageName(t *testing.T) {
+	r := newTestOTLPReporter(t)
+	r.kernelImageName = "vmlinux-6.1.0-18-amd64"
+
+	trace := &libpf.Trace{Hash: libpf.NewTraceHash(1, 2)}
+	trace.AppendFrame(libpf.KernelFrame, libpf.NewFileID(3, 4), 5)
+	r.ReportFramesForTrace(trace)
+	r.ReportCountForTrace(trace.Hash, libpf.UnixTime64(1710000000e9), 1, "", "", "", "", "", "")
+
+	profile, _, _ := r.getProfile()
+	require.Len(t, profile.Function, 1)
+	assert.Equal(t, "vmlinux-6.1.0-18-amd64", profile.StringTable[profile.Function[0].Filename])
+}
+
+func TestGetProfileKernelModuleFileName(t *testing.T) {
+	vmlinux := libpf.NewFileID(3, 4)
+	module := libpf.NewFileID(5, 6)
+	unknown := libpf.NewFileID(7, 8)
+
+	r := newTestOTLPReporter(t)
+	r.kernelImageName = "vmlinux-6.1.0-18-amd64"
+	r.ExecutableMetadata(context.Background(), vmlinux, "vmlinux", "", false)
+	r.ExecutableMetadata(context.Background(), module, "nf_conntrack", "", false)
+
+	trace := &libpf.Trace{Hash: libpf.NewTraceHash(1, 2)}
+	trace.AppendFrame(libpf.KernelFrame, module, 0x10)
+	trace.AppendFrame(libpf.KernelFrame, vmlinux, 0x20)
+	trace.AppendFrame(libpf.KernelFrame, unknown, 0x30)
+	r.ReportFramesForTrace(trace)
+	r.ReportFallbackSymbol(libpf.NewFrameID(module, 0x10), "nf_conntrack_in")
+	r.ReportFallbackSymbol(libpf.NewFrameID(vmlinux, 0x20), "ip_rcv")
+	r.ReportFallbackSymbol(libpf.NewFrameID(unknown, 0x30), "do_syscall_64")
+	r.ReportCountForTrace(trace.Hash, libpf.UnixTime64(1710000000e9), 1, "", "", "", "", "", "")
+
+	profile, _, _ := r.getProfile()
+	fileNames := make(map[string]string, len(profile.Function))
+	for _, fn := range profile.Function {
+		fileNames[profile.StringTable[fn.Name]] = profile.StringTable[fn.Filename]
+	}
+	assert.Equal(t, map[string]string{
+		"nf_conntrack_in": "nf_conntrack",
+		"ip_rcv":          "vmlinux-6.1.0-18-amd64",
+		"do_syscall_64":   "vmlinux-6.1.0-18-amd64",
+	}, fileNames)
+}
+
+func TestGetProfileKernelAddress(t *testing.T) {
+	r := newTestOTLPReporter(t)
+	r.ReportHostMetadata(map[string]string{"host:kernel_text_base": "0xffffffff9d000000"})
+
+	// A BPF program that is mapped below the kernel text.
+	offset := int64(-0x2000)
+	trace := &libpf.Trace{Hash: libpf.NewTraceHash(1, 2)}
+	trace.AppendFrame(libpf.KernelFrame, libpf.UnknownKernelFileID,
+		libpf.AddressOrLineno(offset))
+	trace.AppendFrame(libpf.KernelFrame, libpf.NewFileID(3, 4), 0x1234)
+	r.ReportFramesForTrace(trace)
+	r.ReportCountForTrace(trace.Hash, libpf.UnixTime64(1710000000e9), 1, "", "", "", "", "", "")
+
+	profile, _, _ := r.getProfile()
+	require.Len(t, profile.Location, 2)
+	assert.Equal(t, offset, int64(profile.Location[0].Address))
+	assert.Equal(t, uint64(0x1234), profile.Location[1].Address)
+
+	attrs := attributeMap(r.getResource().Attributes)
+	assert.Equal(t, "0xffffffff9d000000", attrs["host:kernel_text_base"])
+}
+
+func TestGetProfileJITTier(t *testing.T) {
+	r := newTestOTLPReporter(t)
+
+	fileID := libpf.NewFileID(3, 4)
+	r.FrameMetadata(fileID, 5, 10, 0, "foo", "Foo.java")
+
+	// The same method and BCI is executed once interpreted and once compiled.
+	trace := &libpf.Trace{Hash: libpf.NewTraceHash(1, 2)}
+	trace.AppendFrameWithJITTier(libpf.HotSpotFrame, fileID, 5, libpf.JITTierCompiled)
+	trace.AppendFrameWithJITTier(libpf.HotSpotFrame, fileID, 5, libpf.JITTierInterpreted)
+	trace.AppendFrame(libpf.HotSpotFrame, fileID, 5)
+	r.ReportFramesForTrace(trace)
+	r.ReportCountForTrace(trace.Hash, libpf.UnixTime64(1710000000e9), 1, "", "", "", "", "", "")
+
+	profile, _, _ := r.getProfile()
+	require.Len(t, profile.Sample, 1)
+	// The tier is part of the location identity.
+	require.Len(t, profile.Location, 3)
+
+	var tiers []string
+	for _, loc := range sampleLocations(profile, profile.Sample[0]) {
+		var tier string
+		for _, idx := range loc.Attributes {
+			if attr := profile.AttributeTable[idx]; attr.Key == "jit.tier" {
+				tier = attr.Value.GetStringValue()
+			}
+		}
+		tiers = append(tiers, tier)
+	}
+	assert.Equal(t, []string{"compiled", "interpreted", ""}, tiers)
+}
+
+func TestGetProfileJITTierWithoutMetadata(t *testing.T) {
+	r := newTestOTLPReporter(t)
+
+	resolvedFileID := libpf.NewFileID(3, 4)
+	r.FrameMetadata(resolvedFileID, 5, 10, 0, "foo", "Foo.java")
+
+	// Neither the address of the first frame nor the file of the second frame
+	// has metadata.
+	trace := &libpf.Trace{Hash: libpf.NewTraceHash(1, 2)}
+	trace.AppendFrameWithJITTier(libpf.HotSpotFrame, resolvedFileID, 6, libpf.JITTierCompiled)
+	trace.AppendFrameWithJITTier(libpf.HotSpotFrame, libpf.NewFileID(5, 6), 5,
+		libpf.JITTierInterpreted)
+	r.ReportFramesForTrace(trace)
+	r.ReportCountForTrace(trace.Hash, libpf.UnixTime64(1710000000e9), 1, "", "", "", "", "", "")
+
+	profile, _, _ := r.getProfile()
+	require.Len(t, profile.Sample, 1)
+
+	var functions, tiers []string
+	for _, loc := range sampleLocations(profile, profile.Sample[0]) {
+		require.Len(t, loc.Line, 1)
+		function := profile.Function[loc.Line[0].FunctionIndex-1]
+		functions = append(functions, profile.StringTable[function.Name])
+		for _, idx := range loc.Attributes {
+			if attr := profile.AttributeTable[idx]; attr.Key == "jit.tier" {
+				tiers = append(tiers, attr.Value.GetStringValue())
+			}
+		}
+	}
+	assert.Equal(t, []string{unresolvedFunctionName, unreportedFunctionName}, functions)
+	assert.Equal(t, []string{"compiled", "interpreted"}, tiers)
+}
+
+func TestGetProfileIdleSamples(t *testing.T) {
+	tests := map[string]struct {
+		mode        string
+		wantSamples int
+		wantIdle    bool
+	}{
+		"keep": {
+			mode:        IdleSamplesKeep,
+			wantSamples: 2,
+		},
+		"label": {
+			mode:        IdleSamplesLabel,
+			wantSamples: 2,
+			wantIdle:    true,
+		},
+		"drop": {
+			mode:        IdleSamplesDrop,
+			wantSamples: 1,
+		},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			r := newTestOTLPReporter(t)
+			r.idleSamples = tc.mode
+
+			for i, comm := range []string{"swapper/3", "python"} {
+				trace := &libpf.Trace{Hash: libpf.NewTraceHash(uint64(i), 0)}
+				trace.AppendFrame(libpf.KernelFrame, libpf.NewFileID(3, 4), 5)
+				r.ReportFramesForTrace(trace)
+				r.ReportCountForTrace(trace.Hash, libpf.UnixTime64(1710000000e9), 1,
+					comm, "", "", "", "", "")
+			}
+
+			profile, _, _ := r.getProfile()
+			require.Len(t, profile.Sample, tc.wantSamples)
+
+			var idle int
+			for _, sample := range profile.Sample {
+				for _, label := range sample.Label {
+					if profile.StringTable[label.Key] == "cpu.state" {
+						assert.Equal(t, "idle", profile.StringTable[label.Str])
+						idle++
+					}
+				}
+			}
+			if tc.wantIdle {
+				assert.Equal(t, 1, idle)
+			} else {
+				assert.Zero(t, idle)
+			}
+		})
+	}
+}
+
+func TestGetProfileFunctionStartLine(t *testing.T) {
+	r := newTestOTLPReporter(t)
+
+	fileID := libpf.NewFileID(3, 4)
+	// Two lines of the same function and a function of the same name that
+	// starts at a different line, e.g. a redefinition.
+	r.FrameMetadata(fileID, 5, 12, 2, "foo", "foo.py")
+	r.FrameMetadata(fileID, 6, 15, 5, "foo", "foo.py")
+	r.FrameMetadata(fileID, 7, 42, 2, "foo", "foo.py")
+
+	trace := &libpf.Trace{Hash: libpf.NewTraceHash(1, 2)}
+	trace.AppendFrame(libpf.PythonFrame, fileID, 5)
+	trace.AppendFrame(libpf.PythonFrame, fileID, 6)
+	trace.AppendFrame(libpf.PythonFrame, fileID, 7)
+	r.ReportFramesForTrace(trace)
+	r.ReportCountForTrace(trace.Hash, libpf.UnixTime64(1710000000e9), 1, "", "", "", "", "", "")
+
+	profile, _, _ := r.getProfile()
+	require.Len(t, profile.Sample, 1)
+	require.Len(t, profile.Function, 2)
+
+	var startLines []int64
+	for _, loc := range sampleLocations(profile, profile.Sample[0]) {
+		require.Len(t, loc.Line, 1)
+		fn := profile.Function[loc.Line[0].FunctionIndex-1]
+		startLines = append(startLines, fn.StartLine)
+		assert.Equal(t, "foo", profile.StringTable[fn.SystemName])
+	}
+	assert.Equal(t, []int64{10, 10, 40}, startLines)
+}
+
+func TestSourceInfoStartLine(t *testing.T) {
+	assert.Equal(t, int64(10), sourceInfo{lineNumber: 12, functionOffset: 2}.startLine())
+	assert.Equal(t, int64(12), sourceInfo{lineNumber: 12}.startLine())
+	assert.Equal(t, int64(0), sourceInfo{lineNumber: 1, functionOffset: 2}.startLine())
+}
+
+func TestGetProfileAttributes(t *testing.T) {
+	r := newTestOTLPReporter(t)
+
+	pyTrace := &libpf.Trace{Hash: libpf.NewTraceHash(1, 1)}
+	pyTrace.AppendFrame(libpf.NativeFrame, libpf.NewFileID(5, 6), 0x10)
+	pyTrace.AppendFrame(libpf.PythonFrame, libpf.NewFileID(3, 4), 5)
+	r.ReportFramesForTrace(pyTrace)
+
+	kernelTrace := &libpf.Trace{Hash: libpf.NewTraceHash(2, 2)}
+	kernelTrace.AppendFrame(libpf.KernelFrame, libpf.NewFileID(7, 8), 0x20)
+	r.ReportFramesForTrace(kernelTrace)
+
+	for i := 0; i < 2; i++ {
+		r.ReportCountForTrace(pyTrace.Hash, libpf.UnixTime64(1710000000e9), 1,
+			"", "", "", "", "", "")
+	}
+	r.ReportCountForTrace(kernelTrace.Hash, libpf.UnixTime64(1710000000e9), 1,
+		"", "", "", "", "", "")
+
+	profile, _, _ := r.getProfile()
+	attrs := make(map[string]any)
+	for _, kv := range getProfileAttributes(profile, 5*time.Second) {
+		switch v := kv.Value.Value.(type) {
+		case *common.AnyValue_IntValue:
+			attrs[kv.Key] = v.IntValue
+		case *common.AnyValue_StringValue:
+			attrs[kv.Key] = v.StringValue
+		}
+	}
+	assert.Equal(t, map[string]any{
+		"profile.window.duration_ns": int64(5e9),
+		"profile.runtime":            libpf.PythonFrame.String(),
+	}, attrs)
+
+	assert.Empty(t, dominantRuntime(&pprofextended.Profile{}))
+}
+
+func TestGetProfileInlineFrames(t *testing.T) {
+	r := newTestOTLPReporter(t)
+
+	fileID := libpf.NewFileID(3, 4)
+	r.ReportFrameMetadata(&libpf.FrameMetadata{
+		FileID:        fileID,
+		AddressOrLine: 5,
+		LineNumber:    10,
+		FunctionName:  "caller",
+		Filename:      "Caller.java",
+		InlineFrames: []libpf.InlineFrame{
+			{FunctionName: "middle", Filename: "Middle.java", LineNumber: 20},
+			{FunctionName: "callee", Filename: "Callee.java", LineNumber: 30},
+		},
+	})
+	// Metadata without inline frames must not remove previously reported ones.
+	r.FrameMetadata(fileID, 5, 10, 0, "caller", "Caller.java")
+
+	trace := &libpf.Trace{Hash: libpf.NewTraceHash(1, 2)}
+	trace.AppendFrame(libpf.HotSpotFrame, fileID, 5)
+	r.ReportFramesForTrace(trace)
+	r.ReportCountForTrace(trace.Hash, libpf.UnixTime64(1710000000e9), 1, "", "", "", "", "", "")
+
+	profile, _, _ := r.getProfile()
+	require.Len(t, profile.Sample, 1)
+	require.Len(t, profile.Location, 1)
+
+	loc := profile.Location[0]
+	assert.Equal(t, []string{"callee", "middle", "caller"}, functionNames(profile, loc))
+	var lines []int64
+	for _, line := range loc.Line {
+		lines = append(lines, line.Line)
+	}
+	assert.Equal(t, []int64{30, 20, 10}, lines)
+}
+
+func TestGetProfilePlaceholderFrames(t *testing.T) {
+	tests := map[string]struct {
+		omit      bool
+		wantNames [][]string
+	}{
+		"placeholders": {
+			wantNames: [][]string{
+				{unknownPlaceholder},
+				{unreportedFunctionName},
+				{unresolvedFunctionName},
+				{"foo"},
+				nil,
+			},
+		},
+		"omitted": {
+			omit: true,
+			wantNames: [][]string{
+				{"foo"},
+				nil,
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			r := newTestOTLPReporter(t)
+			r.omitPlaceholderFrames = tc.omit
+
+			pyFile := libpf.NewFileID(3, 4)
+			r.FrameMetadata(pyFile, 5, 10, 0, "foo", "foo.py")
+
+			trace := &libpf.Trace{Hash: libpf.NewTraceHash(1, 2)}
+			// Kernel frame without a reported symbol.
+			trace.AppendFrame(libpf.KernelFrame, libpf.NewFileID(7, 8), 0x30)
+			// Interpreted frame of a file without any metadata.
+			trace.AppendFrame(libpf.PythonFrame, libpf.NewFileID(5, 6), 5)
+			// Interpreted frame of a line without metadata.
+			trace.AppendFrame(libpf.PythonFrame, pyFile, 6)
+			trace.AppendFrame(libpf.PythonFrame, pyFile, 5)
+			trace.AppendFrame(libpf.NativeFrame, libpf.NewFileID(9, 10), 0x10)
+
+			// Report the trace twice, so that omitted frames are also skipped
+			// for locations that are looked up.
+			for i := uint64(0); i < 2; i++ {
+				trace.Hash = libpf.NewTraceHash(1, i)
+				r.ReportFramesForTrace(trace)
+				r.ReportCountForTrace(trace.Hash, libpf.UnixTime64(1710000000e9), 1,
+					"", "", "", "", "", "")
+			}
+
+			profile, _, _ := r.getProfile()
+			require.Len(t, profile.Sample, 2)
+			for _, sample := range profile.Sample {
+				locs := sampleLocations(profile, sample)
+				require.Len(t, locs, len(tc.wantNames))
+				for i, loc := range locs {
+					if tc.wantNames[i] == nil {
+						assert.Empty(t, loc.Line)
+						continue
+					}
+					assert.Equal(t, tc.wantNames[i], functionNames(profile, loc))
+				}
+			}
+			assert.Len(t, profile.LocationIndices, 2*len(tc.wantNames))
+		})
+	}
+}
+
+func TestGetProfileMergesMappings(t *testing.T) {
+	fileID := libpf.NewFileID(3, 4)
+
+	tests := map[string][]libpf.FrameType{
+		"nativeFirst":      {libpf.NativeFrame, libpf.PythonFrame},
+		"interpretedFirst": {libpf.PythonFrame, libpf.NativeFrame},
+		"kernelFirst":      {libpf.KernelFrame, libpf.NativeFrame, libpf.PythonFrame},
+	}
+
+	for name, frameTypes := range tests {
+		frameTypes := frameTypes
+		t.Run(name, func(t *testing.T) {
+			r := newTestOTLPReporter(t)
+			r.executables.Add(fileID, execInfo{
+				fileName: "libpython3.12.so",
+				buildID:  "0123456789abcdef",
+			})
+
+			trace := &libpf.Trace{Hash: libpf.NewTraceHash(1, 2)}
+			for i, frameType := range frameTypes {
+				trace.AppendFrame(frameType, fileID, libpf.AddressOrLineno(i+1))
+			}
+			r.ReportFramesForTrace(trace)
+			r.ReportCountForTrace(trace.Hash, libpf.UnixTime64(1710000000e9), 1,
+				"python", "", "", "", "", "")
+
+			profile, _, _ := r.getProfile()
+			require.Len(t, profile.Mapping, 1)
+			mapping := profile.Mapping[0]
+			assert.Equal(t, "libpython3.12.so", profile.StringTable[mapping.Filename])
+			assert.Equal(t, "0123456789abcdef", profile.StringTable[mapping.BuildId])
+			assert.Equal(t, pprofextended.BuildIdKind_BUILD_ID_LINKER, mapping.BuildIdKind)
+
+			for _, loc := range profile.Location {
+				assert.Equal(t, uint64(1), loc.MappingIndex)
+			}
+		})
+	}
+}
+
+func TestGetProfileMappingMemoryRange(t *testing.T) {
+	r := newTestOTLPReporter(t)
+	mapped := libpf.NewFileID(3, 4)
+	unmapped := libpf.NewFileID(6, 7)
+	r.ExecutableMetadata(context.Background(), mapped, "/usr/bin/app", "", false)
+	r.MappingMetadata(mapped, 0x55d0a0000000, 0x55d0a0042000)
+	// Another process mapping the executable at the same range.
+	r.MappingMetadata(mapped, 0x55d0a0000000, 0x55d0a0042000)
+	r.ExecutableMetadata(context.Background(), unmapped, "/usr/lib/libc.so.6", "", false)
+	// Memory ranges of unknown executables are ignored.
+	r.MappingMetadata(libpf.NewFileID(8, 9), 0x1000, 0x2000)
+	// Processes map the library at different ranges, so neither is reported.
+	relocated := libpf.NewFileID(10, 11)
+	r.ExecutableMetadata(context.Background(), relocated, "/usr/lib/libfoo.so", "", false)
+	r.MappingMetadata(relocated, 0x7f0000000000, 0x7f0000010000)
+	r.MappingMetadata(relocated, 0x7f1000000000, 0x7f1000010000)
+	r.MappingMetadata(relocated, 0x7f0000000000, 0x7f0000010000)
+
+	trace := &libpf.Trace{Hash: libpf.NewTraceHash(1, 2)}
+	trace.AppendFrame(libpf.NativeFrame, mapped, 0x1234)
+	trace.AppendFrame(libpf.NativeFrame, unmapped, 0x5678)
+	trace.AppendFrame(libpf.NativeFrame, relocated, 0x9abc)
+	r.ReportFramesForTrace(trace)
+	r.ReportCountForTrace(trace.Hash, libpf.UnixTime64(1710000000e9), 1,
+		"app", "", "", "", "", "")
+
+	profile, _, _ := r.getProfile()
+	require.Len(t, profile.Mapping, 3)
+	assert.Equal(t, uint64(0x55d0a0000000), profile.Mapping[0].MemoryStart)
+	assert.Equal(t, uint64(0x55d0a0042000), profile.Mapping[0].MemoryLimit)
+	for _, mapping := range profile.Mapping[1:] {
+		assert.Zero(t, mapping.MemoryStart)
+		assert.Zero(t, mapping.MemoryLimit)
+	}
+}
+
+func TestGetProfileBuildIDMode(t *testing.T) {
+	fileID := libpf.NewFileID(3, 4)
+
+	tests := map[string]struct {
+		mode     string
+		buildID  string
+		wantID   string
+		wantKind pprofextended.BuildIdKind
+	}{
+		"linker": {
+			mode:     BuildIDModeLinker,
+			buildID:  "0123456789abcdef",
+			wantID:   "0123456789abcdef",
+			wantKind: pprofextended.BuildIdKind_BUILD_ID_LINKER,
+		},
+		"hash": {
+			mode:     BuildIDModeHash,
+			buildID:  "0123456789abcdef",
+			wantID:   fileID.StringNoQuotes(),
+			wantKind: pprofextended.BuildIdKind_BUILD_ID_BINARY_HASH,
+		},
+		"autoWithBuildID": {
+			mode:     BuildIDModeAuto,
+			buildID:  "0123456789abcdef",
+			wantID:   "0123456789abcdef",
+			wantKind: pprofextended.BuildIdKind_BUILD_ID_LINKER,
+		},
+		"autoWithoutBuildID": {
+			mode:     BuildIDModeAuto,
+			wantID:   fileID.StringNoQuotes(),
+			wantKind: pprofextended.BuildIdKind_BUILD_ID_BINARY_HASH,
+		},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			r := newTestOTLPReporter(t)
+			r.otlpBuildIDMode = tc.mode
+			r.executables.Add(fileID, execInfo{
+				fileName: "libfoo.so",
+				buildID:  tc.buildID,
+			})
+
+			trace := &libpf.Trace{Hash: libpf.NewTraceHash(1, 2)}
+			trace.AppendFrame(libpf.NativeFrame, fileID, 1)
+			r.ReportFramesForTrace(trace)
+			r.ReportCountForTrace(trace.Hash, libpf.UnixTime64(1710000000e9), 1,
+				"foo", "", "", "", "", "")
+
+			profile, _, _ := r.getProfile()
+			require.Len(t, profile.Mapping, 1)
+			mapping := profile.Mapping[0]
+			assert.Equal(t, tc.wantID, profile.StringTable[mapping.BuildId])
+			assert.Equal(t, tc.wantKind, mapping.BuildIdKind)
+		})
+	}
+}
+
+func TestGetProfileRawNativeFrames(t *testing.T) {
+	known := libpf.NewFileID(3, 4)
+	unknown := libpf.NewFileID(5, 6)
+
+	r := newTestOTLPReporter(t)
+	r.rawNativeFrames = true
+	r.executables.Add(known, execInfo{
+		fileName:    "libfoo.so",
+		buildID:     "0123456789abcdef",
+		memoryStart: 0x1000,
+		memoryLimit: 0x2000,
+	})
+
+	trace := &libpf.Trace{Hash: libpf.NewTraceHash(1, 2)}
+	trace.AppendFrame(libpf.NativeFrame, known, 0x1234)
+	trace.AppendFrame(libpf.NativeFrame, unknown, 0x5678)
+	r.ReportFramesForTrace(trace)
+	r.ReportCountForTrace(trace.Hash, libpf.UnixTime64(1710000000e9), 1,
+		"foo", "", "", "", "", "")
+
+	profile, _, _ := r.getProfile()
+	for _, s := range []string{unknownPlaceholder, dummyMappingFileName, "libfoo.so",
+		"0123456789abcdef"} {
+		assert.NotContains(t, profile.StringTable, s)
+	}
+
+	require.Len(t, profile.Mapping, 2)
+	locations := sampleLocations(profile, profile.Sample[0])
+	require.Len(t, locations, 2)
+	for i, fileID := range []libpf.FileID{known, unknown} {
+		mapping := profile.Mapping[locations[i].MappingIndex-1]
+		assert.Equal(t, "", profile.StringTable[mapping.Filename])
+		assert.Equal(t, fileID.StringNoQuotes(), profile.StringTable[mapping.BuildId])
+		assert.Equal(t, pprofextended.BuildIdKind_BUILD_ID_BINARY_HASH, mapping.BuildIdKind)
+		assert.Zero(t, mapping.MemoryStart)
+		assert.False(t, mapping.HasFunctions)
+		assert.False(t, mapping.HasFilenames)
+	}
+	assert.Equal(t, uint64(0x1234), locations[0].Address)
+	assert.Equal(t, uint64(0x5678), locations[1].Address)
+}
+
+func TestGetProfileMinSampleCount(t *testing.T) {
+	r := newTestOTLPReporter(t)
+	r.minSampleCount = 3
+
+	rare := &libpf.Trace{Hash: libpf.NewTraceHash(1, 2)}
+	rare.AppendFrame(libpf.KernelFrame, libpf.NewFileID(3, 4), 5)
+	r.ReportFramesForTrace(rare)
+	frequent := &libpf.Trace{Hash: libpf.NewTraceHash(6, 7)}
+	frequent.AppendFrame(libpf.KernelFrame, libpf.NewFileID(3, 4), 8)
+	r.ReportFramesForTrace(frequent)
+
+	sampleCounts := func(profile *pprofextended.Profile) map[string]int64 {
+		counts := make(map[string]int64)
+		for _, s := range profile.Sample {
+			counts[profile.StringTable[s.StacktraceIdIndex]] = s.Value[0]
+		}
+		return counts
+	}
+
+	for i := 0; i < 2; i++ {
+		ts := libpf.UnixTime64(1710000000e9 + uint64(i)*1e9)
+		r.ReportCountForTrace(rare.Hash, ts, 1, "comm", "", "", "", "", "")
+		r.ReportCountForTrace(frequent.Hash, ts, 3, "comm", "", "", "", "", "")
+
+		// The rare trace is held back until its counts add up to the minimum.
+		profile, _, _ := r.getProfile()
+		assert.Equal(t, map[string]int64{frequent.Hash.StringNoQuotes(): 3},
+			sampleCounts(profile))
+	}
+
+	r.ReportCountForTrace(rare.Hash, libpf.UnixTime64(1710000002e9), 1,
+		"comm", "", "", "", "", "")
+	profile, _, _ := r.getProfile()
+	require.Len(t, profile.Sample, 1)
+	assert.Equal(t, map[string]int64{rare.Hash.StringNoQuotes(): 3}, sampleCounts(profile))
+	assert.Len(t, profile.Sample[0].Timestamps, 3)
+
+	profile, _, _ = r.getProfile()
+	assert.Empty(t, profile.Sample)
+}
+
+func TestGetProfileTraceInfoMaxReports(t *testing.T) {
+	r := newTestOTLPReporter(t)
+	r.traceInfoMaxReports = 3
+
+	late := &libpf.Trace{Hash: libpf.NewTraceHash(1, 2)}
+	late.AppendFrame(libpf.KernelFrame, libpf.NewFileID(3, 4), 5)
+	missing := libpf.NewTraceHash(6, 7)
+	for _, hash := range []libpf.TraceHash{late.Hash, missing} {
+		r.ReportCountForTrace(hash, libpf.UnixTime64(1710000000e9), 1,
+			"comm", "", "", "", "", "")
+		// Simulate the eviction of the trace information.
+		r.traces.Remove(hash)
+	}
+
+	profile, _, _ := r.getProfile()
+	assert.Empty(t, profile.Sample)
+
+	// Trace information that arrives before the limit is reached still
+	// reports the sample.
+	r.ReportFramesForTrace(late)
+	profile, _, _ = r.getProfile()
+	require.Len(t, profile.Sample, 1)
+	assert.Equal(t, late.Hash.StringNoQuotes(),
+		profile.StringTable[profile.Sample[0].StacktraceIdIndex])
+	assert.Equal(t, 1, r.samples.Len())
+	assert.Zero(t, r.GetMetrics().TraceInfoMissingDroppedCount)
+
+	// The sample whose trace information never arrives is dropped.
+	profile, _, _ = r.getProfile()
+	assert.Empty(t, profile.Sample)
+	assert.Zero(t, r.samples.Len())
+	assert.Equal(t, uint32(1), r.GetMetrics().TraceInfoMissingDroppedCount)
+}
+
+func TestGetProfileMaxStackDepth(t *testing.T) {
+	r := newTestOTLPReporter(t)
+	r.maxStackDepth = 50
+
+	deep := &libpf.Trace{Hash: libpf.NewTraceHash(1, 2)}
+	for i := 0; i < 1000; i++ {
+		deep.AppendFrame(libpf.KernelFrame, libpf.NewFileID(3, 4), libpf.AddressOrLineno(i))
+	}
+	r.ReportFramesForTrace(deep)
+	r.ReportCountForTrace(deep.Hash, libpf.UnixTime64(1710000000e9), 1,
+		"comm", "", "", "", "", "")
+	shallow := &libpf.Trace{Hash: libpf.NewTraceHash(5, 6)}
+	for i := 0; i < 50; i++ {
+		shallow.AppendFrame(libpf.KernelFrame, libpf.NewFileID(3, 4), libpf.AddressOrLineno(i))
+	}
+	r.ReportFramesForTrace(shallow)
+	r.ReportCountForTrace(shallow.Hash, libpf.UnixTime64(1710000000e9), 2,
+		"comm", "", "", "", "", "")
+
+	profile, _, _ := r.getProfile()
+	require.Len(t, profile.Sample, 2)
+	for _, sample := range profile.Sample {
+		locs := sampleLocations(profile, sample)
+		switch profile.StringTable[sample.StacktraceIdIndex] {
+		case deep.Hash.StringNoQuotes():
+			// The innermost frames are kept, the others are replaced by a
+			// single synthetic frame.
+			assert.Equal(t, uint64(51), sample.LocationsLength)
+			assert.Equal(t, []int64{1}, sample.Value)
+			assert.Equal(t, []string{"[truncated 950 frames]"},
+				functionNames(profile, locs[50]))
+			assert.Equal(t, uint64(0), locs[0].Address)
+			assert.Equal(t, uint64(49), locs[49].Address)
+		case shallow.Hash.StringNoQuotes():
+			assert.Equal(t, uint64(50), sample.LocationsLength)
+			assert.Equal(t, []int64{2}, sample.Value)
+		default:
+			t.Fatalf("unexpected sample %s", profile.StringTable[sample.StacktraceIdIndex])
+		}
+	}
+	// The frames both traces share are only reported once.
+	assert.Len(t, profile.Location, 51)
+}
+
+func TestCacheEvictionMetrics(t *testing.T) {
+	r := newTestOTLPReporter(t)
+
+	const cacheSize = 4
+	traces, err := newLockedLRU[libpf.TraceHash, traceInfo](cacheSize, libpf.TraceHash.Hash32)
+	require.NoError(t, err)
+	samples, err := newLockedLRU[libpf.TraceHash, sample](cacheSize, libpf.TraceHash.Hash32)
+	require.NoError(t, err)
+	r.traces = traces
+	r.samples = samples
+	r.capacities.samples = cacheSize
+	r.cacheHighWaterMark = 0.5
+
+	const numTraces = 10
+	for i := 0; i < numTraces; i++ {
+		trace := &libpf.Trace{Hash: libpf.NewTraceHash(uint64(i), 0)}
+		trace.AppendFrame(libpf.KernelFrame, libpf.NewFileID(3, 4), 5)
+		r.ReportFramesForTrace(trace)
+		r.ReportCountForTrace(trace.Hash, libpf.UnixTime64(1710000000e9), 1,
+			"comm", "", "", "", "", "")
+	}
+
+	metrics := r.GetMetrics()
+	assert.Equal(t, uint32(numTraces-cacheSize), metrics.TraceEvictionCount)
+	assert.Equal(t, uint32(numTraces-cacheSize), metrics.SampleEvictionCount)
+
+	// Removing samples on report does not count as eviction.
+	profile, _, _ := r.getProfile()
+	assert.Len(t, profile.Sample, cacheSize)
+	metrics = r.GetMetrics()
+	assert.Zero(t, metrics.TraceEvictionCount)
+	assert.Zero(t, metrics.SampleEvictionCount)
+}
+
+func TestExecutableMetadataLifetime(t *testing.T) {
+	r := newTestOTLPReporter(t)
+	r.executables.SetLifetime(10 * time.Millisecond)
+
+	fileID := libpf.NewFileID(1, 2)
+	r.ExecutableMetadata(context.Background(), fileID, "/usr/bin/app", "build-id", false)
+	_, ok := r.executables.Peek(fileID)
+	require.True(t, ok)
+
+	time.Sleep(20 * time.Millisecond)
+	_, ok = r.executables.Peek(fileID)
+	assert.False(t, ok)
+}
+
+func TestTraceInfoLifetime(t *testing.T) {
+	const lifetime = 50 * time.Millisecond
+
+	r := newTestOTLPReporter(t)
+	r.traceInfoLifetime = lifetime
+	r.traces.SetLifetime(lifetime)
+	r.minSampleCount = 2
+
+	stale := &libpf.Trace{Hash: libpf.NewTraceHash(1, 2)}
+	stale.AppendFrame(libpf.KernelFrame, libpf.NewFileID(3, 4), 5)
+	r.ReportFramesForTrace(stale)
+	held := &libpf.Trace{Hash: libpf.NewTraceHash(6, 7)}
+	held.AppendFrame(libpf.KernelFrame, libpf.NewFileID(3, 4), 8)
+	r.ReportFramesForTrace(held)
+	r.ReportCountForTrace(held.Hash, libpf.UnixTime64(1710000000e9), 1,
+		"comm", "", "", "", "", "")
+
+	time.Sleep(lifetime / 2)
+	// The sample is held back until it reaches the minimum count, which renews
+	// the lifetime of its trace information.
+	assert.Empty(t, r.collectSamples())
+
+	time.Sleep(lifetime/2 + 10*time.Millisecond)
+	_, ok := r.traces.Peek(stale.Hash)
+	assert.False(t, ok, "trace information of a trace that was not seen again expired")
+	_, ok = r.traces.Peek(held.Hash)
+	assert.True(t, ok, "trace information of a held back sample expired")
+
+	r.ReportCountForTrace(held.Hash, libpf.UnixTime64(1710000001e9), 1,
+		"comm", "", "", "", "", "")
+	samples := r.collectSamples()
+	require.Contains(t, samples, held.Hash)
+	assert.Equal(t, uint32(2), samples[held.Hash].count)
+}
+
+func TestExpireExecutableMetadata(t *testing.T) {
+	r := newTestOTLPReporter(t)
+	r.expiredExecutableLifetime = 10 * time.Millisecond
+
+	expired := libpf.NewFileID(1, 2)
+	mapped := libpf.NewFileID(3, 4)
+	r.ExecutableMetadata(context.Background(), expired, "/usr/bin/app", "build-id", false)
+	r.ExecutableMetadata(context.Background(), mapped, "/usr/lib/libc.so.6", "libc", false)
+
+	// Executables that are not known are ignored.
+	r.ExpireExecutableMetadata(libpf.NewFileID(5, 6))
+	_, ok := r.executables.Peek(libpf.NewFileID(5, 6))
+	assert.False(t, ok)
+
+	// The metadata is kept for the samples that were collected before.
+	r.ExpireExecutableMetadata(expired)
+	info, ok := r.executables.Peek(expired)
+	require.True(t, ok)
+	assert.Equal(t, "build-id", info.buildID)
+
+	time.Sleep(20 * time.Millisecond)
+	_, ok = r.executables.Peek(expired)
+	assert.False(t, ok)
+	_, ok = r.executables.Peek(mapped)
+	assert.True(t, ok)
+}
+
+func TestGetProfileAllocations(t *testing.T) {
+	type report struct {
+		count      uint16
+		allocBytes uint64
+	}
+
+	tests := map[string]struct {
+		reports     []report
+		wantTypes   []string
+		wantSamples [][]int64
+	}{
+		"cpuOnly": {
+			reports:     []report{{count: 2}},
+			wantTypes:   []string{"samples/count"},
+			wantSamples: [][]int64{{2}},
+		},
+		"allocOnly": {
+			reports:     []report{{allocBytes: 4096}},
+			wantTypes:   []string{"samples/count", "alloc_space/bytes"},
+			wantSamples: [][]int64{{0, 4096}},
+		},
+		"mixed": {
+			reports: []report{
+				{count: 3},
+				{allocBytes: 512},
+				{count: 1, allocBytes: 64},
+			},
+			wantTypes:   []string{"samples/count", "alloc_space/bytes"},
+			wantSamples: [][]int64{{3, 0}, {0, 512}, {1, 64}},
+		},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			r := newTestOTLPReporter(t)
+
+			for i, rep := range tc.reports {
+				trace := &libpf.Trace{Hash: libpf.NewTraceHash(uint64(i), 0)}
+				trace.AppendFrame(libpf.KernelFrame, libpf.NewFileID(3, 4), 5)
+				r.ReportFramesForTrace(trace)
+				if rep.count != 0 {
+					r.ReportCountForTrace(trace.Hash, libpf.UnixTime64(1710000000e9),
+						rep.count, "comm", "", "", "", "", "")
+				}
+				if rep.allocBytes != 0 {
+					r.ReportAllocationForTrace(trace.Hash, libpf.UnixTime64(1710000000e9),
+						rep.allocBytes, "comm", "", "", "", "", "")
+				}
+			}
+
+			profile, _, _ := r.getProfile()
+
+			types := make([]string, 0, len(profile.SampleType))
+			for _, st := range profile.SampleType {
+				types = append(types, profile.StringTable[st.Type]+"/"+
+					profile.StringTable[st.Unit])
+			}
+			assert.Equal(t, tc.wantTypes, types)
+
+			values := make([][]int64, 0, len(profile.Sample))
+			for _, sample := range profile.Sample {
+				require.Len(t, sample.Value, len(profile.SampleType))
+				values = append(values, sample.Value)
+			}
+			assert.ElementsMatch(t, tc.wantSamples, values)
+		})
+	}
+}
+
+func TestGetProfileDefaultSampleType(t *testing.T) {
+	tests := map[string]struct {
+		reportCPUTime     bool
+		defaultSampleType string
+		want              string
+	}{
+		"sample count": {
+			want: "samples",
+		},
+		"cpu time": {
+			reportCPUTime: true,
+			want:          "cpu",
+		},
+		"configured": {
+			reportCPUTime:     true,
+			defaultSampleType: "alloc_space",
+			want:              "alloc_space",
+		},
+		"configured sample count": {
+			reportCPUTime:     true,
+			defaultSampleType: "samples",
+			want:              "samples",
+		},
+		"configured type not reported": {
+			defaultSampleType: "cpu",
+			want:              "samples",
+		},
+	}
+
+	for name, tc := range tests {
+		name := name
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			r := newTestOTLPReporter(t)
+			r.reportCPUTime = tc.reportCPUTime
+			r.profileOptions.defaultSampleType = tc.defaultSampleType
+
+			trace := &libpf.Trace{Hash: libpf.NewTraceHash(1, 2)}
+			trace.AppendFrame(libpf.KernelFrame, libpf.NewFileID(3, 4), 5)
+			r.ReportFramesForTrace(trace)
+			r.ReportCountForTrace(trace.Hash, libpf.UnixTime64(1710000000e9), 1,
+				"comm", "", "", "", "", "")
+			r.ReportAllocationForTrace(trace.Hash, libpf.UnixTime64(1710000000e9), 64,
+				"comm", "", "", "", "", "")
+
+			profile, _, _ := r.getProfile()
+			assert.Equal(t, tc.want, profile.StringTable[profile.DefaultSampleType], name)
+		})
+	}
+}
+
+// fakeProfilesClient records the number of Export calls and the last request.
+type fakeProfilesClient struct {
+	exports  int
+	last     *otlpcollector.ExportProfilesServiceRequest
+	requests []*otlpcollector.ExportProfilesServiceRequest
+	// partialSuccess is returned in the response of every export.
+	partialSuccess *otlpcollector.ExportProfilesPartialSuccess
+}
+
+func (f *fakeProfilesClient) Export(_ context.Context,
+	in *otlpcollector.ExportProfilesServiceRequest, _ ...grpc.CallOption) (
+	*otlpcollector.ExportProfilesServiceResponse, error) {
+	f.exports++
+	f.last = in
+	f.requests = append(f.requests, in)
+	return &otlpcollector.ExportProfilesServiceResponse{PartialSuccess: f.partialSuccess}, nil
+}
+
+func TestReportOTLPProfile(t *testing.T) {
+	const reportInterval = 5 * time.Second
+
+	tests := map[string]struct {
+		samples int
+		// lastReport is the time since the previous report, if any.
+		lastReport time.Duration
+		wantExport bool
+	}{
+		"no samples": {},
+		"first report": {
+			samples:    2,
+			wantExport: true,
+		},
+		"later report": {
+			samples:    1,
+			lastReport: 2 * time.Second,
+			wantExport: true,
+		},
+	}
+
+	for name, tc := range tests {
+		name := name
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			client := &fakeProfilesClient{}
+			r := newTestOTLPReporterWithClient(t, client)
+			if tc.lastReport != 0 {
+				r.lastReport = time.Now().Add(-tc.lastReport)
+			}
+
+			for i := 0; i < tc.samples; i++ {
+				trace := &libpf.Trace{Hash: libpf.NewTraceHash(uint64(i), 2)}
+				trace.AppendFrame(libpf.KernelFrame, libpf.NewFileID(3, 4),
+					libpf.AddressOrLineno(i))
+				r.ReportFramesForTrace(trace)
+				r.ReportCountForTrace(trace.Hash, libpf.UnixTime64(1710000000e9), 1,
+					"comm", "", "", "", "", "")
+			}
+
+			require.NoError(t, r.reportOTLPProfile(context.Background(), reportInterval))
+			if !tc.wantExport {
+				// Reports without samples are skipped.
+				assert.Zero(t, client.exports)
+				return
+			}
+
+			require.Equal(t, 1, client.exports)
+			require.Len(t, client.last.ResourceProfiles, 1)
+			profile := client.last.ResourceProfiles[0].ScopeProfiles[0].Profiles[0].Profile
+			assert.Len(t, profile.Sample, tc.samples)
+			// The duration is taken from the report window, which falls back to
+			// the report interval before the first report.
+			if tc.lastReport == 0 {
+				assert.Equal(t, reportInterval.Nanoseconds(), profile.DurationNanos)
+			} else {
+				assert.GreaterOrEqual(t, profile.DurationNanos, tc.lastReport.Nanoseconds())
+				assert.Less(t, profile.DurationNanos, reportInterval.Nanoseconds())
+			}
+		})
+	}
+}
+
+func TestReportOTLPProfileBuildTime(t *testing.T) {
+	r := newTestOTLPReporterWithClient(t, &fakeProfilesClient{})
+	r.profileBuildWarnFraction = 0.5
+
+	trace := &libpf.Trace{Hash: libpf.NewTraceHash(1, 2)}
+	trace.AppendFrame(libpf.KernelFrame, libpf.NewFileID(3, 4), 5)
+	r.ReportFramesForTrace(trace)
+	r.ReportCountForTrace(trace.Hash, libpf.UnixTime64(1710000000e9), 1,
+		"comm", "", "", "", "", "")
+	require.NoError(t, r.reportOTLPProfile(context.Background(), 5*time.Second))
+
+	assert.Positive(t, r.maxProfileBuildTime.Load())
+	// The metric holds the maximum since the last metrics report.
+	r.recordProfileBuildTime(2*time.Millisecond, 5*time.Second)
+	r.recordProfileBuildTime(time.Millisecond, 5*time.Second)
+	assert.Equal(t, int64(2000), r.GetMetrics().ProfileBuildMaxUsec)
+	assert.Zero(t, r.GetMetrics().ProfileBuildMaxUsec)
+}
+
+func TestReportOTLPProfileMaxRequestSize(t *testing.T) {
+	const numTraces = 32
+
+	client := &fakeProfilesClient{}
+	r := newTestOTLPReporterWithClient(t, client)
+	reportSamples := func() {
+		for i := 0; i < numTraces; i++ {
+			trace := &libpf.Trace{Hash: libpf.NewTraceHash(uint64(i), 2)}
+			trace.AppendFrame(libpf.PythonFrame, libpf.NewFileID(uint64(i), 4), 5)
+			r.FrameMetadata(trace.Files[0], 5, 10, 0, fmt.Sprintf("func%d", i),
+				fmt.Sprintf("file%d.py", i))
+			r.ReportFramesForTrace(trace)
+			r.ReportCountForTrace(trace.Hash, libpf.UnixTime64(1710000000e9), 1,
+				"comm", "", "", "", "", "")
+		}
+	}
+
+	reportSamples()
+	require.NoError(t, r.reportOTLPProfile(context.Background(), 5*time.Second))
+	require.Equal(t, 1, client.exports)
+	size := proto.Size(client.last)
+
+	// Force the samples to be split across several requests.
+	r.maxRequestSize = size / 3
+	client.requests = nil
+	reportSamples()
+	require.NoError(t, r.reportOTLPProfile(context.Background(), 5*time.Second))
+	require.Greater(t, len(client.requests), 1)
+
+	traces := make(map[string]bool)
+	for _, req := range client.requests {
+		assert.LessOrEqual(t, proto.Size(req), r.maxRequestSize)
+		for _, rp := range req.ResourceProfiles {
+			profile := rp.ScopeProfiles[0].Profiles[0].Profile
+			// Every profile references its own string table.
+			assert.Equal(t, "", profile.StringTable[0])
+			for _, s := range profile.Sample {
+				traces[profile.StringTable[s.StacktraceIdIndex]] = true
+				assert.Equal(t, []int64{1}, s.Value)
+				locs := sampleLocations(profile, s)
+				require.Len(t, locs, 1)
+				assert.Len(t, functionNames(profile, locs[0]), 1)
+			}
+		}
+	}
+	assert.Len(t, traces, numTraces)
+}
+
+func TestBatchResourceProfiles(t *testing.T) {
+	rp := &profiles.ResourceProfiles{SchemaUrl: DefaultSchemaURL}
+	size := resourceProfilesSize(rp)
+
+	tests := map[string]struct {
+		maxSize int
+		want    []int
+	}{
+		"unlimited":     {maxSize: 0, want: []int{5}},
+		"two per batch": {maxSize: 2*size + 1, want: []int{2, 2, 1}},
+		"too small":     {maxSize: 1, want: []int{1, 1, 1, 1, 1}},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			resourceProfiles := []*profiles.ResourceProfiles{rp, rp, rp, rp, rp}
+			var got []int
+			for _, batch := range batchResourceProfiles(resourceProfiles, tc.maxSize) {
+				got = append(got, len(batch))
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestReportOTLPProfilePartialSuccess(t *testing.T) {
+	tests := map[string]struct {
+		partialSuccess   *otlpcollector.ExportProfilesPartialSuccess
+		rejectedProfiles uint32
+		rejectedSamples  uint32
+	}{
+		"full success": {},
+		"warning": {
+			partialSuccess: &otlpcollector.ExportProfilesPartialSuccess{
+				ErrorMessage: "deprecated attribute",
+			},
+		},
+		"rejected": {
+			partialSuccess: &otlpcollector.ExportProfilesPartialSuccess{
+				RejectedProfiles: 1,
+				ErrorMessage:     "invalid profile",
+			},
+			rejectedProfiles: 1,
+			rejectedSamples:  2,
+		},
+	}
+
+	for name, tc := range tests {
+		name := name
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			client := &fakeProfilesClient{partialSuccess: tc.partialSuccess}
+			r := newTestOTLPReporterWithClient(t, client)
+
+			for i := uint64(0); i < 2; i++ {
+				trace := &libpf.Trace{Hash: libpf.NewTraceHash(i, 2)}
+				trace.AppendFrame(libpf.KernelFrame, libpf.NewFileID(3, 4),
+					libpf.AddressOrLineno(i))
+				r.ReportFramesForTrace(trace)
+				r.ReportCountForTrace(trace.Hash, libpf.UnixTime64(1710000000e9), 1,
+					"comm", "", "", "", "", "")
+			}
+
+			// A partial success is no transport error.
+			require.NoError(t, r.reportOTLPProfile(context.Background(), time.Second))
+			assert.Equal(t, 1, client.exports)
+			metrics := r.GetMetrics()
+			assert.Equal(t, tc.rejectedProfiles, metrics.ExportRejectedProfilesCount)
+			assert.Equal(t, tc.rejectedSamples, metrics.ExportRejectedSamplesCount)
+		})
+	}
+}
+
+func TestReportOTLPProfileDryRun(t *testing.T) {
+	for _, dryRun := range []bool{true, false} {
+		dryRun := dryRun
+		t.Run(fmt.Sprintf("dryRun=%v", dryRun), func(t *testing.T) {
+			r := newTestOTLPReporter(t)
+			require.NoError(t, config.SetConfiguration(&config.Config{
+				ProjectID:        1,
+				SecretToken:      "secret",
+				CacheDirectory:   t.TempDir(),
+				SamplesPerSecond: 20,
+				DryRun:           dryRun,
+			}))
+			client := &fakeProfilesClient{}
+			r.client = client
+
+			trace := &libpf.Trace{Hash: libpf.NewTraceHash(1, 2)}
+			trace.AppendFrame(libpf.KernelFrame, libpf.NewFileID(3, 4), 5)
+			r.ReportFramesForTrace(trace)
+			r.ReportCountForTrace(trace.Hash, libpf.UnixTime64(1710000000e9), 1,
+				"comm", "", "", "", "", "")
+
+			require.NoError(t, r.reportOTLPProfile(context.Background(), time.Second))
+			if dryRun {
+				assert.Zero(t, client.exports)
+				assert.Positive(t, r.rpcStats.getWireBytesOut())
+			} else {
+				assert.Equal(t, 1, client.exports)
+			}
+		})
+	}
+}
+
+func TestReportOTLPProfileScope(t *testing.T) {
+	tests := map[string]struct {
+		name          string
+		versionSuffix string
+		wantName      string
+		wantVersion   string
+	}{
+		"default": {
+			wantName:    DefaultScopeName,
+			wantVersion: fmt.Sprintf("%s@%s", vc.Version(), vc.Revision()),
+		},
+		"configured": {
+			name:          "Vendor-Profiler",
+			versionSuffix: "+vendor.1",
+			wantName:      "Vendor-Profiler",
+			wantVersion:   fmt.Sprintf("%s@%s+vendor.1", vc.Version(), vc.Revision()),
+		},
+	}
+
+	for name, tc := range tests {
+		name := name
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			client := &fakeProfilesClient{}
+			r := newTestOTLPReporterWithClient(t, client)
+			r.scopeName = tc.name
+			r.scopeVersionSuffix = tc.versionSuffix
+
+			trace := &libpf.Trace{Hash: libpf.NewTraceHash(1, 2)}
+			trace.AppendFrame(libpf.KernelFrame, libpf.NewFileID(3, 4), 5)
+			r.ReportFramesForTrace(trace)
+			r.ReportCountForTrace(trace.Hash, libpf.UnixTime64(1710000000e9), 1,
+				"comm", "", "", "", "", "")
+
+			require.NoError(t, r.reportOTLPProfile(context.Background(), time.Second))
+			require.NotNil(t, client.last)
+			require.Len(t, client.last.ResourceProfiles, 1)
+			require.Len(t, client.last.ResourceProfiles[0].ScopeProfiles, 1)
+			scope := client.last.ResourceProfiles[0].ScopeProfiles[0].Scope
+			assert.Equal(t, tc.wantName, scope.Name)
+			assert.Equal(t, tc.wantVersion, scope.Version)
+		})
+	}
+}
+
+func TestValidateSchemaURL(t *testing.T) {
+	tests := map[string]struct {
+		schemaURL string
+		want      string
+		wantErr   bool
+	}{
+		"default": {want: DefaultSchemaURL},
+		"custom": {
+			schemaURL: "https://example.com/schemas/1.0",
+			want:      "https://example.com/schemas/1.0",
+		},
+		"relative": {schemaURL: "schemas/1.25.0", wantErr: true},
+		"scheme":   {schemaURL: "ftp://example.com/schemas/1.0", wantErr: true},
+		"invalid":  {schemaURL: "https://example.com/%zz", wantErr: true},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			schemaURL, err := validateSchemaURL(tc.schemaURL)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, schemaURL)
+		})
+	}
+}
+
+func TestGetResourceKubernetes(t *testing.T) {
+	r := newTestOTLPReporter(t)
+	r.ReportHostMetadata(map[string]string{
+		"k8s:node_name": "node-1",
+		// Names that look like numbers are still reported as strings.
+		"k8s:cluster_name": "2024",
+	})
+
+	attrs := attributeMap(r.getResource().Attributes)
+	assert.Equal(t, "node-1", attrs["k8s.node.name"])
+	assert.Equal(t, "2024", attrs["k8s.cluster.name"])
+	assert.NotContains(t, attrs, "k8s:node_name")
+	assert.NotContains(t, attrs, "k8s:cluster_name")
+}
+
+func TestGetResourceSampleFrequency(t *testing.T) {
+	r := newTestOTLPReporter(t)
+
+	attrs := attributeMap(r.getResource().Attributes)
+	assert.Equal(t, int64(config.SamplesPerSecond()), attrs[sampleFrequencyAttributeKey])
+}
+
+func TestGetResourceAgentVersion(t *testing.T) {
+	r := newTestOTLPReporter(t)
+
+	attrs := attributeMap(r.getResource().Attributes)
+	assert.Equal(t, vc.Version(), attrs[agentVersionKey])
+	assert.Equal(t, vc.Revision(), attrs[agentRevisionKey])
+
+	// The attributes don't depend on the reported host metadata.
+	r.ReportHostMetadata(map[string]string{"agent:version": "v0.0.1"})
+	attrs = attributeMap(r.getResource().Attributes)
+	assert.Equal(t, vc.Version(), attrs[agentVersionKey])
+	assert.Equal(t, vc.Revision(), attrs[agentRevisionKey])
+}
+
+func TestGetResourceProfileName(t *testing.T) {
+	tests := map[string]struct {
+		key   string
+		value string
+		omit  bool
+		want  map[string]any
+	}{
+		"default": {
+			want: map[string]any{DefaultProfileNameKey: DefaultProfileName},
+		},
+		"renamed": {
+			key:   "profile.type",
+			value: "cpu",
+			want:  map[string]any{"profile.type": "cpu"},
+		},
+		"omitted": {
+			omit: true,
+			want: map[string]any{},
+		},
+	}
+
+	for name, tc := range tests {
+		name := name
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			r := newTestOTLPReporter(t)
+			r.profileNameKey = tc.key
+			r.profileName = tc.value
+			r.omitProfileName = tc.omit
+
+			attrs := attributeMap(r.getResource().Attributes)
+			for _, key := range []string{DefaultProfileNameKey, "profile.type"} {
+				if want, ok := tc.want[key]; ok {
+					assert.Equal(t, want, attrs[key], name)
+				} else {
+					assert.NotContains(t, attrs, key, name)
+				}
+			}
+		})
+	}
+}
+
+func TestGetResourceProfilesSchemaURL(t *testing.T) {
+	r := newTestOTLPReporter(t)
+	r.schemaURL = DefaultSchemaURL
+
+	trace := &libpf.Trace{Hash: libpf.NewTraceHash(1, 2)}
+	trace.AppendFrame(libpf.KernelFrame, libpf.NewFileID(3, 4), 5)
+	r.ReportFramesForTrace(trace)
+	r.ReportCountForTrace(trace.Hash, libpf.UnixTime64(1710000000e9), 1, "", "", "", "", "", "")
+
+	profile, startTS, endTS := r.getProfile()
+	rp := r.getResourceProfiles("", profile, startTS, endTS, time.Second)
+	assert.Equal(t, DefaultSchemaURL, rp.SchemaUrl)
+	require.Len(t, rp.ScopeProfiles, 1)
+	assert.Equal(t, DefaultSchemaURL, rp.ScopeProfiles[0].SchemaUrl)
+}
+
+func TestGetProfileDropKeepFrames(t *testing.T) {
+	r := newTestOTLPReporter(t)
+
+	trace := &libpf.Trace{Hash: libpf.NewTraceHash(1, 2)}
+	trace.AppendFrame(libpf.KernelFrame, libpf.NewFileID(3, 4), 5)
+	r.ReportFramesForTrace(trace)
+	r.ReportCountForTrace(trace.Hash, libpf.UnixTime64(1710000000e9), 1, "comm", "", "", "", "", "")
+
+	// Without patterns, both reference the empty string.
+	profile, _, _ := r.getProfile()
+	assert.Zero(t, profile.DropFrames)
+	assert.Zero(t, profile.KeepFrames)
+
+	r.dropFrames = `runtime\.goexit|runtime\.main`
+	r.keepFrames = `main\..*`
+	r.ReportCountForTrace(trace.Hash, libpf.UnixTime64(1710000001e9), 1, "comm", "", "", "", "", "")
+	profile, _, _ = r.getProfile()
+	require.Less(t, int(profile.DropFrames), len(profile.StringTable))
+	require.Less(t, int(profile.KeepFrames), len(profile.StringTable))
+	assert.Equal(t, r.dropFrames, profile.StringTable[profile.DropFrames])
+	assert.Equal(t, r.keepFrames, profile.StringTable[profile.KeepFrames])
+}
+
+func TestGetTraceLabelsContainer(t *testing.T) {
+	tests := map[string]struct {
+		containerName string
+		containerID   string
+		want          map[string]string
+	}{
+		"name and ID": {
+			containerName: "app",
+			containerID:   "0123abcd",
+			want:          map[string]string{"containerName": "app", "containerId": "0123abcd"},
+		},
+		"name only": {
+			containerName: "app",
+			want:          map[string]string{"containerName": "app"},
+		},
+		"ID only": {
+			containerID: "0123abcd",
+			want:        map[string]string{"containerId": "0123abcd"},
+		},
+		"neither": {
+			want: map[string]string{},
+		},
+	}
+
+	for name, tc := range tests {
+		name := name
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			stringMap := map[string]uint32{"": 0}
+			labels := getTraceLabels(stringMap, traceInfo{
+				containerName: tc.containerName,
+				containerID:   tc.containerID,
+			})
+
+			stringTable := make([]string, len(stringMap))
+			for s, idx := range stringMap {
+				stringTable[idx] = s
+			}
+			got := make(map[string]string)
+			for _, label := range labels {
+				got[stringTable[label.Key]] = stringTable[label.Str]
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestGetProfileFrameTypeAttribute(t *testing.T) {
+	r := newTestOTLPReporter(t)
+
+	trace := &libpf.Trace{Hash: libpf.NewTraceHash(1, 2)}
+	trace.AppendFrame(libpf.PythonFrame, libpf.NewFileID(3, 4), 5)
+	trace.AppendFrame(libpf.NativeFrame, libpf.NewFileID(6, 7), 0x10)
+	trace.AppendFrame(libpf.KernelFrame, libpf.NewFileID(8, 9), 0x20)
+	r.ReportFramesForTrace(trace)
+	r.ReportCountForTrace(trace.Hash, libpf.UnixTime64(1710000000e9), 1, "", "", "", "", "", "")
+
+	profile, _, _ := r.getProfile()
+	require.Len(t, profile.Sample, 1)
+
+	var frameTypes []string
+	for _, loc := range sampleLocations(profile, profile.Sample[0]) {
+		// TypeIndex is not used for the frame type.
+		assert.Zero(t, loc.TypeIndex)
+		require.NotEmpty(t, loc.Attributes)
+		attr := profile.AttributeTable[loc.Attributes[0]]
+		assert.Equal(t, "frame.type", attr.Key)
+		frameTypes = append(frameTypes, attr.Value.GetStringValue())
+	}
+	assert.Equal(t, []string{"python", "native", "kernel"}, frameTypes)
+}
+
+func TestGetProfileThreadName(t *testing.T) {
+	r := newTestOTLPReporter(t)
+
+	trace := &libpf.Trace{Hash: libpf.NewTraceHash(1, 2)}
+	trace.AppendFrame(libpf.KernelFrame, libpf.NewFileID(3, 4), 5)
+	r.ReportFramesForTrace(trace)
+	r.ReportCountForTrace(trace.Hash, libpf.UnixTime64(1710000000e9), 1,
+		"server", "", "", "", "", "worker-3")
+
+	profile, _, _ := r.getProfile()
+	require.Len(t, profile.Sample, 1)
+	labels := make(map[string]string)
+	for _, label := range profile.Sample[0].Label {
+		labels[profile.StringTable[label.Key]] = profile.StringTable[label.Str]
+	}
+	assert.Equal(t, map[string]string{"comm": "server", "thread.name": "worker-3"}, labels)
+}
+
+func TestGetProfileProcessLabels(t *testing.T) {
+	r := newTestOTLPReporter(t)
+
+	// The second process reuses the PID of the first one, the pair of PID and
+	// start time identifies the process.
+	for i, startTime := range []libpf.UnixTime64{1700000000e9, 1700000005e9} {
+		trace := &libpf.Trace{Hash: libpf.NewTraceHash(uint64(i), 2)}
+		trace.AppendFrame(libpf.KernelFrame, libpf.NewFileID(3, 4), libpf.AddressOrLineno(i))
+		r.ReportFramesForTrace(trace)
+		r.ReportCountForTrace(trace.Hash, libpf.UnixTime64(1710000000e9), 1,
+			"server", "", "", "", "", "")
+		r.ReportProcessForTrace(trace.Hash, 1234, startTime)
+	}
+
+	profile, _, _ := r.getProfile()
+	require.Len(t, profile.Sample, 2)
+	processes := make([]map[string]int64, 0, len(profile.Sample))
+	for _, sample := range profile.Sample {
+		labels := make(map[string]int64)
+		for _, label := range sample.Label {
+			if label.Str == 0 {
+				labels[profile.StringTable[label.Key]] = label.Num
+			}
+		}
+		processes = append(processes, labels)
+	}
+	assert.ElementsMatch(t, []map[string]int64{
+		{"process.pid": 1234, "process.start_time": 1700000000e9},
+		{"process.pid": 1234, "process.start_time": 1700000005e9},
+	}, processes)
+}
+
+// notifyingProfilesClient sends the request of every export to exports.
+type notifyingProfilesClient struct {
+	exports chan *otlpcollector.ExportProfilesServiceRequest
+}
+
+func (n *notifyingProfilesClient) Export(_ context.Context,
+	in *otlpcollector.ExportProfilesServiceRequest, _ ...grpc.CallOption) (
+	*otlpcollector.ExportProfilesServiceResponse, error) {
+	n.exports <- in
+	return &otlpcollector.ExportProfilesServiceResponse{}, nil
+}
+
+func TestReportLoopMaxSamplesPerReport(t *testing.T) {
+	r := newTestOTLPReporter(t)
+	r.maxSamplesPerReport = 10
+	r.flush = make(chan libpf.Void, 1)
+	client := &notifyingProfilesClient{
+		exports: make(chan *otlpcollector.ExportProfilesServiceRequest, 1),
+	}
+	r.client = client
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan libpf.Void)
+	go func() {
+		// The report interval is never reached within the test.
+		r.reportLoop(ctx, time.Hour, 0)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	for i := uint64(0); i < 11; i++ {
+		trace := &libpf.Trace{Hash: libpf.NewTraceHash(i, 2)}
+		trace.AppendFrame(libpf.KernelFrame, libpf.NewFileID(3, 4), libpf.AddressOrLineno(i))
+		r.ReportFramesForTrace(trace)
+		r.ReportCountForTrace(trace.Hash, libpf.UnixTime64(1710000000e9), 1,
+			"comm", "", "", "", "", "")
+
+		if i < 10 {
+			// Reaching the threshold does not report early.
+			select {
+			case <-client.exports:
+				t.Fatalf("Early report after %d samples", i+1)
+			default:
+			}
+		}
+	}
+
+	select {
+	case req := <-client.exports:
+		assert.Equal(t, 11, numSamples(req.ResourceProfiles))
+	case <-time.After(10 * time.Second):
+		t.Fatal("No early report after exceeding the threshold")
+	}
+	assert.Zero(t, r.samples.Len())
+}
+
+// blockingCloser is an io.Closer whose Close blocks until unblock is closed.
+type blockingCloser struct {
+	closing chan libpf.Void
+	unblock chan libpf.Void
+}
+
+func (c *blockingCloser) Close() error {
+	close(c.closing)
+	<-c.unblock
+	return errors.New("closed too late")
+}
+
+func TestStopShutdownTimeout(t *testing.T) {
+	closer := &blockingCloser{
+		closing: make(chan libpf.Void),
+		unblock: make(chan libpf.Void),
+	}
+	defer close(closer.unblock)
+
+	r := newTestOTLPReporter(t)
+	r.shutdownTimeout = 10 * time.Millisecond
+	r.stopped = make(chan libpf.Void)
+	ctx, cancel := context.WithCancel(context.Background())
+	go r.shutdown(cancel, []io.Closer{closer})
+
+	start := time.Now()
+	r.Stop()
+	// Stop returns after the shutdown timeout, even though the connection is
+	// still being closed.
+	assert.Less(t, time.Since(start), time.Second)
+	<-closer.closing
+	assert.Error(t, ctx.Err())
+	select {
+	case <-r.stopped:
+		t.Fatal("Shutdown completed before the connection was closed")
+	default:
+	}
+}
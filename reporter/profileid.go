@@ -0,0 +1,77 @@
+/*
+ * Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+ * or more contributor license agreements. Licensed under the Apache License 2.0.
+ * See the file "LICENSE" for details.
+ */
+
+package reporter
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+const (
+	// ProfileIDModeRandom generates a random ProfileId for every profile.
+	ProfileIDModeRandom = "random"
+	// ProfileIDModeDeterministic derives the ProfileId from the host ID and
+	// the time of the report.
+	ProfileIDModeDeterministic = "deterministic"
+
+	// profileIDLen is the length of a ProfileId in bytes.
+	profileIDLen = 16
+)
+
+// profileIDGenerator returns a non-zero ProfileId for a profile reported at ts.
+type profileIDGenerator func(ts time.Time) []byte
+
+// newProfileIDGenerator returns a profileIDGenerator for the given mode.
+func newProfileIDGenerator(mode string, hostID uint64) (profileIDGenerator, error) {
+	switch mode {
+	case ProfileIDModeRandom, "":
+		return randomProfileID, nil
+	case ProfileIDModeDeterministic:
+		return func(ts time.Time) []byte {
+			return deterministicProfileID(hostID, ts)
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported profile ID mode: %s", mode)
+	}
+}
+
+// randomProfileID returns a random ProfileId.
+func randomProfileID(_ time.Time) []byte {
+	id := make([]byte, profileIDLen)
+	for isZero(id) {
+		if _, err := rand.Read(id); err != nil {
+			// crypto/rand only fails if the system's entropy source is broken,
+			// fall back to an ID that is still unique for this host.
+			return deterministicProfileID(0, time.Now())
+		}
+	}
+	return id
+}
+
+// deterministicProfileID returns a ProfileId composed of hostID and ts.
+func deterministicProfileID(hostID uint64, ts time.Time) []byte {
+	id := make([]byte, profileIDLen)
+	binary.BigEndian.PutUint64(id[:8], hostID)
+	binary.BigEndian.PutUint64(id[8:], uint64(ts.UnixNano()))
+	if isZero(id) {
+		// An ID with all zeros is considered invalid.
+		id[profileIDLen-1] = 1
+	}
+	return id
+}
+
+// isZero returns true if all bytes of b are zero.
+func isZero(b []byte) bool {
+	for _, v := range b {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
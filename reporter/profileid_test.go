@@ -0,0 +1,56 @@
+/*
+ * Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+ * or more contributor license agreements. Licensed under the Apache License 2.0.
+ * See the file "LICENSE" for details.
+ */
+
+package reporter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfileIDGenerator(t *testing.T) {
+	tests := map[string]struct {
+		mode string
+	}{
+		"default":       {mode: ""},
+		"random":        {mode: ProfileIDModeRandom},
+		"deterministic": {mode: ProfileIDModeDeterministic},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			generate, err := newProfileIDGenerator(tc.mode, 0xcafe)
+			require.NoError(t, err)
+
+			// Simulate two consecutive reports.
+			now := time.Now()
+			first := generate(now)
+			second := generate(now.Add(5 * time.Second))
+
+			assert.Len(t, first, profileIDLen)
+			assert.Len(t, second, profileIDLen)
+			assert.False(t, isZero(first))
+			assert.False(t, isZero(second))
+			assert.NotEqual(t, first, second)
+		})
+	}
+}
+
+func TestProfileIDGeneratorInvalidMode(t *testing.T) {
+	_, err := newProfileIDGenerator("ELASTIC", 0)
+	assert.Error(t, err)
+}
+
+func TestDeterministicProfileID(t *testing.T) {
+	ts := time.Unix(1710000000, 0)
+	assert.Equal(t, deterministicProfileID(42, ts), deterministicProfileID(42, ts))
+	assert.NotEqual(t, deterministicProfileID(42, ts), deterministicProfileID(43, ts))
+	assert.False(t, isZero(deterministicProfileID(0, time.Unix(0, 0))))
+}
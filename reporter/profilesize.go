@@ -0,0 +1,68 @@
+/*
+ * Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+ * or more contributor license agreements. Licensed under the Apache License 2.0.
+ * See the file "LICENSE" for details.
+ */
+
+package reporter
+
+import (
+	"github.com/elastic/otel-profiling-agent/debug/log"
+	profiles "github.com/elastic/otel-profiling-agent/proto/experiments/opentelemetry/proto/profiles/v1"
+	"github.com/elastic/otel-profiling-agent/proto/experiments/opentelemetry/proto/profiles/v1/alternatives/pprofextended"
+)
+
+// profileSize holds the number of entries of the tables of a profile, which
+// grow with the cardinality of the reported data.
+type profileSize struct {
+	locations uint32
+	functions uint32
+	mappings  uint32
+	strings   uint32
+}
+
+// sizeOfProfile returns the number of entries of the tables of profile.
+func sizeOfProfile(profile *pprofextended.Profile) profileSize {
+	return profileSize{
+		locations: uint32(len(profile.Location)),
+		functions: uint32(len(profile.Function)),
+		mappings:  uint32(len(profile.Mapping)),
+		strings:   uint32(len(profile.StringTable)),
+	}
+}
+
+// sizeOfResourceProfiles returns the largest number of entries of each table
+// across the profiles of resourceProfiles.
+func sizeOfResourceProfiles(resourceProfiles []*profiles.ResourceProfiles) profileSize {
+	var size profileSize
+	for _, rp := range resourceProfiles {
+		for _, sp := range rp.ScopeProfiles {
+			for _, pc := range sp.Profiles {
+				s := sizeOfProfile(pc.Profile)
+				size.locations = max(size.locations, s.locations)
+				size.functions = max(size.functions, s.functions)
+				size.mappings = max(size.mappings, s.mappings)
+				size.strings = max(size.strings, s.strings)
+			}
+		}
+	}
+	return size
+}
+
+// exceeds returns whether any table of s has more than limit entries.
+func (s profileSize) exceeds(limit uint32) bool {
+	return s.locations > limit || s.functions > limit || s.mappings > limit ||
+		s.strings > limit
+}
+
+// recordProfileSize records the size of the profiles of the last report, and
+// logs a warning if any of their tables exceeds the configured limit.
+func (r *OTLPReporter) recordProfileSize(size profileSize) {
+	r.lastProfileSize.Store(&size)
+
+	if r.profileSizeWarnLimit > 0 && size.exceeds(r.profileSizeWarnLimit) {
+		log.Warnf("Profile has %d locations, %d functions, %d mappings and %d strings, "+
+			"more than the limit of %d", size.locations, size.functions, size.mappings,
+			size.strings, r.profileSizeWarnLimit)
+	}
+}
@@ -0,0 +1,78 @@
+/*
+ * Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+ * or more contributor license agreements. Licensed under the Apache License 2.0.
+ * See the file "LICENSE" for details.
+ */
+
+package reporter
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/otel-profiling-agent/libpf"
+	profiles "github.com/elastic/otel-profiling-agent/proto/experiments/opentelemetry/proto/profiles/v1"
+	"github.com/elastic/otel-profiling-agent/proto/experiments/opentelemetry/proto/profiles/v1/alternatives/pprofextended"
+)
+
+func TestSizeOfResourceProfiles(t *testing.T) {
+	newProfile := func(locations, functions, mappings, strings int) *profiles.ProfileContainer {
+		return &profiles.ProfileContainer{Profile: &pprofextended.Profile{
+			Location:    make([]*pprofextended.Location, locations),
+			Function:    make([]*pprofextended.Function, functions),
+			Mapping:     make([]*pprofextended.Mapping, mappings),
+			StringTable: make([]string, strings),
+		}}
+	}
+	resourceProfiles := []*profiles.ResourceProfiles{
+		{ScopeProfiles: []*profiles.ScopeProfiles{{
+			Profiles: []*profiles.ProfileContainer{newProfile(5, 1, 2, 10)},
+		}}},
+		{ScopeProfiles: []*profiles.ScopeProfiles{{
+			Profiles: []*profiles.ProfileContainer{newProfile(3, 4, 1, 20)},
+		}}},
+	}
+
+	// Every table is reported with the size of the largest profile.
+	size := sizeOfResourceProfiles(resourceProfiles)
+	assert.Equal(t, profileSize{locations: 5, functions: 4, mappings: 2, strings: 20}, size)
+	assert.True(t, size.exceeds(19))
+	assert.False(t, size.exceeds(20))
+	assert.Equal(t, profileSize{}, sizeOfResourceProfiles(nil))
+}
+
+func TestGetProfileSizeMetrics(t *testing.T) {
+	r := newTestOTLPReporter(t)
+	r.profileSizeWarnLimit = 1
+
+	// Before the first report, no sizes are reported.
+	m := r.GetMetrics()
+	assert.Zero(t, m.ProfileLocations)
+	assert.Zero(t, m.ProfileStrings)
+
+	fileID := libpf.NewFileID(3, 4)
+	r.ExecutableMetadata(context.Background(), fileID, "libfoo.so", "", false)
+	trace := &libpf.Trace{Hash: libpf.NewTraceHash(1, 2)}
+	trace.AppendFrame(libpf.NativeFrame, fileID, 0x1234)
+	trace.AppendFrame(libpf.NativeFrame, fileID, 0x5678)
+	trace.AppendFrame(libpf.KernelFrame, libpf.NewFileID(5, 6), 0x9abc)
+	r.ReportFramesForTrace(trace)
+	r.ReportCountForTrace(trace.Hash, libpf.UnixTime64(1710000000e9), 1,
+		"foo", "", "", "", "", "")
+
+	profile, _, _ := r.getProfile()
+	m = r.GetMetrics()
+	assert.Equal(t, uint32(len(profile.Location)), m.ProfileLocations)
+	assert.Equal(t, uint32(len(profile.Function)), m.ProfileFunctions)
+	assert.Equal(t, uint32(len(profile.Mapping)), m.ProfileMappings)
+	assert.Equal(t, uint32(len(profile.StringTable)), m.ProfileStrings)
+	assert.Equal(t, uint32(3), m.ProfileLocations)
+	assert.Equal(t, uint32(2), m.ProfileMappings)
+
+	// The sizes are those of the last report, and are not reset by GetMetrics.
+	assert.Equal(t, m, r.GetMetrics())
+	r.getProfile()
+	assert.Zero(t, r.GetMetrics().ProfileLocations)
+}
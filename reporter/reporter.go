@@ -34,6 +34,9 @@ type HostMetadata struct {
 type Config struct {
 	// CollAgentAddr defines the destination of the backend connection
 	CollAgentAddr string
+	// ExtraCollAgentAddrs are the destinations of further backends that every
+	// profile and symbol upload is sent to as well.
+	ExtraCollAgentAddrs []string
 
 	// MaxRPCMsgSize defines the maximum size of a gRPC message.
 	MaxRPCMsgSize int
@@ -61,13 +64,219 @@ type Config struct {
 	FallbackSymbolsMaxQueue uint32
 	// Disable secure communication with Collection Agent
 	DisableTLS bool
+	// TLSCAFile is the path to a PEM encoded CA bundle used to verify the
+	// collector. If empty, the system CA pool is used.
+	TLSCAFile string
+	// TLSCertFile and TLSKeyFile are the paths to a PEM encoded client
+	// certificate and key for mTLS. Either both or none must be set.
+	TLSCertFile string
+	TLSKeyFile  string
+	// TLSServerName overrides the server name used to verify the collector.
+	TLSServerName string
+	// TLSInsecureSkipVerify disables the verification of the collector certificate.
+	TLSInsecureSkipVerify bool
 	// Number of connection attempts to the collector after which we give up retrying
 	MaxGRPCRetries uint32
-	// The mode to use for the build ID, either "linker" or "hash".
+	// The mode to use for the build ID, either "linker", "hash" or "auto". The
+	// "auto" mode uses the linker build ID if the executable has one, and the
+	// file hash otherwise.
 	OTLPBuildIDMode string
+	// The transport protocol for OTLP profiles, either "grpc", "http/protobuf"
+	// or "file/json".
+	OTLPProtocol string
+	// OTLPFile is the file the "file/json" protocol appends the profiles to, or
+	// "-" for stdout.
+	OTLPFile string
+	// The mode to generate ProfileIds with, either "random" or "deterministic".
+	ProfileIDMode string
+	// TraceInfoGracePeriod defines how long to wait for missing trace information
+	// before samples are deferred to the next report. Zero disables waiting.
+	TraceInfoGracePeriod time.Duration
+	// TraceInfoMaxReports is the number of reports a sample is kept for while its
+	// trace information is missing. The sample is dropped afterwards. Zero keeps
+	// such samples until they are evicted.
+	TraceInfoMaxReports uint32
+	// TraceInfoLifetime is the time after which the information of a trace is
+	// removed, unless the trace is seen again. It must be at least two report
+	// intervals, so that the information outlives the samples of the trace.
+	// Zero keeps the information until it is evicted.
+	TraceInfoLifetime time.Duration
+	// ReportCPUTime adds a "cpu/nanoseconds" value to every sample, next to
+	// the "samples/count" value.
+	ReportCPUTime bool
+	// KernelImageName is the file name reported for functions of the core
+	// kernel. The placeholder "{release}" is replaced with the kernel release of
+	// the host. Defaults to "vmlinux". Functions of kernel modules are reported
+	// with the name of their module.
+	KernelImageName string
+	// CacheMemoryLimit is the total memory in bytes the caches of the reporter
+	// should use at most. If zero, the caches are sized by number of entries.
+	CacheMemoryLimit uint64
+	// ExecutableMetadataLifetime is the time after which the metadata of an
+	// executable is removed, unless it is reported again. As the metadata is
+	// only reported again once the ELF information of the executable is re-read,
+	// it should be set generously. Zero keeps metadata until it is evicted.
+	ExecutableMetadataLifetime time.Duration
+	// AuthTokenFile is the path to a file that holds the bearer token sent with
+	// every request. It takes precedence over the secret token and is re-read
+	// every AuthTokenRefresh.
+	AuthTokenFile    string
+	AuthTokenRefresh time.Duration
+	// RPCHeaders are sent as additional headers with every request.
+	RPCHeaders map[string]string
+	// IdleSamples defines how samples of the idle task are reported, either
+	// "keep", "label" or "drop". Defaults to "keep".
+	IdleSamples string
+	// OmitPlaceholderFrames omits kernel and interpreted frames without symbol
+	// information from samples, instead of reporting them with a placeholder
+	// function name like "UNKNOWN", "UNREPORTED" or "UNRESOLVED".
+	OmitPlaceholderFrames bool
+	// RawNativeFrames reports the mappings of native frames only by the FileID
+	// of their executable, without its file name, linker build ID or memory
+	// range, for backends that symbolize the addresses on their own.
+	RawNativeFrames bool
+	// MaxStackDepth is the number of frames of a trace above which the
+	// outermost frames are replaced with a single "[truncated N frames]" frame.
+	// Zero reports all frames.
+	MaxStackDepth uint32
+	// DedupTimestamps reports every timestamp of a sample only once, for
+	// backends that expect unique timestamps. The timestamps are always sorted.
+	DedupTimestamps bool
+	// OmitFramePaths are path prefixes or glob patterns of executables whose
+	// frames are omitted from samples, e.g. to drop frames of noisy system
+	// libraries.
+	OmitFramePaths []string
+	// DropFrames and KeepFrames are regular expressions that are reported in
+	// the profiles, to let downstream tooling drop the frames matching
+	// DropFrames, unless they also match KeepFrames.
+	DropFrames string
+	KeepFrames string
+	// DefaultSampleType is the type name of the sample type that UIs show by
+	// default if the profiles hold it, either "samples", "cpu" or "alloc_space".
+	// Defaults to the CPU time if it is reported, and to the sample count
+	// otherwise.
+	DefaultSampleType string
+	// MinSampleCount is the count a trace needs to reach before it is reported.
+	// Traces with a lower count are held back and their counts accumulate
+	// across reports. Zero and one report every trace.
+	MinSampleCount uint32
+	// ExportBreakerThreshold is the number of consecutive failed exports after
+	// which samples are dropped and the backend is probed with a growing delay,
+	// until it is reachable again. Zero disables the breaker.
+	ExportBreakerThreshold uint32
+	// ExportSampleRate is the fraction of report intervals, between 0 and 1, whose
+	// profiles are exported. The profiles of the other intervals are dropped.
+	// Zero and one export every interval.
+	ExportSampleRate float64
+	// TenantNamespaces maps Kubernetes namespaces to the tenant of their
+	// profiles. It takes precedence over TenantPodNameRegex.
+	TenantNamespaces map[string]string
+	// TenantPodNameRegex extracts the tenant of profiles from the pod name.
+	// The tenant is taken from the group named "tenant", or from the only
+	// capture group. Profiles of different tenants are reported separately,
+	// with the tenant as "tenant.id" resource attribute.
+	TenantPodNameRegex string
+	// MaxSamplesPerReport is the number of samples above which the collected
+	// samples are reported before the report interval ends, which then starts
+	// over. Zero reports only once per interval.
+	MaxSamplesPerReport uint32
+	// MaxRequestSize is the size in bytes above which the profiles of a report
+	// are split across several export requests. The samples of a profile that
+	// exceeds it on its own are split across several profiles. Zero sends every
+	// report in a single request.
+	MaxRequestSize int
+	// CacheHighWaterMark is the fill ratio of the sample cache, between 0 and 1,
+	// above which a warning is logged on every report. Zero disables the warning.
+	CacheHighWaterMark float64
+	// ProfileBuildWarnFraction is the fraction of the report interval, between 0
+	// and 1, above which a warning is logged if building the profiles of a report
+	// takes longer. Zero disables the warning.
+	ProfileBuildWarnFraction float64
+	// ProfileSizeWarnLimit is the number of locations, functions, mappings or
+	// strings of a profile above which a warning is logged on report. Zero
+	// disables the warning.
+	ProfileSizeWarnLimit uint32
+	// ReportJitter is the factor, in [0, 1), by which the interval between two
+	// reports is randomly shortened or extended. Zero disables the jitter.
+	ReportJitter float64
 	// Whether or not to extract debuginfo from the executables, or use the
 	// original as is for the symbol upload.
 	NoExtractDebuginfo bool
+	// ExtractDebuginfoMinSize is the size in bytes below which executables are
+	// uploaded as is, without extracting their debuginfo. Zero extracts the
+	// debuginfo of all executables.
+	ExtractDebuginfoMinSize int64
+	// StreamDebuginfo streams the extracted debuginfo to the backend instead of
+	// caching it on disk. The debuginfo is extracted twice to know its size.
+	StreamDebuginfo bool
+	// CompressDebuginfoCache stores the extracted debuginfo gzip-compressed in
+	// the cache directory until it is uploaded.
+	CompressDebuginfoCache bool
+	// ResumableUploadChunkSize is the size in bytes of the chunks the debuginfo
+	// is uploaded in, for backends whose signed URLs accept resumable uploads.
+	// Zero uploads the debuginfo in a single request.
+	ResumableUploadChunkSize int64
+	// UploadVerifyETag verifies uploaded debuginfo with the ETag of the response
+	// of the backend, for backends that use the MD5 checksum as ETag.
+	UploadVerifyETag bool
+	// UploadAllowPaths and UploadDenyPaths are path prefixes or globs of
+	// executables that may or must not be uploaded, UploadAllowBuildIDs and
+	// UploadDenyBuildIDs are their build IDs. Deny takes precedence over allow,
+	// empty allow lists allow all executables.
+	UploadAllowPaths    []string
+	UploadDenyPaths     []string
+	UploadAllowBuildIDs []string
+	UploadDenyBuildIDs  []string
+	// SymbolUploader is the name of the uploader for symbols, see
+	// RegisterSymbolUploader. Defaults to the Parca uploader. If the uploader
+	// fails to start, profiles are reported without uploading symbols.
+	SymbolUploader string
+	// SymbolUploadURL is the base URL of the HTTP symbol uploader.
+	SymbolUploadURL string
+	// SchemaURL is the schema URL of the reported resources and scopes.
+	// Defaults to DefaultSchemaURL.
+	SchemaURL string
+	// ServiceName is the service.name resource attribute of the profiles.
+	// Defaults to DefaultServiceName.
+	ServiceName string
+	// ProfileNameKey is the key of the resource attribute that names the profile
+	// type. Defaults to DefaultProfileNameKey.
+	ProfileNameKey string
+	// ProfileName is the value of the resource attribute that names the profile
+	// type. Defaults to DefaultProfileName.
+	ProfileName string
+	// OmitProfileName omits the resource attribute that names the profile type.
+	OmitProfileName bool
+	// DetectResource enables the resource detectors of the OpenTelemetry SDK. The
+	// detected attributes are reported unless the host metadata holds the same
+	// attributes.
+	DetectResource bool
+	// ScopeName is the name of the instrumentation scope of the profiles.
+	// Defaults to DefaultScopeName.
+	ScopeName string
+	// ScopeVersionSuffix is appended as is to the version of the instrumentation
+	// scope, e.g. "+vendor.1".
+	ScopeVersionSuffix string
+	// HostMetadataSource, if set, is invoked every HostMetadataRefresh, and the
+	// host metadata it returns is added to and overwrites the reported one, so
+	// that long-running agents follow hosts that are re-tagged or moved.
+	HostMetadataSource  func() map[string]string
+	HostMetadataRefresh time.Duration
+	// ShutdownTimeout is the time Stop waits for the connections to the
+	// backends to be closed. Defaults to 5 seconds.
+	ShutdownTimeout time.Duration
+	// GRPCKeepaliveTime is the time without activity after which the gRPC
+	// connections ping the collector, so that idle connections are not dropped
+	// by intermediaries and broken ones are detected. Zero disables keepalive
+	// pings. gRPC enforces a minimum of 10 seconds.
+	GRPCKeepaliveTime time.Duration
+	// GRPCKeepaliveTimeout is the time to wait for the response to a keepalive
+	// ping before the connection is closed. Zero uses the gRPC default of 20
+	// seconds.
+	GRPCKeepaliveTimeout time.Duration
+	// GRPCKeepaliveWithoutStream enables keepalive pings while there are
+	// no active RPCs.
+	GRPCKeepaliveWithoutStream bool
 
 	Times Times
 }
@@ -112,7 +321,7 @@ type executableMetadata struct {
 
 // ExecutableMetadata implements the SymbolReporter interface.
 func (r *GRPCReporter) ExecutableMetadata(ctx context.Context, fileID libpf.FileID,
-	fileName, buildID string) {
+	fileName, buildID string, _ bool) {
 	select {
 	case <-ctx.Done():
 		return
@@ -125,6 +334,14 @@ func (r *GRPCReporter) ExecutableMetadata(ctx context.Context, fileID libpf.File
 	}
 }
 
+// MappingMetadata implements the SymbolReporter interface. The collection agent
+// protocol has no place for the memory range, so it is not reported.
+func (r *GRPCReporter) MappingMetadata(libpf.FileID, uint64, uint64) {}
+
+// ExpireExecutableMetadata implements the SymbolReporter interface. Executable
+// metadata is sent immediately, so there is nothing to expire.
+func (r *GRPCReporter) ExpireExecutableMetadata(libpf.FileID) {}
+
 // FrameMetadata implements the SymbolReporter interface.
 func (r *GRPCReporter) FrameMetadata(fileID libpf.FileID,
 	addressOrLine libpf.AddressOrLineno, lineNumber libpf.SourceLineno, functionOffset uint32,
@@ -139,9 +356,14 @@ func (r *GRPCReporter) FrameMetadata(fileID libpf.FileID,
 	})
 }
 
+// ReportFrameMetadata implements the SymbolReporter interface.
+func (r *GRPCReporter) ReportFrameMetadata(frameMetadata *libpf.FrameMetadata) {
+	r.frameMetadataQueue.append(frameMetadata)
+}
+
 // ReportCountForTrace implements the TraceReporter interface.
-func (r *GRPCReporter) ReportCountForTrace(traceHash libpf.TraceHash, timestamp libpf.UnixTime32,
-	count uint16, comm, podName, podNamespace, containerName string) {
+func (r *GRPCReporter) ReportCountForTrace(traceHash libpf.TraceHash, timestamp libpf.UnixTime64,
+	count uint16, comm, podName, podNamespace, containerName, _, _ string) {
 	r.countsForTracesQueue.append(&libpf.TraceAndCounts{
 		Hash:          traceHash,
 		Timestamp:     timestamp,
@@ -152,6 +374,39 @@ func (r *GRPCReporter) ReportCountForTrace(traceHash libpf.TraceHash, timestamp
 	})
 }
 
+// ReportCounts implements the TraceReporter interface.
+func (r *GRPCReporter) ReportCounts(counts []TraceCount) {
+	for i := range counts {
+		c := &counts[i]
+		r.ReportCountForTrace(c.TraceHash, c.Timestamp, c.Count, c.Comm, c.PodName,
+			c.PodNamespace, c.ContainerName, c.ContainerID, c.ThreadName)
+	}
+}
+
+// ReportCompleteTrace implements the Reporter interface.
+func (r *GRPCReporter) ReportCompleteTrace(trace *libpf.Trace, count TraceCount) {
+	r.ReportFramesForTrace(trace)
+	r.ReportCountForTrace(trace.Hash, count.Timestamp, count.Count, count.Comm,
+		count.PodName, count.PodNamespace, count.ContainerName, count.ContainerID,
+		count.ThreadName)
+}
+
+// ReportProcessForTrace implements the TraceReporter interface. The collection
+// agent protocol has no place for the process, so it is not reported.
+func (r *GRPCReporter) ReportProcessForTrace(libpf.TraceHash, libpf.PID, libpf.UnixTime64) {}
+
+// ReportAllocationForTrace implements the AllocationReporter interface.
+// The collection agent protocol can not represent allocations, so they are dropped.
+func (r *GRPCReporter) ReportAllocationForTrace(libpf.TraceHash, libpf.UnixTime64,
+	uint64, string, string, string, string, string, string) {
+}
+
+// Stats implements the Reporter interface. GRPCReporter queues data instead of
+// caching it, so there is no cache usage to report.
+func (r *GRPCReporter) Stats() Stats {
+	return Stats{}
+}
+
 type fallbackSymbol struct {
 	frameID libpf.FrameID
 	symbol  string
@@ -0,0 +1,146 @@
+/*
+ * Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+ * or more contributor license agreements. Licensed under the Apache License 2.0.
+ * See the file "LICENSE" for details.
+ */
+
+package reporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkresource "go.opentelemetry.io/otel/sdk/resource"
+	common "go.opentelemetry.io/proto/otlp/common/v1"
+
+	"github.com/elastic/otel-profiling-agent/debug/log"
+)
+
+// resourceAttributesEnv is the environment variable that holds resource attributes
+// as comma separated key=value pairs, like for the OpenTelemetry SDKs.
+const resourceAttributesEnv = "OTEL_RESOURCE_ATTRIBUTES"
+
+// parseResourceAttributes parses resource attributes in the format of
+// OTEL_RESOURCE_ATTRIBUTES. Values are percent-decoded. If a key is repeated, the
+// last value is used. As required by the specification, the whole value is
+// rejected if any pair is invalid.
+func parseResourceAttributes(s string) ([]*common.KeyValue, error) {
+	var attributes []*common.KeyValue
+	indices := make(map[string]int)
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		key, value, found := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !found || key == "" {
+			return nil, fmt.Errorf("invalid key=value pair %q", pair)
+		}
+		value, err := url.PathUnescape(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of %s: %v", key, err)
+		}
+
+		kv := &common.KeyValue{Key: key, Value: anyValue(attribute.StringValue(value))}
+		if i, exists := indices[key]; exists {
+			attributes[i] = kv
+			continue
+		}
+		indices[key] = len(attributes)
+		attributes = append(attributes, kv)
+	}
+	return attributes, nil
+}
+
+// envServiceName returns the service.name of the attributes from the environment,
+// unless another service name than DefaultServiceName is configured.
+func envServiceName(serviceName string, envAttributes []*common.KeyValue) string {
+	if serviceName != "" && serviceName != DefaultServiceName {
+		return serviceName
+	}
+	for _, kv := range envAttributes {
+		if kv.Key == "service.name" {
+			return kv.Value.GetStringValue()
+		}
+	}
+	return serviceName
+}
+
+// detectResourceAttributes returns the resource attributes that the detectors of
+// the OpenTelemetry resource SDK find for the host, its operating system, the
+// agent process and its container. The command line of the agent is not
+// detected, as it may hold secrets. Detectors that fail are skipped.
+func detectResourceAttributes(ctx context.Context) []*common.KeyValue {
+	res, err := sdkresource.New(ctx,
+		sdkresource.WithHost(),
+		sdkresource.WithOS(),
+		sdkresource.WithContainer(),
+		sdkresource.WithProcessPID(),
+		sdkresource.WithProcessExecutableName(),
+		sdkresource.WithProcessExecutablePath(),
+		sdkresource.WithProcessOwner(),
+		sdkresource.WithProcessRuntimeName(),
+		sdkresource.WithProcessRuntimeVersion(),
+		sdkresource.WithProcessRuntimeDescription(),
+	)
+	if err != nil {
+		if !errors.Is(err, sdkresource.ErrPartialResource) {
+			log.Warnf("Failed to detect resource attributes: %v", err)
+			return nil
+		}
+		log.Debugf("Failed to detect some resource attributes: %v", err)
+	}
+
+	attrs := res.Attributes()
+	attributes := make([]*common.KeyValue, 0, len(attrs))
+	for _, kv := range attrs {
+		attributes = append(attributes, &common.KeyValue{
+			Key:   string(kv.Key),
+			Value: anyValue(kv.Value),
+		})
+	}
+	return attributes
+}
+
+// anyValue converts an attribute value of the OpenTelemetry SDK to its OTLP
+// representation.
+func anyValue(v attribute.Value) *common.AnyValue {
+	switch v.Type() {
+	case attribute.BOOL:
+		return &common.AnyValue{Value: &common.AnyValue_BoolValue{BoolValue: v.AsBool()}}
+	case attribute.INT64:
+		return &common.AnyValue{Value: &common.AnyValue_IntValue{IntValue: v.AsInt64()}}
+	case attribute.FLOAT64:
+		return &common.AnyValue{Value: &common.AnyValue_DoubleValue{DoubleValue: v.AsFloat64()}}
+	case attribute.STRINGSLICE:
+		values := make([]*common.AnyValue, 0, len(v.AsStringSlice()))
+		for _, s := range v.AsStringSlice() {
+			values = append(values, &common.AnyValue{
+				Value: &common.AnyValue_StringValue{StringValue: s}})
+		}
+		return &common.AnyValue{Value: &common.AnyValue_ArrayValue{
+			ArrayValue: &common.ArrayValue{Values: values}}}
+	default:
+		return &common.AnyValue{Value: &common.AnyValue_StringValue{StringValue: v.Emit()}}
+	}
+}
+
+// mergeAttributes appends the detected attributes to attributes, unless an
+// attribute with the same key is already present. It is also used for the
+// attributes from the environment.
+func mergeAttributes(attributes, detected []*common.KeyValue) []*common.KeyValue {
+	keys := make(map[string]bool, len(attributes))
+	for _, kv := range attributes {
+		keys[kv.Key] = true
+	}
+	for _, kv := range detected {
+		if !keys[kv.Key] {
+			attributes = append(attributes, kv)
+		}
+	}
+	return attributes
+}
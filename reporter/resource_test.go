@@ -0,0 +1,206 @@
+/*
+ * Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+ * or more contributor license agreements. Licensed under the Apache License 2.0.
+ * See the file "LICENSE" for details.
+ */
+
+package reporter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	common "go.opentelemetry.io/proto/otlp/common/v1"
+
+	"github.com/elastic/otel-profiling-agent/libpf"
+)
+
+func TestGetResourceDetectedAttributes(t *testing.T) {
+	r := newTestOTLPReporter(t)
+	r.ReportHostMetadata(map[string]string{"host:hostname": "metadata-host"})
+	r.detectedAttributes = []*common.KeyValue{
+		{Key: "host.name", Value: anyValue(attribute.StringValue("detected-host"))},
+		{Key: "os.type", Value: anyValue(attribute.StringValue("detected-os"))},
+		{Key: "container.id", Value: anyValue(attribute.StringValue("abc123"))},
+		{Key: "process.owner", Value: anyValue(attribute.StringValue("root"))},
+	}
+
+	attrs := attributeMap(r.getResource().Attributes)
+	// Host metadata takes precedence over detected attributes.
+	assert.Equal(t, "metadata-host", attrs["host.name"])
+	assert.Equal(t, "linux", attrs["os.type"])
+	assert.Equal(t, "abc123", attrs["container.id"])
+	assert.Equal(t, "root", attrs["process.owner"])
+
+	// Every attribute is only reported once.
+	keys := make(map[string]int)
+	for _, kv := range r.getResource().Attributes {
+		keys[kv.Key]++
+	}
+	for key, n := range keys {
+		assert.Equal(t, 1, n, key)
+	}
+}
+
+func TestHostMetadataRefresh(t *testing.T) {
+	const refresh = time.Minute
+
+	clock := newFakeClock(time.Unix(1710000000, 0))
+	r := newTestOTLPReporter(t)
+	r.clock = clock
+	r.ReportHostMetadata(map[string]string{
+		"host:hostname":                   "metadata-host",
+		"ec2:placement/availability-zone": "us-east-1a",
+	})
+
+	source := make(chan map[string]string, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan libpf.Void)
+	go func() {
+		r.hostMetadataLoop(ctx, refresh, func() map[string]string { return <-source })
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	<-clock.created
+
+	// The host moved to another availability zone.
+	source <- map[string]string{"ec2:placement/availability-zone": "us-east-1b"}
+	clock.Advance(refresh)
+	require.Eventually(t, func() bool {
+		return attributeMap(r.getResource().Attributes)["cloud.availability_zone"] ==
+			"us-east-1b"
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, "metadata-host", attributeMap(r.getResource().Attributes)["host.name"])
+}
+
+func TestParseResourceAttributes(t *testing.T) {
+	tests := map[string]struct {
+		value   string
+		want    map[string]any
+		wantErr bool
+	}{
+		"empty": {
+			want: map[string]any{},
+		},
+		"encoded": {
+			value: "team=core%20profiling, service.name = checkout%2Capi ,," +
+				"deployment.environment=prod%3Deu,url=https://example.com/a%2Fb",
+			want: map[string]any{
+				"team":                   "core profiling",
+				"service.name":           "checkout,api",
+				"deployment.environment": "prod=eu",
+				"url":                    "https://example.com/a/b",
+			},
+		},
+		"repeated key": {
+			value: "team=a,team=b",
+			want:  map[string]any{"team": "b"},
+		},
+		"missing value": {
+			value:   "team=a,service.name",
+			wantErr: true,
+		},
+		"missing key": {
+			value:   "=a",
+			wantErr: true,
+		},
+		"invalid encoding": {
+			value:   "team=a%zz",
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range tests {
+		name := name
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			attributes, err := parseResourceAttributes(tc.value)
+			if tc.wantErr {
+				require.Error(t, err)
+				assert.Nil(t, attributes)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, attributeMap(attributes), name)
+		})
+	}
+}
+
+func TestGetResourceEnvAttributes(t *testing.T) {
+	envAttributes, err := parseResourceAttributes(
+		"host.name=env-host,team=core%20profiling,os.type=env-os,service.name=checkout")
+	require.NoError(t, err)
+
+	r := newTestOTLPReporter(t)
+	r.ReportHostMetadata(map[string]string{"host:hostname": "metadata-host"})
+	r.envAttributes = envAttributes
+	r.serviceName = envServiceName(DefaultServiceName, envAttributes)
+	r.detectedAttributes = []*common.KeyValue{
+		{Key: "team", Value: anyValue(attribute.StringValue("detected-team"))},
+		{Key: "process.owner", Value: anyValue(attribute.StringValue("root"))},
+	}
+
+	attrs := attributeMap(r.getResource().Attributes)
+	// Host metadata takes precedence over the environment, which takes
+	// precedence over detected attributes.
+	assert.Equal(t, "metadata-host", attrs["host.name"])
+	assert.Equal(t, "linux", attrs["os.type"])
+	assert.Equal(t, "core profiling", attrs["team"])
+	assert.Equal(t, "root", attrs["process.owner"])
+	// The service name of the environment replaces the default one.
+	assert.Equal(t, "checkout", attrs["service.name"])
+
+	// A configured service name takes precedence.
+	assert.Equal(t, "configured", envServiceName("configured", envAttributes))
+}
+
+func TestAnyValue(t *testing.T) {
+	tests := map[string]struct {
+		value attribute.Value
+		want  *common.AnyValue
+	}{
+		"string": {
+			value: attribute.StringValue("linux"),
+			want:  &common.AnyValue{Value: &common.AnyValue_StringValue{StringValue: "linux"}},
+		},
+		"int": {
+			value: attribute.Int64Value(42),
+			want:  &common.AnyValue{Value: &common.AnyValue_IntValue{IntValue: 42}},
+		},
+		"double": {
+			value: attribute.Float64Value(0.5),
+			want:  &common.AnyValue{Value: &common.AnyValue_DoubleValue{DoubleValue: 0.5}},
+		},
+		"bool": {
+			value: attribute.BoolValue(true),
+			want:  &common.AnyValue{Value: &common.AnyValue_BoolValue{BoolValue: true}},
+		},
+		"string slice": {
+			value: attribute.StringSliceValue([]string{"a", "b"}),
+			want: &common.AnyValue{Value: &common.AnyValue_ArrayValue{
+				ArrayValue: &common.ArrayValue{Values: []*common.AnyValue{
+					{Value: &common.AnyValue_StringValue{StringValue: "a"}},
+					{Value: &common.AnyValue_StringValue{StringValue: "b"}},
+				}}}},
+		},
+		"int slice": {
+			value: attribute.Int64SliceValue([]int64{1, 2}),
+			want:  &common.AnyValue{Value: &common.AnyValue_StringValue{StringValue: "[1 2]"}},
+		},
+	}
+
+	for name, tc := range tests {
+		name := name
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.want, anyValue(tc.value), name)
+		})
+	}
+}
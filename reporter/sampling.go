@@ -0,0 +1,77 @@
+/*
+ * Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+ * or more contributor license agreements. Licensed under the Apache License 2.0.
+ * See the file "LICENSE" for details.
+ */
+
+package reporter
+
+import (
+	"math/rand"
+	"sync/atomic"
+
+	"github.com/elastic/otel-profiling-agent/debug/log"
+	profiles "github.com/elastic/otel-profiling-agent/proto/experiments/opentelemetry/proto/profiles/v1"
+)
+
+// exportSampler exports the profiles of a random fraction of the report
+// intervals and skips the others, to protect the backend under extreme load.
+// The decision is made once per interval, so that the profiles of an interval
+// that are split across several requests are either all exported or all
+// skipped. As the samples of a skipped interval are already collected, the
+// caches are drained either way.
+type exportSampler struct {
+	// rate is the fraction of report intervals that are exported.
+	rate float64
+	// random returns a pseudo-random number in [0, 1).
+	random func() float64
+
+	// skipped counts the report intervals that were skipped.
+	skipped atomic.Uint32
+	// skippedSamples counts the samples of the skipped report intervals.
+	skippedSamples atomic.Uint32
+}
+
+// newExportSampler returns a sampler that exports the given fraction of the
+// report intervals, or nil if rate is zero or one, which exports all intervals.
+func newExportSampler(rate float64) *exportSampler {
+	if rate <= 0 || rate >= 1 {
+		return nil
+	}
+	return &exportSampler{
+		rate: rate,
+		// nolint:gosec
+		random: rand.Float64,
+	}
+}
+
+// keep returns whether the profiles of a report interval are exported, and
+// counts them as skipped otherwise. A nil sampler keeps all profiles.
+func (s *exportSampler) keep(resourceProfiles []*profiles.ResourceProfiles) bool {
+	if s == nil || s.random() < s.rate {
+		return true
+	}
+
+	n := numSamples(resourceProfiles)
+	log.Debugf("Skip sending of %d OTLP profiles with %d samples", len(resourceProfiles), n)
+	s.skipped.Add(1)
+	s.skippedSamples.Add(uint32(n))
+	return false
+}
+
+// skippedCount returns the number of skipped report intervals since the last call.
+func (s *exportSampler) skippedCount() uint32 {
+	if s == nil {
+		return 0
+	}
+	return s.skipped.Swap(0)
+}
+
+// skippedSampleCount returns the number of samples of skipped report intervals
+// since the last call.
+func (s *exportSampler) skippedSampleCount() uint32 {
+	if s == nil {
+		return 0
+	}
+	return s.skippedSamples.Swap(0)
+}
@@ -0,0 +1,105 @@
+/*
+ * Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+ * or more contributor license agreements. Licensed under the Apache License 2.0.
+ * See the file "LICENSE" for details.
+ */
+
+package reporter
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/otel-profiling-agent/libpf"
+)
+
+func TestExportSampler(t *testing.T) {
+	const (
+		rate      = 0.25
+		intervals = 2000
+	)
+
+	client := &fakeProfilesClient{}
+	r := newTestOTLPReporterWithClient(t, client)
+	r.sampler = newExportSampler(rate)
+	require.NotNil(t, r.sampler)
+	r.sampler.random = rand.New(rand.NewSource(1)).Float64 // nolint:gosec
+
+	trace := &libpf.Trace{Hash: libpf.NewTraceHash(1, 2)}
+	trace.AppendFrame(libpf.KernelFrame, libpf.NewFileID(3, 4), 5)
+	for i := 0; i < intervals; i++ {
+		r.ReportFramesForTrace(trace)
+		r.ReportCountForTrace(trace.Hash, libpf.UnixTime64(1710000000e9), 1,
+			"comm", "", "", "", "", "")
+		require.Equal(t, time.Second, r.report(context.Background(), time.Second))
+		// The samples of skipped intervals are not kept for the next report.
+		require.Zero(t, r.samples.Len())
+	}
+
+	assert.InDelta(t, rate, float64(client.exports)/intervals, 0.03)
+	metrics := r.GetMetrics()
+	assert.Equal(t, uint32(intervals-client.exports), metrics.ExportSkippedCount)
+	assert.Equal(t, uint32(intervals-client.exports), metrics.ExportSkippedSamplesCount)
+
+	// The probes of the export breaker are not sampled.
+	r.breaker = newExportBreaker(1)
+	r.breaker.record(errors.New("unavailable"), time.Second)
+	require.True(t, r.breaker.isOpen())
+	exports := client.exports
+	r.report(context.Background(), time.Second)
+	assert.Equal(t, exports+1, client.exports)
+}
+
+func TestExportSamplerMaxRequestSize(t *testing.T) {
+	const intervals = 100
+
+	client := &fakeProfilesClient{}
+	r := newTestOTLPReporterWithClient(t, client)
+	r.sampler = newExportSampler(0.5)
+	require.NotNil(t, r.sampler)
+	r.sampler.random = rand.New(rand.NewSource(1)).Float64 // nolint:gosec
+	// Every tenant is sent in its own request.
+	tenants, err := newTenantResolver(nil, `^([a-z]+)-`)
+	require.NoError(t, err)
+	r.tenants = tenants
+	r.maxRequestSize = 1
+
+	pods := []string{"shop-1", "invoice-1", "search-1"}
+	for i := 0; i < intervals; i++ {
+		for j, pod := range pods {
+			trace := &libpf.Trace{Hash: libpf.NewTraceHash(uint64(j), 0)}
+			trace.AppendFrame(libpf.KernelFrame, libpf.NewFileID(3, 4), 5)
+			r.ReportFramesForTrace(trace)
+			r.ReportCountForTrace(trace.Hash, libpf.UnixTime64(1710000000e9), 1,
+				"comm", pod, "default", "", "", "")
+		}
+
+		exports := client.exports
+		require.NoError(t, r.reportOTLPProfile(context.Background(), time.Second))
+		// The requests of an interval are either all sent or all skipped.
+		if sent := client.exports - exports; sent != 0 {
+			require.Equal(t, len(pods), sent)
+		}
+	}
+
+	skipped := r.GetMetrics().ExportSkippedCount
+	assert.Equal(t, intervals*len(pods), client.exports+int(skipped)*len(pods))
+	assert.NotZero(t, skipped)
+	assert.NotZero(t, client.exports)
+}
+
+func TestExportSamplerDisabled(t *testing.T) {
+	for _, rate := range []float64{0, 1} {
+		s := newExportSampler(rate)
+		assert.Nil(t, s)
+		assert.True(t, s.keep(nil))
+		assert.Zero(t, s.skippedCount())
+		assert.Zero(t, s.skippedSampleCount())
+	}
+}
@@ -0,0 +1,164 @@
+/*
+ * Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+ * or more contributor license agreements. Licensed under the Apache License 2.0.
+ * See the file "LICENSE" for details.
+ */
+
+package reporter
+
+import (
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	common "go.opentelemetry.io/proto/otlp/common/v1"
+
+	"github.com/elastic/otel-profiling-agent/hostmetadata/host"
+	"github.com/elastic/otel-profiling-agent/libpf/vc"
+)
+
+// DefaultServiceName is the service.name resource attribute that is reported if
+// no other name is configured.
+const DefaultServiceName = "otel-profiling-agent"
+
+const (
+	// agentVersionKey is the resource attribute that holds the version of the agent.
+	agentVersionKey = "telemetry.sdk.version"
+	// agentRevisionKey is the resource attribute that holds the git revision of the
+	// agent. It is not defined by the semantic conventions.
+	agentRevisionKey = "telemetry.sdk.revision"
+)
+
+// semconvKeys maps host metadata keys to the names of the corresponding resource
+// attributes of the OpenTelemetry semantic conventions. Keys that are not listed
+// here are reported unchanged.
+var semconvKeys = map[string]string{
+	host.KeyHostname:      "host.name",
+	host.KeyMachine:       "host.arch",
+	host.KeyIPAddress:     "host.ip",
+	host.KeyKernelVersion: "os.version",
+
+	"agent:version": "service.version",
+
+	"ec2:instance-id":                 "host.id",
+	"ec2:instance-type":               "host.type",
+	"ec2:ami-id":                      "host.image.id",
+	"ec2:placement/region":            "cloud.region",
+	"ec2:placement/availability-zone": "cloud.availability_zone",
+
+	"gce:instance/id":           "host.id",
+	"gce:instance/machine-type": "host.type",
+
+	"azure:compute/vmid":     "host.id",
+	"azure:compute/vmsize":   "host.type",
+	"azure:compute/location": "cloud.region",
+
+	"k8s:node_name":    "k8s.node.name",
+	"k8s:cluster_name": "k8s.cluster.name",
+}
+
+// cloudProviders maps the prefix of the host metadata keys of a cloud provider to
+// the value of the cloud.provider resource attribute.
+var cloudProviders = map[string]string{
+	"ec2:":   "aws",
+	"gce:":   "gcp",
+	"azure:": "azure",
+}
+
+// hostArchitectures maps the machine names reported by uname to the values of
+// the host.arch resource attribute.
+var hostArchitectures = map[string]string{
+	"x86_64":  "amd64",
+	"aarch64": "arm64",
+}
+
+// stringAttributes are the resource attributes that are always reported as strings,
+// even if their value looks like a number or boolean.
+var stringAttributes = map[string]bool{
+	"host.name":       true,
+	"host.id":         true,
+	"host.ip":         true,
+	"host.type":       true,
+	"host.image.id":   true,
+	"os.version":      true,
+	"service.name":    true,
+	"service.version": true,
+	agentVersionKey:   true,
+	agentRevisionKey:  true,
+
+	"k8s.node.name":    true,
+	"k8s.cluster.name": true,
+}
+
+// typedValue returns v as the AnyValue variant that matches its content. Values
+// are only reported as integers, doubles or booleans if the conversion back to
+// a string yields v, so that no information like leading zeros is lost.
+func typedValue(key, v string) *common.AnyValue {
+	if stringAttributes[key] {
+		return &common.AnyValue{Value: &common.AnyValue_StringValue{StringValue: v}}
+	}
+	if i, err := strconv.ParseInt(v, 10, 64); err == nil && strconv.FormatInt(i, 10) == v {
+		return &common.AnyValue{Value: &common.AnyValue_IntValue{IntValue: i}}
+	}
+	if f, err := strconv.ParseFloat(v, 64); err == nil &&
+		strings.Contains(v, ".") && strconv.FormatFloat(f, 'f', -1, 64) == v {
+		return &common.AnyValue{Value: &common.AnyValue_DoubleValue{DoubleValue: f}}
+	}
+	if v == "true" || v == "false" {
+		return &common.AnyValue{Value: &common.AnyValue_BoolValue{BoolValue: v == "true"}}
+	}
+	return &common.AnyValue{Value: &common.AnyValue_StringValue{StringValue: v}}
+}
+
+// semconvAttributes translates the host metadata to resource attributes following
+// the OpenTelemetry semantic conventions and adds the attributes that describe
+// the agent itself. Values are reported with the AnyValue variant that matches
+// their content, see typedValue. The attributes are sorted by key.
+func semconvAttributes(metadata map[string]string, serviceName string) []*common.KeyValue {
+	attrs := make(map[string]string, len(metadata)+6)
+	for k, v := range metadata {
+		key, ok := semconvKeys[k]
+		if !ok {
+			attrs[k] = v
+			continue
+		}
+		if key == "host.arch" {
+			if arch, ok := hostArchitectures[v]; ok {
+				v = arch
+			}
+		}
+		attrs[key] = v
+
+		if provider, ok := cloudProviders[k[:strings.IndexByte(k, ':')+1]]; ok {
+			attrs["cloud.provider"] = provider
+		}
+	}
+
+	if serviceName == "" {
+		serviceName = DefaultServiceName
+	}
+	attrs["service.name"] = serviceName
+	attrs["os.type"] = "linux"
+	// Unlike the agent metadata, which is only reported periodically, the version
+	// of the agent is part of every report.
+	attrs[agentVersionKey] = vc.Version()
+	attrs[agentRevisionKey] = vc.Revision()
+
+	attributes := make([]*common.KeyValue, 0, len(attrs)+1)
+	for k, v := range attrs {
+		attributes = append(attributes, &common.KeyValue{
+			Key:   k,
+			Value: typedValue(k, v),
+		})
+	}
+	attributes = append(attributes, &common.KeyValue{
+		Key:   "process.pid",
+		Value: &common.AnyValue{Value: &common.AnyValue_IntValue{IntValue: int64(os.Getpid())}},
+	})
+
+	sort.Slice(attributes, func(i, j int) bool {
+		return attributes[i].Key < attributes[j].Key
+	})
+	return attributes
+}
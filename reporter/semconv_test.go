@@ -0,0 +1,192 @@
+/*
+ * Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+ * or more contributor license agreements. Licensed under the Apache License 2.0.
+ * See the file "LICENSE" for details.
+ */
+
+package reporter
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	common "go.opentelemetry.io/proto/otlp/common/v1"
+
+	"github.com/elastic/otel-profiling-agent/libpf/vc"
+)
+
+func attributeMap(attrs []*common.KeyValue) map[string]any {
+	m := make(map[string]any, len(attrs))
+	for _, attr := range attrs {
+		switch v := attr.Value.Value.(type) {
+		case *common.AnyValue_StringValue:
+			m[attr.Key] = v.StringValue
+		case *common.AnyValue_IntValue:
+			m[attr.Key] = v.IntValue
+		case *common.AnyValue_DoubleValue:
+			m[attr.Key] = v.DoubleValue
+		case *common.AnyValue_BoolValue:
+			m[attr.Key] = v.BoolValue
+		}
+	}
+	return m
+}
+
+func TestSemconvAttributes(t *testing.T) {
+	tests := map[string]struct {
+		metadata    map[string]string
+		serviceName string
+		want        map[string]any
+	}{
+		"ec2": {
+			metadata: map[string]string{
+				"host:hostname":              "ip-10-0-0-1",
+				"host:machine":               "x86_64",
+				"host:ip":                    "10.0.0.1",
+				"host:kernel_version":        "6.1.0",
+				"agent:version":              "v1.2.3",
+				"agent:revision":             "abcdef",
+				"agent:config_bpf_log_level": "2",
+				"ec2:instance-id":            "i-0123456789",
+				"ec2:instance-type":          "m5.large",
+				"ec2:placement/region":       "eu-west-1",
+			},
+			want: map[string]any{
+				"host.name":                  "ip-10-0-0-1",
+				"host.arch":                  "amd64",
+				"host.ip":                    "10.0.0.1",
+				"host.id":                    "i-0123456789",
+				"host.type":                  "m5.large",
+				"os.type":                    "linux",
+				"os.version":                 "6.1.0",
+				"cloud.provider":             "aws",
+				"cloud.region":               "eu-west-1",
+				"service.name":               DefaultServiceName,
+				"service.version":            "v1.2.3",
+				"agent:revision":             "abcdef",
+				"agent:config_bpf_log_level": int64(2),
+				"process.pid":                int64(os.Getpid()),
+				agentVersionKey:              vc.Version(),
+				agentRevisionKey:             vc.Revision(),
+			},
+		},
+		"azureServiceName": {
+			metadata: map[string]string{
+				"host:machine":           "aarch64",
+				"azure:compute/vmid":     "0b6f8c1e",
+				"instance:private-ipv4s": "10.0.0.2",
+			},
+			serviceName: "profiler",
+			want: map[string]any{
+				"host.arch":              "arm64",
+				"host.id":                "0b6f8c1e",
+				"cloud.provider":         "azure",
+				"os.type":                "linux",
+				"service.name":           "profiler",
+				"instance:private-ipv4s": "10.0.0.2",
+				"process.pid":            int64(os.Getpid()),
+				agentVersionKey:          vc.Version(),
+				agentRevisionKey:         vc.Revision(),
+			},
+		},
+		"unknownArchitecture": {
+			metadata: map[string]string{"host:machine": "riscv64"},
+			want: map[string]any{
+				"host.arch":      "riscv64",
+				"os.type":        "linux",
+				"service.name":   DefaultServiceName,
+				"process.pid":    int64(os.Getpid()),
+				agentVersionKey:  vc.Version(),
+				agentRevisionKey: vc.Revision(),
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			attrs := semconvAttributes(tc.metadata, tc.serviceName)
+			require.Len(t, attrs, len(tc.want))
+			assert.Equal(t, tc.want, attributeMap(attrs))
+			assert.IsIncreasing(t, attributeKeys(attrs))
+		})
+	}
+}
+
+func attributeKeys(attrs []*common.KeyValue) []string {
+	keys := make([]string, 0, len(attrs))
+	for _, attr := range attrs {
+		keys = append(keys, attr.Key)
+	}
+	return keys
+}
+
+func TestTypedValue(t *testing.T) {
+	tests := map[string]struct {
+		key   string
+		value string
+		want  *common.AnyValue
+	}{
+		"int": {
+			key:   "host:cpus",
+			value: "16",
+			want:  &common.AnyValue{Value: &common.AnyValue_IntValue{IntValue: 16}},
+		},
+		"negativeInt": {
+			key:   "agent:offset",
+			value: "-3",
+			want:  &common.AnyValue{Value: &common.AnyValue_IntValue{IntValue: -3}},
+		},
+		"double": {
+			key:   "host:load",
+			value: "0.75",
+			want:  &common.AnyValue{Value: &common.AnyValue_DoubleValue{DoubleValue: 0.75}},
+		},
+		"bool": {
+			key:   "agent:config_no_kernel_version_check",
+			value: "true",
+			want:  &common.AnyValue{Value: &common.AnyValue_BoolValue{BoolValue: true}},
+		},
+		"string": {
+			key:   "host:kernel_proc_version",
+			value: "Linux version 6.1.0",
+			want: &common.AnyValue{Value: &common.AnyValue_StringValue{
+				StringValue: "Linux version 6.1.0"}},
+		},
+		"leadingZeros": {
+			key:   "ec2:product-codes",
+			value: "0042",
+			want:  &common.AnyValue{Value: &common.AnyValue_StringValue{StringValue: "0042"}},
+		},
+		"ipAddress": {
+			key:   "instance:public-ipv4s",
+			value: "10.0.0.1",
+			want:  &common.AnyValue{Value: &common.AnyValue_StringValue{StringValue: "10.0.0.1"}},
+		},
+		"nan": {
+			key:   "host:load",
+			value: "NaN",
+			want:  &common.AnyValue{Value: &common.AnyValue_StringValue{StringValue: "NaN"}},
+		},
+		"numericHostID": {
+			key:   "host.id",
+			value: "1234567890",
+			want:  &common.AnyValue{Value: &common.AnyValue_StringValue{StringValue: "1234567890"}},
+		},
+		"numericVersion": {
+			key:   "os.version",
+			value: "6.1",
+			want:  &common.AnyValue{Value: &common.AnyValue_StringValue{StringValue: "6.1"}},
+		},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.want, typedValue(tc.key, tc.value))
+		})
+	}
+}
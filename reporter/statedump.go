@@ -0,0 +1,328 @@
+/*
+ * Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+ * or more contributor license agreements. Licensed under the Apache License 2.0.
+ * See the file "LICENSE" for details.
+ */
+
+package reporter
+
+import (
+	"encoding/gob"
+	"fmt"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/elastic/otel-profiling-agent/libpf"
+)
+
+// stateDumpVersion is the version of the on-disk format written by DumpState.
+// It must be incremented on every incompatible change of stateDump.
+const stateDumpVersion = 1
+
+// stateDump is the on-disk representation of the caches of OTLPReporter.
+// libpf types that hold unexported fields are stored as their components, so
+// that the format does not depend on their internal representation.
+type stateDump struct {
+	Version         uint32
+	Traces          []dumpedTrace
+	Samples         []dumpedSample
+	Executables     []dumpedExecutable
+	Frames          []dumpedFrame
+	FallbackSymbols []dumpedFallbackSymbol
+}
+
+// dumpedHash holds the components of a 128 bit hash.
+type dumpedHash struct {
+	Hi, Lo uint64
+}
+
+type dumpedTrace struct {
+	Hash           dumpedHash
+	Files          []dumpedHash
+	Linenos        []libpf.AddressOrLineno
+	FrameTypes     []libpf.FrameType
+	JITTiers       []libpf.JITTier
+	Comm           string
+	ThreadName     string
+	PodName        string
+	PodNamespace   string
+	ContainerName  string
+	ContainerID    string
+	APMServiceName string
+
+	PID              libpf.PID
+	ProcessStartTime libpf.UnixTime64
+}
+
+type dumpedSample struct {
+	Hash       dumpedHash
+	Timestamps []libpf.UnixTime64
+	Count      uint32
+	AllocBytes uint64
+}
+
+type dumpedExecutable struct {
+	FileID   dumpedHash
+	FileName string
+	BuildID  string
+	Inode    uint64
+	Device   uint64
+	// GNUBuildID is set if BuildID comes from a GNU build ID note.
+	GNUBuildID bool
+
+	MemoryStart uint64
+	MemoryLimit uint64
+}
+
+type dumpedFrame struct {
+	FileID          dumpedHash
+	AddressOrLine   libpf.AddressOrLineno
+	LineNumber      libpf.SourceLineno
+	FunctionOffset  uint32
+	FunctionName    string
+	FilePath        string
+	FunctionEndLine libpf.SourceLineno
+	InlineFrames    []libpf.InlineFrame
+}
+
+type dumpedFallbackSymbol struct {
+	FileID        dumpedHash
+	AddressOrLine libpf.AddressOrLineno
+	Symbol        string
+}
+
+func dumpFileID(fileID libpf.FileID) dumpedHash {
+	return dumpedHash{Hi: fileID.Hi(), Lo: fileID.Lo()}
+}
+
+func (h dumpedHash) fileID() libpf.FileID {
+	return libpf.NewFileID(h.Hi, h.Lo)
+}
+
+func (h dumpedHash) traceHash() libpf.TraceHash {
+	return libpf.NewTraceHash(h.Hi, h.Lo)
+}
+
+// DumpState writes the traces, samples, executables, frames and fallback symbols
+// currently held by r as zstd compressed file to path, so that profiles can be
+// regenerated offline with LoadState. The caches are not modified.
+func (r *OTLPReporter) DumpState(path string) error {
+	dump := stateDump{Version: stateDumpVersion}
+
+	for _, hash := range r.traces.Keys() {
+		trace, ok := r.traces.Peek(hash)
+		if !ok {
+			continue
+		}
+		files := make([]dumpedHash, 0, len(trace.files))
+		for _, fileID := range trace.files {
+			files = append(files, dumpFileID(fileID))
+		}
+		dump.Traces = append(dump.Traces, dumpedTrace{
+			Hash:           dumpedHash{Hi: hash.Hi(), Lo: hash.Lo()},
+			Files:          files,
+			Linenos:        trace.linenos,
+			FrameTypes:     trace.frameTypes,
+			JITTiers:       trace.jitTiers,
+			Comm:           trace.comm,
+			ThreadName:     trace.threadName,
+			PodName:        trace.podName,
+			PodNamespace:   trace.podNamespace,
+			ContainerName:  trace.containerName,
+			ContainerID:    trace.containerID,
+			APMServiceName: trace.apmServiceName,
+
+			PID:              trace.pid,
+			ProcessStartTime: trace.processStartTime,
+		})
+	}
+
+	for _, hash := range r.samples.Keys() {
+		s, ok := r.samples.Peek(hash)
+		if !ok {
+			continue
+		}
+		dump.Samples = append(dump.Samples, dumpedSample{
+			Hash:       dumpedHash{Hi: hash.Hi(), Lo: hash.Lo()},
+			Timestamps: s.timestamps,
+			Count:      s.count,
+			AllocBytes: s.allocBytes,
+		})
+	}
+
+	for _, fileID := range r.executables.Keys() {
+		info, ok := r.executables.Peek(fileID)
+		if !ok {
+			continue
+		}
+		dump.Executables = append(dump.Executables, dumpedExecutable{
+			FileID:   dumpFileID(fileID),
+			FileName: info.fileName,
+			BuildID:  info.buildID,
+			Inode:    info.inode,
+			Device:   info.device,
+
+			GNUBuildID: info.gnuBuildID,
+
+			MemoryStart: info.memoryStart,
+			MemoryLimit: info.memoryLimit,
+		})
+	}
+
+	// The maps of frames are updated in place, so they are only read while
+	// holding framesMu.
+	r.framesMu.RLock()
+	for _, fileID := range r.frames.Keys() {
+		frames, ok := r.frames.Peek(fileID)
+		if !ok {
+			continue
+		}
+		for addressOrLine, si := range frames {
+			dump.Frames = append(dump.Frames, dumpedFrame{
+				FileID:          dumpFileID(fileID),
+				AddressOrLine:   addressOrLine,
+				LineNumber:      si.lineNumber,
+				FunctionOffset:  si.functionOffset,
+				FunctionName:    si.functionName,
+				FilePath:        si.filePath,
+				FunctionEndLine: si.functionEndLine,
+				InlineFrames:    si.inlineFrames,
+			})
+		}
+	}
+	r.framesMu.RUnlock()
+
+	for _, frameID := range r.fallbackSymbols.Keys() {
+		symbol, ok := r.fallbackSymbols.Peek(frameID)
+		if !ok {
+			continue
+		}
+		dump.FallbackSymbols = append(dump.FallbackSymbols, dumpedFallbackSymbol{
+			FileID:        dumpFileID(frameID.FileID()),
+			AddressOrLine: frameID.AddressOrLine(),
+			Symbol:        symbol,
+		})
+	}
+
+	// Write to a temporary file first, so that an existing dump is not
+	// replaced by a partial one.
+	tmpPath := path + ".tmp"
+	out, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create state dump: %v", err)
+	}
+	defer os.Remove(tmpPath)
+	defer out.Close()
+
+	zw, err := zstd.NewWriter(out)
+	if err != nil {
+		return fmt.Errorf("failed to create zstd writer: %v", err)
+	}
+	if err = gob.NewEncoder(zw).Encode(&dump); err != nil {
+		zw.Close()
+		return fmt.Errorf("failed to encode state dump: %v", err)
+	}
+	if err = zw.Close(); err != nil {
+		return fmt.Errorf("failed to compress state dump: %v", err)
+	}
+	if err = out.Close(); err != nil {
+		return fmt.Errorf("failed to write state dump: %v", err)
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// LoadState adds the information of a file written by DumpState to the caches of r.
+func (r *OTLPReporter) LoadState(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open state dump: %v", err)
+	}
+	defer in.Close()
+
+	zr, err := zstd.NewReader(in)
+	if err != nil {
+		return fmt.Errorf("failed to create zstd reader: %v", err)
+	}
+	defer zr.Close()
+
+	var dump stateDump
+	if err = gob.NewDecoder(zr).Decode(&dump); err != nil {
+		return fmt.Errorf("failed to decode state dump: %v", err)
+	}
+	if dump.Version != stateDumpVersion {
+		return fmt.Errorf("unsupported state dump version %d, expected %d",
+			dump.Version, stateDumpVersion)
+	}
+
+	for _, t := range dump.Traces {
+		files := make([]libpf.FileID, 0, len(t.Files))
+		for _, h := range t.Files {
+			files = append(files, h.fileID())
+		}
+		r.traces.Add(t.Hash.traceHash(), traceInfo{
+			files:          files,
+			linenos:        t.Linenos,
+			frameTypes:     t.FrameTypes,
+			jitTiers:       t.JITTiers,
+			comm:           t.Comm,
+			threadName:     t.ThreadName,
+			podName:        t.PodName,
+			podNamespace:   t.PodNamespace,
+			containerName:  t.ContainerName,
+			containerID:    t.ContainerID,
+			apmServiceName: t.APMServiceName,
+
+			pid:              t.PID,
+			processStartTime: t.ProcessStartTime,
+		})
+	}
+
+	for _, s := range dump.Samples {
+		r.samples.Add(s.Hash.traceHash(), sample{
+			timestamps: s.Timestamps,
+			count:      s.Count,
+			allocBytes: s.AllocBytes,
+		})
+	}
+
+	for _, e := range dump.Executables {
+		r.executables.Add(e.FileID.fileID(), execInfo{
+			fileName: e.FileName,
+			buildID:  e.BuildID,
+			inode:    e.Inode,
+			device:   e.Device,
+
+			gnuBuildID: e.GNUBuildID,
+
+			memoryStart: e.MemoryStart,
+			memoryLimit: e.MemoryLimit,
+		})
+	}
+
+	frames := make(map[libpf.FileID]map[libpf.AddressOrLineno]sourceInfo)
+	for _, f := range dump.Frames {
+		fileID := f.FileID.fileID()
+		if frames[fileID] == nil {
+			frames[fileID] = make(map[libpf.AddressOrLineno]sourceInfo)
+		}
+		frames[fileID][f.AddressOrLine] = sourceInfo{
+			lineNumber:      f.LineNumber,
+			functionOffset:  f.FunctionOffset,
+			functionName:    f.FunctionName,
+			filePath:        f.FilePath,
+			functionEndLine: f.FunctionEndLine,
+			inlineFrames:    f.InlineFrames,
+		}
+	}
+	for fileID, v := range frames {
+		r.frames.Add(fileID, v)
+	}
+
+	for _, s := range dump.FallbackSymbols {
+		r.fallbackSymbols.Add(libpf.NewFrameID(s.FileID.fileID(), s.AddressOrLine),
+			r.internSymbol(s.Symbol))
+	}
+
+	return nil
+}
@@ -0,0 +1,130 @@
+/*
+ * Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+ * or more contributor license agreements. Licensed under the Apache License 2.0.
+ * See the file "LICENSE" for details.
+ */
+
+package reporter
+
+import (
+	"context"
+	"encoding/gob"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	common "go.opentelemetry.io/proto/otlp/common/v1"
+
+	"github.com/elastic/otel-profiling-agent/libpf"
+	"github.com/elastic/otel-profiling-agent/proto/experiments/opentelemetry/proto/profiles/v1/alternatives/pprofextended"
+)
+
+func TestStateDumpRoundTrip(t *testing.T) {
+	r := newTestOTLPReporter(t)
+
+	pyFile := libpf.NewFileID(3, 4)
+	exeFile := libpf.NewFileID(5, 6)
+	kernelFile := libpf.NewFileID(7, 8)
+
+	r.ReportFrameMetadata(&libpf.FrameMetadata{
+		FileID:          pyFile,
+		AddressOrLine:   5,
+		LineNumber:      12,
+		FunctionOffset:  2,
+		FunctionName:    "foo",
+		Filename:        "foo.py",
+		FunctionEndLine: 20,
+		InlineFrames: []libpf.InlineFrame{
+			{FunctionName: "bar", Filename: "bar.py", LineNumber: 30},
+		},
+	})
+	r.ExecutableMetadata(context.Background(), exeFile, "/usr/bin/python3", "abcd", false)
+	r.ReportFallbackSymbol(libpf.NewFrameID(kernelFile, 0x30), "do_syscall_64")
+
+	trace := &libpf.Trace{Hash: libpf.NewTraceHash(1, 2)}
+	trace.AppendFrameWithJITTier(libpf.PythonFrame, pyFile, 5, libpf.JITTierInterpreted)
+	trace.AppendFrame(libpf.NativeFrame, exeFile, 0x10)
+	trace.AppendFrame(libpf.KernelFrame, kernelFile, 0x30)
+	r.ReportFramesForTrace(trace)
+	r.ReportCountForTrace(trace.Hash, libpf.UnixTime64(1710000000e9), 1, "python", "pod", "ns",
+		"c", "cid", "")
+	r.ReportCountForTrace(trace.Hash, libpf.UnixTime64(1710000001e9), 1, "python", "pod", "ns",
+		"c", "cid", "")
+
+	path := filepath.Join(t.TempDir(), "state.zst")
+	require.NoError(t, r.DumpState(path))
+
+	loaded := newTestOTLPReporter(t)
+	require.NoError(t, loaded.LoadState(path))
+
+	// Dumping does not consume the samples, so both reporters hold the same data.
+	want, wantStart, wantEnd := r.getProfile()
+	got, gotStart, gotEnd := loaded.getProfile()
+	assert.Equal(t, wantStart, gotStart)
+	assert.Equal(t, wantEnd, gotEnd)
+	require.Len(t, got.Sample, 1)
+	assert.Equal(t, describeProfile(want), describeProfile(got))
+	assert.Equal(t, []string{
+		"python 0x5 [bar bar.py:30 0] [foo foo.py:12 10] jit.tier=interpreted " +
+			"code.function.end_line=20",
+		"native 0x10 /python3 abcd",
+		"kernel 0x30 [do_syscall_64 vmlinux:0 0]",
+	}, describeProfile(got)[:3])
+}
+
+// describeProfile returns a description of the locations and labels of all
+// samples in profile that does not depend on the order of its tables.
+func describeProfile(profile *pprofextended.Profile) []string {
+	var desc []string
+	for _, sample := range profile.Sample {
+		for _, loc := range sampleLocations(profile, sample) {
+			d := fmt.Sprintf("%s 0x%x", locationFrameType(profile, loc), loc.Address)
+			if mapping := profile.Mapping[loc.MappingIndex-1]; len(loc.Line) == 0 {
+				d += fmt.Sprintf(" /%s %s", profile.StringTable[mapping.Filename],
+					profile.StringTable[mapping.BuildId])
+			}
+			for _, line := range loc.Line {
+				fn := profile.Function[line.FunctionIndex-1]
+				d += fmt.Sprintf(" [%s %s:%d %d]", profile.StringTable[fn.Name],
+					profile.StringTable[fn.Filename], line.Line, fn.StartLine)
+			}
+			for _, idx := range loc.Attributes {
+				attr := profile.AttributeTable[idx]
+				if attr.Key == frameTypeAttribute {
+					// Already part of the description.
+					continue
+				}
+				value := any(attr.Value.GetStringValue())
+				if v, ok := attr.Value.Value.(*common.AnyValue_IntValue); ok {
+					value = v.IntValue
+				}
+				d += fmt.Sprintf(" %s=%v", attr.Key, value)
+			}
+			desc = append(desc, d)
+		}
+		for _, label := range sample.Label {
+			desc = append(desc, fmt.Sprintf("%s=%s", profile.StringTable[label.Key],
+				profile.StringTable[label.Str]))
+		}
+		desc = append(desc, fmt.Sprintf("%v %v", sample.Value, sample.Timestamps))
+	}
+	return desc
+}
+
+func TestLoadStateVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.zst")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	zw, err := zstd.NewWriter(f)
+	require.NoError(t, err)
+	require.NoError(t, gob.NewEncoder(zw).Encode(&stateDump{Version: stateDumpVersion + 1}))
+	require.NoError(t, zw.Close())
+	require.NoError(t, f.Close())
+
+	assert.ErrorContains(t, newTestOTLPReporter(t).LoadState(path), "unsupported state dump version")
+	assert.Error(t, newTestOTLPReporter(t).LoadState(filepath.Join(t.TempDir(), "missing")))
+}
@@ -0,0 +1,169 @@
+/*
+ * Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+ * or more contributor license agreements. Licensed under the Apache License 2.0.
+ * See the file "LICENSE" for details.
+ */
+
+package reporter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/elastic/otel-profiling-agent/debug/log"
+	"github.com/elastic/otel-profiling-agent/libpf"
+	"github.com/elastic/otel-profiling-agent/proto/experiments/opentelemetry/proto/profiles/v1/alternatives/pprofextended"
+)
+
+// stdoutTopFunctions is the number of leaf functions listed in every summary.
+const stdoutTopFunctions = 10
+
+// Assert that we implement the full Reporter interface.
+var _ Reporter = (*StdoutReporter)(nil)
+
+// StdoutReporter prints a summary of the collected samples instead of sending
+// them to a backend. It is meant for local debugging.
+type StdoutReporter struct {
+	*OTLPReporter
+
+	// out receives the summaries.
+	out io.Writer
+}
+
+// StartStdout sets up a reporter that prints a summary of the collected samples
+// to stdout every reporting interval.
+func StartStdout(mainCtx context.Context, c *Config) (Reporter, error) {
+	otlp, _, err := newOTLPReporter(c)
+	if err != nil {
+		return nil, err
+	}
+	otlp.symuploader = NewNoopSymbolUploader()
+
+	r := &StdoutReporter{
+		OTLPReporter: otlp,
+		out:          os.Stdout,
+	}
+
+	// Create a child context for reporting features
+	ctx, cancelReporting := context.WithCancel(mainCtx)
+
+	go func() {
+		tick := time.NewTicker(c.Times.ReportInterval())
+		defer tick.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-r.stopSignal:
+				return
+			case <-tick.C:
+				r.traceInfoGraceLeft = r.traceInfoGracePeriod
+				if err := r.reportSummary(); err != nil {
+					log.Errorf("Failed to write profile summary: %v", err)
+				}
+				tick.Reset(libpf.AddJitter(c.Times.ReportInterval(), c.ReportJitter))
+			}
+		}
+	}()
+
+	go func() {
+		<-r.stopSignal
+		cancelReporting()
+	}()
+
+	return r, nil
+}
+
+// reportSummary writes a summary of all samples collected up to this moment.
+func (r *StdoutReporter) reportSummary() error {
+	profile, _, _ := r.getProfile()
+	return writeProfileSummary(r.out, profile, stdoutTopFunctions)
+}
+
+// summaryEntry is a name and the number of samples attributed to it.
+type summaryEntry struct {
+	name  string
+	count int64
+}
+
+// sortedEntries returns the entries of counts ordered by descending count and name.
+func sortedEntries(counts map[string]int64) []summaryEntry {
+	entries := make([]summaryEntry, 0, len(counts))
+	for name, count := range counts {
+		entries = append(entries, summaryEntry{name: name, count: count})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].count != entries[j].count {
+			return entries[i].count > entries[j].count
+		}
+		return entries[i].name < entries[j].name
+	})
+	return entries
+}
+
+// locationName returns a human readable name for loc.
+func locationName(profile *pprofextended.Profile, loc *pprofextended.Location) string {
+	if len(loc.Line) != 0 {
+		fn := profile.Function[loc.Line[0].FunctionIndex-1]
+		return fmt.Sprintf("%s (%s)", profile.StringTable[fn.Name],
+			profile.StringTable[fn.Filename])
+	}
+	if loc.MappingIndex != 0 {
+		mapping := profile.Mapping[loc.MappingIndex-1]
+		return fmt.Sprintf("%s+0x%x", profile.StringTable[mapping.Filename], loc.Address)
+	}
+	return fmt.Sprintf("0x%x", loc.Address)
+}
+
+// writeProfileSummary writes the number of samples, the samples per frame type
+// and the topN leaf functions of profile to w.
+func writeProfileSummary(w io.Writer, profile *pprofextended.Profile, topN int) error {
+	var numSamples int64
+	frameTypes := make(map[string]int64)
+	leafFunctions := make(map[string]int64)
+
+	for _, sample := range profile.Sample {
+		count := sample.Value[0]
+		numSamples += count
+
+		indices := profile.LocationIndices[sample.LocationsStartIndex:][:sample.LocationsLength]
+		for i, idx := range indices {
+			loc := profile.Location[idx]
+			frameTypes[locationFrameType(profile, loc)] += count
+			// The first frame of a trace is the leaf frame.
+			if i == 0 {
+				leafFunctions[locationName(profile, loc)] += count
+			}
+		}
+	}
+
+	if _, err := fmt.Fprintf(w, "Samples: %d\n", numSamples); err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintln(w, "Frames per type:"); err != nil {
+		return err
+	}
+	for _, e := range sortedEntries(frameTypes) {
+		if _, err := fmt.Fprintf(w, "  %-10s %d\n", e.name, e.count); err != nil {
+			return err
+		}
+	}
+
+	if _, err := fmt.Fprintf(w, "Top %d leaf functions:\n", topN); err != nil {
+		return err
+	}
+	for i, e := range sortedEntries(leafFunctions) {
+		if i == topN {
+			break
+		}
+		if _, err := fmt.Fprintf(w, "  %8d %s\n", e.count, e.name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
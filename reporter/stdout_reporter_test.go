@@ -0,0 +1,66 @@
+/*
+ * Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+ * or more contributor license agreements. Licensed under the Apache License 2.0.
+ * See the file "LICENSE" for details.
+ */
+
+package reporter
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/otel-profiling-agent/libpf"
+)
+
+func TestStdoutReporterSummary(t *testing.T) {
+	var out bytes.Buffer
+	r := &StdoutReporter{
+		OTLPReporter: newTestOTLPReporter(t),
+		out:          &out,
+	}
+
+	pyFile := libpf.NewFileID(3, 4)
+	r.FrameMetadata(pyFile, 5, 10, 0, "foo", "foo.py")
+	r.FrameMetadata(pyFile, 6, 20, 0, "bar", "foo.py")
+
+	exeFile := libpf.NewFileID(5, 6)
+	r.ExecutableMetadata(context.Background(), exeFile, "python3", "", false)
+
+	pyTrace := &libpf.Trace{Hash: libpf.NewTraceHash(1, 1)}
+	pyTrace.AppendFrame(libpf.PythonFrame, pyFile, 5)
+	pyTrace.AppendFrame(libpf.PythonFrame, pyFile, 6)
+	pyTrace.AppendFrame(libpf.NativeFrame, exeFile, 0x10)
+	r.ReportFramesForTrace(pyTrace)
+
+	nativeTrace := &libpf.Trace{Hash: libpf.NewTraceHash(2, 2)}
+	nativeTrace.AppendFrame(libpf.NativeFrame, exeFile, 0x20)
+	nativeTrace.AppendFrame(libpf.NativeFrame, exeFile, 0x10)
+	r.ReportFramesForTrace(nativeTrace)
+
+	for i := 0; i < 3; i++ {
+		r.ReportCountForTrace(pyTrace.Hash, libpf.UnixTime64(1710000000e9), 1,
+			"", "", "", "", "", "")
+	}
+	r.ReportCountForTrace(nativeTrace.Hash, libpf.UnixTime64(1710000000e9), 1,
+		"", "", "", "", "", "")
+
+	require.NoError(t, r.reportSummary())
+	assert.Equal(t, `Samples: 4
+Frames per type:
+  python     6
+  native     5
+Top 10 leaf functions:
+         3 foo (foo.py)
+         1 python3+0x20
+`, out.String())
+
+	// Samples are only reported once.
+	out.Reset()
+	require.NoError(t, r.reportSummary())
+	assert.Equal(t, "Samples: 0\nFrames per type:\nTop 10 leaf functions:\n", out.String())
+}
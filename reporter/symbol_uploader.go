@@ -0,0 +1,184 @@
+/*
+ * Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+ * or more contributor license agreements. Licensed under the Apache License 2.0.
+ * See the file "LICENSE" for details.
+ */
+
+package reporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc"
+
+	"github.com/elastic/otel-profiling-agent/debug/log"
+	"github.com/elastic/otel-profiling-agent/libpf"
+	v1alpha1 "github.com/elastic/otel-profiling-agent/proto/experiments/parca/debuginfo/v1alpha1"
+	"github.com/elastic/otel-profiling-agent/symuploader"
+)
+
+// Names of the built-in symbol uploaders.
+const (
+	SymbolUploaderParca = "parca"
+	SymbolUploaderHTTP  = "http"
+)
+
+// SymbolUploader uploads the symbols of executables to a backend.
+type SymbolUploader interface {
+	// Upload queues the executable at fileName for upload. It must not block.
+	Upload(ctx context.Context, fileID libpf.FileID, fileName, buildID string)
+}
+
+func NewNoopSymbolUploader() SymbolUploader {
+	return &noopSymbolUploader{}
+}
+
+type noopSymbolUploader struct{}
+
+func (n *noopSymbolUploader) Upload(_ context.Context, _ libpf.FileID, _ string, _ string) {}
+
+// SymbolUploaderParams holds what a SymbolUploaderFactory may use to create
+// a SymbolUploader.
+type SymbolUploaderParams struct {
+	// Config is the configuration of the reporter.
+	Config *Config
+	// Conn is the gRPC connection to the collector. It is nil if the
+	// collector is not connected via gRPC.
+	Conn *grpc.ClientConn
+	// Conns holds the gRPC connections to all collectors that profiles are
+	// sent to, starting with Conn.
+	Conns []*grpc.ClientConn
+	// CacheSize is the number of executables the uploader should keep track of.
+	CacheSize int
+	// PathFilter decides which executables may be uploaded.
+	PathFilter *symuploader.PathFilter
+}
+
+// SymbolUploaderFactory creates a SymbolUploader.
+type SymbolUploaderFactory func(p SymbolUploaderParams) (SymbolUploader, error)
+
+var (
+	symbolUploadersMu sync.RWMutex
+	symbolUploaders   = map[string]SymbolUploaderFactory{
+		SymbolUploaderParca: newParcaSymbolUploader,
+		SymbolUploaderHTTP:  newHTTPSymbolUploader,
+	}
+)
+
+// RegisterSymbolUploader makes a SymbolUploader available under name, so that it
+// can be selected with Config.SymbolUploader. An existing uploader with the same
+// name is replaced.
+func RegisterSymbolUploader(name string, factory SymbolUploaderFactory) {
+	symbolUploadersMu.Lock()
+	defer symbolUploadersMu.Unlock()
+	symbolUploaders[name] = factory
+}
+
+// errUnknownSymbolUploader is returned by newSymbolUploader for names without a
+// registered SymbolUploader.
+var errUnknownSymbolUploader = errors.New("unknown symbol uploader")
+
+// newSymbolUploader creates the SymbolUploader registered under name.
+// If name is empty, the Parca uploader is used.
+func newSymbolUploader(name string, p SymbolUploaderParams) (SymbolUploader, error) {
+	if name == "" {
+		name = SymbolUploaderParca
+	}
+
+	symbolUploadersMu.RLock()
+	factory, ok := symbolUploaders[name]
+	names := make([]string, 0, len(symbolUploaders))
+	for n := range symbolUploaders {
+		names = append(names, n)
+	}
+	symbolUploadersMu.RUnlock()
+
+	if !ok {
+		sort.Strings(names)
+		return nil, fmt.Errorf("%w %q, expected one of %s",
+			errUnknownSymbolUploader, name, strings.Join(names, ", "))
+	}
+	return factory(p)
+}
+
+// startSymbolUploader creates the SymbolUploader registered under name like
+// newSymbolUploader. As profiles are reported without the symbol upload, an
+// uploader that fails to start, e.g. as the cache directory is not writable, is
+// replaced with a no-op uploader. Only an unknown name is returned as error.
+func startSymbolUploader(name string, p SymbolUploaderParams) (SymbolUploader, error) {
+	uploader, err := newSymbolUploader(name, p)
+	if errors.Is(err, errUnknownSymbolUploader) {
+		return nil, err
+	}
+	if err != nil {
+		log.Warnf("Symbol upload is disabled, as the symbol uploader failed to start: %v", err)
+		return NewNoopSymbolUploader(), nil
+	}
+	return uploader, nil
+}
+
+// multiSymbolUploader passes every executable to all of its uploaders.
+type multiSymbolUploader []SymbolUploader
+
+func (m multiSymbolUploader) Upload(ctx context.Context, fileID libpf.FileID,
+	fileName, buildID string) {
+	for _, u := range m {
+		u.Upload(ctx, fileID, fileName, buildID)
+	}
+}
+
+// newParcaSymbolUploader creates an uploader for every collector connection.
+func newParcaSymbolUploader(p SymbolUploaderParams) (SymbolUploader, error) {
+	conns := p.Conns
+	if len(conns) == 0 && p.Conn != nil {
+		conns = []*grpc.ClientConn{p.Conn}
+	}
+	if len(conns) == 0 {
+		log.Warnf("Symbol upload requires the %s protocol and is disabled", OTLPProtocolGRPC)
+		return NewNoopSymbolUploader(), nil
+	}
+
+	uploaders := make(multiSymbolUploader, 0, len(conns))
+	for _, conn := range conns {
+		u, err := symuploader.NewParcaSymbolUploader(
+			v1alpha1.NewDebuginfoServiceClient(conn),
+			p.CacheSize,
+			p.Config.NoExtractDebuginfo,
+			p.Config.ExtractDebuginfoMinSize,
+			p.Config.StreamDebuginfo,
+			p.Config.CompressDebuginfoCache,
+			p.Config.ResumableUploadChunkSize,
+			p.Config.UploadVerifyETag,
+			p.PathFilter,
+		)
+		if err != nil {
+			return nil, err
+		}
+		uploaders = append(uploaders, u)
+	}
+	if len(uploaders) == 1 {
+		return uploaders[0], nil
+	}
+	return uploaders, nil
+}
+
+func newHTTPSymbolUploader(p SymbolUploaderParams) (SymbolUploader, error) {
+	if p.Config.SymbolUploadURL == "" {
+		return nil, fmt.Errorf("the %s symbol uploader requires an upload URL",
+			SymbolUploaderHTTP)
+	}
+	return symuploader.NewHTTPSymbolUploader(
+		http.DefaultClient,
+		p.Config.SymbolUploadURL,
+		p.CacheSize,
+		p.Config.NoExtractDebuginfo,
+		p.Config.ExtractDebuginfoMinSize,
+		p.PathFilter,
+	)
+}
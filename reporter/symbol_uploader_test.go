@@ -0,0 +1,156 @@
+/*
+ * Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+ * or more contributor license agreements. Licensed under the Apache License 2.0.
+ * See the file "LICENSE" for details.
+ */
+
+package reporter
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/elastic/otel-profiling-agent/config"
+	"github.com/elastic/otel-profiling-agent/libpf"
+	"github.com/elastic/otel-profiling-agent/symuploader"
+)
+
+// fakeSymbolUploader records the uploaded file names.
+type fakeSymbolUploader struct {
+	params   SymbolUploaderParams
+	uploaded []string
+}
+
+func (f *fakeSymbolUploader) Upload(_ context.Context, _ libpf.FileID, fileName, _ string) {
+	f.uploaded = append(f.uploaded, fileName)
+}
+
+func TestRegisterSymbolUploader(t *testing.T) {
+	fake := &fakeSymbolUploader{}
+	RegisterSymbolUploader("fake", func(p SymbolUploaderParams) (SymbolUploader, error) {
+		fake.params = p
+		return fake, nil
+	})
+
+	c := &Config{SymbolUploader: "fake"}
+	filter, err := symuploader.NewPathFilter(nil, nil, nil, nil)
+	require.NoError(t, err)
+	uploader, err := newSymbolUploader(c.SymbolUploader, SymbolUploaderParams{
+		Config:     c,
+		CacheSize:  16,
+		PathFilter: filter,
+	})
+	require.NoError(t, err)
+	require.Same(t, fake, uploader)
+	assert.Same(t, c, fake.params.Config)
+	assert.Equal(t, 16, fake.params.CacheSize)
+	assert.Same(t, filter, fake.params.PathFilter)
+
+	uploader.Upload(context.Background(), libpf.NewFileID(1, 2), "/usr/bin/fake", "abc")
+	assert.Equal(t, []string{"/usr/bin/fake"}, fake.uploaded)
+}
+
+func TestNewSymbolUploader(t *testing.T) {
+	tests := map[string]struct {
+		config  Config
+		wantErr bool
+	}{
+		// Without a gRPC connection the Parca uploader is disabled.
+		"default": {},
+		"parca":   {config: Config{SymbolUploader: SymbolUploaderParca}},
+		"http": {config: Config{
+			SymbolUploader:  SymbolUploaderHTTP,
+			SymbolUploadURL: "http://localhost:8080/symbols",
+		}},
+		"httpNoURL": {config: Config{SymbolUploader: SymbolUploaderHTTP}, wantErr: true},
+		"httpInvalidURL": {
+			config:  Config{SymbolUploader: SymbolUploaderHTTP, SymbolUploadURL: "symbols"},
+			wantErr: true,
+		},
+		"unknown": {config: Config{SymbolUploader: "s3"}, wantErr: true},
+	}
+	// The HTTP uploader extracts debuginfo to the cache directory.
+	require.NoError(t, config.SetConfiguration(&config.Config{
+		ProjectID:        1,
+		SecretToken:      "secret",
+		CacheDirectory:   t.TempDir(),
+		SamplesPerSecond: 20,
+	}))
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			uploader, err := newSymbolUploader(tc.config.SymbolUploader, SymbolUploaderParams{
+				Config:    &tc.config,
+				CacheSize: 16,
+			})
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.NotNil(t, uploader)
+		})
+	}
+}
+
+func TestStartOTLPUnwritableCacheDirectory(t *testing.T) {
+	// A file in place of the cache directory can't be written to, even by root.
+	cacheDir := filepath.Join(t.TempDir(), "cache")
+	require.NoError(t, os.WriteFile(cacheDir, nil, 0o644))
+	require.NoError(t, config.SetConfiguration(&config.Config{
+		ProjectID:        1,
+		SecretToken:      "secret",
+		CacheDirectory:   cacheDir,
+		SamplesPerSecond: 20,
+		ReportInterval:   time.Hour,
+		UploadSymbols:    true,
+		// StartOTLP requires a host ID.
+		EnvironmentType: "hardware",
+		MachineID:       "0x1234",
+	}))
+
+	conn, err := grpc.Dial("localhost:0",
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	// The Parca uploader, but with a connection that is independent of the
+	// protocol the profiles are reported with.
+	RegisterSymbolUploader("unwritable", func(p SymbolUploaderParams) (SymbolUploader, error) {
+		p.Conns = []*grpc.ClientConn{conn}
+		return newParcaSymbolUploader(p)
+	})
+	c := &Config{
+		OTLPProtocol:   OTLPProtocolFile,
+		OTLPFile:       filepath.Join(t.TempDir(), "profiles.jsonl"),
+		SymbolUploader: "unwritable",
+		Times:          config.GetTimes(),
+	}
+
+	_, err = newSymbolUploader(c.SymbolUploader, SymbolUploaderParams{
+		Config:    c,
+		CacheSize: 16,
+	})
+	require.Error(t, err)
+
+	// The agent still starts and reports profiles, without the symbol upload.
+	rep, err := StartOTLP(context.Background(), c)
+	require.NoError(t, err)
+	defer rep.Stop()
+	r, ok := rep.(*OTLPReporter)
+	require.True(t, ok)
+	assert.IsType(t, NewNoopSymbolUploader(), r.symuploader)
+
+	// A misspelled uploader is still rejected.
+	c.SymbolUploader = "parac"
+	_, err = StartOTLP(context.Background(), c)
+	require.ErrorIs(t, err, errUnknownSymbolUploader)
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+ * or more contributor license agreements. Licensed under the Apache License 2.0.
+ * See the file "LICENSE" for details.
+ */
+
+package reporter
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/otel-profiling-agent/libpf"
+)
+
+// LoadSymbols fills the frames cache for the executable fileID with symbols
+// from rd, so that frames of executables that were symbolized offline are
+// resolved without waiting for their frame metadata.
+//
+// Every line of rd holds the address, function name, source file and source
+// line of a frame, separated by tabs. The address is hexadecimal, with or
+// without 0x prefix. Empty lines and lines starting with '#' are skipped.
+// If rd is malformed, an error with the line number is returned and the cache
+// is left unchanged.
+func (r *OTLPReporter) LoadSymbols(fileID libpf.FileID, rd io.Reader) error {
+	symbols, err := parseSymbols(rd)
+	if err != nil {
+		return err
+	}
+	if len(symbols) == 0 {
+		return nil
+	}
+
+	r.framesMu.Lock()
+	defer r.framesMu.Unlock()
+
+	if v, exists := r.frames.Get(fileID); exists {
+		for addr, si := range symbols {
+			v[addr] = si
+		}
+		return nil
+	}
+	r.frames.Add(fileID, symbols)
+	return nil
+}
+
+// parseSymbols parses the symbols of the format that LoadSymbols reads.
+func parseSymbols(rd io.Reader) (map[libpf.AddressOrLineno]sourceInfo, error) {
+	symbols := make(map[libpf.AddressOrLineno]sourceInfo)
+	scanner := bufio.NewScanner(rd)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		addr, si, err := parseSymbol(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid symbol on line %d: %v", lineNo, err)
+		}
+		symbols[addr] = si
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read symbols: %v", err)
+	}
+	return symbols, nil
+}
+
+// parseSymbol parses a single line of the format that LoadSymbols reads.
+func parseSymbol(line string) (libpf.AddressOrLineno, sourceInfo, error) {
+	fields := strings.Split(line, "\t")
+	if len(fields) != 4 {
+		return 0, sourceInfo{}, fmt.Errorf("expected 4 tab separated fields, got %d",
+			len(fields))
+	}
+
+	addr, err := strconv.ParseUint(strings.TrimPrefix(fields[0], "0x"), 16, 64)
+	if err != nil {
+		return 0, sourceInfo{}, fmt.Errorf("invalid address %q", fields[0])
+	}
+	if fields[1] == "" {
+		return 0, sourceInfo{}, errors.New("empty function name")
+	}
+	lineNumber, err := strconv.ParseUint(fields[3], 10, 64)
+	if err != nil {
+		return 0, sourceInfo{}, fmt.Errorf("invalid source line %q", fields[3])
+	}
+
+	return libpf.AddressOrLineno(addr), sourceInfo{
+		functionName: fields[1],
+		filePath:     fields[2],
+		lineNumber:   libpf.SourceLineno(lineNumber),
+	}, nil
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+ * or more contributor license agreements. Licensed under the Apache License 2.0.
+ * See the file "LICENSE" for details.
+ */
+
+package reporter
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/otel-profiling-agent/libpf"
+)
+
+func TestLoadSymbols(t *testing.T) {
+	r := newTestOTLPReporter(t)
+	fileID := libpf.NewFileID(1, 2)
+
+	// Symbols reported before are kept, unless the file holds the same address.
+	r.ReportFrameMetadata(&libpf.FrameMetadata{
+		FileID:        fileID,
+		AddressOrLine: 0x2000,
+		FunctionName:  "reported",
+		LineNumber:    3,
+	})
+
+	f, err := os.Open("testdata/symbols.txt")
+	require.NoError(t, err)
+	defer f.Close()
+	require.NoError(t, r.LoadSymbols(fileID, f))
+
+	frames, ok := r.frames.Get(fileID)
+	require.True(t, ok)
+	assert.Equal(t, map[libpf.AddressOrLineno]sourceInfo{
+		0x1040: {functionName: "main", filePath: "/src/main.c", lineNumber: 12},
+		0x1080: {functionName: "compute(int, int)", filePath: "/src/compute.cc", lineNumber: 40},
+		0x10c0: {functionName: "helper", filePath: "/src/helper.c", lineNumber: 7},
+		0x2000: {functionName: "reported", lineNumber: 3},
+	}, frames)
+
+	// Traces resolve from the loaded symbols.
+	trace := &libpf.Trace{Hash: libpf.NewTraceHash(3, 4)}
+	trace.AppendFrame(libpf.PythonFrame, fileID, 0x1080)
+	r.ReportFramesForTrace(trace)
+	r.ReportCountForTrace(trace.Hash, libpf.UnixTime64(1710000000e9), 1, "comm", "", "", "", "", "")
+	profile, _, _ := r.getProfile()
+	require.Len(t, profile.Sample, 1)
+	locs := sampleLocations(profile, profile.Sample[0])
+	require.Len(t, locs, 1)
+	assert.Equal(t, []string{"compute(int, int)"}, functionNames(profile, locs[0]))
+}
+
+func TestLoadSymbolsMalformed(t *testing.T) {
+	tests := map[string]struct {
+		symbols string
+		err     string
+	}{
+		"missing field": {
+			symbols: "0x10\tmain\t/src/main.c\t1\n0x20\tfoo\t/src/foo.c\n",
+			err:     "line 2: expected 4 tab separated fields, got 3",
+		},
+		"invalid address": {
+			symbols: "# comment\n\nzz\tmain\t/src/main.c\t1\n",
+			err:     `line 3: invalid address "zz"`,
+		},
+		"empty function": {
+			symbols: "0x10\t\t/src/main.c\t1\n",
+			err:     "line 1: empty function name",
+		},
+		"invalid line": {
+			symbols: "0x10\tmain\t/src/main.c\t-1\n",
+			err:     `line 1: invalid source line "-1"`,
+		},
+	}
+
+	for name, tc := range tests {
+		name := name
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			r := newTestOTLPReporter(t)
+			fileID := libpf.NewFileID(1, 2)
+
+			err := r.LoadSymbols(fileID, strings.NewReader(tc.symbols))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.err)
+			// Nothing is loaded from malformed files.
+			assert.Zero(t, r.frames.Len())
+		})
+	}
+}
@@ -0,0 +1,108 @@
+/*
+ * Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+ * or more contributor license agreements. Licensed under the Apache License 2.0.
+ * See the file "LICENSE" for details.
+ */
+
+package reporter
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/elastic/otel-profiling-agent/libpf"
+)
+
+// tenantAttributeKey is the resource attribute that holds the tenant of a profile.
+const tenantAttributeKey = "tenant.id"
+
+// tenantRegexGroup is the name of the capture group that holds the tenant if
+// a regular expression on the pod name defines more than one group.
+const tenantRegexGroup = "tenant"
+
+// tenantResolver derives the tenant of a sample from the Kubernetes namespace
+// and pod name of its trace.
+type tenantResolver struct {
+	// namespaces maps a namespace to its tenant.
+	namespaces map[string]string
+
+	// podName extracts the tenant from the pod name, if set.
+	podName *regexp.Regexp
+	// podNameGroup is the index of the capture group of podName that
+	// holds the tenant.
+	podNameGroup int
+}
+
+// newTenantResolver returns a resolver that looks up the tenant of a namespace in
+// namespaces first, and otherwise extracts it from the pod name with podNameRegex.
+// If podNameRegex has more than one capture group, the tenant is taken from the
+// group named "tenant", otherwise from the only group. It returns nil if no
+// rules are given.
+func newTenantResolver(namespaces map[string]string,
+	podNameRegex string) (*tenantResolver, error) {
+	if len(namespaces) == 0 && podNameRegex == "" {
+		return nil, nil
+	}
+
+	t := &tenantResolver{namespaces: namespaces}
+	if podNameRegex == "" {
+		return t, nil
+	}
+
+	re, err := regexp.Compile(podNameRegex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tenant pod name regex: %v", err)
+	}
+	switch re.NumSubexp() {
+	case 0:
+		return nil, fmt.Errorf("tenant pod name regex %q has no capture group", podNameRegex)
+	case 1:
+		t.podNameGroup = 1
+	default:
+		t.podNameGroup = re.SubexpIndex(tenantRegexGroup)
+		if t.podNameGroup < 0 {
+			return nil, fmt.Errorf("tenant pod name regex %q has no capture group named %q",
+				podNameRegex, tenantRegexGroup)
+		}
+	}
+	t.podName = re
+
+	return t, nil
+}
+
+// resolve returns the tenant for a trace of the given namespace and pod, or an
+// empty string if no rule matches.
+func (t *tenantResolver) resolve(podNamespace, podName string) string {
+	if tenant, ok := t.namespaces[podNamespace]; ok && podNamespace != "" {
+		return tenant
+	}
+	if t.podName == nil || podName == "" {
+		return ""
+	}
+	if m := t.podName.FindStringSubmatch(podName); m != nil {
+		return m[t.podNameGroup]
+	}
+	return ""
+}
+
+// partitionByTenant splits samples by the tenant of their trace. If no tenant
+// rules are configured, all samples are returned for the empty tenant.
+func (r *OTLPReporter) partitionByTenant(
+	samples map[libpf.TraceHash]sample) map[string]map[libpf.TraceHash]sample {
+	if r.tenants == nil {
+		return map[string]map[libpf.TraceHash]sample{"": samples}
+	}
+
+	partitions := make(map[string]map[libpf.TraceHash]sample)
+	for hash, s := range samples {
+		var tenant string
+		if trace, ok := r.traces.Peek(hash); ok {
+			tenant = r.tenants.resolve(trace.podNamespace, trace.podName)
+		}
+		if partitions[tenant] == nil {
+			partitions[tenant] = make(map[libpf.TraceHash]sample)
+		}
+		partitions[tenant][hash] = s
+	}
+	return partitions
+}
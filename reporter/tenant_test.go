@@ -0,0 +1,125 @@
+/*
+ * Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+ * or more contributor license agreements. Licensed under the Apache License 2.0.
+ * See the file "LICENSE" for details.
+ */
+
+package reporter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/otel-profiling-agent/libpf"
+)
+
+func TestNewTenantResolver(t *testing.T) {
+	tests := map[string]struct {
+		namespaces   map[string]string
+		podNameRegex string
+		wantNil      bool
+		wantErr      bool
+	}{
+		"disabled":       {wantNil: true},
+		"namespacesOnly": {namespaces: map[string]string{"a": "b"}},
+		"singleGroup":    {podNameRegex: `^([a-z]+)-`},
+		"namedGroup":     {podNameRegex: `^(env)-(?P<tenant>[a-z]+)-`},
+		"invalidRegex":   {podNameRegex: `(`, wantErr: true},
+		"noGroup":        {podNameRegex: `^[a-z]+-`, wantErr: true},
+		"noNamedGroup":   {podNameRegex: `^([a-z]+)-([a-z]+)-`, wantErr: true},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			resolver, err := newTenantResolver(tc.namespaces, tc.podNameRegex)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantNil, resolver == nil)
+		})
+	}
+}
+
+func TestTenantResolverResolve(t *testing.T) {
+	resolver, err := newTenantResolver(map[string]string{
+		"billing":  "team-billing",
+		"frontend": "team-web",
+	}, `^(?P<env>prod|dev)-(?P<tenant>[a-z]+)-`)
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		podNamespace string
+		podName      string
+		want         string
+	}{
+		"namespace":            {podNamespace: "billing", podName: "invoice-7d9f", want: "team-billing"},
+		"namespaceOverPodName": {podNamespace: "frontend", podName: "prod-shop-1", want: "team-web"},
+		"podName":              {podNamespace: "default", podName: "prod-shop-1", want: "shop"},
+		"podNameNoNamespace":   {podName: "dev-search-2", want: "search"},
+		"noMatch":              {podNamespace: "default", podName: "nginx-1", want: ""},
+		"noPod":                {},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.want, resolver.resolve(tc.podNamespace, tc.podName))
+		})
+	}
+}
+
+func TestPartitionByTenant(t *testing.T) {
+	r := newTestOTLPReporter(t)
+
+	pods := []struct{ name, namespace string }{
+		{"shop-1", "frontend"},
+		{"shop-2", "frontend"},
+		{"invoice-1", "billing"},
+		{"", ""},
+	}
+	for i, pod := range pods {
+		trace := &libpf.Trace{Hash: libpf.NewTraceHash(uint64(i), 0)}
+		trace.AppendFrame(libpf.KernelFrame, libpf.NewFileID(3, 4), 5)
+		r.ReportFramesForTrace(trace)
+		r.ReportCountForTrace(trace.Hash, libpf.UnixTime64(1710000000e9), 1,
+			"comm", pod.name, pod.namespace, "", "", "")
+	}
+
+	// Without tenant rules all samples belong to the empty tenant.
+	partitions := r.partitionByTenant(r.collectSamples())
+	require.Len(t, partitions, 1)
+	assert.Len(t, partitions[""], len(pods))
+
+	for i := range pods {
+		r.ReportCountForTrace(libpf.NewTraceHash(uint64(i), 0),
+			libpf.UnixTime64(1710000001e9), 1, "comm", pods[i].name, pods[i].namespace, "", "", "")
+	}
+	tenants, err := newTenantResolver(map[string]string{"frontend": "web"}, `^([a-z]+)-`)
+	require.NoError(t, err)
+	r.tenants = tenants
+
+	partitions = r.partitionByTenant(r.collectSamples())
+	require.Len(t, partitions, 3)
+	assert.Len(t, partitions["web"], 2)
+	assert.Len(t, partitions["invoice"], 1)
+	assert.Len(t, partitions[""], 1)
+
+	for tenant, samples := range partitions {
+		profile, startTS, endTS := r.buildProfile(samples)
+		rp := r.getResourceProfiles(tenant, profile, startTS, endTS, 0)
+
+		var got string
+		for _, attr := range rp.Resource.Attributes {
+			if attr.Key == tenantAttributeKey {
+				got = attr.Value.GetStringValue()
+			}
+		}
+		assert.Equal(t, tenant, got)
+		assert.Len(t, rp.ScopeProfiles[0].Profiles[0].Profile.Sample, len(samples))
+	}
+}
@@ -0,0 +1,152 @@
+/*
+ * Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+ * or more contributor license agreements. Licensed under the Apache License 2.0.
+ * See the file "LICENSE" for details.
+ */
+
+package reporter
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+
+	"github.com/elastic/otel-profiling-agent/debug/log"
+)
+
+// newTLSConfig returns the TLS configuration for the connection to the collector
+// described by c. It returns nil if TLS is disabled.
+// The client certificate and the CA file are re-read on every handshake, so that
+// rotated credentials are used for new connections without restarting the agent.
+func newTLSConfig(c *Config) (*tls.Config, error) {
+	if c.DisableTLS {
+		if c.TLSCAFile != "" || c.TLSCertFile != "" || c.TLSKeyFile != "" ||
+			c.TLSServerName != "" || c.TLSInsecureSkipVerify {
+			return nil, errors.New("TLS options can not be used when TLS is disabled")
+		}
+		return nil, nil
+	}
+
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		return nil, errors.New("mTLS requires both a client certificate and a client key")
+	}
+
+	tlsConfig := &tls.Config{
+		// Support only TLS1.3+ with valid CA certificates
+		MinVersion:         tls.VersionTLS13,
+		ServerName:         c.TLSServerName,
+		InsecureSkipVerify: c.TLSInsecureSkipVerify, //nolint:gosec
+	}
+
+	// Load the credentials once up front, so that invalid files are reported
+	// on startup and not only on the first handshake.
+	creds := &reloadingCredentials{
+		caFile:   c.TLSCAFile,
+		certFile: c.TLSCertFile,
+		keyFile:  c.TLSKeyFile,
+	}
+
+	if c.TLSCAFile != "" {
+		pool, err := creds.loadCA()
+		if err != nil {
+			return nil, err
+		}
+		creds.pool.Store(pool)
+
+		if !c.TLSInsecureSkipVerify {
+			// The default verification uses RootCAs, which can not be replaced on
+			// rotation. Therefore the built-in verification is skipped and the
+			// server certificate is verified against the current CA pool instead.
+			tlsConfig.InsecureSkipVerify = true //nolint:gosec
+			tlsConfig.VerifyConnection = creds.verifyConnection
+		}
+	}
+
+	if c.TLSCertFile != "" {
+		cert, err := creds.loadCertificate()
+		if err != nil {
+			return nil, err
+		}
+		creds.cert.Store(cert)
+		tlsConfig.GetClientCertificate = creds.getClientCertificate
+	}
+
+	return tlsConfig, nil
+}
+
+// reloadingCredentials holds the CA pool and the client certificate for the
+// connection to the collector and re-reads them from disk on every handshake.
+// If the files can not be read, e.g. while they are being rotated, the last
+// valid credentials are used.
+type reloadingCredentials struct {
+	caFile   string
+	certFile string
+	keyFile  string
+
+	pool atomic.Pointer[x509.CertPool]
+	cert atomic.Pointer[tls.Certificate]
+}
+
+// loadCA returns the certificates of caFile as pool.
+func (rc *reloadingCredentials) loadCA() (*x509.CertPool, error) {
+	caPEM, err := os.ReadFile(rc.caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA file: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no valid certificates found in CA file %s", rc.caFile)
+	}
+	return pool, nil
+}
+
+// loadCertificate returns the client certificate of certFile and keyFile.
+func (rc *reloadingCredentials) loadCertificate() (*tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(rc.certFile, rc.keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load client certificate: %v", err)
+	}
+	return &cert, nil
+}
+
+// getClientCertificate implements tls.Config.GetClientCertificate.
+func (rc *reloadingCredentials) getClientCertificate(
+	_ *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	cert, err := rc.loadCertificate()
+	if err != nil {
+		log.Warnf("Using previous client certificate: %v", err)
+		return rc.cert.Load(), nil
+	}
+	rc.cert.Store(cert)
+	return cert, nil
+}
+
+// verifyConnection implements tls.Config.VerifyConnection and verifies the
+// certificate chain of the server against the current CA pool.
+func (rc *reloadingCredentials) verifyConnection(cs tls.ConnectionState) error {
+	pool, err := rc.loadCA()
+	if err != nil {
+		log.Warnf("Using previous CA certificates: %v", err)
+		pool = rc.pool.Load()
+	} else {
+		rc.pool.Store(pool)
+	}
+
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("server did not provide a certificate")
+	}
+
+	opts := x509.VerifyOptions{
+		DNSName:       cs.ServerName,
+		Roots:         pool,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err = cs.PeerCertificates[0].Verify(opts)
+	return err
+}
@@ -0,0 +1,208 @@
+/*
+ * Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+ * or more contributor license agreements. Licensed under the Apache License 2.0.
+ * See the file "LICENSE" for details.
+ */
+
+package reporter
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestCertificate writes a self-signed certificate and its key as PEM files
+// into dir and returns their paths.
+func writeTestCertificate(t *testing.T, dir string) (certFile, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "otel-profiling-agent"},
+		DNSNames:              []string{"localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile,
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certFile, keyFile
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTestCertificate(t, dir)
+	invalidFile := filepath.Join(dir, "invalid.pem")
+	require.NoError(t, os.WriteFile(invalidFile, []byte("invalid"), 0o600))
+
+	tests := map[string]struct {
+		config  Config
+		wantErr bool
+		wantNil bool
+	}{
+		"disabled": {
+			config:  Config{DisableTLS: true},
+			wantNil: true,
+		},
+		"disabled with TLS options": {
+			config:  Config{DisableTLS: true, TLSCAFile: certFile},
+			wantErr: true,
+		},
+		"default": {
+			config: Config{},
+		},
+		"custom CA and server name": {
+			config: Config{TLSCAFile: certFile, TLSServerName: "collector.example.com"},
+		},
+		"mTLS": {
+			config: Config{TLSCAFile: certFile, TLSCertFile: certFile, TLSKeyFile: keyFile},
+		},
+		"cert without key": {
+			config:  Config{TLSCertFile: certFile},
+			wantErr: true,
+		},
+		"key without cert": {
+			config:  Config{TLSKeyFile: keyFile},
+			wantErr: true,
+		},
+		"missing CA file": {
+			config:  Config{TLSCAFile: filepath.Join(dir, "missing.pem")},
+			wantErr: true,
+		},
+		"invalid CA file": {
+			config:  Config{TLSCAFile: invalidFile},
+			wantErr: true,
+		},
+		"invalid key pair": {
+			config:  Config{TLSCertFile: certFile, TLSKeyFile: invalidFile},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			tlsConfig, err := newTLSConfig(&tc.config)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			if tc.wantNil {
+				assert.Nil(t, tlsConfig)
+				return
+			}
+			require.NotNil(t, tlsConfig)
+
+			assert.Equal(t, tc.config.TLSServerName, tlsConfig.ServerName)
+			assert.Equal(t, tc.config.TLSCAFile != "", tlsConfig.VerifyConnection != nil)
+			assert.Equal(t, tc.config.TLSCertFile != "", tlsConfig.GetClientCertificate != nil)
+		})
+	}
+}
+
+// handshake performs a TLS handshake between a client using clientConfig and a
+// server presenting the certificate of certFile and keyFile.
+func handshake(t *testing.T, clientConfig *tls.Config, certFile, keyFile string) error {
+	t.Helper()
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	require.NoError(t, err)
+
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	server := tls.Server(serverConn, &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequestClientCert,
+		MinVersion:   tls.VersionTLS13,
+	})
+	go func() {
+		// The result of the handshake is checked on the client side.
+		_ = server.Handshake()
+	}()
+
+	return tls.Client(clientConn, clientConfig).Handshake()
+}
+
+func TestTLSConfigRotation(t *testing.T) {
+	dir := t.TempDir()
+	oldCert, oldKey := writeTestCertificate(t, t.TempDir())
+	newCert, newKey := writeTestCertificate(t, t.TempDir())
+
+	copyFile := func(dst, src string) {
+		data, err := os.ReadFile(src)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(dst, data, 0o600))
+	}
+
+	caFile := filepath.Join(dir, "ca.pem")
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	copyFile(caFile, oldCert)
+	copyFile(certFile, oldCert)
+	copyFile(keyFile, oldKey)
+
+	tlsConfig, err := newTLSConfig(&Config{
+		TLSCAFile:     caFile,
+		TLSCertFile:   certFile,
+		TLSKeyFile:    keyFile,
+		TLSServerName: "localhost",
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, handshake(t, tlsConfig, oldCert, oldKey))
+	assert.Error(t, handshake(t, tlsConfig, newCert, newKey))
+
+	clientCert, err := tlsConfig.GetClientCertificate(nil)
+	require.NoError(t, err)
+	oldLeaf := clientCert.Certificate[0]
+
+	// Rotate the credentials on disk.
+	copyFile(caFile, newCert)
+	copyFile(certFile, newCert)
+	copyFile(keyFile, newKey)
+
+	assert.Error(t, handshake(t, tlsConfig, oldCert, oldKey))
+	require.NoError(t, handshake(t, tlsConfig, newCert, newKey))
+
+	clientCert, err = tlsConfig.GetClientCertificate(nil)
+	require.NoError(t, err)
+	assert.NotEqual(t, oldLeaf, clientCert.Certificate[0])
+
+	// Broken files during a rotation do not replace the last valid credentials.
+	require.NoError(t, os.WriteFile(caFile, []byte("invalid"), 0o600))
+	require.NoError(t, os.WriteFile(certFile, []byte("invalid"), 0o600))
+	require.NoError(t, handshake(t, tlsConfig, newCert, newKey))
+	clientCert, err = tlsConfig.GetClientCertificate(nil)
+	require.NoError(t, err)
+	assert.NotNil(t, clientCert)
+}
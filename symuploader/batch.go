@@ -0,0 +1,172 @@
+package symuploader
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/elastic/otel-profiling-agent/debug/log"
+	v1alpha1 "github.com/elastic/otel-profiling-agent/proto/experiments/parca/debuginfo/v1alpha1"
+)
+
+const (
+	// shouldInitiateUploadWindow is the time newly seen build IDs are
+	// accumulated before they are checked with a single RPC.
+	shouldInitiateUploadWindow = 100 * time.Millisecond
+
+	// maxShouldInitiateUploadBatchSize is the maximum number of build IDs
+	// that are checked with a single RPC.
+	maxShouldInitiateUploadBatchSize = 128
+
+	// shouldInitiateUploadTimeout bounds the RPCs of a batch, which are not
+	// bound by the contexts of the callers that wait for them.
+	shouldInitiateUploadTimeout = 30 * time.Second
+)
+
+// shouldInitiateUploadResult is the outcome of a ShouldInitiateUpload check.
+type shouldInitiateUploadResult struct {
+	resp *v1alpha1.ShouldInitiateUploadResponse
+	err  error
+}
+
+// pendingShouldInitiateUpload is a ShouldInitiateUpload check waiting to be sent.
+type pendingShouldInitiateUpload struct {
+	req  *v1alpha1.ShouldInitiateUploadRequest
+	done chan shouldInitiateUploadResult
+}
+
+// shouldInitiateUploadBatcher accumulates ShouldInitiateUpload checks and sends
+// them with a single ShouldInitiateUploads RPC. If the backend does not support
+// the batched RPC, it falls back to concurrent ShouldInitiateUpload RPCs, one per
+// check.
+type shouldInitiateUploadBatcher struct {
+	client v1alpha1.DebuginfoServiceClient
+
+	// ctx is the parent of the RPCs of a batch. A batch serves many callers, so
+	// the context of the caller that happened to start it must not cancel it.
+	ctx context.Context
+
+	window       time.Duration
+	maxBatchSize int
+
+	// unsupported is set once the backend signaled that it does not
+	// implement ShouldInitiateUploads.
+	unsupported atomic.Bool
+
+	mu      sync.Mutex
+	pending []pendingShouldInitiateUpload
+	timer   *time.Timer
+}
+
+func newShouldInitiateUploadBatcher(client v1alpha1.DebuginfoServiceClient,
+	window time.Duration, maxBatchSize int) *shouldInitiateUploadBatcher {
+	return &shouldInitiateUploadBatcher{
+		client:       client,
+		ctx:          context.Background(),
+		window:       window,
+		maxBatchSize: maxBatchSize,
+	}
+}
+
+// ShouldInitiateUpload queues req for the next batch and waits for its response.
+func (b *shouldInitiateUploadBatcher) ShouldInitiateUpload(ctx context.Context,
+	req *v1alpha1.ShouldInitiateUploadRequest) (*v1alpha1.ShouldInitiateUploadResponse, error) {
+	if b.unsupported.Load() {
+		return b.client.ShouldInitiateUpload(ctx, req)
+	}
+
+	done := make(chan shouldInitiateUploadResult, 1)
+
+	b.mu.Lock()
+	b.pending = append(b.pending, pendingShouldInitiateUpload{req: req, done: done})
+	switch {
+	case len(b.pending) >= b.maxBatchSize:
+		if b.timer != nil {
+			b.timer.Stop()
+			b.timer = nil
+		}
+		batch := b.pending
+		b.pending = nil
+		go b.send(batch)
+	case len(b.pending) == 1:
+		b.timer = time.AfterFunc(b.window, b.flush)
+	}
+	b.mu.Unlock()
+
+	select {
+	case res := <-done:
+		return res.resp, res.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// flush sends all pending checks.
+func (b *shouldInitiateUploadBatcher) flush() {
+	b.mu.Lock()
+	batch := b.pending
+	b.pending = nil
+	b.timer = nil
+	b.mu.Unlock()
+
+	b.send(batch)
+}
+
+// send checks batch with a single RPC if possible and delivers the results.
+func (b *shouldInitiateUploadBatcher) send(batch []pendingShouldInitiateUpload) {
+	if len(batch) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(b.ctx, shouldInitiateUploadTimeout)
+	defer cancel()
+
+	if len(batch) > 1 && !b.unsupported.Load() {
+		reqs := make([]*v1alpha1.ShouldInitiateUploadRequest, 0, len(batch))
+		for _, p := range batch {
+			reqs = append(reqs, p.req)
+		}
+
+		resp, err := b.client.ShouldInitiateUploads(ctx,
+			&v1alpha1.ShouldInitiateUploadsRequest{Requests: reqs})
+		switch {
+		case status.Code(err) == codes.Unimplemented:
+			log.Debugf("Backend does not support batched upload checks, " +
+				"falling back to individual checks")
+			b.unsupported.Store(true)
+		case err != nil:
+			for _, p := range batch {
+				p.done <- shouldInitiateUploadResult{err: err}
+			}
+			return
+		case len(resp.Responses) != len(batch):
+			err = fmt.Errorf("expected %d responses, got %d",
+				len(batch), len(resp.Responses))
+			for _, p := range batch {
+				p.done <- shouldInitiateUploadResult{err: err}
+			}
+			return
+		default:
+			for i, p := range batch {
+				p.done <- shouldInitiateUploadResult{resp: resp.Responses[i]}
+			}
+			return
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, p := range batch {
+		wg.Add(1)
+		go func(p pendingShouldInitiateUpload) {
+			defer wg.Done()
+			resp, err := b.client.ShouldInitiateUpload(ctx, p.req)
+			p.done <- shouldInitiateUploadResult{resp: resp, err: err}
+		}(p)
+	}
+	wg.Wait()
+}
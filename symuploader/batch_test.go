@@ -0,0 +1,202 @@
+package symuploader
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	v1alpha1 "github.com/elastic/otel-profiling-agent/proto/experiments/parca/debuginfo/v1alpha1"
+)
+
+// fakeDebuginfoClient answers upload checks with ShouldInitiateUpload set for
+// build IDs that start with "new".
+type fakeDebuginfoClient struct {
+	v1alpha1.DebuginfoServiceClient
+
+	batchUnsupported bool
+	// singleBarrier, if set, lets ShouldInitiateUpload calls only return once
+	// all calls it counts are in flight.
+	singleBarrier *sync.WaitGroup
+
+	singleCalls atomic.Int32
+	batchCalls  atomic.Int32
+}
+
+func fakeResponse(req *v1alpha1.ShouldInitiateUploadRequest) *v1alpha1.ShouldInitiateUploadResponse {
+	return &v1alpha1.ShouldInitiateUploadResponse{
+		ShouldInitiateUpload: len(req.BuildId) >= 3 && req.BuildId[:3] == "new",
+		Reason:               req.BuildId,
+	}
+}
+
+func (f *fakeDebuginfoClient) ShouldInitiateUpload(_ context.Context,
+	in *v1alpha1.ShouldInitiateUploadRequest, _ ...grpc.CallOption) (
+	*v1alpha1.ShouldInitiateUploadResponse, error) {
+	f.singleCalls.Add(1)
+	if f.singleBarrier != nil {
+		f.singleBarrier.Done()
+		f.singleBarrier.Wait()
+	}
+	return fakeResponse(in), nil
+}
+
+func (f *fakeDebuginfoClient) ShouldInitiateUploads(ctx context.Context,
+	in *v1alpha1.ShouldInitiateUploadsRequest, _ ...grpc.CallOption) (
+	*v1alpha1.ShouldInitiateUploadsResponse, error) {
+	f.batchCalls.Add(1)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if f.batchUnsupported {
+		return nil, status.Error(codes.Unimplemented, "unknown method")
+	}
+	resp := &v1alpha1.ShouldInitiateUploadsResponse{}
+	for _, req := range in.Requests {
+		resp.Responses = append(resp.Responses, fakeResponse(req))
+	}
+	return resp, nil
+}
+
+func TestShouldInitiateUploadBatcher(t *testing.T) {
+	tests := map[string]struct {
+		batchUnsupported bool
+		wantBatchCalls   int32
+		wantSingleCalls  int32
+	}{
+		"batched": {
+			wantBatchCalls:  1,
+			wantSingleCalls: 0,
+		},
+		"fallback": {
+			batchUnsupported: true,
+			wantBatchCalls:   1,
+			wantSingleCalls:  10,
+		},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			client := &fakeDebuginfoClient{batchUnsupported: tc.batchUnsupported}
+			b := newShouldInitiateUploadBatcher(client, 50*time.Millisecond, 128)
+
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				buildID := fmt.Sprintf("old%d", i)
+				if i%2 == 0 {
+					buildID = fmt.Sprintf("new%d", i)
+				}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					resp, err := b.ShouldInitiateUpload(context.Background(),
+						&v1alpha1.ShouldInitiateUploadRequest{BuildId: buildID})
+					if assert.NoError(t, err) {
+						// Every caller must receive the response for its build ID.
+						assert.Equal(t, buildID, resp.Reason)
+						assert.Equal(t, buildID[:3] == "new", resp.ShouldInitiateUpload)
+					}
+				}()
+			}
+			wg.Wait()
+
+			assert.Equal(t, tc.wantBatchCalls, client.batchCalls.Load())
+			assert.Equal(t, tc.wantSingleCalls, client.singleCalls.Load())
+
+			if tc.batchUnsupported {
+				// Once the backend signaled missing support, no further batches are attempted.
+				_, err := b.ShouldInitiateUpload(context.Background(),
+					&v1alpha1.ShouldInitiateUploadRequest{BuildId: "new"})
+				require.NoError(t, err)
+				assert.Equal(t, tc.wantBatchCalls, client.batchCalls.Load())
+			}
+		})
+	}
+}
+
+func TestShouldInitiateUploadBatcherMaxBatchSize(t *testing.T) {
+	client := &fakeDebuginfoClient{}
+	// The window is long enough that only a full batch triggers the RPC.
+	b := newShouldInitiateUploadBatcher(client, time.Hour, 4)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		buildID := fmt.Sprintf("new%d", i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := b.ShouldInitiateUpload(context.Background(),
+				&v1alpha1.ShouldInitiateUploadRequest{BuildId: buildID})
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(2), client.batchCalls.Load())
+	assert.Equal(t, int32(0), client.singleCalls.Load())
+}
+
+func TestShouldInitiateUploadBatcherCanceledCaller(t *testing.T) {
+	client := &fakeDebuginfoClient{}
+	b := newShouldInitiateUploadBatcher(client, 50*time.Millisecond, 128)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	canceled := make(chan error, 1)
+	go func() {
+		_, err := b.ShouldInitiateUpload(ctx,
+			&v1alpha1.ShouldInitiateUploadRequest{BuildId: "new0"})
+		canceled <- err
+	}()
+	require.Eventually(t, func() bool {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		return len(b.pending) == 1
+	}, time.Second, time.Millisecond)
+	cancel()
+	require.ErrorIs(t, <-canceled, context.Canceled)
+
+	// The batch that the canceled caller started still serves the others.
+	resp, err := b.ShouldInitiateUpload(context.Background(),
+		&v1alpha1.ShouldInitiateUploadRequest{BuildId: "new1"})
+	require.NoError(t, err)
+	assert.Equal(t, "new1", resp.Reason)
+	assert.Equal(t, int32(1), client.batchCalls.Load())
+}
+
+func TestShouldInitiateUploadBatcherConcurrentFallback(t *testing.T) {
+	const checks = 4
+
+	var barrier sync.WaitGroup
+	barrier.Add(checks)
+	client := &fakeDebuginfoClient{batchUnsupported: true, singleBarrier: &barrier}
+	b := newShouldInitiateUploadBatcher(client, time.Hour, checks)
+
+	// The checks of a batch only complete if they are sent concurrently.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var wg sync.WaitGroup
+	for i := 0; i < checks; i++ {
+		buildID := fmt.Sprintf("new%d", i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := b.ShouldInitiateUpload(ctx,
+				&v1alpha1.ShouldInitiateUploadRequest{BuildId: buildID})
+			if assert.NoError(t, err) {
+				assert.Equal(t, buildID, resp.Reason)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(checks), client.singleCalls.Load())
+}
@@ -0,0 +1,169 @@
+package symuploader
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/elastic/otel-profiling-agent/debug/log"
+)
+
+// runLockSuffix is the suffix of the lock file that marks the cache directory of
+// a running uploader. The directory has the name of the lock file without suffix.
+const runLockSuffix = ".lock"
+
+// runCacheDir is a directory below the shared cache directory that is owned by a
+// single uploader. Ownership is held with an exclusive lock on a lock file next
+// to the directory, so that concurrent agents that share the cache directory
+// only remove directories of uploaders that are no longer running.
+type runCacheDir struct {
+	path string
+	// lock holds the lock for as long as the uploader exists.
+	lock *os.File
+}
+
+// newRunCacheDir creates a new directory below root that is owned by the caller
+// and removes the directories of uploaders that are no longer running.
+func newRunCacheDir(root string) (*runCacheDir, error) {
+	if err := os.MkdirAll(root, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory (%s): %s", root, err)
+	}
+
+	lock, err := createRunLock(root)
+	if err != nil {
+		return nil, err
+	}
+
+	path := strings.TrimSuffix(lock.Name(), runLockSuffix)
+	if err := os.Mkdir(path, os.ModePerm); err != nil {
+		lock.Close()
+		os.Remove(lock.Name())
+		return nil, fmt.Errorf("failed to create cache directory (%s): %s", path, err)
+	}
+
+	if err := cleanRunCacheDirs(root, lock.Name()); err != nil {
+		log.Warnf("Failed to clean cache directory (%s): %v", root, err)
+	}
+
+	return &runCacheDir{path: path, lock: lock}, nil
+}
+
+// createRunLock creates and locks a new lock file in root.
+func createRunLock(root string) (*os.File, error) {
+	for {
+		lock, err := os.CreateTemp(root, "run-*"+runLockSuffix)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create lock file: %v", err)
+		}
+		if err := unix.Flock(int(lock.Fd()), unix.LOCK_EX|unix.LOCK_NB); err != nil {
+			lock.Close()
+			os.Remove(lock.Name())
+			if errors.Is(err, unix.EWOULDBLOCK) {
+				// Another agent considers the lock file stale and holds its
+				// lock to remove it.
+				continue
+			}
+			return nil, fmt.Errorf("failed to lock %s: %v", lock.Name(), err)
+		}
+
+		// Another agent could have considered the lock file stale and removed
+		// it before the lock was taken. In that case, the lock is worthless.
+		if sameFile(lock) {
+			return lock, nil
+		}
+		lock.Close()
+	}
+}
+
+// sameFile returns whether the name of f still refers to f.
+func sameFile(f *os.File) bool {
+	opened, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	current, err := os.Stat(f.Name())
+	if err != nil {
+		return false
+	}
+	return os.SameFile(opened, current)
+}
+
+// cleanRunCacheDirs removes the content of root that does not belong to a running
+// uploader. ownLock is the lock file of the caller.
+func cleanRunCacheDirs(root, ownLock string) error {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return err
+	}
+
+	locks := make(map[string]bool)
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), runLockSuffix) {
+			locks[strings.TrimSuffix(entry.Name(), runLockSuffix)] = true
+		}
+	}
+
+	var errs []error
+	for _, entry := range entries {
+		path := filepath.Join(root, entry.Name())
+		switch {
+		case path == ownLock || path == strings.TrimSuffix(ownLock, runLockSuffix):
+			continue
+		case strings.HasSuffix(entry.Name(), runLockSuffix):
+			errs = append(errs, removeStaleRun(path))
+		case locks[entry.Name()] || lockExists(path):
+			// The directory is removed together with its lock file.
+			continue
+		default:
+			// Files and directories without lock file are left behind by
+			// earlier versions of the agent that did not use per-run
+			// directories.
+			errs = append(errs, os.RemoveAll(path))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// lockExists returns whether the lock file of the directory path exists. It covers
+// lock files that were created after root was listed.
+func lockExists(path string) bool {
+	_, err := os.Stat(path + runLockSuffix)
+	return err == nil
+}
+
+// removeStaleRun removes the directory of lockPath and lockPath itself, if no
+// running uploader holds the lock.
+func removeStaleRun(lockPath string) error {
+	lock, err := os.Open(lockPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer lock.Close()
+
+	if err := unix.Flock(int(lock.Fd()), unix.LOCK_EX|unix.LOCK_NB); err != nil {
+		if errors.Is(err, unix.EWOULDBLOCK) {
+			// The uploader is still running.
+			return nil
+		}
+		return err
+	}
+
+	// The directory is removed first, so that a directory is never left
+	// without lock file while its content is still being removed.
+	if err := os.RemoveAll(strings.TrimSuffix(lockPath, runLockSuffix)); err != nil {
+		return err
+	}
+	// The lock file could have been removed by the uploader that created it,
+	// if it failed to take the lock in the meantime.
+	if err := os.Remove(lockPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package symuploader
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/otel-profiling-agent/config"
+)
+
+func TestConcurrentUploadersCacheDir(t *testing.T) {
+	cacheDirectory := t.TempDir()
+	require.NoError(t, config.SetConfiguration(&config.Config{
+		ProjectID:        1,
+		SecretToken:      "secret",
+		CacheDirectory:   cacheDirectory,
+		SamplesPerSecond: 20,
+	}))
+	root := filepath.Join(cacheDirectory, "symuploader")
+
+	// Leftovers of an earlier version and of a stopped uploader.
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "run-stale"), os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "run-stale", "a"), nil, 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "run-stale.lock"), nil, 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "0123456789abcdef"), nil, 0o600))
+
+	first, err := NewParcaSymbolUploader(&fakeDebuginfoClient{}, 16, false, 0,
+		false, false, 0, false, nil)
+	require.NoError(t, err)
+	inProgress := filepath.Join(first.tmp, "extraction")
+	require.NoError(t, os.WriteFile(inProgress, []byte("debuginfo"), 0o600))
+
+	second, err := NewParcaSymbolUploader(&fakeDebuginfoClient{}, 16, false, 0,
+		false, false, 0, false, nil)
+	require.NoError(t, err)
+	assert.NotEqual(t, first.tmp, second.tmp)
+
+	// The second uploader keeps the files of the first one.
+	assert.FileExists(t, inProgress)
+	assert.DirExists(t, second.tmp)
+	assert.NoDirExists(t, filepath.Join(root, "run-stale"))
+	assert.NoFileExists(t, filepath.Join(root, "run-stale.lock"))
+	assert.NoFileExists(t, filepath.Join(root, "0123456789abcdef"))
+
+	// Once the first uploader is gone, its directory is removed.
+	require.NoError(t, first.cacheDir.lock.Close())
+	_, err = NewParcaSymbolUploader(&fakeDebuginfoClient{}, 16, false, 0,
+		false, false, 0, false, nil)
+	require.NoError(t, err)
+	assert.NoDirExists(t, first.tmp)
+	assert.DirExists(t, second.tmp)
+}
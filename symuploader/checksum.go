@@ -0,0 +1,48 @@
+package symuploader
+
+import (
+	"bytes"
+	"crypto/md5" // nolint:gosec
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// verifyChecksum compares the MD5 checksum sum of the uploaded bytes with the
+// checksum that the backend reported in the Content-MD5 header of its response,
+// or in its ETag header if verifyETag is set. Only some backends use the MD5
+// checksum as ETag, S3 for example not for objects encrypted with SSE-KMS or
+// SSE-C. Backends that report neither, or an ETag that is not an MD5 checksum,
+// e.g. for multipart uploads, are trusted.
+func verifyChecksum(header http.Header, sum []byte, verifyETag bool) error {
+	if contentMD5 := header.Get("Content-MD5"); contentMD5 != "" {
+		want, err := base64.StdEncoding.DecodeString(contentMD5)
+		if err != nil {
+			return fmt.Errorf("invalid Content-MD5 %q: %w", contentMD5, err)
+		}
+		if !bytes.Equal(want, sum) {
+			return fmt.Errorf("checksum %x in Content-MD5 does not match uploaded data %x",
+				want, sum)
+		}
+		return nil
+	}
+	if !verifyETag {
+		return nil
+	}
+
+	etag := strings.Trim(strings.TrimPrefix(header.Get("ETag"), "W/"), `"`)
+	if len(etag) != 2*md5.Size {
+		return nil
+	}
+	want, err := hex.DecodeString(etag)
+	if err != nil {
+		// Not a checksum.
+		return nil
+	}
+	if !bytes.Equal(want, sum) {
+		return fmt.Errorf("checksum %x in ETag does not match uploaded data %x", want, sum)
+	}
+	return nil
+}
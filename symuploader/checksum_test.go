@@ -0,0 +1,71 @@
+package symuploader
+
+import (
+	"context"
+	"crypto/md5" // nolint:gosec
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUploadViaSignedURLChecksum(t *testing.T) {
+	const data = "debuginfo"
+	sum := md5.Sum([]byte(data))       // nolint:gosec
+	wrong := md5.Sum([]byte(data[:4])) // nolint:gosec
+	etag := func(sum [md5.Size]byte) string {
+		return `"` + hex.EncodeToString(sum[:]) + `"`
+	}
+	contentMD5 := func(sum [md5.Size]byte) string {
+		return base64.StdEncoding.EncodeToString(sum[:])
+	}
+
+	tests := map[string]struct {
+		header     string
+		value      string
+		verifyETag bool
+		ok         bool
+	}{
+		"no checksum":   {ok: true},
+		"matching ETag": {header: "ETag", value: etag(sum), verifyETag: true, ok: true},
+		"wrong ETag":    {header: "ETag", value: etag(wrong), verifyETag: true},
+		// An ETag that is not the MD5 checksum, like for the encrypted objects of
+		// some backends, is ignored by default.
+		"unverified ETag": {header: "ETag", value: etag(wrong), ok: true},
+		"multipart ETag": {header: "ETag", value: etag(wrong)[:33] + `-2"`, verifyETag: true,
+			ok: true},
+		"opaque ETag":          {header: "ETag", value: `"abc"`, verifyETag: true, ok: true},
+		"matching Content-MD5": {header: "Content-MD5", value: contentMD5(sum), ok: true},
+		"wrong Content-MD5":    {header: "Content-MD5", value: contentMD5(wrong)},
+	}
+
+	for name, tc := range tests {
+		name := name
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+				_ *http.Request) {
+				if tc.header != "" {
+					w.Header().Set(tc.header, tc.value)
+				}
+			}))
+			defer srv.Close()
+
+			u := &ParcaSymbolUploader{httpClient: srv.Client(), verifyETag: tc.verifyETag}
+			err := u.uploadViaSignedURL(context.Background(), srv.URL,
+				strings.NewReader(data), int64(len(data)))
+			if tc.ok {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			// A mismatch is retried.
+			assert.Equal(t, UploadErrorBackend, UploadErrorCategoryOf(err))
+		})
+	}
+}
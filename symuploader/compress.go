@@ -0,0 +1,105 @@
+package symuploader
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/elastic/otel-profiling-agent/debug/log"
+	"github.com/elastic/otel-profiling-agent/libpf"
+)
+
+// compressedCacheSuffix is the suffix of gzip-compressed debuginfo in the cache
+// directory.
+const compressedCacheSuffix = ".gz"
+
+// compressedDebuginfoFile returns the gzip-compressed debuginfo of the executable
+// at path from the cache directory, together with its decompressed size, which
+// is the size that is uploaded. If there is no valid cached copy, the debuginfo
+// is extracted and compressed first. Failures are returned as *UploadError.
+func (u *ParcaSymbolUploader) compressedDebuginfoFile(fileID libpf.FileID, path string) (
+	*os.File, int64, error) {
+	cachedFile := filepath.Join(u.tmp, fileID.StringNoQuotes()+compressedCacheSuffix)
+
+	f, size, err := openValidGzip(cachedFile)
+	if err == nil {
+		// File already exists, no need to extract it again.
+		return f, size, nil
+	}
+	if !os.IsNotExist(err) {
+		// The compression of an earlier attempt did not complete.
+		log.Debugf("Extracting debuginfo again, cached file %s is invalid: %v", cachedFile, err)
+		os.Remove(cachedFile)
+	}
+
+	// The extraction seeks in its output, so it can't write to the compressor
+	// directly. The uncompressed debuginfo is only kept until it is compressed.
+	extracted, err := u.debuginfoFile(fileID, path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer os.Remove(extracted.Name())
+	defer extracted.Close()
+
+	// Compress to a temporary file that is only renamed on success, so that
+	// an incomplete compression is never taken from the cache.
+	tmp, err := os.CreateTemp(u.tmp, fileID.StringNoQuotes()+compressedCacheSuffix+".tmp-*")
+	if err != nil {
+		return nil, 0, newUploadError(UploadErrorExtract, "create file", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	zw := gzip.NewWriter(tmp)
+	size, err = io.Copy(zw, extracted)
+	if err == nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		tmp.Close()
+		return nil, 0, newUploadError(UploadErrorExtract, "compress debuginfo", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, 0, newUploadError(UploadErrorExtract, "write compressed debuginfo", err)
+	}
+	if err := os.Rename(tmp.Name(), cachedFile); err != nil {
+		return nil, 0, newUploadError(UploadErrorExtract, "rename compressed debuginfo", err)
+	}
+
+	f, err = os.Open(cachedFile)
+	if err != nil {
+		return nil, 0, newUploadError(UploadErrorExtract, "open compressed debuginfo", err)
+	}
+	return f, size, nil
+}
+
+// openValidGzip opens the gzip-compressed file at path and checks that it is
+// complete, by decompressing it once. It returns the decompressed size.
+func openValidGzip(path string) (*os.File, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	size, err := gzipSize(f)
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, size, nil
+}
+
+// gzipSize returns the decompressed size of r. Reading the stream to its end
+// verifies its checksum and length.
+func gzipSize(r io.Reader) (int64, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return 0, err
+	}
+	defer zr.Close()
+	return io.Copy(io.Discard, zr)
+}
@@ -0,0 +1,94 @@
+package symuploader
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/otel-profiling-agent/config"
+	"github.com/elastic/otel-profiling-agent/libpf"
+)
+
+func TestAttemptUploadCompressedCache(t *testing.T) {
+	require.NoError(t, config.SetConfiguration(&config.Config{
+		ProjectID:        1,
+		SecretToken:      "secret",
+		CacheDirectory:   t.TempDir(),
+		SamplesPerSecond: 20,
+	}))
+
+	exe, err := os.Executable()
+	require.NoError(t, err)
+	want := extractDebuginfo(t, exe)
+
+	var got []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		var err error
+		got, err = io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(len(want)), r.ContentLength)
+	}))
+	defer srv.Close()
+
+	client := &signedURLDebuginfoClient{url: srv.URL}
+	u, err := NewParcaSymbolUploader(client, 16, false, 0, false, true, 0, false, nil)
+	require.NoError(t, err)
+	fileID := libpf.NewFileID(1, 2)
+
+	f, size, err := u.compressedDebuginfoFile(fileID, exe)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(want)), size)
+	stat, err := f.Stat()
+	require.NoError(t, err)
+	assert.Less(t, stat.Size(), size)
+	zr, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	decompressed, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	assert.True(t, bytes.Equal(want, decompressed), "cached debuginfo differs from extracted file")
+
+	// Only the compressed debuginfo is kept in the cache directory.
+	entries, err := os.ReadDir(u.tmp)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, fileID.StringNoQuotes()+compressedCacheSuffix, entries[0].Name())
+
+	// The cached file is uploaded decompressed, even if the executable is gone.
+	require.NoError(t, u.attemptUpload(context.Background(), fileID, "/does/not/exist",
+		"new-build-id"))
+	assert.True(t, bytes.Equal(want, got), "uploaded debuginfo differs from extracted file")
+	assert.Equal(t, int32(1), client.finished.Load())
+
+	entries, err = os.ReadDir(u.tmp)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestOpenValidGzipTruncated(t *testing.T) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write(bytes.Repeat([]byte("debuginfo"), 1024))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	path := t.TempDir() + "/cached.gz"
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0o600))
+	f, size, err := openValidGzip(path)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	assert.Equal(t, int64(9*1024), size)
+
+	// A truncated file, as left behind by a crash during compression.
+	require.NoError(t, os.WriteFile(path, buf.Bytes()[:buf.Len()-4], 0o600))
+	_, _, err = openValidGzip(path)
+	assert.Error(t, err)
+}
@@ -0,0 +1,102 @@
+package symuploader
+
+import (
+	"debug/elf"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/elastic/otel-profiling-agent/libpf/pfelf"
+)
+
+// debugFileDir is the directory where distributions install separate debug
+// files.
+const debugFileDir = "/usr/lib/debug"
+
+// procRootPattern matches the root directory of a process through which its
+// executables are accessed.
+var procRootPattern = regexp.MustCompile(`^/proc/\d+/root`)
+
+// findDebugFile returns the path of the separate debug file of the executable
+// at path, if the executable has no debug information itself. The debug file
+// is looked up in the root directory of the process the executable was mapped
+// by. Otherwise, or if no debug file is found, path is returned.
+func findDebugFile(path, buildID string) string {
+	root := procRootPattern.FindString(path)
+	debugFile := lookupDebugFile(root, strings.TrimPrefix(path, root), buildID)
+	if debugFile != "" {
+		return debugFile
+	}
+	return path
+}
+
+// lookupDebugFile returns the path of the separate debug file of the
+// executable at root+path, or "" if the executable has debug information
+// itself or no debug file is found. The debug file is looked up by build ID
+// first, as GDB does, and then by the name in the .gnu_debuglink section.
+func lookupDebugFile(root, path, buildID string) string {
+	ef, err := elf.Open(root + path)
+	if err != nil {
+		return ""
+	}
+	defer ef.Close()
+	if pfelf.HasDWARFData(ef) {
+		return ""
+	}
+
+	if len(buildID) > 2 {
+		debugFile := filepath.Join(root, debugFileDir, ".build-id",
+			buildID[:2], buildID[2:]+".debug")
+		if hasDWARFData(debugFile) {
+			return debugFile
+		}
+	}
+
+	linkName, linkCRC32, err := pfelf.GetDebugLink(ef)
+	if err != nil || linkName == "" || strings.Contains(linkName, "/") {
+		return ""
+	}
+	dir := filepath.Dir(path)
+	for _, debugFile := range []string{
+		filepath.Join(root, dir, linkName),
+		filepath.Join(root, dir, ".debug", linkName),
+		filepath.Join(root, debugFileDir, dir, linkName),
+	} {
+		if debugFile == root+path {
+			continue
+		}
+		if fileCRC32(debugFile) == linkCRC32 && hasDWARFData(debugFile) {
+			return debugFile
+		}
+	}
+	return ""
+}
+
+// hasDWARFData returns whether the ELF file at path has debug information.
+func hasDWARFData(path string) bool {
+	ef, err := elf.Open(path)
+	if err != nil {
+		return false
+	}
+	defer ef.Close()
+	return pfelf.HasDWARFData(ef)
+}
+
+// fileCRC32 returns the .gnu_debuglink compatible CRC-32 of the file at path,
+// or 0 if it cannot be read.
+func fileCRC32(path string) int32 {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	h := crc32.NewIEEE()
+	if _, err := io.Copy(h, f); err != nil {
+		return 0
+	}
+	return int32(h.Sum32())
+}
@@ -0,0 +1,105 @@
+package symuploader
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/otel-profiling-agent/libpf/pfelf"
+)
+
+// copyFile copies the file at src to dst, creating the directories of dst.
+func copyFile(t *testing.T, src, dst string) {
+	t.Helper()
+
+	data, err := os.ReadFile(src)
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Dir(dst), 0o755))
+	require.NoError(t, os.WriteFile(dst, data, 0o644))
+}
+
+func TestFindDebugFile(t *testing.T) {
+	ef, err := pfelf.Open("testdata/stripped")
+	require.NoError(t, err)
+	buildID, err := ef.GetBuildID()
+	require.NoError(t, err)
+	require.NoError(t, ef.Close())
+	buildIDFile := "/usr/lib/debug/.build-id/" + buildID[:2] + "/" + buildID[2:] + ".debug"
+
+	tests := map[string]struct {
+		// exe is the testdata file installed as /usr/bin/app.
+		exe string
+		// debugFiles maps the paths of installed debug files to their
+		// testdata files.
+		debugFiles map[string]string
+		// want is the expected debug file, or "" if none should be found.
+		want string
+	}{
+		"build ID": {
+			exe: "stripped",
+			debugFiles: map[string]string{
+				buildIDFile:                             "stripped.debug",
+				"/usr/lib/debug/usr/bin/stripped.debug": "stripped.debug",
+			},
+			want: buildIDFile,
+		},
+		"debuglink next to executable": {
+			exe:        "stripped",
+			debugFiles: map[string]string{"/usr/bin/stripped.debug": "stripped.debug"},
+			want:       "/usr/bin/stripped.debug",
+		},
+		"debuglink in .debug directory": {
+			exe:        "stripped",
+			debugFiles: map[string]string{"/usr/bin/.debug/stripped.debug": "stripped.debug"},
+			want:       "/usr/bin/.debug/stripped.debug",
+		},
+		"debuglink in debug directory": {
+			exe: "stripped",
+			debugFiles: map[string]string{
+				"/usr/lib/debug/usr/bin/stripped.debug": "stripped.debug",
+			},
+			want: "/usr/lib/debug/usr/bin/stripped.debug",
+		},
+		"debuglink CRC mismatch": {
+			exe:        "stripped",
+			debugFiles: map[string]string{"/usr/lib/debug/usr/bin/stripped.debug": "with-debug"},
+		},
+		"no debug file": {
+			exe: "stripped",
+		},
+		"executable with debug info": {
+			exe: "with-debug",
+			debugFiles: map[string]string{
+				buildIDFile: "stripped.debug",
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		name := name
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			root := t.TempDir()
+			copyFile(t, filepath.Join("testdata", tc.exe), filepath.Join(root, "usr/bin/app"))
+			for path, src := range tc.debugFiles {
+				copyFile(t, filepath.Join("testdata", src), filepath.Join(root, path))
+			}
+
+			want := ""
+			if tc.want != "" {
+				want = filepath.Join(root, tc.want)
+			}
+			assert.Equal(t, want, lookupDebugFile(root, "/usr/bin/app", buildID), name)
+		})
+	}
+}
+
+func TestFindDebugFileFallback(t *testing.T) {
+	// Executables with debug information or that cannot be opened are
+	// uploaded as is.
+	assert.Equal(t, "testdata/with-debug", findDebugFile("testdata/with-debug", ""))
+	assert.Equal(t, "/proc/1/root/nonexistent", findDebugFile("/proc/1/root/nonexistent", ""))
+}
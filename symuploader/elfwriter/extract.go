@@ -3,10 +3,11 @@ package elfwriter
 import (
 	"debug/elf"
 	"fmt"
+	"io"
 	"os"
 )
 
-func OnlyKeepDebug(dst, src *os.File) error {
+func OnlyKeepDebug(dst io.WriteSeeker, src *os.File) error {
 	w, err := NewNullifyingWriter(dst, src)
 	if err != nil {
 		return fmt.Errorf("initialize nullifying writer: %w", err)
@@ -0,0 +1,143 @@
+package symuploader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/elastic/otel-profiling-agent/debug/log"
+	"github.com/elastic/otel-profiling-agent/libpf"
+)
+
+// UploadErrorCategory classifies why the upload of an executable failed.
+type UploadErrorCategory int
+
+const (
+	// UploadErrorNotFound means that the executable does not exist anymore,
+	// usually because its process exited.
+	UploadErrorNotFound UploadErrorCategory = iota
+	// UploadErrorExtract means that the debuginfo could not be extracted or
+	// the file to upload could not be read.
+	UploadErrorExtract
+	// UploadErrorNetwork means that the backend could not be reached.
+	UploadErrorNetwork
+	// UploadErrorBackend means that the backend failed to handle a request,
+	// which may succeed later.
+	UploadErrorBackend
+	// UploadErrorPermanent means that the upload can never succeed, so it is
+	// not retried.
+	UploadErrorPermanent
+)
+
+func (c UploadErrorCategory) String() string {
+	switch c {
+	case UploadErrorNotFound:
+		return "not found"
+	case UploadErrorExtract:
+		return "extract"
+	case UploadErrorNetwork:
+		return "network"
+	case UploadErrorBackend:
+		return "backend"
+	case UploadErrorPermanent:
+		return "permanent"
+	default:
+		return fmt.Sprintf("UploadErrorCategory(%d)", int(c))
+	}
+}
+
+// UploadError is the error of a failed upload.
+type UploadError struct {
+	Category UploadErrorCategory
+	// Op describes the step of the upload that failed.
+	Op  string
+	Err error
+}
+
+func (e *UploadError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Op, e.Err)
+}
+
+func (e *UploadError) Unwrap() error {
+	return e.Err
+}
+
+func newUploadError(category UploadErrorCategory, op string, err error) *UploadError {
+	return &UploadError{Category: category, Op: op, Err: err}
+}
+
+// UploadErrorCategoryOf returns the category of err. Errors that are not an
+// UploadError are considered backend errors.
+func UploadErrorCategoryOf(err error) UploadErrorCategory {
+	var uploadErr *UploadError
+	if errors.As(err, &uploadErr) {
+		return uploadErr.Category
+	}
+	return UploadErrorBackend
+}
+
+// fileError returns the error for a failed access to the executable to upload.
+func fileError(op string, err error) *UploadError {
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return newUploadError(UploadErrorNotFound, op, err)
+	case errors.Is(err, os.ErrPermission):
+		return newUploadError(UploadErrorPermanent, op, err)
+	default:
+		return newUploadError(UploadErrorExtract, op, err)
+	}
+}
+
+// grpcError returns the error for a failed gRPC request to the backend.
+func grpcError(op string, err error) *UploadError {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return newUploadError(UploadErrorNetwork, op, err)
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Canceled:
+		return newUploadError(UploadErrorNetwork, op, err)
+	case codes.InvalidArgument, codes.Unimplemented, codes.PermissionDenied:
+		return newUploadError(UploadErrorPermanent, op, err)
+	default:
+		return newUploadError(UploadErrorBackend, op, err)
+	}
+}
+
+// statusError returns the error for an HTTP upload that was answered with
+// statusCode. Client errors are permanent, except for timeouts and rate limits.
+func statusError(op string, statusCode int, msg []byte) *UploadError {
+	err := fmt.Errorf("unexpected status code: %d, msg: %s", statusCode, string(msg))
+	if statusCode/100 == 4 && statusCode != http.StatusRequestTimeout &&
+		statusCode != http.StatusTooManyRequests {
+		return newUploadError(UploadErrorPermanent, op, err)
+	}
+	return newUploadError(UploadErrorBackend, op, err)
+}
+
+// signedURLStatusError is like statusError for uploads to a signed URL. A signed
+// URL that expired or was revoked is rejected with 401 or 403, which is retried
+// with the new signed URL of the next attempt.
+func signedURLStatusError(op string, statusCode int, msg []byte) *UploadError {
+	if statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden {
+		err := fmt.Errorf("unexpected status code: %d, msg: %s", statusCode, string(msg))
+		return newUploadError(UploadErrorBackend, op, err)
+	}
+	return statusError(op, statusCode, msg)
+}
+
+// logUploadError logs the failed upload of the executable at path. Executables
+// that do not exist anymore are expected and only logged at debug level.
+func logUploadError(err error, path string, fileID libpf.FileID, buildID string) {
+	if UploadErrorCategoryOf(err) == UploadErrorNotFound {
+		log.Debugf("Skipped upload of %q with file ID %q and build ID %q: %v",
+			path, fileID.StringNoQuotes(), buildID, err)
+		return
+	}
+	log.Warnf("Failed to upload %q with file ID %q and build ID %q: %v",
+		path, fileID.StringNoQuotes(), buildID, err)
+}
@@ -0,0 +1,208 @@
+package symuploader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/elastic/otel-profiling-agent/config"
+	"github.com/elastic/otel-profiling-agent/libpf"
+)
+
+func TestUploadErrorCategory(t *testing.T) {
+	tests := map[string]struct {
+		err  error
+		want UploadErrorCategory
+	}{
+		"missing file": {
+			err:  fileError("open file", os.ErrNotExist),
+			want: UploadErrorNotFound,
+		},
+		"unreadable file": {
+			err:  fileError("open file", os.ErrPermission),
+			want: UploadErrorPermanent,
+		},
+		"broken file": {
+			err:  fileError("stat file to upload", errors.New("i/o error")),
+			want: UploadErrorExtract,
+		},
+		"backend unavailable": {
+			err:  grpcError("initiate upload", status.Error(codes.Unavailable, "")),
+			want: UploadErrorNetwork,
+		},
+		"deadline exceeded": {
+			err:  grpcError("initiate upload", context.DeadlineExceeded),
+			want: UploadErrorNetwork,
+		},
+		"invalid request": {
+			err:  grpcError("initiate upload", status.Error(codes.InvalidArgument, "")),
+			want: UploadErrorPermanent,
+		},
+		"backend failure": {
+			err:  grpcError("initiate upload", status.Error(codes.Internal, "")),
+			want: UploadErrorBackend,
+		},
+		"server error": {
+			err:  statusError("upload", http.StatusServiceUnavailable, nil),
+			want: UploadErrorBackend,
+		},
+		"rate limited": {
+			err:  statusError("upload", http.StatusTooManyRequests, nil),
+			want: UploadErrorBackend,
+		},
+		"rejected upload": {
+			err:  statusError("upload", http.StatusForbidden, nil),
+			want: UploadErrorPermanent,
+		},
+		"expired signed URL": {
+			err:  signedURLStatusError("upload", http.StatusForbidden, nil),
+			want: UploadErrorBackend,
+		},
+		"rejected signed URL upload": {
+			err:  signedURLStatusError("upload", http.StatusBadRequest, nil),
+			want: UploadErrorPermanent,
+		},
+		"wrapped": {
+			err:  fmt.Errorf("upload: %w", fileError("open file", os.ErrNotExist)),
+			want: UploadErrorNotFound,
+		},
+		"uncategorized": {
+			err:  errors.New("unknown"),
+			want: UploadErrorBackend,
+		},
+	}
+
+	for name, tc := range tests {
+		name := name
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.want, UploadErrorCategoryOf(tc.err))
+		})
+	}
+}
+
+func TestAttemptUploadErrorCategory(t *testing.T) {
+	require.NoError(t, config.SetConfiguration(&config.Config{
+		ProjectID:        1,
+		SecretToken:      "secret",
+		CacheDirectory:   t.TempDir(),
+		SamplesPerSecond: 20,
+	}))
+	dir := t.TempDir()
+	exe := filepath.Join(dir, "app")
+	require.NoError(t, os.WriteFile(exe, []byte("executable"), 0o600))
+
+	tests := map[string]struct {
+		path            string
+		status          int
+		closed          bool
+		keepTextSection bool
+		want            UploadErrorCategory
+	}{
+		"missing file": {
+			path:            filepath.Join(dir, "gone"),
+			keepTextSection: true,
+			want:            UploadErrorNotFound,
+		},
+		"no ELF file": {
+			path: exe,
+			want: UploadErrorExtract,
+		},
+		"unreachable backend": {
+			path:            exe,
+			closed:          true,
+			keepTextSection: true,
+			want:            UploadErrorNetwork,
+		},
+		"server error": {
+			path:            exe,
+			status:          http.StatusInternalServerError,
+			keepTextSection: true,
+			want:            UploadErrorBackend,
+		},
+		"rejected upload": {
+			path:            exe,
+			status:          http.StatusRequestEntityTooLarge,
+			keepTextSection: true,
+			want:            UploadErrorPermanent,
+		},
+	}
+
+	for name, tc := range tests {
+		name := name
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+				_ *http.Request) {
+				w.WriteHeader(tc.status)
+			}))
+			defer srv.Close()
+			if tc.closed {
+				srv.Close()
+			}
+
+			u, err := NewHTTPSymbolUploader(srv.Client(), srv.URL, 16, tc.keepTextSection, 0,
+				nil)
+			require.NoError(t, err)
+
+			err = u.attemptUpload(context.Background(), tc.path, "build-id")
+			require.Error(t, err)
+			var uploadErr *UploadError
+			require.ErrorAs(t, err, &uploadErr)
+			assert.Equal(t, tc.want, uploadErr.Category)
+
+			// A failed extraction leaves nothing behind.
+			entries, err := os.ReadDir(u.tmp)
+			require.NoError(t, err)
+			assert.Empty(t, entries)
+		})
+	}
+}
+
+func TestDebuginfoFileErrorCategory(t *testing.T) {
+	require.NoError(t, config.SetConfiguration(&config.Config{
+		ProjectID:        1,
+		SecretToken:      "secret",
+		CacheDirectory:   t.TempDir(),
+		SamplesPerSecond: 20,
+	}))
+	u, err := NewParcaSymbolUploader(&fakeDebuginfoClient{}, 16, false, 0,
+		false, false, 0, false, nil)
+	require.NoError(t, err)
+
+	_, err = u.debuginfoFile(libpf.NewFileID(1, 2), filepath.Join(t.TempDir(), "gone"))
+	assert.Equal(t, UploadErrorNotFound, UploadErrorCategoryOf(err))
+
+	exe := filepath.Join(t.TempDir(), "app")
+	require.NoError(t, os.WriteFile(exe, []byte("executable"), 0o600))
+	_, err = u.debuginfoFile(libpf.NewFileID(3, 4), exe)
+	assert.Equal(t, UploadErrorExtract, UploadErrorCategoryOf(err))
+}
+
+func TestUploadViaSignedURLErrorCategory(t *testing.T) {
+	u := &ParcaSymbolUploader{httpClient: http.DefaultClient}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+
+	err := u.uploadViaSignedURL(context.Background(), srv.URL, strings.NewReader(""), 0)
+	assert.Equal(t, UploadErrorPermanent, UploadErrorCategoryOf(err))
+
+	srv.Close()
+	err = u.uploadViaSignedURL(context.Background(), srv.URL, strings.NewReader(""), 0)
+	assert.Equal(t, UploadErrorNetwork, UploadErrorCategoryOf(err))
+
+	err = u.uploadViaSignedURL(context.Background(), "://invalid", strings.NewReader(""), 0)
+	assert.Equal(t, UploadErrorPermanent, UploadErrorCategoryOf(err))
+}
@@ -0,0 +1,177 @@
+package symuploader
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	lru "github.com/elastic/go-freelru"
+
+	"github.com/elastic/otel-profiling-agent/config"
+	"github.com/elastic/otel-profiling-agent/debug/log"
+	"github.com/elastic/otel-profiling-agent/libpf"
+	"github.com/elastic/otel-profiling-agent/symuploader/elfwriter"
+)
+
+// HTTPSymbolUploader uploads executables with a plain HTTP POST request of the
+// file content to <url>/<build ID>. The backend may answer with 409 Conflict if
+// it already has the symbols for a build ID.
+type HTTPSymbolUploader struct {
+	client *http.Client
+	url    string
+
+	// seen holds the executables that are uploaded or being uploaded.
+	seen *lru.SyncedLRU[libpf.FileID, libpf.Void]
+
+	// pathFilter decides which executables may be uploaded.
+	pathFilter *PathFilter
+
+	keepTextSection bool
+	// extractMinSize is the size in bytes below which executables are uploaded
+	// as is, even if keepTextSection is not set.
+	extractMinSize int64
+
+	// tmp is the directory the debuginfo is extracted to.
+	tmp string
+	// cacheDir owns tmp.
+	cacheDir *runCacheDir
+}
+
+// NewHTTPSymbolUploader returns an uploader that posts executables to baseURL.
+func NewHTTPSymbolUploader(
+	client *http.Client,
+	baseURL string,
+	cacheSize int,
+	keepTextSection bool,
+	extractMinSize int64,
+	pathFilter *PathFilter,
+) (*HTTPSymbolUploader, error) {
+	if _, err := url.ParseRequestURI(baseURL); err != nil {
+		return nil, fmt.Errorf("invalid symbol upload URL: %w", err)
+	}
+
+	seen, err := lru.NewSynced[libpf.FileID, libpf.Void](uint32(cacheSize), libpf.FileID.Hash32)
+	if err != nil {
+		return nil, err
+	}
+
+	// Like ParcaSymbolUploader, every uploader extracts to its own directory.
+	cacheDir, err := newRunCacheDir(filepath.Join(config.CacheDirectory(), "symuploader"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &HTTPSymbolUploader{
+		client:          client,
+		url:             strings.TrimSuffix(baseURL, "/"),
+		seen:            seen,
+		pathFilter:      pathFilter,
+		keepTextSection: keepTextSection,
+		extractMinSize:  extractMinSize,
+		tmp:             cacheDir.path,
+		cacheDir:        cacheDir,
+	}, nil
+}
+
+func (u *HTTPSymbolUploader) Upload(ctx context.Context, fileID libpf.FileID,
+	path, buildID string) {
+	if buildID == "" {
+		return
+	}
+	if _, ok := u.seen.Get(fileID); ok {
+		return
+	}
+	u.seen.Add(fileID, libpf.Void{})
+
+	if !u.pathFilter.Allowed(path, buildID) {
+		// Executables on paths that are not allowed must never be uploaded.
+		return
+	}
+
+	go func() {
+		if err := u.attemptUpload(ctx, path, buildID); err != nil {
+			switch UploadErrorCategoryOf(err) {
+			case UploadErrorNotFound, UploadErrorPermanent:
+				// Retrying can't succeed.
+			default:
+				// Allow a retry the next time the executable is reported.
+				u.seen.Remove(fileID)
+			}
+			logUploadError(err, path, fileID, buildID)
+		}
+	}()
+}
+
+// attemptUpload uploads the executable at path. Failures are returned as
+// *UploadError.
+func (u *HTTPSymbolUploader) attemptUpload(ctx context.Context, path, buildID string) error {
+	if debugFile := findDebugFile(path, buildID); debugFile != path {
+		log.Debugf("Uploading debug file %s of %s", debugFile, path)
+		path = debugFile
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		// If the file doesn't exist, the process is likely already gone.
+		return fileError("open file", err)
+	}
+	defer f.Close()
+
+	keepText, err := uploadAsIs(u.keepTextSection, u.extractMinSize, path)
+	if err != nil {
+		return err
+	}
+	if !keepText {
+		debuginfo, err := os.CreateTemp(u.tmp, "debuginfo-*")
+		if err != nil {
+			return newUploadError(UploadErrorExtract, "create file", err)
+		}
+		defer os.Remove(debuginfo.Name())
+		defer debuginfo.Close()
+
+		if err := elfwriter.OnlyKeepDebug(debuginfo, f); err != nil {
+			return newUploadError(UploadErrorExtract, "extract debuginfo", err)
+		}
+		if _, err := debuginfo.Seek(0, io.SeekStart); err != nil {
+			return newUploadError(UploadErrorExtract, "seek extracted debuginfo to start", err)
+		}
+		f = debuginfo
+	}
+
+	stat, err := f.Stat()
+	if err != nil {
+		return fileError("stat file to upload", err)
+	}
+	if stat.Size() == 0 {
+		// There is nothing to upload.
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		u.url+"/"+url.PathEscape(buildID), io.NopCloser(f))
+	if err != nil {
+		return newUploadError(UploadErrorPermanent, "create request", err)
+	}
+	req.ContentLength = stat.Size()
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return newUploadError(UploadErrorNetwork, "do upload request", err)
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode/100 != 2 && resp.StatusCode != http.StatusConflict {
+		data, _ := io.ReadAll(resp.Body)
+		return statusError("upload", resp.StatusCode, data)
+	}
+	return nil
+}
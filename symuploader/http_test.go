@@ -0,0 +1,91 @@
+package symuploader
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/otel-profiling-agent/config"
+	"github.com/elastic/otel-profiling-agent/libpf"
+)
+
+type httpUpload struct {
+	path string
+	body string
+}
+
+func TestHTTPSymbolUploader(t *testing.T) {
+	uploads := make(chan httpUpload, 4)
+	status := http.StatusInternalServerError
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		w.WriteHeader(status)
+		uploads <- httpUpload{path: r.URL.Path, body: string(body)}
+	}))
+	defer srv.Close()
+
+	cacheDirectory := t.TempDir()
+	require.NoError(t, config.SetConfiguration(&config.Config{
+		ProjectID:        1,
+		SecretToken:      "secret",
+		CacheDirectory:   cacheDirectory,
+		SamplesPerSecond: 20,
+	}))
+
+	dir := t.TempDir()
+	exe := filepath.Join(dir, "bin", "app")
+	require.NoError(t, os.MkdirAll(filepath.Dir(exe), 0o755))
+	require.NoError(t, os.WriteFile(exe, []byte("executable"), 0o600))
+
+	filter, err := NewPathFilter([]string{dir}, nil, nil, nil)
+	require.NoError(t, err)
+	u, err := NewHTTPSymbolUploader(srv.Client(), srv.URL+"/symbols/", 16, true, 0, filter)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(cacheDirectory, "symuploader"), filepath.Dir(u.tmp))
+
+	await := func() httpUpload {
+		t.Helper()
+		select {
+		case upload := <-uploads:
+			return upload
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for upload")
+		}
+		return httpUpload{}
+	}
+
+	fileID := libpf.NewFileID(1, 2)
+	ctx := context.Background()
+
+	// A failed upload is retried.
+	u.Upload(ctx, fileID, exe, "build/id")
+	assert.Equal(t, httpUpload{path: "/symbols/build/id", body: "executable"}, await())
+	require.Eventually(t, func() bool {
+		_, ok := u.seen.Peek(fileID)
+		return !ok
+	}, 5*time.Second, time.Millisecond)
+
+	status = http.StatusOK
+	u.Upload(ctx, fileID, exe, "build/id")
+	assert.Equal(t, "executable", await().body)
+
+	// Uploaded executables and executables that are not allowed are skipped.
+	u.Upload(ctx, fileID, exe, "build/id")
+	u.Upload(ctx, libpf.NewFileID(3, 4), "/usr/bin/other", "other")
+	u.Upload(ctx, libpf.NewFileID(5, 6), exe, "")
+	select {
+	case upload := <-uploads:
+		t.Fatalf("unexpected upload %v", upload)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
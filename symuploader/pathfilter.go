@@ -0,0 +1,155 @@
+package symuploader
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"github.com/elastic/otel-profiling-agent/libpf"
+)
+
+// procRootPrefix matches the prefix that makes the path of an executable
+// accessible from outside of the mount namespace of its process.
+var procRootPrefix = regexp.MustCompile(`^/proc/[0-9]+/root(/|$)`)
+
+// PathFilter decides based on the on-disk path or the build ID of an executable
+// whether it may be uploaded.
+type PathFilter struct {
+	allow []string
+	deny  []string
+
+	allowBuildIDs libpf.Set[string]
+	denyBuildIDs  libpf.Set[string]
+
+	// denied counts the executables that were not allowed.
+	denied atomic.Uint32
+}
+
+// NewPathFilter returns a filter that allows executables that match one of the
+// allow patterns or build IDs and rejects executables that match one of the deny
+// patterns or build IDs. Patterns that contain glob metacharacters, see
+// filepath.Match, match the whole path, other patterns match the paths below
+// the directory they name. Deny takes precedence over allow. If allow and
+// allowBuildIDs are empty, all executables that are not denied are allowed.
+// Empty patterns and build IDs are ignored.
+func NewPathFilter(allow, deny, allowBuildIDs, denyBuildIDs []string) (*PathFilter, error) {
+	allowPatterns, err := cleanPatterns(allow)
+	if err != nil {
+		return nil, err
+	}
+	denyPatterns, err := cleanPatterns(deny)
+	if err != nil {
+		return nil, err
+	}
+	return &PathFilter{
+		allow:         allowPatterns,
+		deny:          denyPatterns,
+		allowBuildIDs: buildIDSet(allowBuildIDs),
+		denyBuildIDs:  buildIDSet(denyBuildIDs),
+	}, nil
+}
+
+func cleanPatterns(patterns []string) ([]string, error) {
+	cleaned := make([]string, 0, len(patterns))
+	for _, p := range patterns {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if _, err := filepath.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid path pattern %q: %v", p, err)
+		}
+		cleaned = append(cleaned, filepath.Clean(p))
+	}
+	return cleaned, nil
+}
+
+func buildIDSet(buildIDs []string) libpf.Set[string] {
+	set := make(libpf.Set[string], len(buildIDs))
+	for _, id := range buildIDs {
+		id = strings.ToLower(strings.TrimSpace(id))
+		if id == "" {
+			continue
+		}
+		set[id] = libpf.Void{}
+	}
+	return set
+}
+
+// Allowed returns whether the executable at path with the given build ID may be
+// uploaded. Paths of the form /proc/<pid>/root/<path> are matched by the path
+// within the mount namespace of the process.
+func (f *PathFilter) Allowed(path, buildID string) bool {
+	if f == nil || (len(f.allow) == 0 && len(f.deny) == 0 &&
+		len(f.allowBuildIDs) == 0 && len(f.denyBuildIDs) == 0) {
+		return true
+	}
+
+	if f.match(ExecutablePath(path), strings.ToLower(buildID)) {
+		return true
+	}
+	f.denied.Add(1)
+	return false
+}
+
+func (f *PathFilter) match(path, buildID string) bool {
+	if _, ok := f.denyBuildIDs[buildID]; ok {
+		return false
+	}
+	for _, pattern := range f.deny {
+		if matchPath(path, pattern) {
+			return false
+		}
+	}
+	if len(f.allow) == 0 && len(f.allowBuildIDs) == 0 {
+		return true
+	}
+	if _, ok := f.allowBuildIDs[buildID]; ok {
+		return true
+	}
+	for _, pattern := range f.allow {
+		if matchPath(path, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// DeniedCount returns the number of executables that were not allowed since
+// the last call.
+func (f *PathFilter) DeniedCount() uint32 {
+	if f == nil {
+		return 0
+	}
+	return f.denied.Swap(0)
+}
+
+// ExecutablePath returns the cleaned path of an executable within the mount
+// namespace of its process.
+func ExecutablePath(path string) string {
+	if loc := procRootPrefix.FindStringIndex(path); loc != nil {
+		path = "/" + path[loc[1]:]
+	}
+	return filepath.Clean(path)
+}
+
+// matchPath returns whether path matches the glob pattern, or is below the
+// directory pattern if it holds no glob metacharacters.
+func matchPath(path, pattern string) bool {
+	if !strings.ContainsAny(pattern, "*?[\\") {
+		return hasPathPrefix(path, pattern)
+	}
+	// The pattern was validated by NewPathFilter.
+	matched, _ := filepath.Match(pattern, path)
+	return matched
+}
+
+// hasPathPrefix returns whether path is prefix or a path below the directory prefix.
+func hasPathPrefix(path, prefix string) bool {
+	if prefix == "/" || path == prefix {
+		return true
+	}
+	return strings.HasPrefix(path, prefix+"/")
+}
@@ -0,0 +1,168 @@
+package symuploader
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPathFilter(t *testing.T) {
+	tests := map[string]struct {
+		allow   []string
+		deny    []string
+		allowed map[string]bool
+	}{
+		"empty": {
+			allow: []string{""},
+			deny:  []string{""},
+			allowed: map[string]bool{
+				"/usr/bin/python3": true,
+				"/home/user/a.out": true,
+			},
+		},
+		"deny": {
+			deny: []string{"/home", "/tmp/"},
+			allowed: map[string]bool{
+				"/usr/bin/python3":           true,
+				"/home/user/a.out":           false,
+				"/home":                      false,
+				"/homer/a.out":               true,
+				"/tmp/a.out":                 false,
+				"/proc/42/root/home/a.out":   false,
+				"/proc/42/root/usr/bin/bash": true,
+				"/usr/../home/a.out":         false,
+			},
+		},
+		"allow": {
+			allow: []string{"/usr", "/opt/app"},
+			allowed: map[string]bool{
+				"/usr/bin/python3":          true,
+				"/opt/app/bin/server":       true,
+				"/opt/application/server":   false,
+				"/home/user/a.out":          false,
+				"/proc/1/root/usr/lib/a.so": true,
+			},
+		},
+		"deny takes precedence": {
+			allow: []string{"/usr"},
+			deny:  []string{"/usr/local"},
+			allowed: map[string]bool{
+				"/usr/bin/python3":     true,
+				"/usr/local/bin/a.out": false,
+			},
+		},
+		"root": {
+			deny: []string{"/"},
+			allowed: map[string]bool{
+				"/usr/bin/python3": false,
+			},
+		},
+		"deny glob": {
+			deny: []string{"/opt/*/bin/vendor-*"},
+			allowed: map[string]bool{
+				"/opt/app/bin/vendor-agent":   false,
+				"/opt/app/bin/server":         true,
+				"/opt/app/sub/bin/vendor-cli": true,
+			},
+		},
+		"allow glob": {
+			allow: []string{"/usr/lib/*.so*"},
+			allowed: map[string]bool{
+				"/usr/lib/libc.so.6":           true,
+				"/proc/1/root/usr/lib/libm.so": true,
+				"/usr/lib/x86_64/libc.so.6":    false,
+				"/usr/bin/python3":             false,
+				"/proc/1/root/usr/bin/python3": false,
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			f, err := NewPathFilter(tc.allow, tc.deny, nil, nil)
+			require.NoError(t, err)
+			for path, want := range tc.allowed {
+				assert.Equal(t, want, f.Allowed(path, "abcd"), path)
+			}
+		})
+	}
+}
+
+func TestPathFilterBuildIDs(t *testing.T) {
+	type executable struct {
+		path    string
+		buildID string
+	}
+	tests := map[string]struct {
+		allow, deny                 []string
+		allowBuildIDs, denyBuildIDs []string
+		allowed                     map[executable]bool
+	}{
+		"allow only": {
+			allowBuildIDs: []string{" ABCD ", ""},
+			allowed: map[executable]bool{
+				{"/usr/bin/app", "abcd"}: true,
+				{"/usr/bin/app", "ABCD"}: true,
+				{"/usr/bin/app", "1234"}: false,
+				{"/usr/bin/app", ""}:     false,
+			},
+		},
+		"deny only": {
+			denyBuildIDs: []string{"abcd"},
+			allowed: map[executable]bool{
+				{"/usr/bin/app", "abcd"}: false,
+				{"/usr/bin/app", "1234"}: true,
+				{"/usr/bin/app", ""}:     true,
+			},
+		},
+		"combined": {
+			allow:         []string{"/usr"},
+			deny:          []string{"/usr/local"},
+			allowBuildIDs: []string{"1234"},
+			denyBuildIDs:  []string{"abcd"},
+			allowed: map[executable]bool{
+				// Allowed by path or build ID.
+				{"/usr/bin/app", "5678"}: true,
+				{"/opt/app", "1234"}:     true,
+				{"/opt/app", "5678"}:     false,
+				// Deny takes precedence over allow.
+				{"/usr/bin/app", "abcd"}:       false,
+				{"/usr/local/bin/app", "1234"}: false,
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			f, err := NewPathFilter(tc.allow, tc.deny, tc.allowBuildIDs, tc.denyBuildIDs)
+			require.NoError(t, err)
+			for exe, want := range tc.allowed {
+				assert.Equal(t, want, f.Allowed(exe.path, exe.buildID), exe)
+			}
+		})
+	}
+}
+
+func TestNewPathFilterInvalidPattern(t *testing.T) {
+	_, err := NewPathFilter(nil, []string{"/opt/[a-"}, nil, nil)
+	assert.Error(t, err)
+}
+
+func TestPathFilterNil(t *testing.T) {
+	var f *PathFilter
+	assert.True(t, f.Allowed("/home/user/a.out", "abcd"))
+	assert.Zero(t, f.DeniedCount())
+}
+
+func TestPathFilterDeniedCount(t *testing.T) {
+	f, err := NewPathFilter(nil, []string{"/home"}, nil, nil)
+	require.NoError(t, err)
+	f.Allowed("/home/user/a.out", "abcd")
+	f.Allowed("/home/user/b.out", "abcd")
+	f.Allowed("/usr/bin/python3", "abcd")
+	assert.Equal(t, uint32(2), f.DeniedCount())
+	assert.Equal(t, uint32(0), f.DeniedCount())
+}
@@ -0,0 +1,177 @@
+package symuploader
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5" // nolint:gosec
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxResumableChunkSize limits the memory a resumable upload buffers, as
+	// every chunk is kept until the backend received it.
+	maxResumableChunkSize = 64 * 1024 * 1024
+	// maxChunkRetries is the number of times the upload of a chunk is resumed
+	// before the upload fails.
+	maxChunkRetries = 3
+	// statusResumeIncomplete is the status code of a response to a chunk that
+	// does not complete a resumable upload.
+	statusResumeIncomplete = 308
+)
+
+// uploadResumable uploads size bytes of r to url in chunks of at most chunkSize
+// bytes. Every chunk is sent in a PUT request with a Content-Range header.
+// Chunks that do not complete the upload are answered with status 308 and a
+// Range header that holds the bytes received so far. If a chunk fails, the bytes
+// the backend received are queried with a PUT request without body and a
+// Content-Range of "bytes */<size>", and only the rest of the chunk is sent again.
+// The checksum of the uploaded bytes is verified if the backend reports one.
+// Failures are returned as *UploadError.
+func (u *ParcaSymbolUploader) uploadResumable(ctx context.Context, url string, r io.Reader,
+	size, chunkSize int64) error {
+	h := md5.New() // nolint:gosec
+	buf := make([]byte, min(chunkSize, maxResumableChunkSize, size))
+
+	var (
+		offset int64
+		header http.Header
+		done   bool
+	)
+	for offset < size {
+		chunkStart := offset
+		chunk := buf[:min(int64(len(buf)), size-offset)]
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return newUploadError(UploadErrorExtract, "read chunk", err)
+		}
+		h.Write(chunk)
+		chunkEnd := chunkStart + int64(len(chunk))
+
+		for retries := 0; offset < chunkEnd; {
+			received, respHeader, err := u.putChunk(ctx, url, chunk[offset-chunkStart:],
+				offset, size)
+			if err != nil {
+				if UploadErrorCategoryOf(err) == UploadErrorPermanent ||
+					retries == maxChunkRetries {
+					return err
+				}
+				retries++
+				if err = u.waitChunkRetry(ctx); err != nil {
+					return newUploadError(UploadErrorNetwork, "resume upload", err)
+				}
+				// If the query fails as well, the chunk is sent again.
+				received, respHeader, err = u.putChunk(ctx, url, nil, -1, size)
+				if err != nil {
+					continue
+				}
+			} else if received == offset && received < chunkEnd {
+				// The backend did not store any of the bytes, which is retried
+				// like a failure, so that a stuck backend is not busy-looped.
+				if retries == maxChunkRetries {
+					return newUploadError(UploadErrorBackend, "resume upload",
+						fmt.Errorf("backend received no bytes after offset %d", offset))
+				}
+				retries++
+				if err = u.waitChunkRetry(ctx); err != nil {
+					return newUploadError(UploadErrorNetwork, "resume upload", err)
+				}
+				continue
+			}
+			if received < chunkStart || received > chunkEnd {
+				// Bytes of earlier chunks are not kept, so they can't be sent again.
+				return newUploadError(UploadErrorBackend, "resume upload",
+					fmt.Errorf("backend received %d bytes, expected %d to %d",
+						received, chunkStart, chunkEnd))
+			}
+			offset = received
+			header = respHeader
+			done = received == size && respHeader != nil
+		}
+	}
+	if !done {
+		return newUploadError(UploadErrorBackend, "complete upload",
+			errors.New("backend did not confirm the received bytes"))
+	}
+
+	if err := verifyChecksum(header, h.Sum(nil), u.verifyETag); err != nil {
+		// The data may have been corrupted, which a retry can fix.
+		return newUploadError(UploadErrorBackend, "verify upload", err)
+	}
+	return nil
+}
+
+// putChunk sends chunk as the bytes from offset of the upload of size bytes to
+// url. An offset of -1 queries the bytes the backend received without sending
+// any. It returns the number of bytes the backend received, and the header of
+// the response that completed the upload if it did.
+func (u *ParcaSymbolUploader) putChunk(ctx context.Context, url string, chunk []byte,
+	offset, size int64) (int64, http.Header, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, bytes.NewReader(chunk))
+	if err != nil {
+		return 0, nil, newUploadError(UploadErrorPermanent, "create request", err)
+	}
+	if offset < 0 {
+		req.Header.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+	} else {
+		req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d",
+			offset, offset+int64(len(chunk))-1, size))
+	}
+
+	resp, err := u.httpClient.Do(req)
+	if err != nil {
+		return 0, nil, newUploadError(UploadErrorNetwork, "do upload request", err)
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+
+	switch {
+	case resp.StatusCode/100 == 2:
+		return size, resp.Header, nil
+	case resp.StatusCode == statusResumeIncomplete:
+		received, err := receivedBytes(resp.Header.Get("Range"))
+		if err != nil {
+			return 0, nil, newUploadError(UploadErrorBackend, "resume upload", err)
+		}
+		return received, nil, nil
+	default:
+		data, _ := io.ReadAll(resp.Body)
+		return 0, nil, signedURLStatusError("upload", resp.StatusCode, data)
+	}
+}
+
+// receivedBytes returns the number of bytes the backend received according to
+// the Range header "bytes=0-<last>" of a response with status 308. No header
+// means that no bytes were received.
+func receivedBytes(rangeHeader string) (int64, error) {
+	if rangeHeader == "" {
+		return 0, nil
+	}
+	last, ok := strings.CutPrefix(rangeHeader, "bytes=0-")
+	if !ok {
+		return 0, fmt.Errorf("unexpected Range header %q", rangeHeader)
+	}
+	n, err := strconv.ParseInt(last, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("unexpected Range header %q", rangeHeader)
+	}
+	return n + 1, nil
+}
+
+// waitChunkRetry waits before the upload of a failed chunk is resumed.
+func (u *ParcaSymbolUploader) waitChunkRetry(ctx context.Context) error {
+	timer := time.NewTimer(u.chunkRetryDelay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
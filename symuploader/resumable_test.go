@@ -0,0 +1,215 @@
+package symuploader
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5" // nolint:gosec
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// resumableServer is a fake signed URL that accepts resumable uploads. It fails
+// the request for the chunk at failAt after storing half of its bytes.
+type resumableServer struct {
+	t      *testing.T
+	size   int64
+	failAt int64
+	// lose drops the received bytes of a failed request and the chunks before.
+	lose bool
+	// status is returned for every chunk request, if set.
+	status int
+
+	mu       sync.Mutex
+	data     []byte
+	requests []string
+}
+
+func (s *resumableServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	contentRange := r.Header.Get("Content-Range")
+	s.requests = append(s.requests, contentRange)
+	body, err := io.ReadAll(r.Body)
+	assert.NoError(s.t, err)
+
+	if contentRange == fmt.Sprintf("bytes */%d", s.size) {
+		s.writeReceived(w)
+		return
+	}
+	if s.status != 0 {
+		w.WriteHeader(s.status)
+		return
+	}
+
+	var start, end, size int64
+	_, err = fmt.Sscanf(contentRange, "bytes %d-%d/%d", &start, &end, &size)
+	require.NoError(s.t, err)
+	assert.Equal(s.t, s.size, size)
+	assert.Equal(s.t, end-start+1, int64(len(body)))
+	if start != int64(len(s.data)) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if start == s.failAt {
+		s.failAt = -1
+		s.data = append(s.data, body[:len(body)/2]...)
+		if s.lose {
+			s.data = nil
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	s.data = append(s.data, body...)
+	if int64(len(s.data)) == s.size {
+		sum := md5.Sum(s.data) // nolint:gosec
+		w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	s.writeReceived(w)
+}
+
+func (s *resumableServer) writeReceived(w http.ResponseWriter) {
+	if len(s.data) > 0 {
+		w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", len(s.data)-1))
+	}
+	w.WriteHeader(statusResumeIncomplete)
+}
+
+func TestUploadResumable(t *testing.T) {
+	const (
+		size      = 1000
+		chunkSize = 300
+	)
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	tests := map[string]struct {
+		failAt   int64
+		lose     bool
+		status   int
+		wantErr  UploadErrorCategory
+		requests []string
+	}{
+		"no failure": {
+			failAt: -1,
+			requests: []string{
+				"bytes 0-299/1000",
+				"bytes 300-599/1000",
+				"bytes 600-899/1000",
+				"bytes 900-999/1000",
+			},
+		},
+		"resumed chunk": {
+			failAt: 300,
+			requests: []string{
+				"bytes 0-299/1000",
+				"bytes 300-599/1000",
+				"bytes */1000",
+				// Only the bytes the backend did not receive are sent again.
+				"bytes 450-599/1000",
+				"bytes 600-899/1000",
+				"bytes 900-999/1000",
+			},
+		},
+		"lost chunks": {
+			failAt:  600,
+			lose:    true,
+			wantErr: UploadErrorBackend,
+			requests: []string{
+				"bytes 0-299/1000",
+				"bytes 300-599/1000",
+				"bytes 600-899/1000",
+				"bytes */1000",
+			},
+		},
+		"permanent failure": {
+			failAt:   -1,
+			status:   http.StatusBadRequest,
+			wantErr:  UploadErrorPermanent,
+			requests: []string{"bytes 0-299/1000"},
+		},
+		"no progress": {
+			failAt:  -1,
+			status:  statusResumeIncomplete,
+			wantErr: UploadErrorBackend,
+			requests: []string{
+				"bytes 0-299/1000", "bytes 0-299/1000",
+				"bytes 0-299/1000", "bytes 0-299/1000",
+			},
+		},
+		"retries exhausted": {
+			failAt:  -1,
+			status:  http.StatusServiceUnavailable,
+			wantErr: UploadErrorBackend,
+			requests: []string{
+				"bytes 0-299/1000", "bytes */1000",
+				"bytes 0-299/1000", "bytes */1000",
+				"bytes 0-299/1000", "bytes */1000",
+				"bytes 0-299/1000",
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		name := name
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			s := &resumableServer{t: t, size: size, failAt: tc.failAt, lose: tc.lose,
+				status: tc.status}
+			srv := httptest.NewServer(s)
+			defer srv.Close()
+
+			u := &ParcaSymbolUploader{httpClient: srv.Client()}
+			err := u.uploadResumable(context.Background(), srv.URL, bytes.NewReader(data),
+				size, chunkSize)
+			assert.Equal(t, tc.requests, s.requests, name)
+			if tc.requests[len(tc.requests)-1] != "bytes 900-999/1000" {
+				require.Error(t, err)
+				assert.Equal(t, tc.wantErr, UploadErrorCategoryOf(err), err)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, bytes.Equal(data, s.data), "uploaded data differs")
+		})
+	}
+}
+
+func TestReceivedBytes(t *testing.T) {
+	tests := map[string]struct {
+		header  string
+		want    int64
+		wantErr bool
+	}{
+		"none":        {header: "", want: 0},
+		"received":    {header: "bytes=0-449", want: 450},
+		"not at zero": {header: "bytes=10-449", wantErr: true},
+		"invalid":     {header: "bytes=0-x", wantErr: true},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			got, err := receivedBytes(tc.header)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
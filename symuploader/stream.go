@@ -0,0 +1,142 @@
+package symuploader
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/elastic/otel-profiling-agent/symuploader/elfwriter"
+)
+
+// The ELF writer seeks back to fill in header fields once the offsets of the
+// program and section headers are known, so its output can't be streamed as is.
+// Instead, the debuginfo is extracted twice: the first pass discards the data and
+// only records its size and the header fields that are written over earlier
+// data. The second pass streams the data with these patches applied, and skips
+// the writes over data that was already streamed.
+
+// patch is data that the ELF writer wrote over earlier data at off.
+type patch struct {
+	off  int64
+	data []byte
+}
+
+// sizingWriter is an io.WriteSeeker that discards the data written to it, but
+// records its size and the patches of earlier data.
+type sizingWriter struct {
+	pos     int64
+	size    int64
+	patches []patch
+}
+
+func (w *sizingWriter) Write(p []byte) (int, error) {
+	if w.pos < w.size {
+		n := min(int64(len(p)), w.size-w.pos)
+		w.patches = append(w.patches, patch{
+			off:  w.pos,
+			data: append([]byte(nil), p[:n]...),
+		})
+	}
+	w.pos += int64(len(p))
+	w.size = max(w.size, w.pos)
+	return len(p), nil
+}
+
+func (w *sizingWriter) Seek(offset int64, whence int) (int64, error) {
+	pos, err := seekPos(w.pos, w.size, offset, whence)
+	if err != nil {
+		return w.pos, err
+	}
+	w.pos = pos
+	return pos, nil
+}
+
+// streamingWriter is an io.WriteSeeker that writes the data to w in order, with
+// the patches recorded by a sizingWriter applied.
+type streamingWriter struct {
+	w        io.Writer
+	pos      int64
+	streamed int64
+	patches  []patch
+}
+
+func (w *streamingWriter) Write(p []byte) (int, error) {
+	if w.pos > w.streamed {
+		return 0, errors.New("write beyond the streamed data")
+	}
+
+	// Data before streamed was written with its patches applied already.
+	skip := min(int64(len(p)), w.streamed-w.pos)
+	w.pos += skip
+	if skip == int64(len(p)) {
+		return len(p), nil
+	}
+
+	buf := append([]byte(nil), p[skip:]...)
+	for _, pt := range w.patches {
+		// Copy the part of the patch that overlaps with buf.
+		start := max(pt.off, w.pos)
+		end := min(pt.off+int64(len(pt.data)), w.pos+int64(len(buf)))
+		if start < end {
+			copy(buf[start-w.pos:end-w.pos], pt.data[start-pt.off:end-pt.off])
+		}
+	}
+	n, err := w.w.Write(buf)
+	w.pos += int64(n)
+	w.streamed = w.pos
+	return int(skip) + n, err
+}
+
+func (w *streamingWriter) Seek(offset int64, whence int) (int64, error) {
+	pos, err := seekPos(w.pos, w.streamed, offset, whence)
+	if err != nil {
+		return w.pos, err
+	}
+	w.pos = pos
+	return pos, nil
+}
+
+// seekPos returns the position after seeking to offset relative to whence, for
+// the current position pos and the size of the written data.
+func seekPos(pos, size, offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += pos
+	case io.SeekEnd:
+		offset += size
+	default:
+		return 0, fmt.Errorf("invalid whence %d", whence)
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	return offset, nil
+}
+
+// debuginfoSize returns the size of the debuginfo extracted from the executable
+// original, and the patches needed to stream it with streamDebuginfo. Failures
+// are returned as *UploadError.
+func debuginfoSize(original *os.File) (int64, []patch, error) {
+	w := &sizingWriter{}
+	if err := elfwriter.OnlyKeepDebug(w, original); err != nil {
+		return 0, nil, newUploadError(UploadErrorExtract, "extract debuginfo", err)
+	}
+	return w.size, w.patches, nil
+}
+
+// streamDebuginfo extracts the debuginfo of the executable original again and
+// returns a reader for it, without writing it to disk. The reader must be
+// closed, to stop the extraction if not all of the data is read.
+func streamDebuginfo(original *os.File, patches []patch) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		err := elfwriter.OnlyKeepDebug(&streamingWriter{w: pw, patches: patches}, original)
+		if err != nil {
+			err = newUploadError(UploadErrorExtract, "extract debuginfo", err)
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
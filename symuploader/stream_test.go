@@ -0,0 +1,218 @@
+package symuploader
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+
+	"github.com/elastic/otel-profiling-agent/config"
+	"github.com/elastic/otel-profiling-agent/libpf"
+	v1alpha1 "github.com/elastic/otel-profiling-agent/proto/experiments/parca/debuginfo/v1alpha1"
+	"github.com/elastic/otel-profiling-agent/symuploader/elfwriter"
+)
+
+// signedURLDebuginfoClient instructs uploads to a signed URL.
+type signedURLDebuginfoClient struct {
+	fakeDebuginfoClient
+
+	url      string
+	finished atomic.Int32
+}
+
+func (c *signedURLDebuginfoClient) InitiateUpload(_ context.Context,
+	in *v1alpha1.InitiateUploadRequest, _ ...grpc.CallOption) (
+	*v1alpha1.InitiateUploadResponse, error) {
+	return &v1alpha1.InitiateUploadResponse{
+		UploadInstructions: &v1alpha1.UploadInstructions{
+			BuildId:        in.BuildId,
+			UploadId:       "upload",
+			UploadStrategy: v1alpha1.UploadInstructions_UPLOAD_STRATEGY_SIGNED_URL,
+			SignedUrl:      c.url,
+		},
+	}, nil
+}
+
+func (c *signedURLDebuginfoClient) MarkUploadFinished(context.Context,
+	*v1alpha1.MarkUploadFinishedRequest, ...grpc.CallOption) (
+	*v1alpha1.MarkUploadFinishedResponse, error) {
+	c.finished.Add(1)
+	return &v1alpha1.MarkUploadFinishedResponse{}, nil
+}
+
+// extractDebuginfo returns the debuginfo of the executable at path, extracted to
+// a file.
+func extractDebuginfo(t testing.TB, path string) []byte {
+	original, err := os.Open(path)
+	require.NoError(t, err)
+	defer original.Close()
+
+	extracted, err := os.CreateTemp(t.TempDir(), "debuginfo-")
+	require.NoError(t, err)
+	defer extracted.Close()
+	require.NoError(t, elfwriter.OnlyKeepDebug(extracted, original))
+
+	data, err := os.ReadFile(extracted.Name())
+	require.NoError(t, err)
+	return data
+}
+
+func TestStreamDebuginfo(t *testing.T) {
+	exe, err := os.Executable()
+	require.NoError(t, err)
+	want := extractDebuginfo(t, exe)
+
+	original, err := os.Open(exe)
+	require.NoError(t, err)
+	defer original.Close()
+
+	size, patches, err := debuginfoSize(original)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(want)), size)
+	assert.NotEmpty(t, patches)
+
+	r := streamDebuginfo(original, patches)
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	assert.True(t, bytes.Equal(want, got), "streamed debuginfo differs from extracted file")
+
+	// Closing the reader early stops the extraction.
+	r = streamDebuginfo(original, patches)
+	_, err = io.ReadFull(r, make([]byte, 16))
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+}
+
+func TestStreamDebuginfoNoELF(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app")
+	require.NoError(t, os.WriteFile(path, []byte("executable"), 0o600))
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	_, _, err = debuginfoSize(f)
+	assert.Equal(t, UploadErrorExtract, UploadErrorCategoryOf(err))
+}
+
+func TestAttemptUploadStreamDebuginfo(t *testing.T) {
+	require.NoError(t, config.SetConfiguration(&config.Config{
+		ProjectID:        1,
+		SecretToken:      "secret",
+		CacheDirectory:   t.TempDir(),
+		SamplesPerSecond: 20,
+	}))
+
+	exe, err := os.Executable()
+	require.NoError(t, err)
+	want := extractDebuginfo(t, exe)
+
+	var got []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		var err error
+		got, err = io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(len(want)), r.ContentLength)
+	}))
+	defer srv.Close()
+
+	client := &signedURLDebuginfoClient{url: srv.URL}
+	u, err := NewParcaSymbolUploader(client, 16, false, 0, true, false, 0, false, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, u.attemptUpload(context.Background(), libpf.NewFileID(1, 2), exe,
+		"new-build-id"))
+	assert.True(t, bytes.Equal(want, got), "uploaded debuginfo differs from extracted file")
+	assert.Equal(t, int32(1), client.finished.Load())
+
+	// Neither the debuginfo is written to the cache directory, nor is the
+	// original executable removed.
+	entries, err := os.ReadDir(u.tmp)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+	_, err = os.Stat(exe)
+	require.NoError(t, err)
+}
+
+// writtenBytes returns the number of bytes the process has written so far.
+func writtenBytes(b *testing.B) int64 {
+	f, err := os.Open("/proc/self/io")
+	require.NoError(b, err)
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), "wchar: "); ok {
+			n, err := strconv.ParseInt(value, 10, 64)
+			require.NoError(b, err)
+			return n
+		}
+	}
+	b.Fatal("no wchar in /proc/self/io")
+	return 0
+}
+
+// roundTripFunc sends HTTP requests without writing them to a socket.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (fn roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return fn(req)
+}
+
+// BenchmarkDebuginfoUpload compares the disk IO of uploads of the debuginfo
+// cached on disk and of the streamed debuginfo. Every iteration uploads the
+// debuginfo of a new executable.
+func BenchmarkDebuginfoUpload(b *testing.B) {
+	exe, err := os.Executable()
+	require.NoError(b, err)
+
+	httpClient := &http.Client{Transport: roundTripFunc(func(req *http.Request) (
+		*http.Response, error) {
+		_, err := io.Copy(io.Discard, req.Body)
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{},
+			Body:       io.NopCloser(strings.NewReader("")),
+		}, err
+	})}
+
+	for _, stream := range []bool{false, true} {
+		name := "cache file"
+		if stream {
+			name = "stream"
+		}
+		b.Run(name, func(b *testing.B) {
+			require.NoError(b, config.SetConfiguration(&config.Config{
+				ProjectID:        1,
+				SecretToken:      "secret",
+				CacheDirectory:   b.TempDir(),
+				SamplesPerSecond: 20,
+			}))
+			client := &signedURLDebuginfoClient{url: "http://backend/upload"}
+			u, err := NewParcaSymbolUploader(client, b.N+1, false, 0, stream, false, 0, false, nil)
+			require.NoError(b, err)
+			u.httpClient = httpClient
+
+			b.ResetTimer()
+			written := writtenBytes(b)
+			for i := 0; i < b.N; i++ {
+				fileID := libpf.NewFileID(uint64(i), 1)
+				require.NoError(b, u.attemptUpload(context.Background(), fileID, exe,
+					"new-build-id"))
+			}
+			b.ReportMetric(float64(writtenBytes(b)-written)/float64(b.N), "written-B/op")
+		})
+	}
+}
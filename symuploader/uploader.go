@@ -2,7 +2,10 @@ package symuploader
 
 import (
 	"bufio"
+	"compress/gzip"
 	"context"
+	"crypto/md5" // nolint:gosec
+	"debug/elf"
 	"fmt"
 	"io"
 	"net/http"
@@ -23,17 +26,50 @@ type ParcaSymbolUploader struct {
 	client     v1alpha1.DebuginfoServiceClient
 	httpClient *http.Client
 
+	// uploadChecker batches ShouldInitiateUpload calls for newly seen build IDs.
+	uploadChecker *shouldInitiateUploadBatcher
+
 	retry        *lru.SyncedLRU[libpf.FileID, bool]
 	singleflight *lru.SyncedLRU[libpf.FileID, bool]
 
+	// pathFilter decides which executables may be uploaded.
+	pathFilter *PathFilter
+
 	keepTextSection bool
+	// extractMinSize is the size in bytes below which executables are uploaded
+	// as is, even if keepTextSection is not set.
+	extractMinSize int64
+	// streamDebuginfo streams the extracted debuginfo to the backend instead of
+	// caching it on disk.
+	streamDebuginfo bool
+	// compressCache stores the extracted debuginfo gzip-compressed in the cache
+	// directory. It is decompressed while it is uploaded.
+	compressCache bool
+	// uploadChunkSize is the size of the chunks the debuginfo is uploaded
+	// in, if the signed URLs of the backend accept resumable uploads. Zero
+	// uploads the debuginfo in a single request.
+	uploadChunkSize int64
+	// verifyETag verifies the uploaded bytes with the ETag of the response, if
+	// it is an MD5 checksum. The Content-MD5 of the response is always verified.
+	verifyETag bool
+	// chunkRetryDelay is the time to wait before a failed chunk of a resumable
+	// upload is resumed.
+	chunkRetryDelay time.Duration
 	tmp             string
+	// cacheDir owns tmp.
+	cacheDir *runCacheDir
 }
 
 func NewParcaSymbolUploader(
 	client v1alpha1.DebuginfoServiceClient,
 	cacheSize int,
 	keepTextSection bool,
+	extractMinSize int64,
+	streamDebuginfo bool,
+	compressCache bool,
+	uploadChunkSize int64,
+	verifyETag bool,
+	pathFilter *PathFilter,
 ) (*ParcaSymbolUploader, error) {
 	retryCache, err := lru.NewSynced[libpf.FileID, bool](uint32(cacheSize), libpf.FileID.Hash32)
 	if err != nil {
@@ -45,35 +81,32 @@ func NewParcaSymbolUploader(
 		return nil, err
 	}
 
-	cacheDirectory := filepath.Join(config.CacheDirectory(), "symuploader")
-	if _, err := os.Stat(cacheDirectory); os.IsNotExist(err) {
-		log.Debugf("Creating cache directory '%s'", cacheDirectory)
-		if err := os.MkdirAll(cacheDirectory, os.ModePerm); err != nil {
-			return nil, fmt.Errorf("failed to create cache directory (%s): %s", cacheDirectory, err)
-		}
+	// Every uploader uses its own directory, so that agents which share the
+	// cache directory do not remove files of each other.
+	cacheDir, err := newRunCacheDir(filepath.Join(config.CacheDirectory(), "symuploader"))
+	if err != nil {
+		return nil, err
 	}
 
-	if err := filepath.Walk(cacheDirectory, func(path string, info os.FileInfo, err error) error {
-		if info.IsDir() {
-			return nil
-		}
-
-		if os.Remove(path) != nil {
-			log.Warnf("Failed to remove cached file: %s", path)
-		}
-
-		return nil
-	}); err != nil {
-		return nil, fmt.Errorf("failed to clean cache directory (%s): %s", cacheDirectory, err)
-	}
+	uploadChecker := newShouldInitiateUploadBatcher(client, shouldInitiateUploadWindow,
+		maxShouldInitiateUploadBatchSize)
 
 	return &ParcaSymbolUploader{
 		httpClient:      http.DefaultClient,
 		client:          client,
+		uploadChecker:   uploadChecker,
 		retry:           retryCache,
 		singleflight:    singleflightCache,
+		pathFilter:      pathFilter,
 		keepTextSection: keepTextSection,
-		tmp:             cacheDirectory,
+		extractMinSize:  extractMinSize,
+		streamDebuginfo: streamDebuginfo,
+		compressCache:   compressCache,
+		uploadChunkSize: uploadChunkSize,
+		verifyETag:      verifyETag,
+		chunkRetryDelay: time.Second,
+		tmp:             cacheDir.path,
+		cacheDir:        cacheDir,
 	}, nil
 }
 
@@ -91,6 +124,13 @@ func (u *ParcaSymbolUploader) Upload(ctx context.Context, fileID libpf.FileID, p
 		return
 	}
 
+	if !u.pathFilter.Allowed(path, buildID) {
+		// Denied executables must never be uploaded. The decision is cached, so
+		// that they are not evaluated again when they are discovered again.
+		u.retry.Add(fileID, false)
+		return
+	}
+
 	// Check if the file is already uploading.
 	singleflight, ok := u.singleflight.Get(fileID)
 	if ok || singleflight {
@@ -102,20 +142,25 @@ func (u *ParcaSymbolUploader) Upload(ctx context.Context, fileID libpf.FileID, p
 		defer u.singleflight.Add(fileID, false)
 
 		if err := u.attemptUpload(ctx, fileID, path, buildID); err != nil {
-			log.Warnf("Failed to upload %q with file ID %q and build ID %q: %v", path, fileID.StringNoQuotes(), buildID, err)
+			if UploadErrorCategoryOf(err) == UploadErrorPermanent {
+				u.retry.Add(fileID, false)
+			}
+			logUploadError(err, path, fileID, buildID)
 		}
 	}()
 }
 
+// attemptUpload uploads the executable at path. Failures are returned as
+// *UploadError.
 func (u *ParcaSymbolUploader) attemptUpload(ctx context.Context, fileID libpf.FileID, path, buildID string) error {
 	defer u.singleflight.Add(fileID, false)
 
-	shouldInitiateUploadResp, err := u.client.ShouldInitiateUpload(ctx, &v1alpha1.ShouldInitiateUploadRequest{
+	shouldInitiateUploadResp, err := u.uploadChecker.ShouldInitiateUpload(ctx, &v1alpha1.ShouldInitiateUploadRequest{
 		BuildId: buildID,
 		Type:    v1alpha1.DebuginfoType_DEBUGINFO_TYPE_DEBUGINFO_UNSPECIFIED,
 	})
 	if err != nil {
-		return err
+		return grpcError("should initiate upload", err)
 	}
 
 	if !shouldInitiateUploadResp.ShouldInitiateUpload {
@@ -127,25 +172,33 @@ func (u *ParcaSymbolUploader) attemptUpload(ctx context.Context, fileID libpf.Fi
 		return nil
 	}
 
+	if debugFile := findDebugFile(path, buildID); debugFile != path {
+		log.Debugf("Uploading debug file %s of %s", debugFile, path)
+		path = debugFile
+	}
+
+	keepText, err := uploadAsIs(u.keepTextSection, u.extractMinSize, path)
+	if err != nil {
+		return err
+	}
+
 	var (
-		f    *os.File
-		size int64
+		f       *os.File
+		size    int64
+		patches []patch
 	)
-	if u.keepTextSection {
+	switch {
+	case keepText:
 		f, err = os.Open(path)
 		if err != nil {
-			if os.IsNotExist(err) {
-				// File doesn't exist, likely because the process is already
-				// gone.
-				return nil
-			}
-			return fmt.Errorf("open file: %w", err)
+			// If the file doesn't exist, the process is likely already gone.
+			return fileError("open file", err)
 		}
 		defer f.Close()
 
 		stat, err := f.Stat()
 		if err != nil {
-			return fmt.Errorf("stat file to upload: %w", err)
+			return fileError("stat file to upload", err)
 		}
 
 		size = stat.Size()
@@ -154,74 +207,50 @@ func (u *ParcaSymbolUploader) attemptUpload(ctx context.Context, fileID libpf.Fi
 			u.retry.Add(fileID, false)
 			return nil
 		}
-	} else {
-		cachedFile := filepath.Join(u.tmp, fileID.StringNoQuotes())
-
-		_, err := os.Stat(cachedFile)
-		if err == nil {
-			// File already exists, no need to extract it again.
-			f, err = os.Open(cachedFile)
-			if err != nil {
-				return fmt.Errorf("open cached file: %w", err)
-			}
-			defer f.Close()
-
-			stat, err := f.Stat()
-			if err != nil {
-				return fmt.Errorf("stat file to upload: %w", err)
-			}
-			size = stat.Size()
-
-			if size == 0 {
-				// Something went wrong, an empty file should have never been left behind.
-				os.Remove(f.Name())
-				return nil
-			}
-		} else if os.IsNotExist(err) {
-			// Doesn't exist yet so we need to extract it.
-			f, err = os.Create(filepath.Join(u.tmp, fileID.StringNoQuotes()))
-			if err != nil {
-				os.Remove(f.Name())
-				return fmt.Errorf("create file: %w", err)
-			}
-			defer f.Close()
-
-			original, err := os.Open(path)
-			if err != nil {
-				os.Remove(f.Name())
-				if os.IsNotExist(err) {
-					// Original file doesn't exist the process is likely
-					// already gone.
-					return nil
-				}
-				return fmt.Errorf("open original file: %w", err)
-			}
-			defer original.Close()
+	case u.streamDebuginfo:
+		f, err = os.Open(path)
+		if err != nil {
+			return fileError("open original file", err)
+		}
+		defer f.Close()
 
-			if err := elfwriter.OnlyKeepDebug(f, original); err != nil {
-				os.Remove(f.Name())
-				return fmt.Errorf("extract debuginfo: %w", err)
-			}
+		size, patches, err = debuginfoSize(f)
+		if err != nil {
+			return err
+		}
+		if size == 0 {
+			u.retry.AddWithLifetime(fileID, false, 5*time.Minute)
+			return nil
+		}
+	case u.compressCache:
+		f, size, err = u.compressedDebuginfoFile(fileID, path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
 
-			if _, err := f.Seek(0, io.SeekStart); err != nil {
-				os.Remove(f.Name())
-				return fmt.Errorf("seek extracted debuginfo to start: %w", err)
-			}
+		if size == 0 {
+			os.Remove(f.Name())
+			u.retry.AddWithLifetime(fileID, false, 5*time.Minute)
+			return nil
+		}
+	default:
+		f, err = u.debuginfoFile(fileID, path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
 
-			stat, err := f.Stat()
-			if err != nil {
-				os.Remove(f.Name())
-				return fmt.Errorf("stat file to upload: %w", err)
-			}
-			size = stat.Size()
+		stat, err := f.Stat()
+		if err != nil {
+			return fileError("stat file to upload", err)
+		}
+		size = stat.Size()
 
-			if size == 0 {
-				os.Remove(f.Name())
-				u.retry.AddWithLifetime(fileID, false, 5*time.Minute)
-				return nil
-			}
-		} else {
-			return fmt.Errorf("stat cached file file: %w", err)
+		if size == 0 {
+			os.Remove(f.Name())
+			u.retry.AddWithLifetime(fileID, false, 5*time.Minute)
+			return nil
 		}
 	}
 
@@ -232,7 +261,7 @@ func (u *ParcaSymbolUploader) attemptUpload(ctx context.Context, fileID libpf.Fi
 		Size:    size,
 	})
 	if err != nil {
-		return err
+		return grpcError("initiate upload", err)
 	}
 
 	if initiateUploadResp.UploadInstructions == nil {
@@ -247,7 +276,28 @@ func (u *ParcaSymbolUploader) attemptUpload(ctx context.Context, fileID libpf.Fi
 		return nil
 	}
 
-	if err := u.uploadViaSignedURL(ctx, instructions.SignedUrl, f, size); err != nil {
+	var r io.Reader = f
+	switch {
+	case keepText:
+	case u.streamDebuginfo:
+		rc := streamDebuginfo(f, patches)
+		defer rc.Close()
+		r = rc
+	case u.compressCache:
+		// The size in the InitiateUploadRequest is the decompressed size.
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return newUploadError(UploadErrorExtract, "decompress cached debuginfo", err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+	if u.uploadChunkSize > 0 {
+		err = u.uploadResumable(ctx, instructions.SignedUrl, r, size, u.uploadChunkSize)
+	} else {
+		err = u.uploadViaSignedURL(ctx, instructions.SignedUrl, r, size)
+	}
+	if err != nil {
 		return err
 	}
 
@@ -256,11 +306,15 @@ func (u *ParcaSymbolUploader) attemptUpload(ctx context.Context, fileID libpf.Fi
 		UploadId: initiateUploadResp.UploadInstructions.UploadId,
 	})
 	if err != nil {
-		return err
+		return grpcError("mark upload finished", err)
 	}
 
 	u.retry.Add(fileID, false)
 
+	if keepText || u.streamDebuginfo {
+		// f is the original executable, which must be kept.
+		return nil
+	}
 	// We've successfully uploaded the file, no need to keep it around.
 	if err := os.Remove(f.Name()); err != nil {
 		log.Warnf("Failed to remove cached file: %s", f.Name())
@@ -269,20 +323,129 @@ func (u *ParcaSymbolUploader) attemptUpload(ctx context.Context, fileID libpf.Fi
 	return nil
 }
 
+// debuginfoFile returns the debuginfo of the executable at path from the cache
+// directory. If there is no valid cached copy, the debuginfo is extracted first.
+// Failures are returned as *UploadError.
+func (u *ParcaSymbolUploader) debuginfoFile(fileID libpf.FileID, path string) (*os.File, error) {
+	cachedFile := filepath.Join(u.tmp, fileID.StringNoQuotes())
+
+	f, err := openValidELF(cachedFile)
+	if err == nil {
+		// File already exists, no need to extract it again.
+		return f, nil
+	}
+	if !os.IsNotExist(err) {
+		// The extraction of an earlier attempt did not complete.
+		log.Debugf("Extracting debuginfo again, cached file %s is invalid: %v", cachedFile, err)
+		os.Remove(cachedFile)
+	}
+
+	original, err := os.Open(path)
+	if err != nil {
+		return nil, fileError("open original file", err)
+	}
+	defer original.Close()
+
+	// Extract to a temporary file that is only renamed on success, so that
+	// an incomplete extraction is never taken from the cache.
+	tmp, err := os.CreateTemp(u.tmp, fileID.StringNoQuotes()+".tmp-*")
+	if err != nil {
+		return nil, newUploadError(UploadErrorExtract, "create file", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := elfwriter.OnlyKeepDebug(tmp, original); err != nil {
+		tmp.Close()
+		return nil, newUploadError(UploadErrorExtract, "extract debuginfo", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, newUploadError(UploadErrorExtract, "write extracted debuginfo", err)
+	}
+	if err := os.Rename(tmp.Name(), cachedFile); err != nil {
+		return nil, newUploadError(UploadErrorExtract, "rename extracted debuginfo", err)
+	}
+
+	f, err = os.Open(cachedFile)
+	if err != nil {
+		return nil, newUploadError(UploadErrorExtract, "open extracted debuginfo", err)
+	}
+	return f, nil
+}
+
+// uploadAsIs returns whether the executable at path is uploaded with its .text
+// section, instead of only its extracted debuginfo. For executables smaller than
+// extractMinSize bytes, the extraction isn't worth its overhead.
+func uploadAsIs(keepTextSection bool, extractMinSize int64, path string) (bool, error) {
+	if keepTextSection || extractMinSize <= 0 {
+		return keepTextSection, nil
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		return false, fileError("stat original file", err)
+	}
+	return stat.Size() < extractMinSize, nil
+}
+
+// openValidELF opens the ELF file at path and checks that its headers and the
+// content of its sections are complete.
+func openValidELF(path string) (*os.File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateELF(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func validateELF(f *os.File) error {
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	ef, err := elf.NewFile(f)
+	if err != nil {
+		return err
+	}
+	for _, section := range ef.Sections {
+		if section.Type == elf.SHT_NOBITS {
+			continue
+		}
+		if section.Offset+section.FileSize > uint64(stat.Size()) {
+			return fmt.Errorf("section %s exceeds file size", section.Name)
+		}
+	}
+	return nil
+}
+
+// uploadViaSignedURL uploads size bytes of r to url, and verifies the checksum
+// of the uploaded bytes if the backend reports one. Failures are returned as
+// *UploadError.
 func (u *ParcaSymbolUploader) uploadViaSignedURL(ctx context.Context, url string, r io.Reader, size int64) error {
 	// Client is closing the reader if the reader is also closer.
 	// We need to wrap the reader to avoid this.
 	// We want to have total control over the reader.
 	r = bufio.NewReader(r)
+	// The checksum is computed while the request streams the data.
+	h := md5.New() // nolint:gosec
+	r = io.TeeReader(r, h)
 	req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, r)
 	if err != nil {
-		return fmt.Errorf("create request: %w", err)
+		return newUploadError(UploadErrorPermanent, "create request", err)
 	}
 
 	req.ContentLength = size
 	resp, err := u.httpClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("do upload request: %w", err)
+		return newUploadError(UploadErrorNetwork, "do upload request", err)
 	}
 	defer func() {
 		_, _ = io.Copy(io.Discard, resp.Body)
@@ -291,7 +454,12 @@ func (u *ParcaSymbolUploader) uploadViaSignedURL(ctx context.Context, url string
 
 	if resp.StatusCode/100 != 2 {
 		data, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("unexpected status code: %d, msg: %s", resp.StatusCode, string(data))
+		return signedURLStatusError("upload", resp.StatusCode, data)
+	}
+
+	if err := verifyChecksum(resp.Header, h.Sum(nil), u.verifyETag); err != nil {
+		// The data may have been truncated, which a retry can fix.
+		return newUploadError(UploadErrorBackend, "verify upload", err)
 	}
 
 	return nil
@@ -0,0 +1,127 @@
+package symuploader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/otel-profiling-agent/config"
+	"github.com/elastic/otel-profiling-agent/libpf"
+)
+
+func TestDebuginfoFileReextractsTruncatedCache(t *testing.T) {
+	require.NoError(t, config.SetConfiguration(&config.Config{
+		ProjectID:        1,
+		SecretToken:      "secret",
+		CacheDirectory:   t.TempDir(),
+		SamplesPerSecond: 20,
+	}))
+	u, err := NewParcaSymbolUploader(&fakeDebuginfoClient{}, 16, false, 0,
+		false, false, 0, false, nil)
+	require.NoError(t, err)
+
+	exe, err := os.Executable()
+	require.NoError(t, err)
+	fileID := libpf.NewFileID(1, 2)
+
+	f, err := u.debuginfoFile(fileID, exe)
+	require.NoError(t, err)
+	require.NotNil(t, f)
+	stat, err := f.Stat()
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	extractedSize := stat.Size()
+
+	// A valid cached file is used, even if the executable is gone.
+	f, err = u.debuginfoFile(fileID, "/does/not/exist")
+	require.NoError(t, err)
+	require.NotNil(t, f)
+	require.NoError(t, f.Close())
+
+	// Plant a truncated file, as left behind by a crash during extraction.
+	require.NoError(t, os.Truncate(f.Name(), extractedSize/2))
+	_, err = openValidELF(f.Name())
+	require.Error(t, err)
+
+	f, err = u.debuginfoFile(fileID, exe)
+	require.NoError(t, err)
+	require.NotNil(t, f)
+	defer f.Close()
+	stat, err = f.Stat()
+	require.NoError(t, err)
+	assert.Equal(t, extractedSize, stat.Size())
+	require.NoError(t, validateELF(f))
+
+	// No temporary files of the extraction are left behind.
+	entries, err := os.ReadDir(u.tmp)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestUploadDenied(t *testing.T) {
+	require.NoError(t, config.SetConfiguration(&config.Config{
+		ProjectID:        1,
+		SecretToken:      "secret",
+		CacheDirectory:   t.TempDir(),
+		SamplesPerSecond: 20,
+	}))
+	filter, err := NewPathFilter(nil, []string{"/opt/vendor"}, nil, []string{"new-denied"})
+	require.NoError(t, err)
+	client := &fakeDebuginfoClient{}
+	u, err := NewParcaSymbolUploader(client, 16, false, 0, false, false, 0, false, filter)
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		u.Upload(context.Background(), libpf.NewFileID(1, 2), "/opt/vendor/bin/app",
+			"new-build-id")
+		u.Upload(context.Background(), libpf.NewFileID(3, 4), "/usr/bin/app", "new-denied")
+	}
+
+	// Denied executables are neither checked with the backend nor evaluated
+	// again when they are discovered again.
+	assert.Equal(t, uint32(2), filter.DeniedCount())
+	for _, fileID := range []libpf.FileID{libpf.NewFileID(1, 2), libpf.NewFileID(3, 4)} {
+		retry, ok := u.retry.Get(fileID)
+		assert.True(t, ok)
+		assert.False(t, retry)
+		_, ok = u.singleflight.Get(fileID)
+		assert.False(t, ok)
+	}
+	assert.Zero(t, client.singleCalls.Load())
+	assert.Zero(t, client.batchCalls.Load())
+}
+
+func TestUploadAsIs(t *testing.T) {
+	exe := filepath.Join(t.TempDir(), "app")
+	require.NoError(t, os.WriteFile(exe, make([]byte, 1024), 0o600))
+
+	tests := map[string]struct {
+		keepTextSection bool
+		extractMinSize  int64
+		want            bool
+	}{
+		"extract all":        {want: false},
+		"keep all":           {keepTextSection: true, extractMinSize: 512, want: true},
+		"above threshold":    {extractMinSize: 1023, want: false},
+		"at threshold":       {extractMinSize: 1024, want: false},
+		"below threshold":    {extractMinSize: 1025, want: true},
+		"negative threshold": {extractMinSize: -1, want: false},
+	}
+
+	for name, tc := range tests {
+		name := name
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			got, err := uploadAsIs(tc.keepTextSection, tc.extractMinSize, exe)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+
+	_, err := uploadAsIs(false, 1024, filepath.Join(t.TempDir(), "gone"))
+	assert.Equal(t, UploadErrorNotFound, UploadErrorCategoryOf(err))
+}
@@ -10,6 +10,7 @@ package tracehandler
 
 import (
 	"context"
+	"encoding/binary"
 	"fmt"
 	"time"
 
@@ -22,6 +23,7 @@ import (
 	"github.com/elastic/otel-profiling-agent/reporter"
 	"github.com/elastic/otel-profiling-agent/tracer"
 	log "github.com/sirupsen/logrus"
+	"github.com/zeebo/xxh3"
 )
 
 // metadataWarnInhibDuration defines the minimum duration between warnings printed
@@ -50,6 +52,31 @@ type TraceProcessor interface {
 	// is in essence an indicator that all Traces until that time have been now processed,
 	// and any events up to this time can be processed.
 	SymbolizationComplete(traceCaptureKTime libpf.KTime)
+
+	// ProcessStartTime returns the start time of the process with the given PID,
+	// or zero if it can not be determined.
+	ProcessStartTime(pid libpf.PID) libpf.UnixTime64
+
+	// ProcessName returns the name of the process with the given PID, or an
+	// empty string if it can not be determined.
+	ProcessName(pid libpf.PID) string
+}
+
+// bpfTraceKey identifies a BPF trace. If traces are split by process, it also
+// identifies the process, the start time of which tells apart processes that
+// reused the PID of an exited one.
+type bpfTraceKey struct {
+	hash      host.TraceHash
+	pid       libpf.PID
+	startTime libpf.UnixTime64
+}
+
+// umTraceInfo is the user-mode hash of a BPF trace together with the process it
+// was last reported for.
+type umTraceInfo struct {
+	hash      libpf.TraceHash
+	pid       libpf.PID
+	startTime libpf.UnixTime64
 }
 
 // Compile time check to make sure Tracer satisfies the interfaces.
@@ -69,7 +96,7 @@ type traceHandler struct {
 	// bpfTraceCache stores mappings from BPF to user-mode hashes. This allows
 	// avoiding the overhead of re-doing user-mode symbolization of traces that
 	// we have recently seen already.
-	bpfTraceCache *lru.LRU[host.TraceHash, libpf.TraceHash]
+	bpfTraceCache *lru.LRU[bpfTraceKey, umTraceInfo]
 
 	// umTraceCache is a LRU set that suppresses unnecessary resends of traces
 	// that we have recently reported to the collector already.
@@ -85,6 +112,11 @@ type traceHandler struct {
 	// update container metadata (rate-limiting).
 	metadataWarnInhib *lru.LRU[libpf.PID, libpf.Void]
 
+	// splitByProcess reports the same trace of different processes as separate
+	// traces, so that each of them carries its own process. This multiplies the
+	// traces that are reported by the number of processes that share them.
+	splitByProcess bool
+
 	times Times
 }
 
@@ -94,8 +126,8 @@ func newTraceHandler(ctx context.Context, rep reporter.TraceReporter,
 	*traceHandler, error) {
 	cacheSize := config.TraceCacheEntries()
 
-	bpfTraceCache, err := lru.New[host.TraceHash, libpf.TraceHash](
-		cacheSize, func(k host.TraceHash) uint32 { return uint32(k) })
+	bpfTraceCache, err := lru.New[bpfTraceKey, umTraceInfo](
+		cacheSize, func(k bpfTraceKey) uint32 { return uint32(k.hash) })
 	if err != nil {
 		return nil, err
 	}
@@ -126,13 +158,26 @@ func newTraceHandler(ctx context.Context, rep reporter.TraceReporter,
 		times:                    times,
 		containerMetadataHandler: containerMetadataHandler,
 		metadataWarnInhib:        metadataWarnInhib,
+		splitByProcess:           config.SplitTracesByProcess(),
 	}
 
 	return t, nil
 }
 
+// processTraceHash returns the hash of a trace of the process with the given PID
+// and start time.
+func processTraceHash(traceHash libpf.TraceHash, pid libpf.PID,
+	startTime libpf.UnixTime64) libpf.TraceHash {
+	var buf [32]byte
+	copy(buf[:], traceHash.Bytes())
+	binary.LittleEndian.PutUint64(buf[16:], uint64(pid))
+	binary.LittleEndian.PutUint64(buf[24:], uint64(startTime))
+	h := xxh3.Hash128(buf[:])
+	return libpf.NewTraceHash(h.Hi, h.Lo)
+}
+
 func (m *traceHandler) HandleTrace(bpfTrace *host.Trace) {
-	timestamp := libpf.UnixTime32(libpf.NowAsUInt32())
+	timestamp := libpf.UnixTime64(libpf.NowAsUInt64())
 	defer m.traceProcessor.SymbolizationComplete(bpfTrace.KTime)
 
 	meta, err := m.containerMetadataHandler.GetContainerMetadata(bpfTrace.PID)
@@ -140,22 +185,56 @@ func (m *traceHandler) HandleTrace(bpfTrace *host.Trace) {
 		log.Warnf("Failed to determine container info for trace: %v", err)
 	}
 
+	// The comm of a trace is the name of the thread it was sampled in. It is
+	// additionally reported as thread name if it differs from the name of the
+	// process, as it is the case for threads that were named on their own.
+	var threadName string
+	if name := m.traceProcessor.ProcessName(bpfTrace.PID); name != "" &&
+		name != bpfTrace.Comm {
+		threadName = bpfTrace.Comm
+	}
+
+	startTime := m.traceProcessor.ProcessStartTime(bpfTrace.PID)
+	key := bpfTraceKey{hash: bpfTrace.Hash}
+	if m.splitByProcess {
+		key.pid = bpfTrace.PID
+		key.startTime = startTime
+	}
+
 	// Fast path: if the trace is already known remotely, we just send a counter update.
-	postConvHash, traceKnown := m.bpfTraceCache.Get(bpfTrace.Hash)
+	postConv, traceKnown := m.bpfTraceCache.Get(key)
 	if traceKnown {
 		m.bpfTraceCacheHit++
-		m.reporter.ReportCountForTrace(postConvHash, timestamp, 1,
-			bpfTrace.Comm, meta.PodName, meta.PodNamespace, meta.ContainerName)
+		m.reporter.ReportCountForTrace(postConv.hash, timestamp, 1,
+			bpfTrace.Comm, meta.PodName, meta.PodNamespace, meta.ContainerName,
+			meta.ContainerID, threadName)
+		// Unless traces are split by process, the trace keeps the process
+		// that sampled it last.
+		if postConv.pid != bpfTrace.PID || postConv.startTime != startTime {
+			m.reporter.ReportProcessForTrace(postConv.hash, bpfTrace.PID, startTime)
+			postConv.pid = bpfTrace.PID
+			postConv.startTime = startTime
+			m.bpfTraceCache.Add(key, postConv)
+		}
 		return
 	}
 	m.bpfTraceCacheMiss++
 
 	// Slow path: convert trace.
 	umTrace := m.traceProcessor.ConvertTrace(bpfTrace)
+	if m.splitByProcess {
+		umTrace.Hash = processTraceHash(umTrace.Hash, bpfTrace.PID, startTime)
+	}
 	log.Debugf("Trace hash remap 0x%x -> 0x%x", bpfTrace.Hash, umTrace.Hash)
-	m.bpfTraceCache.Add(bpfTrace.Hash, umTrace.Hash)
+	m.bpfTraceCache.Add(key, umTraceInfo{
+		hash:      umTrace.Hash,
+		pid:       bpfTrace.PID,
+		startTime: startTime,
+	})
 	m.reporter.ReportCountForTrace(umTrace.Hash, timestamp, 1,
-		bpfTrace.Comm, meta.PodName, meta.PodNamespace, meta.ContainerName)
+		bpfTrace.Comm, meta.PodName, meta.PodNamespace, meta.ContainerName,
+		meta.ContainerID, threadName)
+	m.reporter.ReportProcessForTrace(umTrace.Hash, bpfTrace.PID, startTime)
 
 	// Trace already known to collector by UM hash?
 	if _, known := m.umTraceCache.Get(umTrace.Hash); known {
@@ -15,6 +15,7 @@ import (
 
 	"github.com/elastic/otel-profiling-agent/host"
 	"github.com/elastic/otel-profiling-agent/libpf"
+	"github.com/elastic/otel-profiling-agent/reporter"
 )
 
 type fakeTimes struct {
@@ -28,7 +29,10 @@ func defaultTimes() *fakeTimes {
 func (ft *fakeTimes) MonitorInterval() time.Duration { return ft.monitorInterval }
 
 // fakeTraceProcessor implements a fake TraceProcessor used only within the test scope.
-type fakeTraceProcessor struct{}
+type fakeTraceProcessor struct {
+	startTime libpf.UnixTime64
+	name      string
+}
 
 // Compile time check to make sure fakeTraceProcessor satisfies the interfaces.
 var _ TraceProcessor = (*fakeTraceProcessor)(nil)
@@ -42,10 +46,22 @@ func (f *fakeTraceProcessor) ConvertTrace(trace *host.Trace) *libpf.Trace {
 func (f *fakeTraceProcessor) SymbolizationComplete(libpf.KTime) {
 }
 
+func (f *fakeTraceProcessor) ProcessStartTime(libpf.PID) libpf.UnixTime64 {
+	return f.startTime
+}
+
+func (f *fakeTraceProcessor) ProcessName(libpf.PID) string {
+	return f.name
+}
+
 // arguments holds the inputs to test the appropriate functions.
 type arguments struct {
 	// trace holds the arguments for the function HandleTrace().
 	trace *host.Trace
+	// startTime and processName are the start time and name of the process of
+	// the trace.
+	startTime   libpf.UnixTime64
+	processName string
 	// delay specifies a time delay after input has been processed
 	delay time.Duration
 }
@@ -53,18 +69,28 @@ type arguments struct {
 // reportedCount / reportedTrace hold the information reported from traceHandler
 // via the reporter functions (reportCountForTrace / reportFramesForTrace).
 type reportedCount struct {
-	traceHash libpf.TraceHash
-	count     uint16
+	traceHash  libpf.TraceHash
+	count      uint16
+	comm       string
+	threadName string
 }
 
 type reportedTrace struct {
 	traceHash libpf.TraceHash
 }
 
+// reportedProcess holds the information reported via ReportProcessForTrace.
+type reportedProcess struct {
+	traceHash libpf.TraceHash
+	pid       libpf.PID
+	startTime libpf.UnixTime64
+}
+
 type mockReporter struct {
-	t              *testing.T
-	reportedCounts []reportedCount
-	reportedTraces []reportedTrace
+	t                 *testing.T
+	reportedCounts    []reportedCount
+	reportedTraces    []reportedTrace
+	reportedProcesses []reportedProcess
 }
 
 func (m *mockReporter) ReportFramesForTrace(trace *libpf.Trace) {
@@ -73,20 +99,51 @@ func (m *mockReporter) ReportFramesForTrace(trace *libpf.Trace) {
 }
 
 func (m *mockReporter) ReportCountForTrace(traceHash libpf.TraceHash,
-	_ libpf.UnixTime32, count uint16, _, _, _ string) {
+	_ libpf.UnixTime64, count uint16, comm, _, _, _, _, threadName string) {
 	m.reportedCounts = append(m.reportedCounts, reportedCount{
-		traceHash: traceHash,
-		count:     count,
+		traceHash:  traceHash,
+		count:      count,
+		comm:       comm,
+		threadName: threadName,
 	})
 	m.t.Logf("reportCountForTrace: 0x%x count: %d", traceHash, count)
 }
 
+func (m *mockReporter) ReportCounts(counts []reporter.TraceCount) {
+	for i := range counts {
+		m.ReportCountForTrace(counts[i].TraceHash, counts[i].Timestamp, counts[i].Count,
+			"", "", "", "", "", "")
+	}
+}
+
+func (m *mockReporter) ReportProcessForTrace(traceHash libpf.TraceHash, pid libpf.PID,
+	startTime libpf.UnixTime64) {
+	m.reportedProcesses = append(m.reportedProcesses, reportedProcess{
+		traceHash: traceHash,
+		pid:       pid,
+		startTime: startTime,
+	})
+}
+
+// testHash returns the hash the fake trace processor reports for a BPF trace hash.
+func testHash(bpfHash uint64) libpf.TraceHash {
+	return libpf.NewTraceHash(bpfHash, bpfHash)
+}
+
+// testTraceHash returns the hash the fake trace processor and traceHandler report
+// for the BPF trace hash of a thread, if traces are split by process.
+func testTraceHash(bpfHash uint64, pid libpf.PID, startTime libpf.UnixTime64) libpf.TraceHash {
+	return processTraceHash(testHash(bpfHash), pid, startTime)
+}
+
 func TestTraceHandler(t *testing.T) {
 	tests := map[string]struct {
-		input          []arguments
-		expectedCounts []reportedCount
-		expectedTraces []reportedTrace
-		expireTimeout  time.Duration
+		input             []arguments
+		splitByProcess    bool
+		expectedCounts    []reportedCount
+		expectedTraces    []reportedTrace
+		expectedProcesses []reportedProcess
+		expireTimeout     time.Duration
 	}{
 		// no input simulates a case where no data is provided as input
 		// to the functions of traceHandler.
@@ -96,22 +153,119 @@ func TestTraceHandler(t *testing.T) {
 		"single trace": {input: []arguments{
 			{trace: &host.Trace{Hash: host.TraceHash(0x1234)}},
 		},
-			expectedTraces: []reportedTrace{{traceHash: libpf.NewTraceHash(0x1234, 0x1234)}},
+			expectedTraces: []reportedTrace{{traceHash: testHash(0x1234)}},
 			expectedCounts: []reportedCount{
-				{traceHash: libpf.NewTraceHash(0x1234, 0x1234), count: 1},
+				{traceHash: testHash(0x1234), count: 1},
 			},
+			expectedProcesses: []reportedProcess{{traceHash: testHash(0x1234)}},
 		},
 
 		// double trace simulates a case where the same trace is encountered in quick succession.
+		// The process is only reported once, as it does not change.
 		"double trace": {input: []arguments{
-			{trace: &host.Trace{Hash: host.TraceHash(4)}},
-			{trace: &host.Trace{Hash: host.TraceHash(4)}},
+			{trace: &host.Trace{Hash: host.TraceHash(4), PID: 5000001}, startTime: 10},
+			{trace: &host.Trace{Hash: host.TraceHash(4), PID: 5000001}, startTime: 10},
+		},
+			expectedTraces: []reportedTrace{{traceHash: testHash(4)}},
+			expectedCounts: []reportedCount{
+				{traceHash: testHash(4), count: 1},
+				{traceHash: testHash(4), count: 1},
+			},
+			expectedProcesses: []reportedProcess{
+				{traceHash: testHash(4), pid: 5000001, startTime: 10},
+			},
+		},
+
+		// the same trace of two processes is reported once, with the process
+		// that sampled it last.
+		// The PIDs are above pid_max, so that no container metadata is found for them.
+		"shared trace": {input: []arguments{
+			{trace: &host.Trace{Hash: host.TraceHash(4), PID: 5000001}, startTime: 10},
+			{trace: &host.Trace{Hash: host.TraceHash(4), PID: 5000002}, startTime: 10},
+		},
+			expectedTraces: []reportedTrace{{traceHash: testHash(4)}},
+			expectedCounts: []reportedCount{
+				{traceHash: testHash(4), count: 1},
+				{traceHash: testHash(4), count: 1},
+			},
+			expectedProcesses: []reportedProcess{
+				{traceHash: testHash(4), pid: 5000001, startTime: 10},
+				{traceHash: testHash(4), pid: 5000002, startTime: 10},
+			},
+		},
+
+		// if traces are split by process, the same trace of two processes is
+		// reported separately for each process.
+		"different processes": {input: []arguments{
+			{trace: &host.Trace{Hash: host.TraceHash(4), PID: 5000001}, startTime: 10},
+			{trace: &host.Trace{Hash: host.TraceHash(4), PID: 5000002}, startTime: 10},
+			{trace: &host.Trace{Hash: host.TraceHash(4), PID: 5000001}, startTime: 10},
+		},
+			splitByProcess: true,
+			expectedTraces: []reportedTrace{
+				{traceHash: testTraceHash(4, 5000001, 10)},
+				{traceHash: testTraceHash(4, 5000002, 10)},
+			},
+			expectedCounts: []reportedCount{
+				{traceHash: testTraceHash(4, 5000001, 10), count: 1},
+				{traceHash: testTraceHash(4, 5000002, 10), count: 1},
+				{traceHash: testTraceHash(4, 5000001, 10), count: 1},
+			},
+			expectedProcesses: []reportedProcess{
+				{traceHash: testTraceHash(4, 5000001, 10), pid: 5000001, startTime: 10},
+				{traceHash: testTraceHash(4, 5000002, 10), pid: 5000002, startTime: 10},
+			},
+		},
+
+		// a process that reuses the PID of an exited process is told apart by
+		// its start time.
+		"reused pid": {input: []arguments{
+			{trace: &host.Trace{Hash: host.TraceHash(4), PID: 5000001}, startTime: 10},
+			{trace: &host.Trace{Hash: host.TraceHash(4), PID: 5000001}, startTime: 20},
+		},
+			splitByProcess: true,
+			expectedTraces: []reportedTrace{
+				{traceHash: testTraceHash(4, 5000001, 10)},
+				{traceHash: testTraceHash(4, 5000001, 20)},
+			},
+			expectedCounts: []reportedCount{
+				{traceHash: testTraceHash(4, 5000001, 10), count: 1},
+				{traceHash: testTraceHash(4, 5000001, 20), count: 1},
+			},
+			expectedProcesses: []reportedProcess{
+				{traceHash: testTraceHash(4, 5000001, 10), pid: 5000001, startTime: 10},
+				{traceHash: testTraceHash(4, 5000001, 20), pid: 5000001, startTime: 20},
+			},
+		},
+
+		// the comm of a trace is reported as thread name, if it differs from the
+		// name of the process. The thread name does not split the trace.
+		"thread names": {input: []arguments{
+			{trace: &host.Trace{Hash: host.TraceHash(4), PID: 5000001, Comm: "worker-1"},
+				processName: "app"},
+			{trace: &host.Trace{Hash: host.TraceHash(4), PID: 5000001, Comm: "worker-2"},
+				processName: "app"},
+			{trace: &host.Trace{Hash: host.TraceHash(4), PID: 5000001, Comm: "app"},
+				processName: "app"},
+		},
+			expectedTraces: []reportedTrace{{traceHash: testHash(4)}},
+			expectedCounts: []reportedCount{
+				{traceHash: testHash(4), count: 1, comm: "worker-1", threadName: "worker-1"},
+				{traceHash: testHash(4), count: 1, comm: "worker-2", threadName: "worker-2"},
+				{traceHash: testHash(4), count: 1, comm: "app"},
+			},
+			expectedProcesses: []reportedProcess{{traceHash: testHash(4), pid: 5000001}},
+		},
+
+		// without the name of the process, no thread name is reported.
+		"unknown process name": {input: []arguments{
+			{trace: &host.Trace{Hash: host.TraceHash(4), PID: 5000001, Comm: "worker-1"}},
 		},
-			expectedTraces: []reportedTrace{{traceHash: libpf.NewTraceHash(4, 4)}},
+			expectedTraces: []reportedTrace{{traceHash: testHash(4)}},
 			expectedCounts: []reportedCount{
-				{traceHash: libpf.NewTraceHash(4, 4), count: 1},
-				{traceHash: libpf.NewTraceHash(4, 4), count: 1},
+				{traceHash: testHash(4), count: 1, comm: "worker-1"},
 			},
+			expectedProcesses: []reportedProcess{{traceHash: testHash(4), pid: 5000001}},
 		},
 	}
 
@@ -121,8 +275,8 @@ func TestTraceHandler(t *testing.T) {
 		t.Run(name, func(t *testing.T) {
 			r := &mockReporter{t: t}
 
-			bpfTraceCache, err := freelru.New[host.TraceHash, libpf.TraceHash](
-				1024, func(k host.TraceHash) uint32 { return uint32(k) })
+			bpfTraceCache, err := freelru.New[bpfTraceKey, umTraceInfo](
+				1024, func(k bpfTraceKey) uint32 { return uint32(k.hash) })
 			require.Nil(t, err)
 			require.NotNil(t, t, bpfTraceCache)
 
@@ -131,15 +285,19 @@ func TestTraceHandler(t *testing.T) {
 			require.Nil(t, err)
 			require.NotNil(t, t, umTraceCache)
 
+			traceProcessor := &fakeTraceProcessor{}
 			tuh := &traceHandler{
-				traceProcessor: &fakeTraceProcessor{},
+				traceProcessor: traceProcessor,
 				bpfTraceCache:  bpfTraceCache,
 				umTraceCache:   umTraceCache,
 				reporter:       r,
+				splitByProcess: test.splitByProcess,
 				times:          defaultTimes(),
 			}
 
 			for _, input := range test.input {
+				traceProcessor.startTime = input.startTime
+				traceProcessor.name = input.processName
 				tuh.HandleTrace(input.trace)
 				time.Sleep(input.delay)
 			}
@@ -152,6 +310,8 @@ func TestTraceHandler(t *testing.T) {
 				t.Fatalf("Expected %d reported traces but got %d",
 					len(test.expectedTraces), len(r.reportedTraces))
 			}
+			// Expected and reported process order should match.
+			require.Equal(t, test.expectedProcesses, r.reportedProcesses, name)
 
 			for idx, trace := range test.expectedTraces {
 				// Expected and reported traces order should match.
@@ -89,6 +89,9 @@ type Tracer struct {
 	// kernelModules holds symbols/addresses for the kernel module address space
 	kernelModules *libpf.SymbolMap
 
+	// kernelTextBase is the address of the start of the kernel text.
+	kernelTextBase libpf.SymbolValue
+
 	// perfEntrypoints holds a list of frequency based perf events that are opened on the system.
 	perfEntrypoints xsync.RWMutex[[]*perf.Event]
 
@@ -160,7 +163,7 @@ func processKernelModulesMetadata(ctx context.Context,
 		if err == nil && len(buildID) >= 16 {
 			fileID = pfelf.CalculateKernelFileID(buildID)
 			result[nameStr] = fileID
-			rep.ExecutableMetadata(ctx, fileID, nameStr, buildID)
+			rep.ExecutableMetadata(ctx, fileID, nameStr, buildID, true)
 		} else {
 			log.Errorf("Failed to get GNU BuildID for kernel module %s: '%s' (%v)",
 				nameStr, buildID, err)
@@ -247,6 +250,15 @@ func NewTracer(ctx context.Context, rep reporter.SymbolReporter, intervals Inter
 	if err != nil {
 		return nil, fmt.Errorf("failed to read kernel modules: %v", err)
 	}
+	// Without the start of the kernel text, kernel addresses outside of modules
+	// are reported as absolute addresses.
+	var kernelTextBase libpf.SymbolValue
+	if stext, err := kernelSymbols.LookupSymbol("_stext"); err == nil {
+		kernelTextBase = stext.Address
+	} else {
+		log.Warnf("Unable to find kernel text section start, reporting absolute "+
+			"kernel addresses: %v", err)
+	}
 
 	transmittedFallbackSymbols, err :=
 		lru.New[libpf.FrameID, libpf.Void](fallbackSymbolsCacheSize, libpf.FrameID.Hash32)
@@ -265,6 +277,7 @@ func NewTracer(ctx context.Context, rep reporter.SymbolReporter, intervals Inter
 		processManager:             processManager,
 		kernelSymbols:              kernelSymbols,
 		kernelModules:              kernelModules,
+		kernelTextBase:             kernelTextBase,
 		transmittedFallbackSymbols: transmittedFallbackSymbols,
 		triggerPIDProcessing:       make(chan bool, 1),
 		pidEvents:                  make(chan libpf.PID, pidEventBufferSize),
@@ -628,14 +641,7 @@ func (t *Tracer) insertKernelFrames(trace *host.Trace, ustackLen uint32,
 
 	for i := uint32(0); i < kstackLen; i++ {
 		var fileID libpf.FileID
-		// Translate the kernel address into something that can be
-		// later symbolized. The address is made relative to
-		// matching module's ELF .text section:
-		//  - main image should have .text section at start of the code segment
-		//  - modules are ELF object files (.o) without program headers and
-		//    LOAD segments. the address is relative to the .text section
-		mod, addr, _ := t.kernelModules.LookupByAddress(
-			libpf.SymbolValue(kstackVal[i]))
+		mod, addr := t.kernelFrameAddress(libpf.SymbolValue(kstackVal[i]))
 		symbol, offs, foundSymbol := t.kernelSymbols.LookupByAddress(
 			libpf.SymbolValue(kstackVal[i]))
 
@@ -669,6 +675,24 @@ func (t *Tracer) insertKernelFrames(trace *host.Trace, ustackLen uint32,
 	return kstackLen, nil
 }
 
+// kernelFrameAddress translates the kernel address pc into something that can be
+// later symbolized. It returns the module of pc and the address relative to the
+// matching module's ELF .text section:
+//   - main image should have .text section at start of the code segment
+//   - modules are ELF object files (.o) without program headers and
+//     LOAD segments. the address is relative to the .text section
+//   - other addresses, like the ones of BPF programs, are made relative
+//     to the start of the kernel text, as they are randomized by KASLR.
+//     Addresses below it wrap around to a negative offset. If the start of
+//     the kernel text is unknown, the address is returned as is.
+func (t *Tracer) kernelFrameAddress(pc libpf.SymbolValue) (libpf.SymbolName, libpf.Address) {
+	mod, addr, foundModule := t.kernelModules.LookupByAddress(pc)
+	if !foundModule {
+		addr = libpf.Address(pc - t.kernelTextBase)
+	}
+	return mod, addr
+}
+
 // reportFallbackKernelSymbol reports fallback symbols for kernel frames, after checking if the
 // symbols were previously sent.
 func (t *Tracer) reportFallbackKernelSymbol(
@@ -1128,6 +1152,14 @@ func (t *Tracer) ConvertTrace(trace *host.Trace) *libpf.Trace {
 	return t.processManager.ConvertTrace(trace)
 }
 
+func (t *Tracer) ProcessStartTime(pid libpf.PID) libpf.UnixTime64 {
+	return t.processManager.ProcessStartTime(pid)
+}
+
+func (t *Tracer) ProcessName(pid libpf.PID) string {
+	return t.processManager.ProcessName(pid)
+}
+
 func (t *Tracer) SymbolizationComplete(traceCaptureKTime libpf.KTime) {
 	t.processManager.SymbolizationComplete(traceCaptureKTime)
 }
@@ -0,0 +1,80 @@
+/*
+ * Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+ * or more contributor license agreements. Licensed under the Apache License 2.0.
+ * See the file "LICENSE" for details.
+ */
+
+package tracer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/otel-profiling-agent/libpf"
+)
+
+func TestKernelFrameAddress(t *testing.T) {
+	const kernelTextBase = libpf.SymbolValue(0xffffffff9d000000)
+
+	kernelModules := &libpf.SymbolMap{}
+	kernelModules.Add(libpf.Symbol{
+		Name:    "vmlinux",
+		Address: kernelTextBase,
+		Size:    0x1000000,
+	})
+	kernelModules.Add(libpf.Symbol{
+		Name:    "nf_conntrack",
+		Address: 0xffffffffc0a1b000,
+		Size:    0x20000,
+	})
+	kernelModules.Finalize()
+
+	tests := map[string]struct {
+		pc             libpf.SymbolValue
+		kernelTextBase libpf.SymbolValue
+		wantModule     libpf.SymbolName
+		wantAddress    libpf.Address
+	}{
+		"kernel image": {
+			pc:             0xffffffff9d001234,
+			kernelTextBase: kernelTextBase,
+			wantModule:     "vmlinux",
+			wantAddress:    0x1234,
+		},
+		"kernel module": {
+			pc:             0xffffffffc0a1c234,
+			kernelTextBase: kernelTextBase,
+			wantModule:     "nf_conntrack",
+			wantAddress:    0x1234,
+		},
+		"above the kernel text": {
+			pc:             0xffffffffc0001234,
+			kernelTextBase: kernelTextBase,
+			wantModule:     libpf.SymbolNameUnknown,
+			wantAddress:    0x23001234,
+		},
+		"below the kernel text": {
+			pc:             0xffffffff9cffe000,
+			kernelTextBase: kernelTextBase,
+			wantModule:     libpf.SymbolNameUnknown,
+			wantAddress:    libpf.Address(^uint64(0x2000 - 1)),
+		},
+		"unknown kernel text": {
+			pc:          0xffffffffc0001234,
+			wantModule:  libpf.SymbolNameUnknown,
+			wantAddress: 0xffffffffc0001234,
+		},
+	}
+
+	for name, tc := range tests {
+		name := name
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			tr := &Tracer{kernelModules: kernelModules, kernelTextBase: tc.kernelTextBase}
+			mod, addr := tr.kernelFrameAddress(tc.pc)
+			assert.Equal(t, tc.wantModule, mod, name)
+			assert.Equal(t, tc.wantAddress, addr, name)
+		})
+	}
+}
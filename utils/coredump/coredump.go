@@ -90,10 +90,14 @@ func newSymbolizationCache() *symbolizationCache {
 }
 
 func (c *symbolizationCache) ExecutableMetadata(_ context.Context, fileID libpf.FileID,
-	fileName, _ string) {
+	fileName, _ string, _ bool) {
 	c.files[fileID] = fileName
 }
 
+func (c *symbolizationCache) MappingMetadata(libpf.FileID, uint64, uint64) {}
+
+func (c *symbolizationCache) ExpireExecutableMetadata(libpf.FileID) {}
+
 func (c *symbolizationCache) FrameMetadata(fileID libpf.FileID,
 	addressOrLine libpf.AddressOrLineno, lineNumber libpf.SourceLineno,
 	functionOffset uint32, functionName, filePath string) {
@@ -103,6 +107,12 @@ func (c *symbolizationCache) FrameMetadata(fileID libpf.FileID,
 	c.symbols[key] = data
 }
 
+func (c *symbolizationCache) ReportFrameMetadata(frameMetadata *libpf.FrameMetadata) {
+	c.FrameMetadata(frameMetadata.FileID, frameMetadata.AddressOrLine,
+		frameMetadata.LineNumber, frameMetadata.FunctionOffset,
+		frameMetadata.FunctionName, frameMetadata.Filename)
+}
+
 func (c *symbolizationCache) ReportFallbackSymbol(libpf.FrameID, string) {}
 
 func generateErrorMap() (map[libpf.AddressOrLineno]string, error) {